@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/Monstroxx/eduko-backend/internal/config"
 	"github.com/Monstroxx/eduko-backend/internal/database"
+	"github.com/Monstroxx/eduko-backend/internal/encryption"
+	"github.com/Monstroxx/eduko-backend/internal/events"
 	"github.com/Monstroxx/eduko-backend/internal/handlers"
+	"github.com/Monstroxx/eduko-backend/internal/jobs"
 	"github.com/Monstroxx/eduko-backend/internal/middleware"
+	"github.com/Monstroxx/eduko-backend/internal/notify"
+	"github.com/Monstroxx/eduko-backend/internal/scanner"
+	"github.com/Monstroxx/eduko-backend/internal/storage"
 	"github.com/labstack/echo/v4"
 	echomw "github.com/labstack/echo/v4/middleware"
 )
@@ -23,6 +31,36 @@ func main() {
 	}
 	defer db.Close()
 
+	if err := encryption.Configure(cfg); err != nil {
+		log.Fatalf("failed to load encryption keys: %v", err)
+	}
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("failed to set up file storage: %v", err)
+	}
+	scan := scanner.New(cfg)
+
+	// Real-time events, fanned out across replicas via LISTEN/NOTIFY
+	hub := events.NewHub(db)
+	go hub.Run(context.Background())
+
+	// Background jobs
+	if cfg.JobsEnabled {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		scheduler := jobs.NewScheduler(db)
+		scheduler.Every(cfg.ReminderInterval, jobs.NewExcuseReminders(db))
+		scheduler.Every(time.Minute, jobs.NewNotificationMailer(db, notify.New(cfg)))
+		scheduler.Every(15*time.Minute, jobs.NewSubstitutionNotices(db))
+		if scan.Enabled() {
+			scheduler.Every(5*time.Minute, jobs.NewAttachmentScan(db, store, scan))
+		}
+		scheduler.Every(24*time.Hour, jobs.NewRetention(db, store))
+		scheduler.Every(time.Minute, jobs.NewTimetableSolver(db))
+		scheduler.Start(ctx)
+	}
+
 	e := echo.New()
 	e.HideBanner = true
 
@@ -41,20 +79,40 @@ func main() {
 		return c.JSON(200, map[string]string{"status": "ok", "version": "0.1.0"})
 	})
 
+	// Calendar subscriptions and hallway displays (no JWT; authorized by the
+	// secret token)
+	e.GET("/ical/:file", handlers.ServeCalendarFeed(db))
+	e.GET("/display/:file", handlers.ServeDisplay(db))
+
 	// Public routes
 	api := e.Group("/api/v1")
 	api.POST("/auth/login", handlers.Login(db, cfg))
 	api.POST("/auth/register", handlers.Register(db, cfg))
 
+	// Signed download links (no JWT; authorized by the signature)
+	api.GET("/files/attachments/:attachmentId", handlers.DownloadSignedAttachment(db, cfg, store))
+
 	// Protected routes
 	protected := api.Group("")
 	protected.Use(middleware.JWT(cfg.JWTSecret))
 
+	// Real-time events (Server-Sent Events)
+	protected.GET("/events", handlers.StreamEvents(hub))
+
+	// Notifications
+	protected.GET("/notifications", handlers.ListNotifications(db))
+	protected.GET("/notifications/unread-count", handlers.GetUnreadNotificationCount(db))
+	protected.PATCH("/notifications/read-all", handlers.MarkAllNotificationsRead(db))
+	protected.PATCH("/notifications/:id/read", handlers.MarkNotificationRead(db))
+	protected.GET("/notifications/preferences", handlers.GetNotificationPreferences(db))
+	protected.PUT("/notifications/preferences", handlers.UpdateNotificationPreferences(db))
+
 	// School
 	protected.GET("/school", handlers.GetSchool(db))
 	protected.PUT("/school", handlers.UpdateSchool(db))
 	protected.GET("/school/settings", handlers.GetSchoolSettings(db))
 	protected.PUT("/school/settings", handlers.UpdateSchoolSettings(db))
+	protected.GET("/school/retention/preview", handlers.PreviewRetention(db))
 
 	// Classes
 	protected.GET("/classes", handlers.ListClasses(db))
@@ -71,27 +129,84 @@ func main() {
 	protected.GET("/students/:id/absences", handlers.GetStudentAbsences(db))
 	protected.POST("/students/import", handlers.ImportStudentsCSV(db))
 	protected.GET("/students/:id/excuses", handlers.GetStudentExcuses(db))
+	protected.GET("/students/:id/guardians", handlers.ListStudentGuardians(db))
+	protected.POST("/students/:id/guardians", handlers.AddStudentGuardian(db))
+	protected.DELETE("/students/:id/guardians/:userId", handlers.RemoveStudentGuardian(db))
 
 	// Teachers
 	protected.GET("/teachers", handlers.ListTeachers(db))
 	protected.GET("/teachers/:id", handlers.GetTeacher(db))
+	protected.GET("/teachers/:id/absences", handlers.ListTeacherAbsences(db))
+	protected.POST("/teachers/:id/absences", handlers.CreateTeacherAbsence(db))
+	protected.DELETE("/teachers/:id/absences/:absenceId", handlers.DeleteTeacherAbsence(db))
+
+	// Course groups
+	protected.GET("/course-groups", handlers.ListCourseGroups(db))
+	protected.POST("/course-groups", handlers.CreateCourseGroup(db))
+	protected.GET("/course-groups/:id", handlers.GetCourseGroup(db))
+	protected.PUT("/course-groups/:id", handlers.UpdateCourseGroup(db))
+	protected.DELETE("/course-groups/:id", handlers.DeleteCourseGroup(db))
+	protected.GET("/course-groups/:id/members", handlers.ListCourseGroupMembers(db))
+	protected.POST("/course-groups/:id/members", handlers.AddCourseGroupMembers(db))
+	protected.DELETE("/course-groups/:id/members/:studentId", handlers.RemoveCourseGroupMember(db))
 
 	// Timetable
+	protected.GET("/calendar", handlers.GetCalendar(db))
+	protected.POST("/calendar/school-years", handlers.CreateSchoolYear(db))
+	protected.DELETE("/calendar/school-years/:id", handlers.DeleteSchoolYear(db))
+	protected.POST("/calendar/holidays", handlers.CreateHoliday(db))
+	protected.DELETE("/calendar/holidays/:id", handlers.DeleteHoliday(db))
+	protected.GET("/calendar/feed", handlers.GetCalendarFeed(db))
+	protected.POST("/calendar/feed", handlers.CreateCalendarFeed(db))
+	protected.DELETE("/calendar/feed", handlers.DeleteCalendarFeed(db))
+	protected.GET("/timetable/epochs", handlers.ListEpochs(db))
+	protected.POST("/timetable/epochs", handlers.CreateEpoch(db))
+	protected.PUT("/timetable/epochs/:id", handlers.UpdateEpoch(db))
+	protected.DELETE("/timetable/epochs/:id", handlers.DeleteEpoch(db))
 	protected.GET("/timetable", handlers.GetTimetable(db))
+	protected.GET("/timetable/day", handlers.GetTimetableDay(db))
+	protected.GET("/timetable/week", handlers.GetTimetableWeek(db))
+	protected.GET("/timetable/conflicts", handlers.GetTimetableConflicts(db))
+	protected.POST("/timetable/import/untis", handlers.ImportUntis(db))
+	protected.POST("/timetable/import/asc", handlers.ImportASc(db))
+	protected.GET("/timetable/drafts", handlers.ListTimetableDrafts(db))
+	protected.POST("/timetable/drafts", handlers.CreateTimetableDraft(db))
+	protected.GET("/timetable/drafts/:id", handlers.GetTimetableDraft(db))
+	protected.DELETE("/timetable/drafts/:id", handlers.DeleteTimetableDraft(db))
+	protected.POST("/timetable/drafts/:id/entries", handlers.CreateTimetableDraftEntry(db))
+	protected.PUT("/timetable/drafts/:id/entries/:entryId", handlers.UpdateTimetableDraftEntry(db))
+	protected.DELETE("/timetable/drafts/:id/entries/:entryId", handlers.DeleteTimetableDraftEntry(db))
+	protected.GET("/timetable/drafts/:id/diff", handlers.GetTimetableDraftDiff(db))
+	protected.GET("/timetable/drafts/:id/conflicts", handlers.GetTimetableDraftConflicts(db))
+	protected.POST("/timetable/drafts/:id/publish", handlers.PublishTimetableDraft(db))
+	protected.GET("/timetable/solver/assignments", handlers.ListTeachingAssignments(db))
+	protected.PUT("/timetable/solver/assignments", handlers.ReplaceTeachingAssignments(db))
+	protected.GET("/timetable/solver/unavailability", handlers.ListTeacherUnavailability(db))
+	protected.PUT("/timetable/solver/unavailability", handlers.ReplaceTeacherUnavailability(db))
+	protected.GET("/timetable/solver/runs", handlers.ListSolverRuns(db))
+	protected.POST("/timetable/solver/runs", handlers.CreateSolverRun(db))
+	protected.GET("/timetable/solver/runs/:id", handlers.GetSolverRun(db))
 	protected.POST("/timetable", handlers.CreateTimetableEntry(db))
 	protected.PUT("/timetable/:id", handlers.UpdateTimetableEntry(db))
 	protected.DELETE("/timetable/:id", handlers.DeleteTimetableEntry(db))
 
 	// Substitutions
 	protected.GET("/substitutions", handlers.ListSubstitutions(db))
+	protected.GET("/substitutions/plan", handlers.GetSubstitutionPlan(db))
+	protected.GET("/substitutions/displays", handlers.ListDisplayFeeds(db))
+	protected.POST("/substitutions/displays", handlers.CreateDisplayFeed(db))
+	protected.DELETE("/substitutions/displays/:id", handlers.DeleteDisplayFeed(db))
 	protected.POST("/substitutions", handlers.CreateSubstitution(db))
 	protected.PUT("/substitutions/:id", handlers.UpdateSubstitution(db))
 	protected.DELETE("/substitutions/:id", handlers.DeleteSubstitution(db))
+	protected.GET("/substitutions/:id/candidates", handlers.ListSubstituteCandidates(db))
+	protected.POST("/substitutions/confirm", handlers.ConfirmSubstitutes(db))
 
 	// Attendance
 	protected.POST("/attendance", handlers.RecordAttendance(db))
 	protected.PUT("/attendance/:id", handlers.UpdateAttendance(db))
 	protected.GET("/attendance/class/:classId", handlers.GetClassAttendance(db))
+	protected.GET("/attendance/entry/:entryId/roster", handlers.GetLessonRoster(db))
 	protected.GET("/attendance/date/:date", handlers.GetAttendanceByDate(db))
 
 	// Excuses
@@ -100,10 +215,24 @@ func main() {
 	protected.GET("/excuses/:id", handlers.GetExcuse(db))
 	protected.PATCH("/excuses/:id/approve", handlers.ApproveExcuse(db))
 	protected.PATCH("/excuses/:id/reject", handlers.RejectExcuse(db))
-	protected.POST("/excuses/upload", handlers.UploadExcuseForm(db))
+	protected.POST("/excuses/bulk", handlers.BulkExcuses(db))
+	protected.POST("/excuses/upload", handlers.UploadExcuseForm(db, store, scan))
+	protected.GET("/excuses/:id/attachments", handlers.ListExcuseAttachments(db))
+	protected.POST("/excuses/:id/attachments", handlers.UploadExcuseForm(db, store, scan))
+	protected.GET("/excuses/:id/attachments/:attachmentId", handlers.DownloadExcuseAttachment(db, store))
+	protected.POST("/excuses/:id/attachments/:attachmentId/link", handlers.CreateAttachmentLink(db, cfg))
+	protected.DELETE("/excuses/:id/attachments/:attachmentId", handlers.DeleteExcuseAttachment(db, store))
 	protected.GET("/excuses/:id/pdf", handlers.GenerateExcusePDF(db))
 	protected.POST("/excuses/import", handlers.ImportExcusesCSV(db))
 
+	// Leave requests (Beurlaubung)
+	protected.POST("/leave-requests", handlers.CreateLeaveRequest(db))
+	protected.GET("/leave-requests", handlers.ListLeaveRequests(db))
+	protected.GET("/leave-requests/:id", handlers.GetLeaveRequest(db))
+	protected.PATCH("/leave-requests/:id/approve", handlers.ApproveLeaveRequest(db))
+	protected.PATCH("/leave-requests/:id/reject", handlers.RejectLeaveRequest(db))
+	protected.POST("/leave-requests/upload", handlers.UploadLeaveFile(db, store, scan))
+
 	// Lesson Content
 	protected.POST("/lessons", handlers.CreateLessonContent(db))
 	protected.PUT("/lessons/:id", handlers.UpdateLessonContent(db))
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/config"
+	"github.com/Monstroxx/eduko-backend/internal/ical"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+// importHolidays reads the holidays of a state from an ICS file (e.g. the
+// calendars published by the ministries of education) into a school's
+// calendar. Re-importing an updated file updates entries by their UID.
+func importHolidays(ctx context.Context, cfg *config.Config, db *pgxpool.Pool, args []string) error {
+	fs := flag.NewFlagSet("import-holidays", flag.ExitOnError)
+	school := fs.String("school", "", "school id")
+	file := fs.String("file", "", "ICS file with the holidays")
+	fs.Parse(args)
+
+	schoolID, err := uuid.Parse(*school)
+	if err != nil || *file == "" {
+		return errors.New("-school and -file are required")
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	events, err := ical.Parse(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *file, err)
+	}
+
+	inserted, updated, err := services.NewCalendarService(db).ImportHolidays(ctx, schoolID, events)
+	if err != nil {
+		return err
+	}
+	log.Printf("imported %d holiday(s): %d new, %d updated", len(events), inserted, updated)
+	return nil
+}
@@ -0,0 +1,73 @@
+// Command edukoctl runs maintenance tasks against an Eduko installation. It
+// reads the same environment variables as the server.
+//
+//	edukoctl migrate-files [-from ./uploads] [-dry-run] [-delete-source]
+//	edukoctl rotate-keys [-new-data-keys] [-batch 500]
+//	edukoctl import-holidays -school <id> -file ferien.ics
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/config"
+	"github.com/Monstroxx/eduko-backend/internal/database"
+	"github.com/Monstroxx/eduko-backend/internal/encryption"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, cfg *config.Config, db *pgxpool.Pool, args []string) error
+}
+
+var commands = []command{
+	{"migrate-files", "move legacy uploads and existing blobs into the configured storage backend", migrateFiles},
+	{"rotate-keys", "rewrap data keys with the current master key and re-encrypt data in batches", rotateKeys},
+	{"import-holidays", "import state holidays from an ICS file into a school's calendar", importHolidays},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: edukoctl <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", c.name, c.usage)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == os.Args[1] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		usage()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+	if err := encryption.Configure(cfg); err != nil {
+		log.Fatalf("failed to load encryption keys: %v", err)
+	}
+
+	if err := cmd.run(context.Background(), cfg, db, os.Args[2:]); err != nil {
+		log.Fatalf("%s: %v", cmd.name, err)
+	}
+}
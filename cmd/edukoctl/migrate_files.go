@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/config"
+	"github.com/Monstroxx/eduko-backend/internal/encryption"
+	"github.com/Monstroxx/eduko-backend/internal/scanner"
+	"github.com/Monstroxx/eduko-backend/internal/storage"
+)
+
+// migrateFiles moves files into the configured storage backend:
+//
+//   - legacy excuse uploads (excuses.file_path, named files in the upload
+//     directory) become content-addressed excuse_attachments,
+//   - legacy leave request uploads are re-stored under their content key,
+//     both encrypted with the school's data key when ENCRYPTION_KEY is set,
+//   - content-addressed blobs still on local disk are copied to the backend,
+//     e.g. when switching from STORAGE_BACKEND=local to s3.
+//
+// Each record is migrated on its own, so the command can be re-run after an
+// interruption.
+func migrateFiles(ctx context.Context, cfg *config.Config, db *pgxpool.Pool, args []string) error {
+	fs := flag.NewFlagSet("migrate-files", flag.ExitOnError)
+	from := fs.String("from", cfg.UploadDir, "directory holding the existing uploads")
+	dryRun := fs.Bool("dry-run", false, "only report what would be migrated")
+	deleteSource := fs.Bool("delete-source", false, "delete legacy files after they were migrated")
+	fs.Parse(args)
+
+	dst, err := storage.New(cfg)
+	if err != nil {
+		return err
+	}
+	// Imported files are quarantined until the scan job has checked them.
+	scanStatus := scanner.StatusSkipped
+	if scanner.New(cfg).Enabled() {
+		scanStatus = scanner.StatusPending
+	}
+	m := &fileMigration{db: db, keys: encryption.NewKeys(db), src: *from, dst: dst, dryRun: *dryRun,
+		deleteSource: *deleteSource, scanStatus: scanStatus}
+
+	if err := m.excuses(ctx); err != nil {
+		return err
+	}
+	if err := m.leaveRequests(ctx); err != nil {
+		return err
+	}
+	if (cfg.StorageBackend != "" && cfg.StorageBackend != "local") || filepath.Clean(*from) != filepath.Clean(cfg.UploadDir) {
+		if err := m.blobs(ctx); err != nil {
+			return err
+		}
+	}
+	log.Printf("migrated %d file(s), %d failed", m.migrated, m.failed)
+	if m.failed > 0 {
+		return fmt.Errorf("%d file(s) could not be migrated", m.failed)
+	}
+	return nil
+}
+
+type fileMigration struct {
+	db           *pgxpool.Pool
+	keys         *encryption.Keys
+	src          string
+	dst          storage.Store
+	dryRun       bool
+	deleteSource bool
+	scanStatus   scanner.Status
+
+	migrated, failed int
+}
+
+func (m *fileMigration) fail(format string, args ...interface{}) {
+	m.failed++
+	log.Printf("  FAILED "+format, args...)
+}
+
+func (m *fileMigration) readLegacy(name string) ([]byte, error) {
+	if name != filepath.Base(name) {
+		return nil, fmt.Errorf("unexpected path %q", name)
+	}
+	return os.ReadFile(filepath.Join(m.src, name))
+}
+
+func (m *fileMigration) removeLegacy(name string) {
+	if m.deleteSource {
+		if err := os.Remove(filepath.Join(m.src, name)); err != nil {
+			log.Printf("  could not delete %s: %v", name, err)
+		}
+	}
+}
+
+// put encrypts a legacy file for the school and stores it. The returned
+// digest and size describe the plaintext.
+func (m *fileMigration) put(ctx context.Context, schoolID uuid.UUID, data []byte, contentType string) (key, sum string, keyID *uuid.UUID, err error) {
+	digest := sha256.Sum256(data)
+	sealed, keyID, err := m.keys.EncryptBlob(ctx, schoolID, data)
+	if err != nil {
+		return "", "", nil, err
+	}
+	blob, err := storage.PutBytes(ctx, m.dst, sealed, contentType)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return blob.Key, hex.EncodeToString(digest[:]), keyID, nil
+}
+
+func contentTypeFor(name string) string {
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(name))); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func (m *fileMigration) excuses(ctx context.Context) error {
+	type legacy struct {
+		id, schoolID, userID uuid.UUID
+		path                 string
+	}
+	rows, err := m.db.Query(ctx,
+		`SELECT e.id, e.school_id, s.user_id, e.file_path
+		 FROM excuses e JOIN students s ON s.id = e.student_id
+		 WHERE e.file_path IS NOT NULL AND e.file_path <> ''`)
+	if err != nil {
+		return fmt.Errorf("list excuse files: %w", err)
+	}
+	var list []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.id, &l.schoolID, &l.userID, &l.path); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan excuse file: %w", err)
+		}
+		list = append(list, l)
+	}
+	rows.Close()
+	log.Printf("excuses: %d legacy file(s)", len(list))
+
+	for _, l := range list {
+		data, err := m.readLegacy(l.path)
+		if err != nil {
+			m.fail("excuse %s: %v", l.id, err)
+			continue
+		}
+		if m.dryRun {
+			log.Printf("  excuse %s: %s (%d bytes)", l.id, l.path, len(data))
+			continue
+		}
+		key, sum, keyID, err := m.put(ctx, l.schoolID, data, contentTypeFor(l.path))
+		if err != nil {
+			m.fail("excuse %s: %v", l.id, err)
+			continue
+		}
+
+		tx, err := m.db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			`INSERT INTO excuse_attachments (excuse_id, school_id, storage_key, sha256, file_name, content_type, size_bytes,
+			                                 uploaded_by, scan_status, data_key_id)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			 ON CONFLICT (excuse_id, sha256) DO NOTHING`,
+			l.id, l.schoolID, key, sum, l.path, contentTypeFor(l.path), len(data), l.userID,
+			m.scanStatus, keyID)
+		if err == nil {
+			_, err = tx.Exec(ctx, `UPDATE excuses SET file_path = NULL WHERE id = $1`, l.id)
+		}
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+		if err != nil {
+			tx.Rollback(ctx)
+			m.fail("excuse %s: %v", l.id, err)
+			continue
+		}
+		m.migrated++
+		m.removeLegacy(l.path)
+	}
+	return nil
+}
+
+func (m *fileMigration) leaveRequests(ctx context.Context) error {
+	type legacy struct {
+		id, schoolID uuid.UUID
+		path         string
+	}
+	rows, err := m.db.Query(ctx,
+		`SELECT id, school_id, file_path FROM leave_requests
+		 WHERE file_path IS NOT NULL AND file_path <> '' AND file_path NOT LIKE 'sha256/%'`)
+	if err != nil {
+		return fmt.Errorf("list leave files: %w", err)
+	}
+	var list []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.id, &l.schoolID, &l.path); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan leave file: %w", err)
+		}
+		list = append(list, l)
+	}
+	rows.Close()
+	log.Printf("leave requests: %d legacy file(s)", len(list))
+
+	for _, l := range list {
+		data, err := m.readLegacy(l.path)
+		if err != nil {
+			m.fail("leave request %s: %v", l.id, err)
+			continue
+		}
+		if m.dryRun {
+			log.Printf("  leave request %s: %s (%d bytes)", l.id, l.path, len(data))
+			continue
+		}
+		key, _, keyID, err := m.put(ctx, l.schoolID, data, contentTypeFor(l.path))
+		if err != nil {
+			m.fail("leave request %s: %v", l.id, err)
+			continue
+		}
+		if _, err := m.db.Exec(ctx,
+			`UPDATE leave_requests SET file_path = $1, file_data_key_id = $2 WHERE id = $3`,
+			key, keyID, l.id); err != nil {
+			m.fail("leave request %s: %v", l.id, err)
+			continue
+		}
+		m.migrated++
+		m.removeLegacy(l.path)
+	}
+	return nil
+}
+
+// blobs copies content-addressed blobs from the local source directory to the
+// destination backend.
+func (m *fileMigration) blobs(ctx context.Context) error {
+	rows, err := m.db.Query(ctx,
+		`SELECT storage_key, content_type FROM excuse_attachments
+		 UNION SELECT file_path, 'application/octet-stream' FROM leave_requests WHERE file_path LIKE 'sha256/%'`)
+	if err != nil {
+		return fmt.Errorf("list blobs: %w", err)
+	}
+	keys := map[string]string{}
+	for rows.Next() {
+		var key, contentType string
+		if err := rows.Scan(&key, &contentType); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan blob: %w", err)
+		}
+		keys[key] = contentType
+	}
+	rows.Close()
+	log.Printf("blobs: %d referenced", len(keys))
+
+	src := storage.NewLocal(m.src)
+	for key, contentType := range keys {
+		exists, err := m.dst.Exists(ctx, key)
+		if err != nil {
+			m.fail("blob %s: %v", key, err)
+			continue
+		}
+		if exists {
+			continue
+		}
+		r, err := src.Get(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			m.fail("blob %s: missing in %s", key, m.src)
+			continue
+		}
+		if err != nil {
+			m.fail("blob %s: %v", key, err)
+			continue
+		}
+		if m.dryRun {
+			r.Close()
+			log.Printf("  blob %s", key)
+			continue
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err == nil {
+			_, err = storage.PutBytes(ctx, m.dst, data, contentType)
+		}
+		if err != nil {
+			m.fail("blob %s: %v", key, err)
+			continue
+		}
+		m.migrated++
+		if m.deleteSource {
+			src.Delete(ctx, key)
+		}
+	}
+	return nil
+}
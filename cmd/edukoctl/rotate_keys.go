@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/config"
+	"github.com/Monstroxx/eduko-backend/internal/encryption"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+	"github.com/Monstroxx/eduko-backend/internal/storage"
+)
+
+// rotateKeys brings all encrypted data onto the current keys:
+//
+//   - with -new-data-keys every school's data key is retired and replaced,
+//   - data keys wrapped by a master key from ENCRYPTION_OLD_KEYS are rewrapped
+//     with ENCRYPTION_KEY, after which the old master key can be removed,
+//   - excuse reasons, excuse attachments and leave request files that are not
+//     encrypted with their school's active data key (including plaintext from
+//     before encryption was enabled) are re-encrypted, -batch records per
+//     transaction.
+//
+// Progress is committed per batch, so the command can be re-run after an
+// interruption.
+func rotateKeys(ctx context.Context, cfg *config.Config, db *pgxpool.Pool, args []string) error {
+	fs := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	newDataKeys := fs.Bool("new-data-keys", false, "retire every school's data key and create a new one")
+	batch := fs.Int("batch", 500, "records re-encrypted per transaction")
+	fs.Parse(args)
+
+	keys := encryption.NewKeys(db)
+	if !keys.Enabled() {
+		return encryption.ErrDisabled
+	}
+	store, err := storage.New(cfg)
+	if err != nil {
+		return err
+	}
+	r := &keyRotation{db: db, keys: keys, store: store, batch: *batch}
+
+	if err := r.schoolKeys(ctx, *newDataKeys); err != nil {
+		return err
+	}
+	n, err := keys.Rewrap(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("rewrapped %d data key(s) with master key %q", n, encryption.Default().ActiveID())
+
+	if err := r.reasons(ctx); err != nil {
+		return err
+	}
+	if err := r.attachments(ctx); err != nil {
+		return err
+	}
+	if err := r.leaveFiles(ctx); err != nil {
+		return err
+	}
+	log.Printf("re-encrypted %d record(s), %d failed", r.done, r.failed)
+	if r.failed > 0 {
+		return fmt.Errorf("%d record(s) could not be re-encrypted", r.failed)
+	}
+	return nil
+}
+
+type keyRotation struct {
+	db    *pgxpool.Pool
+	keys  *encryption.Keys
+	store storage.Store
+	batch int
+
+	done, failed int
+}
+
+func (r *keyRotation) fail(format string, args ...interface{}) {
+	r.failed++
+	log.Printf("  FAILED "+format, args...)
+}
+
+// schoolKeys makes sure every school has an active data key, replacing the
+// existing ones when rotate is set.
+func (r *keyRotation) schoolKeys(ctx context.Context, rotate bool) error {
+	rows, err := r.db.Query(ctx, `SELECT id FROM schools ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("list schools: %w", err)
+	}
+	var schools []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan school: %w", err)
+		}
+		schools = append(schools, id)
+	}
+	rows.Close()
+
+	for _, id := range schools {
+		if rotate {
+			dk, err := r.keys.Rotate(ctx, id)
+			if err != nil {
+				return fmt.Errorf("school %s: %w", id, err)
+			}
+			log.Printf("school %s: new data key %s", id, dk.ID)
+		} else if _, err := r.keys.Active(ctx, id); err != nil {
+			return fmt.Errorf("school %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (r *keyRotation) reasons(ctx context.Context) error {
+	type row struct {
+		id, schoolID uuid.UUID
+		reason       string
+	}
+	after := uuid.Nil
+	for {
+		rows, err := r.db.Query(ctx,
+			`SELECT e.id, e.school_id, e.reason FROM excuses e
+			 JOIN school_data_keys k ON k.school_id = e.school_id AND k.active
+			 WHERE e.id > $1 AND e.reason IS NOT NULL AND e.reason <> ''
+			   AND e.reason NOT LIKE 'enc:v1:' || k.id::text || ':%'
+			 ORDER BY e.id LIMIT $2`, after, r.batch)
+		if err != nil {
+			return fmt.Errorf("list excuse reasons: %w", err)
+		}
+		var list []row
+		for rows.Next() {
+			var x row
+			if err := rows.Scan(&x.id, &x.schoolID, &x.reason); err != nil {
+				rows.Close()
+				return fmt.Errorf("scan excuse reason: %w", err)
+			}
+			list = append(list, x)
+		}
+		rows.Close()
+		if len(list) == 0 {
+			return nil
+		}
+
+		tx, err := r.db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		done := 0
+		for _, x := range list {
+			plain, err := r.keys.DecryptString(ctx, x.reason)
+			if err != nil {
+				r.fail("excuse %s: %v", x.id, err)
+				continue
+			}
+			sealed, err := r.keys.EncryptString(ctx, x.schoolID, plain)
+			if err != nil {
+				tx.Rollback(ctx)
+				return err
+			}
+			// The reason compare skips rows changed since they were read.
+			if _, err := tx.Exec(ctx,
+				`UPDATE excuses SET reason = $2 WHERE id = $1 AND reason = $3`, x.id, sealed, x.reason); err != nil {
+				tx.Rollback(ctx)
+				return fmt.Errorf("update excuse reason: %w", err)
+			}
+			done++
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+		r.done += done
+		after = list[len(list)-1].id
+		log.Printf("excuse reasons: %d re-encrypted (up to %s)", done, after)
+	}
+}
+
+// reencrypt loads a blob, decrypts it if necessary and stores it encrypted
+// with the school's active data key.
+func (r *keyRotation) reencrypt(ctx context.Context, key string, schoolID uuid.UUID, contentType string) (string, *uuid.UUID, error) {
+	rc, err := r.store.Get(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return "", nil, err
+	}
+	plain, err := r.keys.DecryptBlob(ctx, data)
+	if err != nil {
+		return "", nil, err
+	}
+	sealed, keyID, err := r.keys.EncryptBlob(ctx, schoolID, plain)
+	if err != nil {
+		return "", nil, err
+	}
+	blob, err := storage.PutBytes(ctx, r.store, sealed, contentType)
+	if err != nil {
+		return "", nil, err
+	}
+	return blob.Key, keyID, nil
+}
+
+// dropUnreferenced deletes blobs no row points at anymore.
+func (r *keyRotation) dropUnreferenced(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		referenced, err := services.BlobReferenced(ctx, r.db, key)
+		if err != nil || referenced {
+			continue
+		}
+		if err := r.store.Delete(ctx, key); err != nil {
+			log.Printf("  could not delete blob %s: %v", key, err)
+		}
+	}
+}
+
+// attachments re-encrypts excuse attachments per (blob, school), since a
+// plaintext blob may be shared by several schools.
+func (r *keyRotation) attachments(ctx context.Context) error {
+	type row struct {
+		key         string
+		schoolID    uuid.UUID
+		contentType string
+	}
+	afterKey, afterSchool := "", uuid.Nil
+	for {
+		rows, err := r.db.Query(ctx,
+			`SELECT a.storage_key, a.school_id, MIN(a.content_type) FROM excuse_attachments a
+			 JOIN school_data_keys k ON k.school_id = a.school_id AND k.active
+			 WHERE (a.storage_key, a.school_id) > ($1, $2) AND a.data_key_id IS DISTINCT FROM k.id
+			 GROUP BY a.storage_key, a.school_id
+			 ORDER BY a.storage_key, a.school_id LIMIT $3`, afterKey, afterSchool, r.batch)
+		if err != nil {
+			return fmt.Errorf("list attachments: %w", err)
+		}
+		var list []row
+		for rows.Next() {
+			var x row
+			if err := rows.Scan(&x.key, &x.schoolID, &x.contentType); err != nil {
+				rows.Close()
+				return fmt.Errorf("scan attachment: %w", err)
+			}
+			list = append(list, x)
+		}
+		rows.Close()
+		if len(list) == 0 {
+			return nil
+		}
+
+		tx, err := r.db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		var replaced []string
+		for _, x := range list {
+			newKey, keyID, err := r.reencrypt(ctx, x.key, x.schoolID, x.contentType)
+			if err != nil {
+				r.fail("blob %s (school %s): %v", x.key, x.schoolID, err)
+				continue
+			}
+			if _, err := tx.Exec(ctx,
+				`UPDATE excuse_attachments SET storage_key = $3, data_key_id = $4
+				 WHERE storage_key = $1 AND school_id = $2`,
+				x.key, x.schoolID, newKey, keyID); err != nil {
+				tx.Rollback(ctx)
+				return fmt.Errorf("update attachment: %w", err)
+			}
+			if newKey != x.key {
+				replaced = append(replaced, x.key)
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+		r.dropUnreferenced(ctx, replaced)
+		r.done += len(replaced)
+		last := list[len(list)-1]
+		afterKey, afterSchool = last.key, last.schoolID
+		log.Printf("attachments: %d blob(s) re-encrypted", len(replaced))
+	}
+}
+
+func (r *keyRotation) leaveFiles(ctx context.Context) error {
+	type row struct {
+		id, schoolID uuid.UUID
+		key          string
+	}
+	after := uuid.Nil
+	for {
+		rows, err := r.db.Query(ctx,
+			`SELECT l.id, l.school_id, l.file_path FROM leave_requests l
+			 JOIN school_data_keys k ON k.school_id = l.school_id AND k.active
+			 WHERE l.id > $1 AND l.file_path LIKE 'sha256/%' AND l.file_data_key_id IS DISTINCT FROM k.id
+			 ORDER BY l.id LIMIT $2`, after, r.batch)
+		if err != nil {
+			return fmt.Errorf("list leave files: %w", err)
+		}
+		var list []row
+		for rows.Next() {
+			var x row
+			if err := rows.Scan(&x.id, &x.schoolID, &x.key); err != nil {
+				rows.Close()
+				return fmt.Errorf("scan leave file: %w", err)
+			}
+			list = append(list, x)
+		}
+		rows.Close()
+		if len(list) == 0 {
+			return nil
+		}
+
+		tx, err := r.db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		var replaced []string
+		for _, x := range list {
+			newKey, keyID, err := r.reencrypt(ctx, x.key, x.schoolID, "application/octet-stream")
+			if err != nil {
+				r.fail("leave request %s: %v", x.id, err)
+				continue
+			}
+			if _, err := tx.Exec(ctx,
+				`UPDATE leave_requests SET file_path = $2, file_data_key_id = $3 WHERE id = $1`,
+				x.id, newKey, keyID); err != nil {
+				tx.Rollback(ctx)
+				return fmt.Errorf("update leave file: %w", err)
+			}
+			if newKey != x.key {
+				replaced = append(replaced, x.key)
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+		r.dropUnreferenced(ctx, replaced)
+		r.done += len(replaced)
+		after = list[len(list)-1].id
+		log.Printf("leave files: %d re-encrypted", len(replaced))
+	}
+}
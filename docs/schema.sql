@@ -5,14 +5,21 @@
 -- ENUMS (all up front)
 -- ============================================================
 
-CREATE TYPE user_role AS ENUM ('student', 'teacher', 'admin');
+CREATE TYPE user_role AS ENUM ('student', 'teacher', 'admin', 'guardian');
 CREATE TYPE week_type AS ENUM ('all', 'A', 'B');
 CREATE TYPE substitution_type AS ENUM ('substitution', 'cancellation', 'room_change', 'extra_lesson');
-CREATE TYPE attendance_status AS ENUM ('present', 'absent', 'late', 'excused_leave');
+CREATE TYPE attendance_status AS ENUM ('present', 'absent', 'late', 'excused_leave', 'unexcused');
 CREATE TYPE excuse_status AS ENUM ('pending', 'approved', 'rejected');
 CREATE TYPE excuse_submission AS ENUM ('digital', 'paper');
+CREATE TYPE scan_status AS ENUM ('pending', 'clean', 'infected', 'skipped');
+CREATE TYPE leave_status AS ENUM ('pending', 'approved', 'rejected');
+CREATE TYPE leave_approval_level AS ENUM ('class_teacher', 'head');
 CREATE TYPE appointment_type AS ENUM ('exam', 'test', 'event', 'other');
 CREATE TYPE appointment_scope AS ENUM ('school', 'class', 'subject');
+CREATE TYPE calendar_day_kind AS ENUM ('holiday', 'non_teaching_day');
+CREATE TYPE draft_status AS ENUM ('draft', 'published');
+CREATE TYPE solver_status AS ENUM ('queued', 'running', 'done', 'failed');
+CREATE TYPE notification_category AS ENUM ('substitution', 'excuse', 'exam', 'excuse_reminder');
 
 -- ============================================================
 -- SCHOOL & CONFIG
@@ -37,6 +44,21 @@ CREATE TABLE school_settings (
     UNIQUE(school_id, key)
 );
 
+-- Per-school data keys for at-rest encryption of excuse reasons and uploaded
+-- files. wrapped_key is encrypted with the master key master_key_id from the
+-- configuration (ENCRYPTION_KEY); retired keys stay until no record uses them.
+CREATE TABLE school_data_keys (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    master_key_id   VARCHAR(64) NOT NULL,
+    wrapped_key     BYTEA NOT NULL,
+    active          BOOLEAN NOT NULL DEFAULT true,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    retired_at      TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_school_data_keys_active ON school_data_keys(school_id) WHERE active;
+
 -- ============================================================
 -- USERS
 -- ============================================================
@@ -136,33 +158,204 @@ CREATE TABLE students (
     updated_at      TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
+-- Guardians (parents) are users with role 'guardian' linked to their children.
+CREATE TABLE student_guardians (
+    student_id      UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    user_id         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (student_id, user_id)
+);
+
+-- ============================================================
+-- COURSE GROUPS
+-- ============================================================
+
+-- Groups of students taught together apart from their class: religion/ethics
+-- splits, language groups, electives and upper-school courses that mix
+-- several classes. class_id is the home class for split groups (NULL for
+-- courses across classes), subject_id the subject taught.
+CREATE TABLE course_groups (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    name            VARCHAR(100) NOT NULL,           -- e.g. "10a Ethik", "Q1 Ma-LK1"
+    class_id        UUID REFERENCES classes(id) ON DELETE CASCADE,
+    subject_id      UUID REFERENCES subjects(id),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(school_id, name)
+);
+
+CREATE TABLE course_group_members (
+    group_id        UUID NOT NULL REFERENCES course_groups(id) ON DELETE CASCADE,
+    student_id      UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (group_id, student_id)
+);
+
+CREATE INDEX idx_course_group_members_student ON course_group_members(student_id);
+
 -- ============================================================
 -- TIMETABLE
 -- ============================================================
 
+-- Phases in which epoch subjects are taught in concentrated form. Entries
+-- with an epoch only take place between its dates; the same slot in
+-- different epochs for different classes rotates the subject between them.
+CREATE TABLE epochs (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    name            VARCHAR(100) NOT NULL,           -- e.g. "Epoche 1"
+    start_date      DATE NOT NULL,
+    end_date        DATE NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (end_date >= start_date)
+);
+
+CREATE INDEX idx_epochs_school ON epochs(school_id, start_date);
+
 CREATE TABLE timetable_entries (
     id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
-    class_id        UUID NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+    class_id        UUID REFERENCES classes(id) ON DELETE CASCADE,
+    group_id        UUID REFERENCES course_groups(id) ON DELETE CASCADE,
     subject_id      UUID NOT NULL REFERENCES subjects(id),
     teacher_id      UUID NOT NULL REFERENCES teachers(id),
     room_id         UUID REFERENCES rooms(id),
-    time_slot_id    UUID NOT NULL REFERENCES time_slots(id),
+    time_slot_id    UUID NOT NULL REFERENCES time_slots(id),  -- first slot
+    slot_count      INT NOT NULL DEFAULT 1 CHECK (slot_count >= 1),  -- 2 = double period
+    epoch_id        UUID REFERENCES epochs(id),
     day_of_week     INT NOT NULL CHECK (day_of_week BETWEEN 1 AND 7),
     week_type       week_type NOT NULL DEFAULT 'all',
     valid_from      DATE NOT NULL,
     valid_until     DATE,
     created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
-    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- With a group only its members attend, otherwise the whole class.
+    CHECK (class_id IS NOT NULL OR group_id IS NOT NULL),
+    CHECK (valid_until IS NULL OR valid_until >= valid_from)
 );
 
 CREATE INDEX idx_timetable_class ON timetable_entries(class_id, day_of_week);
+CREATE INDEX idx_timetable_group ON timetable_entries(group_id);
+CREATE INDEX idx_timetable_epoch ON timetable_entries(epoch_id);
 CREATE INDEX idx_timetable_teacher ON timetable_entries(teacher_id, day_of_week);
 
+-- Drafts of the timetable: copies of the plan admins edit without students
+-- seeing them, published atomically effective on a date. Published drafts
+-- stay as the history of the plan.
+CREATE TABLE timetable_drafts (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    name            VARCHAR(100) NOT NULL,           -- e.g. "2. Halbjahr 2026/27"
+    status          draft_status NOT NULL DEFAULT 'draft',
+    effective_from  DATE NOT NULL,
+    created_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    published_by    UUID REFERENCES users(id) ON DELETE SET NULL,
+    published_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_timetable_drafts_school ON timetable_drafts(school_id, created_at);
+
+-- Same columns as timetable_entries. source_entry_id is the published entry
+-- the draft entry was copied from (NULL for new lessons), source_updated_at
+-- its updated_at then; publishing checks the published entry is unchanged.
+CREATE TABLE timetable_draft_entries (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    draft_id        UUID NOT NULL REFERENCES timetable_drafts(id) ON DELETE CASCADE,
+    source_entry_id UUID REFERENCES timetable_entries(id) ON DELETE SET NULL,
+    source_updated_at TIMESTAMPTZ,
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    class_id        UUID REFERENCES classes(id) ON DELETE CASCADE,
+    group_id        UUID REFERENCES course_groups(id) ON DELETE CASCADE,
+    subject_id      UUID NOT NULL REFERENCES subjects(id),
+    teacher_id      UUID NOT NULL REFERENCES teachers(id),
+    room_id         UUID REFERENCES rooms(id),
+    time_slot_id    UUID NOT NULL REFERENCES time_slots(id),
+    slot_count      INT NOT NULL DEFAULT 1 CHECK (slot_count >= 1),
+    epoch_id        UUID REFERENCES epochs(id),
+    day_of_week     INT NOT NULL CHECK (day_of_week BETWEEN 1 AND 7),
+    week_type       week_type NOT NULL DEFAULT 'all',
+    valid_from      DATE NOT NULL,
+    valid_until     DATE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (class_id IS NOT NULL OR group_id IS NOT NULL),
+    CHECK (valid_until IS NULL OR valid_until >= valid_from)
+);
+
+CREATE INDEX idx_timetable_draft_entries ON timetable_draft_entries(draft_id);
+
+-- Input of the timetable solver: which teacher teaches which subject to a
+-- class for how many periods a week, double_periods of them as double
+-- periods. room_ids are the rooms the lessons may use (empty: no room).
+CREATE TABLE teaching_assignments (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    class_id        UUID NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+    subject_id      UUID NOT NULL REFERENCES subjects(id) ON DELETE CASCADE,
+    teacher_id      UUID NOT NULL REFERENCES teachers(id) ON DELETE CASCADE,
+    periods_per_week INT NOT NULL CHECK (periods_per_week >= 1),
+    double_periods  INT NOT NULL DEFAULT 0 CHECK (double_periods >= 0),
+    room_ids        UUID[] NOT NULL DEFAULT '{}',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(class_id, subject_id, teacher_id)
+);
+
+-- Times a teacher cannot teach; time_slot_id NULL blocks the whole day.
+CREATE TABLE teacher_unavailability (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    teacher_id      UUID NOT NULL REFERENCES teachers(id) ON DELETE CASCADE,
+    day_of_week     INT NOT NULL CHECK (day_of_week BETWEEN 1 AND 7),
+    time_slot_id    UUID REFERENCES time_slots(id) ON DELETE CASCADE,
+    note            VARCHAR(255),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_teacher_unavailability ON teacher_unavailability(school_id, teacher_id);
+
+-- Runs of the timetable solver, executed by the timetable_solver job. The
+-- generated plan is stored as a draft (draft_id); result holds the summary.
+CREATE TABLE timetable_solver_runs (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    name            VARCHAR(100) NOT NULL,
+    effective_from  DATE NOT NULL,
+    status          solver_status NOT NULL DEFAULT 'queued',
+    progress        INT NOT NULL DEFAULT 0,          -- percent
+    draft_id        UUID REFERENCES timetable_drafts(id) ON DELETE SET NULL,
+    result          JSONB,
+    error           TEXT,
+    created_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at      TIMESTAMPTZ,
+    finished_at     TIMESTAMPTZ
+);
+
+CREATE INDEX idx_timetable_solver_runs ON timetable_solver_runs(school_id, created_at);
+CREATE INDEX idx_timetable_solver_queue ON timetable_solver_runs(created_at) WHERE status = 'queued';
+
 -- ============================================================
 -- SUBSTITUTIONS
 -- ============================================================
 
+-- A teacher gives no lessons from date_from to date_to (inclusive). Each of
+-- their lessons in that range gets a substitution; while it has no
+-- substitute_teacher_id it is still open.
+CREATE TABLE teacher_absences (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    teacher_id      UUID NOT NULL REFERENCES teachers(id) ON DELETE CASCADE,
+    date_from       DATE NOT NULL,
+    date_to         DATE NOT NULL,
+    note            TEXT,
+    created_by      UUID NOT NULL REFERENCES users(id),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (date_to >= date_from)
+);
+
+CREATE INDEX idx_teacher_absences ON teacher_absences(school_id, teacher_id, date_from);
+
 CREATE TABLE substitutions (
     id                  UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     school_id           UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
@@ -172,13 +365,58 @@ CREATE TABLE substitutions (
     substitute_teacher_id UUID REFERENCES teachers(id),
     substitute_room_id  UUID REFERENCES rooms(id),
     substitute_subject_id UUID REFERENCES subjects(id),
+    teacher_absence_id  UUID REFERENCES teacher_absences(id) ON DELETE CASCADE,
+    -- A substitution an absence took over: its state before, restored when
+    -- the absence is deleted (replaced_type is NULL otherwise).
+    replaced_type       substitution_type,
+    replaced_teacher_id UUID REFERENCES teachers(id),
+    replaced_absence_id UUID REFERENCES teacher_absences(id) ON DELETE SET NULL,
     note                TEXT,
+    -- When students and guardians were notified; cleared when it changes.
+    notified_at         TIMESTAMPTZ,
     created_by          UUID NOT NULL REFERENCES users(id),
     created_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
     updated_at          TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
 CREATE INDEX idx_substitutions_date ON substitutions(school_id, date);
+-- One substitution per lesson and date.
+CREATE UNIQUE INDEX idx_substitutions_lesson ON substitutions(timetable_entry_id, date);
+CREATE INDEX idx_substitutions_absence ON substitutions(teacher_absence_id);
+
+-- ============================================================
+-- SCHOOL CALENDAR
+-- ============================================================
+
+-- Once a school has school years, dates outside all of them have no lessons.
+CREATE TABLE school_years (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id   UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    name        VARCHAR(50) NOT NULL,            -- e.g. "2025/26"
+    start_date  DATE NOT NULL,
+    end_date    DATE NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(school_id, name),
+    CHECK (end_date >= start_date)
+);
+
+-- No lessons take place from date_from to date_to (inclusive): holiday ranges
+-- and single non-teaching days (e.g. staff training). uid is the UID of
+-- entries imported from an ICS file, so re-imports update them.
+CREATE TABLE holidays (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id   UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    name        VARCHAR(255) NOT NULL,
+    kind        calendar_day_kind NOT NULL DEFAULT 'holiday',
+    date_from   DATE NOT NULL,
+    date_to     DATE NOT NULL,
+    uid         VARCHAR(255),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(school_id, uid),
+    CHECK (date_to >= date_from)
+);
+
+CREATE INDEX idx_holidays_school ON holidays(school_id, date_from);
 
 -- ============================================================
 -- ATTENDANCE
@@ -213,9 +451,10 @@ CREATE TABLE excuses (
     date_to         DATE NOT NULL,
     submission_type excuse_submission NOT NULL,
     status          excuse_status NOT NULL DEFAULT 'pending',
-    reason          TEXT,
+    reason          TEXT,          -- "enc:v1:<data key>:..." when encrypted
     attestation_provided BOOLEAN NOT NULL DEFAULT false,
-    file_path       VARCHAR(500),
+    file_path       VARCHAR(500),  -- legacy single upload, see excuse_attachments
+    paper_received_at TIMESTAMPTZ,
     submitted_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
     approved_by     UUID REFERENCES users(id),
     approved_at     TIMESTAMPTZ,
@@ -232,6 +471,80 @@ CREATE TABLE excuse_attendance (
 
 CREATE INDEX idx_excuses_student ON excuses(student_id, status);
 
+-- Files attached to an excuse. storage_key is content-addressed
+-- (sha256/ab/cd/<digest>); several rows may share one blob.
+CREATE TABLE excuse_attachments (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    excuse_id       UUID NOT NULL REFERENCES excuses(id) ON DELETE CASCADE,
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    storage_key     VARCHAR(200) NOT NULL,
+    sha256          CHAR(64) NOT NULL,
+    file_name       VARCHAR(255) NOT NULL,
+    content_type    VARCHAR(100) NOT NULL,
+    size_bytes      BIGINT NOT NULL,
+    uploaded_by     UUID NOT NULL REFERENCES users(id),
+    -- Files stay quarantined (not downloadable) until scanned clean.
+    scan_status     scan_status NOT NULL DEFAULT 'pending',
+    scan_signature  VARCHAR(255),
+    scanned_at      TIMESTAMPTZ,
+    -- data key the blob is encrypted with; NULL for plaintext blobs.
+    -- sha256 and size_bytes always describe the plaintext.
+    data_key_id     UUID REFERENCES school_data_keys(id),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(excuse_id, sha256)
+);
+
+CREATE INDEX idx_excuse_attachments_key ON excuse_attachments(storage_key);
+CREATE INDEX idx_excuse_attachments_pending ON excuse_attachments(created_at) WHERE scan_status = 'pending';
+
+-- One row per reminder sent for a student's absence day, so the reminder job
+-- never sends the same "N days left" notice twice.
+CREATE TABLE excuse_reminders (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    student_id      UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    absence_date    DATE NOT NULL,
+    days_before     INT NOT NULL,
+    sent_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(student_id, absence_date, days_before)
+);
+
+-- ============================================================
+-- LEAVE REQUESTS (Beurlaubung — approved before the absence)
+-- ============================================================
+
+CREATE TABLE leave_requests (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    student_id      UUID NOT NULL REFERENCES students(id),
+    date_from       DATE NOT NULL,
+    date_to         DATE NOT NULL,
+    -- optional lesson range: slot_from applies to date_from, slot_to to date_to
+    slot_from       INT,
+    slot_to         INT,
+    reason          TEXT NOT NULL,
+    file_path       VARCHAR(500),  -- storage key of the uploaded proof
+    file_data_key_id UUID REFERENCES school_data_keys(id),
+    status          leave_status NOT NULL DEFAULT 'pending',
+    approval_level  leave_approval_level NOT NULL,
+    submitted_by    UUID NOT NULL REFERENCES users(id),
+    decided_by      UUID REFERENCES users(id),
+    decided_at      TIMESTAMPTZ,
+    decision_note   TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (date_to >= date_from)
+);
+
+CREATE TABLE leave_attendance (
+    id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    leave_request_id UUID NOT NULL REFERENCES leave_requests(id) ON DELETE CASCADE,
+    attendance_id    UUID NOT NULL REFERENCES attendance(id) ON DELETE CASCADE,
+    UNIQUE(leave_request_id, attendance_id)
+);
+
+CREATE INDEX idx_leave_requests_student ON leave_requests(student_id, status);
+
 -- ============================================================
 -- LESSON CONTENT
 -- ============================================================
@@ -264,6 +577,7 @@ CREATE TABLE appointments (
     type            appointment_type NOT NULL,
     scope           appointment_scope NOT NULL,
     class_id        UUID REFERENCES classes(id),
+    group_id        UUID REFERENCES course_groups(id) ON DELETE CASCADE,  -- subject scope: only this course
     subject_id      UUID REFERENCES subjects(id),
     date            DATE NOT NULL,
     time_slot_id    UUID REFERENCES time_slots(id),
@@ -275,10 +589,75 @@ CREATE TABLE appointments (
 CREATE INDEX idx_appointments_date ON appointments(school_id, date);
 CREATE INDEX idx_appointments_class ON appointments(class_id, date);
 
+-- ============================================================
+-- CALENDAR FEEDS
+-- ============================================================
+
+-- Secret ICS subscription URL per user (/ical/<token>.ics). Only the SHA-256
+-- of the token is stored; regenerating replaces it, which revokes the old URL.
+CREATE TABLE calendar_feeds (
+    user_id         UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    token_hash      BYTEA NOT NULL UNIQUE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at    TIMESTAMPTZ
+);
+
+-- Secret URLs for the substitution plan on hallway monitors, shown without
+-- login. Only the hash of the token is stored.
+CREATE TABLE display_feeds (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    name            VARCHAR(100) NOT NULL,
+    token_hash      BYTEA NOT NULL UNIQUE,
+    days_ahead      INT NOT NULL DEFAULT 1 CHECK (days_ahead BETWEEN 0 AND 14),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at    TIMESTAMPTZ
+);
+
+-- ============================================================
+-- NOTIFICATIONS
+-- ============================================================
+
+-- In-app notifications. The text is rendered in the reader's language from
+-- type and params (locales/*.json, "notifications.<type>"). email_pending is
+-- set when the user wants the category by e-mail; the mailer job clears it
+-- once sent, after too many failed attempts, or when the user has no e-mail
+-- address any more. email_retry_at backs off failed sends.
+CREATE TABLE notifications (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    user_id         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category        notification_category NOT NULL,
+    type            VARCHAR(50) NOT NULL,            -- e.g. "excuse_approved"
+    params          JSONB NOT NULL DEFAULT '{}',
+    email_pending   BOOLEAN NOT NULL DEFAULT false,
+    email_attempts  INT NOT NULL DEFAULT 0,
+    email_retry_at  TIMESTAMPTZ,
+    email_error     TEXT,                            -- last failed send
+    read_at         TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_notifications_user ON notifications(user_id, created_at DESC);
+CREATE INDEX idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
+CREATE INDEX idx_notifications_email ON notifications(created_at) WHERE email_pending;
+
+-- Which categories also go out by e-mail or push. Without a row the
+-- defaults apply (see NotificationService).
+CREATE TABLE notification_preferences (
+    user_id         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category        notification_category NOT NULL,
+    email           BOOLEAN NOT NULL,
+    push            BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, category)
+);
+
 -- ============================================================
 -- AUDIT LOG
 -- ============================================================
 
+-- Background jobs log a summary with user_id NULL (e.g. action 'retention_purge').
 CREATE TABLE audit_log (
     id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     school_id       UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
@@ -304,11 +683,16 @@ VALUES ('00000000-0000-0000-0000-000000000001', 'Eduko Testschule', 'Musterstra
 
 INSERT INTO school_settings (school_id, key, value) VALUES
 ('00000000-0000-0000-0000-000000000001', 'excuse_deadline_days', '14'),
+('00000000-0000-0000-0000-000000000001', 'excuse_reminder_days', '[7, 3, 1]'),
 ('00000000-0000-0000-0000-000000000001', 'excuse_granularity', '"day"'),
 ('00000000-0000-0000-0000-000000000001', 'attestation_required_days', '14'),
 ('00000000-0000-0000-0000-000000000001', 'attestation_required_exam', 'true'),
 ('00000000-0000-0000-0000-000000000001', 'approval_role', '"class_teacher"'),
-('00000000-0000-0000-0000-000000000001', 'max_exams_per_week', '3');
+('00000000-0000-0000-0000-000000000001', 'leave_head_approval_days', '3'),
+('00000000-0000-0000-0000-000000000001', 'max_exams_per_week', '3'),
+('00000000-0000-0000-0000-000000000001', 'school_year_end', '"07-31"'),
+('00000000-0000-0000-0000-000000000001', 'ab_week_reference', '"2025-09-01"'),
+('00000000-0000-0000-0000-000000000001', 'retention', '{"excuses": {"years": 1, "action": "delete"}, "attachments": {"years": 1, "action": "delete"}, "attendance": {"years": 1, "action": "delete"}, "leave_requests": {"years": 1, "action": "delete"}}');
 
 -- Admin user (password: admin123)
 INSERT INTO users (id, school_id, username, password_hash, role, first_name, last_name, email)
@@ -367,3 +751,8 @@ INSERT INTO timetable_entries (school_id, class_id, subject_id, teacher_id, room
 ('00000000-0000-0000-0000-000000000001', '00000000-0000-0000-0000-000000000100', '00000000-0000-0000-0000-000000000200', '00000000-0000-0000-0000-000000000021', '00000000-0000-0000-0000-000000000300', '00000000-0000-0000-0000-000000000401', 1, '2025-09-01'),
 ('00000000-0000-0000-0000-000000000001', '00000000-0000-0000-0000-000000000100', '00000000-0000-0000-0000-000000000201', '00000000-0000-0000-0000-000000000021', '00000000-0000-0000-0000-000000000301', '00000000-0000-0000-0000-000000000402', 1, '2025-09-01'),
 ('00000000-0000-0000-0000-000000000001', '00000000-0000-0000-0000-000000000100', '00000000-0000-0000-0000-000000000202', '00000000-0000-0000-0000-000000000021', '00000000-0000-0000-0000-000000000301', '00000000-0000-0000-0000-000000000403', 1, '2025-09-01');
+
+-- Berlin school holidays 2025/26
+INSERT INTO holidays (school_id, name, date_from, date_to) VALUES
+('00000000-0000-0000-0000-000000000001', 'Herbstferien', '2025-10-20', '2025-11-01'),
+('00000000-0000-0000-0000-000000000001', 'Weihnachtsferien', '2025-12-22', '2026-01-02');
@@ -0,0 +1,360 @@
+// Package asc reads the XML export of aSc Timetables (File → Export →
+// aSc Timetables XML) and resolves its cards into weekly lessons.
+package asc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+type period struct {
+	Period    string `xml:"period,attr"`
+	Name      string `xml:"name,attr"`
+	StartTime string `xml:"starttime,attr"`
+	EndTime   string `xml:"endtime,attr"`
+}
+
+type named struct {
+	ID        string `xml:"id,attr"`
+	Name      string `xml:"name,attr"`
+	Short     string `xml:"short,attr"`
+	FirstName string `xml:"firstname,attr"`
+	LastName  string `xml:"lastname,attr"`
+}
+
+type group struct {
+	ID          string `xml:"id,attr"`
+	ClassID     string `xml:"classid,attr"`
+	Name        string `xml:"name,attr"`
+	EntireClass string `xml:"entireclass,attr"`
+}
+
+type weeksDef struct {
+	ID    string `xml:"id,attr"`
+	Weeks string `xml:"weeks,attr"`
+}
+
+type lesson struct {
+	ID             string `xml:"id,attr"`
+	ClassIDs       string `xml:"classids,attr"`
+	SubjectID      string `xml:"subjectid,attr"`
+	TeacherIDs     string `xml:"teacherids,attr"`
+	GroupIDs       string `xml:"groupids,attr"`
+	PeriodsPerCard string `xml:"periodspercard,attr"`
+	WeeksDefID     string `xml:"weeksdefid,attr"`
+}
+
+type card struct {
+	LessonID     string `xml:"lessonid,attr"`
+	ClassroomIDs string `xml:"classroomids,attr"`
+	Period       string `xml:"period,attr"`
+	Weeks        string `xml:"weeks,attr"`
+	Terms        string `xml:"terms,attr"`
+	Days         string `xml:"days,attr"`
+}
+
+type document struct {
+	Periods    []period   `xml:"periods>period"`
+	WeeksDefs  []weeksDef `xml:"weeksdefs>weeksdef"`
+	Subjects   []named    `xml:"subjects>subject"`
+	Teachers   []named    `xml:"teachers>teacher"`
+	Classrooms []named    `xml:"classrooms>classroom"`
+	Classes    []named    `xml:"classes>class"`
+	Groups     []group    `xml:"groups>group"`
+	Lessons    []lesson   `xml:"lessons>lesson"`
+	Cards      []card     `xml:"cards>card"`
+}
+
+type Period struct {
+	Number int
+	Start  string
+	End    string
+	Label  string
+}
+
+type Teacher struct {
+	Short     string
+	FirstName string
+	LastName  string
+}
+
+type Subject struct {
+	Short string
+	Name  string
+}
+
+// Lesson is a card resolved to one class: Count periods from Period on Day
+// (1 = Monday). Group is the class's part group ("Gruppe 1"), empty for the
+// entire class. Weeks is "A", "B" or "" for every week.
+type Lesson struct {
+	LessonID string
+	Class    string
+	Group    string
+	Teacher  string
+	Subject  string
+	Room     string
+	Day      int
+	Period   int
+	Count    int
+	Weeks    string
+}
+
+// Timetable is the content of an export. Issues lists what could not be
+// mapped.
+type Timetable struct {
+	Periods  []Period
+	Teachers []Teacher
+	Subjects []Subject
+	Rooms    []string
+	Classes  []string
+	Lessons  []Lesson
+	Issues   []string
+}
+
+func (t *Timetable) issue(format string, args ...interface{}) {
+	t.Issues = append(t.Issues, fmt.Sprintf(format, args...))
+}
+
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	enc, err := ianaindex.IANA.Encoding(label)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unsupported encoding %q", label)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+func ids(list string) []string {
+	var out []string
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func shortOr(n named) string {
+	if n.Short != "" {
+		return n.Short
+	}
+	return n.Name
+}
+
+// weekType maps the week pattern of a card ("1", "11", "10", "01") to an
+// A/B week. ok is false for longer cycles.
+func weekType(weeks string) (string, bool) {
+	switch {
+	case weeks == "" || strings.Trim(weeks, "1") == "":
+		return "", true
+	case weeks == "10":
+		return "A", true
+	case weeks == "01":
+		return "B", true
+	}
+	return "", false
+}
+
+// clock normalizes "8:00" to "08:00".
+func clock(v string) (string, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(v), ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return "", fmt.Errorf("invalid time %q", v)
+	}
+	return fmt.Sprintf("%02d:%02d", hour, minute), nil
+}
+
+// Parse reads an aSc Timetables XML export.
+func Parse(r io.Reader) (*Timetable, error) {
+	var doc document
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = charsetReader
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid aSc XML: %w", err)
+	}
+
+	t := &Timetable{}
+	for _, p := range doc.Periods {
+		n, err := strconv.Atoi(p.Period)
+		if err != nil {
+			t.issue("period %q: invalid number", p.Period)
+			continue
+		}
+		start, err := clock(p.StartTime)
+		if err == nil {
+			var end string
+			if end, err = clock(p.EndTime); err == nil {
+				t.Periods = append(t.Periods, Period{Number: n, Start: start, End: end, Label: p.Name})
+				continue
+			}
+		}
+		t.issue("period %d: %v", n, err)
+	}
+
+	teachers := map[string]string{}
+	for _, x := range doc.Teachers {
+		short := shortOr(x)
+		teachers[x.ID] = short
+		last := x.LastName
+		if last == "" {
+			last = x.Name
+		}
+		t.Teachers = append(t.Teachers, Teacher{Short: short, FirstName: x.FirstName, LastName: last})
+	}
+	subjects := map[string]string{}
+	for _, x := range doc.Subjects {
+		short := shortOr(x)
+		subjects[x.ID] = short
+		name := x.Name
+		if name == "" {
+			name = short
+		}
+		t.Subjects = append(t.Subjects, Subject{Short: short, Name: name})
+	}
+	rooms := map[string]string{}
+	for _, x := range doc.Classrooms {
+		rooms[x.ID] = shortOr(x)
+		t.Rooms = append(t.Rooms, shortOr(x))
+	}
+	classes := map[string]string{}
+	for _, x := range doc.Classes {
+		classes[x.ID] = x.Name
+		t.Classes = append(t.Classes, x.Name)
+	}
+	groups := map[string]group{}
+	for _, g := range doc.Groups {
+		groups[g.ID] = g
+	}
+	weeksDefs := map[string]string{}
+	for _, w := range doc.WeeksDefs {
+		weeksDefs[w.ID] = w.Weeks
+	}
+	lessons := map[string]lesson{}
+	for _, l := range doc.Lessons {
+		lessons[l.ID] = l
+	}
+
+	type key struct {
+		lessonID, class, group, room, weeks string
+		day                                 int
+	}
+	periodsOf := map[key][]int{}
+	var order []key
+	reported := map[string]bool{}
+	report := func(lessonID, format string, args ...interface{}) {
+		msg := fmt.Sprintf("lesson %s: ", lessonID) + fmt.Sprintf(format, args...)
+		if !reported[msg] {
+			reported[msg] = true
+			t.Issues = append(t.Issues, msg)
+		}
+	}
+
+	for _, c := range doc.Cards {
+		l, ok := lessons[c.LessonID]
+		if !ok {
+			t.issue("card for unknown lesson %s", c.LessonID)
+			continue
+		}
+		day := strings.IndexByte(c.Days, '1') + 1
+		if day < 1 || day > 7 || strings.Count(c.Days, "1") != 1 {
+			report(l.ID, "card with days %q skipped", c.Days)
+			continue
+		}
+		p, err := strconv.Atoi(c.Period)
+		if err != nil {
+			report(l.ID, "card with period %q skipped", c.Period)
+			continue
+		}
+		weeks := c.Weeks
+		if weeks == "" {
+			weeks = weeksDefs[l.WeeksDefID]
+		}
+		wt, ok := weekType(weeks)
+		if !ok {
+			report(l.ID, "week cycle %q is not an A/B cycle, card skipped", weeks)
+			continue
+		}
+		if c.Terms != "" && strings.Trim(c.Terms, "1") != "" {
+			report(l.ID, "term-limited card imported for the whole school year")
+		}
+
+		if _, ok := subjects[l.SubjectID]; !ok {
+			report(l.ID, "no subject, skipped")
+			continue
+		}
+		teacherIDs := ids(l.TeacherIDs)
+		if len(teacherIDs) == 0 {
+			report(l.ID, "no teacher, skipped")
+			continue
+		}
+		if len(teacherIDs) > 1 {
+			report(l.ID, "%d teachers, only %s imported", len(teacherIDs), teachers[teacherIDs[0]])
+		}
+		var room string
+		if roomIDs := ids(c.ClassroomIDs); len(roomIDs) > 0 {
+			room = rooms[roomIDs[0]]
+			if len(roomIDs) > 1 {
+				report(l.ID, "%d rooms, only %s imported", len(roomIDs), room)
+			}
+		}
+
+		for _, classID := range ids(l.ClassIDs) {
+			class, ok := classes[classID]
+			if !ok {
+				report(l.ID, "unknown class %s", classID)
+				continue
+			}
+			var groupName string
+			for _, gid := range ids(l.GroupIDs) {
+				if g, ok := groups[gid]; ok && g.ClassID == classID && g.EntireClass != "1" {
+					groupName = class + " " + g.Name
+				}
+			}
+			k := key{lessonID: l.ID, class: class, group: groupName, room: room, weeks: wt, day: day}
+			if _, seen := periodsOf[k]; !seen {
+				order = append(order, k)
+			}
+			periodsOf[k] = append(periodsOf[k], p)
+		}
+	}
+
+	// Cards of a lesson in consecutive periods form a block. A single card
+	// of a lesson with several periods per card covers all of them.
+	for _, k := range order {
+		periods := periodsOf[k]
+		sort.Ints(periods)
+		l := lessons[k.lessonID]
+		perCard, _ := strconv.Atoi(l.PeriodsPerCard)
+		add := func(start, count int) {
+			if count == 1 && perCard > 1 {
+				count = perCard
+			}
+			t.Lessons = append(t.Lessons, Lesson{
+				LessonID: k.lessonID, Class: k.class, Group: k.group,
+				Teacher: teachers[ids(l.TeacherIDs)[0]], Subject: subjects[l.SubjectID],
+				Room: k.room, Day: k.day, Period: start, Count: count, Weeks: k.weeks,
+			})
+		}
+		start, count := periods[0], 1
+		for _, p := range periods[1:] {
+			switch {
+			case p == start+count:
+				count++
+			case p < start+count:
+				// duplicate card
+			default:
+				add(start, count)
+				start, count = p, 1
+			}
+		}
+		add(start, count)
+	}
+	return t, nil
+}
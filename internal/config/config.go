@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -12,6 +13,40 @@ type Config struct {
 	JWTSecret   string
 	CORSOrigins []string
 	UploadDir   string
+
+	// File storage: "local" keeps files in UploadDir, "s3" uses an
+	// S3-compatible bucket (AWS, MinIO).
+	StorageBackend string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3UseSSL       bool
+
+	// Lifetime of signed attachment download URLs.
+	SignedURLTTL time.Duration
+
+	// ClamAV daemon for upload scanning (Unix socket path or host:port).
+	// Uploads are not scanned when empty.
+	ClamdAddress string
+
+	// Master key for at-rest encryption of excuse reasons and attachments,
+	// "<id>:<base64 32 bytes>". Retired master keys stay listed in
+	// EncryptionOldKeys until edukoctl rotate-keys has rewrapped all data keys.
+	EncryptionKey     string
+	EncryptionOldKeys []string
+
+	// Outgoing mail. Notifications are only logged when SMTPHost is empty.
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// Background jobs. Disable on replicas that should only serve HTTP.
+	JobsEnabled      bool
+	ReminderInterval time.Duration
 }
 
 func Load() (*Config, error) {
@@ -23,12 +58,44 @@ func Load() (*Config, error) {
 
 	corsOrigins := strings.Split(getEnv("CORS_ORIGINS", "*"), ",")
 
+	reminderInterval, err := time.ParseDuration(getEnv("REMINDER_INTERVAL", "1h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid REMINDER_INTERVAL: %w", err)
+	}
+
+	signedURLTTL, err := time.ParseDuration(getEnv("SIGNED_URL_TTL", "5m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIGNED_URL_TTL: %w", err)
+	}
+
 	return &Config{
 		Port:        getEnv("PORT", "8080"),
 		DatabaseURL: dbURL,
 		JWTSecret:   jwtSecret,
 		CORSOrigins: corsOrigins,
 		UploadDir:   getEnv("UPLOAD_DIR", "./uploads"),
+
+		StorageBackend: getEnv("STORAGE_BACKEND", "local"),
+		S3Endpoint:     getEnv("S3_ENDPOINT", ""),
+		S3Region:       getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:       getEnv("S3_BUCKET", "eduko"),
+		S3AccessKey:    getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:    getEnv("S3_SECRET_KEY", ""),
+		S3UseSSL:       getEnv("S3_USE_SSL", "true") == "true",
+		SignedURLTTL:   signedURLTTL,
+		ClamdAddress:   getEnv("CLAMD_ADDRESS", ""),
+
+		EncryptionKey:     getEnv("ENCRYPTION_KEY", ""),
+		EncryptionOldKeys: splitList(getEnv("ENCRYPTION_OLD_KEYS", "")),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUser:     getEnv("SMTP_USER", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "eduko@localhost"),
+
+		JobsEnabled:      getEnv("JOBS_ENABLED", "true") == "true",
+		ReminderInterval: reminderInterval,
 	}, nil
 }
 
@@ -38,3 +105,13 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,120 @@
+// Package display renders the substitution plan as a self-refreshing HTML
+// page for hallway monitors.
+package display
+
+import (
+	"html/template"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Monstroxx/eduko-backend/internal/i18n"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+var page = template.Must(template.New("display").Funcs(template.FuncMap{
+	"deref": func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	},
+	"period": func(e services.DisplayEntry) string {
+		if e.TimeSlotLabel != nil {
+			return *e.TimeSlotLabel
+		}
+		if e.TimeSlotStart != nil && len(*e.TimeSlotStart) >= 5 {
+			return (*e.TimeSlotStart)[:5]
+		}
+		return ""
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} – {{.Display.School}}</title>
+<style>
+body { font-family: sans-serif; margin: 1.5rem; background: #fff; color: #111; }
+header { display: flex; justify-content: space-between; align-items: baseline; }
+h1 { margin: 0; }
+h2 { margin: 2rem 0 .5rem; border-bottom: 2px solid #333; }
+table { width: 100%; border-collapse: collapse; font-size: 1.3rem; }
+th, td { text-align: left; padding: .3rem .6rem; border-bottom: 1px solid #ccc; }
+th { background: #eee; }
+.cancellation td { color: #b00; }
+.old { text-decoration: line-through; color: #777; }
+.none { color: #777; font-size: 1.3rem; }
+</style>
+</head>
+<body>
+<header><h1>{{.Title}} – {{.Display.School}}</h1><span>{{.T.updated}} {{.Updated}}</span></header>
+{{range .Days}}
+<h2>{{.Weekday}}, {{.Date}}</h2>
+{{if .Classes}}
+<table>
+<tr><th>{{$.T.class}}</th><th>{{$.T.period}}</th><th>{{$.T.subject}}</th><th>{{$.T.teacher}}</th><th>{{$.T.room}}</th><th></th></tr>
+{{range .Classes}}{{$class := .Class}}{{range .Entries}}
+<tr class="{{.Type}}">
+<td>{{$class}}{{with .GroupName}} ({{.}}){{end}}</td>
+<td>{{period .}}</td>
+<td>{{deref .Subject}}{{if and .OriginalSubject (ne (deref .OriginalSubject) (deref .Subject))}} <span class="old">{{deref .OriginalSubject}}</span>{{end}}</td>
+<td>{{if .Open}}{{$.T.open}}{{else}}{{deref .Teacher}}{{end}}</td>
+<td>{{deref .Room}}{{if and .OriginalRoom (ne (deref .OriginalRoom) (deref .Room))}} <span class="old">{{deref .OriginalRoom}}</span>{{end}}</td>
+<td>{{index $.Types (printf "%s" .Type)}}</td>
+</tr>
+{{end}}{{end}}
+</table>
+{{else}}
+<p class="none">{{$.T.none}}</p>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+type day struct {
+	services.DisplayDay
+	Weekday string
+	Date    string
+}
+
+// Write renders d. The page reloads itself every refresh seconds.
+func Write(w io.Writer, d *services.Display, tr i18n.Translator, refresh int) error {
+	data := struct {
+		Lang    string
+		Title   string
+		Refresh int
+		Updated string
+		Display *services.Display
+		Days    []day
+		T       map[string]string
+		Types   map[string]string
+	}{
+		Lang:    tr.Locale,
+		Title:   tr.T("substitutions.title"),
+		Refresh: refresh,
+		Display: d,
+		T:       map[string]string{},
+		Types:   map[string]string{},
+	}
+	data.Updated = d.UpdatedAt.Format(tr.DateFormat() + " 15:04")
+	for _, key := range []string{"class", "period", "subject", "teacher", "room"} {
+		data.T[key] = tr.T("timetable." + key)
+	}
+	for _, key := range []string{"updated", "open", "none"} {
+		data.T[key] = tr.T("substitutions." + key)
+	}
+	for _, key := range []string{"substitution", "cancellation", "room_change", "extra_lesson"} {
+		data.Types[key] = tr.T("substitutions." + key)
+	}
+	for _, dd := range d.Days {
+		date := dd.Date
+		if t, err := time.Parse("2006-01-02", dd.Date); err == nil {
+			date = t.Format(tr.DateFormat())
+		}
+		data.Days = append(data.Days, day{DisplayDay: dd, Weekday: tr.T("weekdays." + strconv.Itoa(dd.DayOfWeek)), Date: date})
+	}
+	return page.Execute(w, data)
+}
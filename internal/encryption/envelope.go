@@ -0,0 +1,161 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Encrypted strings look like "enc:v1:<data key id>:<base64(nonce|ciphertext)>".
+const stringPrefix = "enc:v1:"
+
+// Encrypted blobs start with blobMagic, the data key ID and the nonce.
+var blobMagic = []byte("EDK\x01")
+
+const (
+	nonceSize      = 12
+	blobHeaderSize = 4 + 16 + nonceSize
+)
+
+// DataKey is an unwrapped per-school data key.
+type DataKey struct {
+	ID       uuid.UUID
+	SchoolID uuid.UUID
+	key      []byte
+}
+
+// NewDataKey wraps raw key material; use GenerateDataKey for new keys.
+func NewDataKey(id, schoolID uuid.UUID, key []byte) (*DataKey, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("data key: need %d bytes, got %d", keySize, len(key))
+	}
+	return &DataKey{ID: id, SchoolID: schoolID, key: key}, nil
+}
+
+// GenerateDataKey creates a random data key for a school.
+func GenerateDataKey(schoolID uuid.UUID) (*DataKey, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate data key: %w", err)
+	}
+	return &DataKey{ID: uuid.New(), SchoolID: schoolID, key: key}, nil
+}
+
+// EncryptString encrypts s with a random nonce.
+func (k *DataKey) EncryptString(s string) (string, error) {
+	aead, err := newAEAD(k.key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(s), k.ID[:])
+	return stringPrefix + k.ID.String() + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString reverses EncryptString.
+func (k *DataKey) DecryptString(s string) (string, error) {
+	id, payload, ok := parseString(s)
+	if !ok {
+		return "", ErrCorrupt
+	}
+	if id != k.ID {
+		return "", fmt.Errorf("%w %s", ErrUnknownDataKey, id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < nonceSize {
+		return "", ErrCorrupt
+	}
+	aead, err := newAEAD(k.key)
+	if err != nil {
+		return "", err
+	}
+	plain, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], k.ID[:])
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(plain), nil
+}
+
+// EncryptBlob encrypts file content. The nonce is derived from the content,
+// so identical files encrypted with the same key yield identical blobs and
+// content-addressed storage still de-duplicates them.
+func (k *DataKey) EncryptBlob(data []byte) ([]byte, error) {
+	aead, err := newAEAD(k.key)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, k.key)
+	mac.Write(data)
+	nonce := mac.Sum(nil)[:nonceSize]
+
+	out := make([]byte, 0, blobHeaderSize+len(data)+aead.Overhead())
+	out = append(out, blobMagic...)
+	out = append(out, k.ID[:]...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, out[:blobHeaderSize]), nil
+}
+
+// DecryptBlob reverses EncryptBlob.
+func (k *DataKey) DecryptBlob(data []byte) ([]byte, error) {
+	id, ok := BlobKeyID(data)
+	if !ok {
+		return nil, ErrCorrupt
+	}
+	if id != k.ID {
+		return nil, fmt.Errorf("%w %s", ErrUnknownDataKey, id)
+	}
+	aead, err := newAEAD(k.key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, data[4+16:blobHeaderSize], data[blobHeaderSize:], data[:blobHeaderSize])
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return plain, nil
+}
+
+func parseString(s string) (id uuid.UUID, payload string, ok bool) {
+	rest, found := strings.CutPrefix(s, stringPrefix)
+	if !found {
+		return uuid.Nil, "", false
+	}
+	idStr, payload, found := strings.Cut(rest, ":")
+	if !found {
+		return uuid.Nil, "", false
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return uuid.Nil, "", false
+	}
+	return id, payload, true
+}
+
+// StringKeyID returns the data key an encrypted string was sealed with;
+// ok is false for plaintext.
+func StringKeyID(s string) (uuid.UUID, bool) {
+	id, _, ok := parseString(s)
+	return id, ok
+}
+
+// BlobKeyID returns the data key a blob was sealed with; ok is false for
+// plaintext files.
+func BlobKeyID(data []byte) (uuid.UUID, bool) {
+	if len(data) < blobHeaderSize || !bytes.Equal(data[:4], blobMagic) {
+		return uuid.Nil, false
+	}
+	id, err := uuid.FromBytes(data[4 : 4+16])
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return id, true
+}
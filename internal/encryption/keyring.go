@@ -0,0 +1,166 @@
+// Package encryption implements application-level envelope encryption for
+// sensitive data at rest (excuse reasons and attachment files, which are
+// health data under DSGVO Art. 9).
+//
+// Each school has a data key that encrypts its records. Data keys are stored
+// in school_data_keys, wrapped (encrypted) by a master key that only lives in
+// the configuration. Rotating the master key therefore only rewraps the data
+// keys; rotating a data key re-encrypts the records (edukoctl rotate-keys).
+//
+// Without ENCRYPTION_KEY, new data is stored in plaintext. Plaintext written
+// before encryption was enabled stays readable either way.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/Monstroxx/eduko-backend/internal/config"
+)
+
+const keySize = 32 // AES-256
+
+var (
+	ErrDisabled         = errors.New("encryption: no master key configured")
+	ErrUnknownMasterKey = errors.New("encryption: unknown master key")
+	ErrUnknownDataKey   = errors.New("encryption: unknown data key")
+	ErrCorrupt          = errors.New("encryption: ciphertext corrupt or tampered")
+)
+
+// Keyring holds the master keys: the active one wraps new data keys, retired
+// ones are kept so data keys wrapped by them can still be unwrapped.
+type Keyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+// ParseKeyring builds a keyring from "<id>:<base64 32 bytes>" specs. An empty
+// active spec yields a disabled keyring.
+func ParseKeyring(active string, retired []string) (*Keyring, error) {
+	r := &Keyring{keys: map[string][]byte{}}
+	if strings.TrimSpace(active) == "" {
+		return r, nil
+	}
+	for i, spec := range append([]string{active}, retired...) {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(spec, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("master key %q: expected <id>:<base64 key>", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("master key %q: %w", id, err)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("master key %q: need %d bytes, got %d", id, keySize, len(key))
+		}
+		if _, dup := r.keys[id]; dup {
+			return nil, fmt.Errorf("master key %q configured twice", id)
+		}
+		r.keys[id] = key
+		if i == 0 {
+			r.active = id
+		}
+	}
+	return r, nil
+}
+
+// Enabled reports whether a master key is configured.
+func (r *Keyring) Enabled() bool { return r != nil && r.active != "" }
+
+// ActiveID returns the ID of the master key used for wrapping.
+func (r *Keyring) ActiveID() string {
+	if r == nil {
+		return ""
+	}
+	return r.active
+}
+
+// Wrap encrypts a data key with the active master key. The school ID is bound
+// as additional data so a wrapped key cannot be moved to another school.
+func (r *Keyring) Wrap(schoolID uuid.UUID, key []byte) (masterID string, wrapped []byte, err error) {
+	if !r.Enabled() {
+		return "", nil, ErrDisabled
+	}
+	aead, err := newAEAD(r.keys[r.active])
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return r.active, aead.Seal(nonce, nonce, key, schoolID[:]), nil
+}
+
+// Unwrap decrypts a data key wrapped by the given master key.
+func (r *Keyring) Unwrap(schoolID uuid.UUID, masterID string, wrapped []byte) ([]byte, error) {
+	if r == nil {
+		return nil, ErrDisabled
+	}
+	master, ok := r.keys[masterID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownMasterKey, masterID)
+	}
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	key, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], schoolID[:])
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("init cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+var (
+	defaultMu   sync.RWMutex
+	defaultRing = &Keyring{keys: map[string][]byte{}}
+)
+
+// Configure loads the master keys from ENCRYPTION_KEY/ENCRYPTION_OLD_KEYS and
+// makes them the process-wide keyring used by NewKeys.
+func Configure(cfg *config.Config) error {
+	ring, err := ParseKeyring(cfg.EncryptionKey, cfg.EncryptionOldKeys)
+	if err != nil {
+		return err
+	}
+	SetDefault(ring)
+	return nil
+}
+
+// SetDefault replaces the process-wide keyring.
+func SetDefault(r *Keyring) {
+	defaultMu.Lock()
+	defaultRing = r
+	defaultMu.Unlock()
+}
+
+// Default returns the process-wide keyring.
+func Default() *Keyring {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultRing
+}
@@ -0,0 +1,260 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// activeTTL bounds how long an instance keeps encrypting with a school's data
+// key after edukoctl rotate-keys replaced it.
+const activeTTL = 5 * time.Minute
+
+// Keys loads, creates and caches per-school data keys from school_data_keys.
+type Keys struct {
+	db   *pgxpool.Pool
+	ring *Keyring
+
+	mu     sync.Mutex
+	byID   map[uuid.UUID]*DataKey
+	active map[uuid.UUID]activeKey
+}
+
+type activeKey struct {
+	id      uuid.UUID
+	fetched time.Time
+}
+
+// NewKeys uses the process-wide keyring set by Configure.
+func NewKeys(db *pgxpool.Pool) *Keys {
+	return NewKeysWithRing(db, Default())
+}
+
+func NewKeysWithRing(db *pgxpool.Pool, ring *Keyring) *Keys {
+	return &Keys{db: db, ring: ring, byID: map[uuid.UUID]*DataKey{}, active: map[uuid.UUID]activeKey{}}
+}
+
+// Enabled reports whether new data is encrypted.
+func (k *Keys) Enabled() bool { return k.ring.Enabled() }
+
+// Active returns the school's current data key, creating one on first use.
+func (k *Keys) Active(ctx context.Context, schoolID uuid.UUID) (*DataKey, error) {
+	if !k.Enabled() {
+		return nil, ErrDisabled
+	}
+	k.mu.Lock()
+	cached, ok := k.active[schoolID]
+	k.mu.Unlock()
+	if ok && time.Since(cached.fetched) < activeTTL {
+		return k.Get(ctx, cached.id)
+	}
+
+	var id uuid.UUID
+	err := k.db.QueryRow(ctx,
+		`SELECT id FROM school_data_keys WHERE school_id = $1 AND active`, schoolID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		dk, err := k.create(ctx, schoolID)
+		if err != nil {
+			return nil, err
+		}
+		id = dk.ID
+	} else if err != nil {
+		return nil, fmt.Errorf("load active data key: %w", err)
+	}
+
+	k.mu.Lock()
+	k.active[schoolID] = activeKey{id: id, fetched: time.Now()}
+	k.mu.Unlock()
+	return k.Get(ctx, id)
+}
+
+// create stores a new active data key unless another instance created one
+// concurrently, in which case that key is returned.
+func (k *Keys) create(ctx context.Context, schoolID uuid.UUID) (*DataKey, error) {
+	dk, err := GenerateDataKey(schoolID)
+	if err != nil {
+		return nil, err
+	}
+	masterID, wrapped, err := k.ring.Wrap(schoolID, dk.key)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := k.db.Exec(ctx,
+		`INSERT INTO school_data_keys (id, school_id, master_key_id, wrapped_key)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (school_id) WHERE active DO NOTHING`,
+		dk.ID, schoolID, masterID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("create data key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		var id uuid.UUID
+		err := k.db.QueryRow(ctx,
+			`SELECT id FROM school_data_keys WHERE school_id = $1 AND active`, schoolID).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("load active data key: %w", err)
+		}
+		return k.Get(ctx, id)
+	}
+	k.mu.Lock()
+	k.byID[dk.ID] = dk
+	k.mu.Unlock()
+	return dk, nil
+}
+
+// Get returns a data key by ID, active or retired.
+func (k *Keys) Get(ctx context.Context, id uuid.UUID) (*DataKey, error) {
+	k.mu.Lock()
+	dk, ok := k.byID[id]
+	k.mu.Unlock()
+	if ok {
+		return dk, nil
+	}
+
+	var (
+		schoolID uuid.UUID
+		masterID string
+		wrapped  []byte
+	)
+	err := k.db.QueryRow(ctx,
+		`SELECT school_id, master_key_id, wrapped_key FROM school_data_keys WHERE id = $1`, id).
+		Scan(&schoolID, &masterID, &wrapped)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w %s", ErrUnknownDataKey, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load data key: %w", err)
+	}
+	raw, err := k.ring.Unwrap(schoolID, masterID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key %s: %w", id, err)
+	}
+	dk = &DataKey{ID: id, SchoolID: schoolID, key: raw}
+
+	k.mu.Lock()
+	k.byID[id] = dk
+	k.mu.Unlock()
+	return dk, nil
+}
+
+// EncryptString encrypts s with the school's data key. With encryption
+// disabled s is returned unchanged.
+func (k *Keys) EncryptString(ctx context.Context, schoolID uuid.UUID, s string) (string, error) {
+	if !k.Enabled() {
+		return s, nil
+	}
+	dk, err := k.Active(ctx, schoolID)
+	if err != nil {
+		return "", err
+	}
+	return dk.EncryptString(s)
+}
+
+// DecryptString decrypts values written by EncryptString and passes
+// plaintext through.
+func (k *Keys) DecryptString(ctx context.Context, s string) (string, error) {
+	id, ok := StringKeyID(s)
+	if !ok {
+		return s, nil
+	}
+	dk, err := k.Get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return dk.DecryptString(s)
+}
+
+// EncryptBlob encrypts file content with the school's data key and returns
+// the key's ID. With encryption disabled data is returned unchanged and the
+// ID is nil.
+func (k *Keys) EncryptBlob(ctx context.Context, schoolID uuid.UUID, data []byte) ([]byte, *uuid.UUID, error) {
+	if !k.Enabled() {
+		return data, nil, nil
+	}
+	dk, err := k.Active(ctx, schoolID)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err := dk.EncryptBlob(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, &dk.ID, nil
+}
+
+// DecryptBlob decrypts blobs written by EncryptBlob and passes plaintext
+// files through.
+func (k *Keys) DecryptBlob(ctx context.Context, data []byte) ([]byte, error) {
+	id, ok := BlobKeyID(data)
+	if !ok {
+		return data, nil
+	}
+	dk, err := k.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return dk.DecryptBlob(data)
+}
+
+// Rotate retires the school's active data key and creates a new one. Records
+// keep referencing the retired key until they are re-encrypted.
+func (k *Keys) Rotate(ctx context.Context, schoolID uuid.UUID) (*DataKey, error) {
+	if !k.Enabled() {
+		return nil, ErrDisabled
+	}
+	if _, err := k.db.Exec(ctx,
+		`UPDATE school_data_keys SET active = false, retired_at = now()
+		 WHERE school_id = $1 AND active`, schoolID); err != nil {
+		return nil, fmt.Errorf("retire data key: %w", err)
+	}
+	k.mu.Lock()
+	delete(k.active, schoolID)
+	k.mu.Unlock()
+	return k.Active(ctx, schoolID)
+}
+
+// Rewrap re-encrypts every data key that is not wrapped by the active master
+// key, so retired master keys can be removed from the configuration.
+func (k *Keys) Rewrap(ctx context.Context) (int, error) {
+	if !k.Enabled() {
+		return 0, ErrDisabled
+	}
+	rows, err := k.db.Query(ctx,
+		`SELECT id FROM school_data_keys WHERE master_key_id <> $1`, k.ring.ActiveID())
+	if err != nil {
+		return 0, fmt.Errorf("list data keys: %w", err)
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan data key: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		dk, err := k.Get(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		masterID, wrapped, err := k.ring.Wrap(dk.SchoolID, dk.key)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := k.db.Exec(ctx,
+			`UPDATE school_data_keys SET master_key_id = $2, wrapped_key = $3 WHERE id = $1`,
+			id, masterID, wrapped); err != nil {
+			return 0, fmt.Errorf("rewrap data key: %w", err)
+		}
+	}
+	return len(ids), nil
+}
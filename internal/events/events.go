@@ -0,0 +1,223 @@
+// Package events pushes changes to connected users in real time. Services
+// publish events with PostgreSQL NOTIFY, so every backend replica receives
+// them; each replica's Hub LISTENs and hands them to its own subscribers.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Channel is the PostgreSQL notification channel.
+const Channel = "eduko_events"
+
+// Event types.
+const (
+	SubstitutionCreated = "substitution.created"
+	SubstitutionUpdated = "substitution.updated"
+	ExcuseStatusChanged = "excuse.status_changed"
+	AppointmentCreated  = "appointment.created"
+	AppointmentUpdated  = "appointment.updated"
+	AttendanceRecorded  = "attendance.recorded"
+	NotificationCreated = "notification.created"
+	// Resync tells clients that events may have been lost while the
+	// listener reconnected; they should reload what they show.
+	Resync = "resync"
+)
+
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// notification is the NOTIFY payload. Without Users the event goes to
+// everyone in the school.
+type notification struct {
+	SchoolID uuid.UUID   `json:"school_id"`
+	Users    []uuid.UUID `json:"users,omitempty"`
+	Event    Event       `json:"event"`
+}
+
+// NOTIFY payloads are limited to 8000 bytes; a user ID takes 39 in JSON.
+const usersPerNotification = 150
+
+// Execer is a pool or a transaction. Inside a transaction the event is only
+// delivered when it commits.
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// Publish sends ev to users of the school.
+func Publish(ctx context.Context, db Execer, schoolID uuid.UUID, users []uuid.UUID, ev Event) error {
+	for len(users) > 0 {
+		n := min(len(users), usersPerNotification)
+		if err := notify(ctx, db, notification{SchoolID: schoolID, Users: users[:n], Event: ev}); err != nil {
+			return err
+		}
+		users = users[n:]
+	}
+	return nil
+}
+
+// PublishSchool sends ev to everyone in the school.
+func PublishSchool(ctx context.Context, db Execer, schoolID uuid.UUID, ev Event) error {
+	return notify(ctx, db, notification{SchoolID: schoolID, Event: ev})
+}
+
+func notify(ctx context.Context, db Execer, n notification) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	if _, err := db.Exec(ctx, `SELECT pg_notify($1, $2)`, Channel, string(payload)); err != nil {
+		return fmt.Errorf("publish event: %w", err)
+	}
+	return nil
+}
+
+// subscriberBuffer is how many events a slow client may fall behind before
+// its stream is closed; it reconnects and reloads.
+const subscriberBuffer = 32
+
+type subscriber struct {
+	schoolID uuid.UUID
+	ch       chan Event
+}
+
+// Hub fans the notifications out to the streams connected to this replica.
+type Hub struct {
+	db *pgxpool.Pool
+
+	mu   sync.Mutex
+	subs map[uuid.UUID]map[*subscriber]struct{} // by user
+}
+
+func NewHub(db *pgxpool.Pool) *Hub {
+	return &Hub{db: db, subs: map[uuid.UUID]map[*subscriber]struct{}{}}
+}
+
+// Subscribe returns the events for a user until cancel is called. The
+// channel is closed when the user falls too far behind.
+func (h *Hub) Subscribe(schoolID, userID uuid.UUID) (<-chan Event, func()) {
+	sub := &subscriber{schoolID: schoolID, ch: make(chan Event, subscriberBuffer)}
+	h.mu.Lock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = map[*subscriber]struct{}{}
+	}
+	h.subs[userID][sub] = struct{}{}
+	h.mu.Unlock()
+	return sub.ch, func() {
+		h.mu.Lock()
+		h.remove(userID, sub)
+		h.mu.Unlock()
+	}
+}
+
+// remove drops sub and closes its channel once; h.mu must be held.
+func (h *Hub) remove(userID uuid.UUID, sub *subscriber) {
+	subs := h.subs[userID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subs, userID)
+	}
+	close(sub.ch)
+}
+
+func (h *Hub) send(userID uuid.UUID, sub *subscriber, ev Event) {
+	select {
+	case sub.ch <- ev:
+	default:
+		h.remove(userID, sub)
+	}
+}
+
+func (h *Hub) dispatch(n notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n.Users == nil {
+		for userID, subs := range h.subs {
+			for sub := range subs {
+				if sub.schoolID == n.SchoolID {
+					h.send(userID, sub, n.Event)
+				}
+			}
+		}
+		return
+	}
+	for _, userID := range n.Users {
+		for sub := range h.subs[userID] {
+			if sub.schoolID == n.SchoolID {
+				h.send(userID, sub, n.Event)
+			}
+		}
+	}
+}
+
+func (h *Hub) broadcast(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for userID, subs := range h.subs {
+		for sub := range subs {
+			h.send(userID, sub, ev)
+		}
+	}
+}
+
+// Run listens for notifications until ctx is done, reconnecting after
+// errors. Subscribers get a Resync event after each reconnect.
+func (h *Hub) Run(ctx context.Context) {
+	reconnect := false
+	for {
+		err := h.listen(ctx, reconnect)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[events] listener: %v; reconnecting", err)
+		reconnect = true
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// listen uses a connection of its own: a pooled one would keep listening
+// after it is returned.
+func (h *Hub) listen(ctx context.Context, reconnect bool) error {
+	conn, err := pgx.ConnectConfig(ctx, h.db.Config().ConnConfig.Copy())
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, `LISTEN `+Channel); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	if reconnect {
+		h.broadcast(Event{Type: Resync})
+	}
+	for {
+		msg, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var n notification
+		if err := json.Unmarshal([]byte(msg.Payload), &n); err != nil {
+			log.Printf("[events] invalid notification: %v", err)
+			continue
+		}
+		h.dispatch(n)
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/config"
+	"github.com/Monstroxx/eduko-backend/internal/encryption"
+	"github.com/Monstroxx/eduko-backend/internal/models"
+	"github.com/Monstroxx/eduko-backend/internal/scanner"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+	"github.com/Monstroxx/eduko-backend/internal/signing"
+	"github.com/Monstroxx/eduko-backend/internal/storage"
+)
+
+// attachmentForViewer loads an attachment after checking that the caller may
+// see the excuse's files. Unauthorized callers get 404 so attachment IDs
+// cannot be probed.
+func attachmentForViewer(c echo.Context, svc *services.ExcuseService) (*models.ExcuseAttachment, error) {
+	schoolID := c.Get("school_id").(uuid.UUID)
+	userID := c.Get("user_id").(uuid.UUID)
+	role := c.Get("role").(string)
+	ctx := c.Request().Context()
+
+	excuseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	attachmentID, err := uuid.Parse(c.Param("attachmentId"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid attachment id")
+	}
+
+	excuse, err := svc.GetByID(ctx, schoolID, excuseID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "attachment not found")
+	}
+	ok, err := svc.CanViewAttachments(ctx, excuse, userID, role)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to check access")
+	}
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "attachment not found")
+	}
+
+	attachment, err := svc.GetAttachment(ctx, schoolID, excuseID, attachmentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "attachment not found")
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to load attachment")
+	}
+	return attachment, nil
+}
+
+// streamAttachment decrypts the blob and writes it with its stored content
+// type. Files are served as attachments unless they are PDFs or images, which
+// viewers can display inline. Quarantined files are refused.
+func streamAttachment(c echo.Context, store storage.Store, keys *encryption.Keys, a *models.ExcuseAttachment) error {
+	switch status := scanner.Status(a.ScanStatus); {
+	case status == scanner.StatusInfected:
+		return echo.NewHTTPError(http.StatusForbidden, "file quarantined: malware detected")
+	case !status.Released():
+		return echo.NewHTTPError(http.StatusConflict, "file quarantined until the virus scan completes")
+	}
+
+	ctx := c.Request().Context()
+	r, err := store.Get(ctx, a.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "file missing")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+	}
+	sealed, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+	}
+	data, err := keys.DecryptBlob(ctx, sealed)
+	if err != nil {
+		c.Logger().Errorf("decrypt attachment %s: %v", a.ID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+	}
+
+	disposition := "attachment"
+	switch a.ContentType {
+	case "application/pdf", "image/jpeg", "image/png":
+		disposition = "inline"
+	}
+	h := c.Response().Header()
+	h.Set(echo.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": a.FileName}))
+	h.Set(echo.HeaderContentLength, fmt.Sprint(len(data)))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Cache-Control", "private, no-store")
+	return c.Blob(http.StatusOK, a.ContentType, data)
+}
+
+func DownloadExcuseAttachment(db *pgxpool.Pool, store storage.Store) echo.HandlerFunc {
+	svc := services.NewExcuseService(db)
+	keys := encryption.NewKeys(db)
+	return func(c echo.Context) error {
+		attachment, err := attachmentForViewer(c, svc)
+		if err != nil {
+			return err
+		}
+		return streamAttachment(c, store, keys, attachment)
+	}
+}
+
+func attachmentSigner(cfg *config.Config) *signing.Signer {
+	return signing.New(cfg.JWTSecret, "attachment")
+}
+
+// CreateAttachmentLink issues a short-lived URL for an attachment that works
+// without the JWT, e.g. to open a PDF in an external viewer.
+func CreateAttachmentLink(db *pgxpool.Pool, cfg *config.Config) echo.HandlerFunc {
+	svc := services.NewExcuseService(db)
+	signer := attachmentSigner(cfg)
+	return func(c echo.Context) error {
+		attachment, err := attachmentForViewer(c, svc)
+		if err != nil {
+			return err
+		}
+		expires := time.Now().Add(cfg.SignedURLTTL).Truncate(time.Second)
+		query := url.Values{}
+		query.Set("expires", fmt.Sprint(expires.Unix()))
+		query.Set("sig", signer.Sign(attachment.ID.String(), expires))
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"url":        "/api/v1/files/attachments/" + attachment.ID.String() + "?" + query.Encode(),
+			"expires_at": expires,
+		})
+	}
+}
+
+// DownloadSignedAttachment serves an attachment for a URL issued by
+// CreateAttachmentLink. It is mounted outside the JWT-protected group.
+func DownloadSignedAttachment(db *pgxpool.Pool, cfg *config.Config, store storage.Store) echo.HandlerFunc {
+	svc := services.NewExcuseService(db)
+	keys := encryption.NewKeys(db)
+	signer := attachmentSigner(cfg)
+	return func(c echo.Context) error {
+		attachmentID, err := uuid.Parse(c.Param("attachmentId"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, "attachment not found")
+		}
+		err = signer.Verify(attachmentID.String(), c.QueryParam("expires"), c.QueryParam("sig"), time.Now())
+		if errors.Is(err, signing.ErrExpired) {
+			return echo.NewHTTPError(http.StatusGone, "link expired")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusForbidden, "invalid link")
+		}
+
+		attachment, err := svc.GetAttachmentByID(c.Request().Context(), attachmentID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, "attachment not found")
+		}
+		return streamAttachment(c, store, keys, attachment)
+	}
+}
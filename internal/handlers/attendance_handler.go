@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -111,3 +113,34 @@ func GetAttendanceByDate(db *pgxpool.Pool) echo.HandlerFunc {
 		return c.JSON(http.StatusOK, list)
 	}
 }
+
+// GetLessonRoster lists the students expected in a timetable entry on ?date=
+// with their attendance: the group members for course groups, otherwise the
+// class.
+func GetLessonRoster(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewAttendanceService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "teacher" && role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "teachers only")
+		}
+		entryID, err := uuid.Parse(c.Param("entryId"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid entry id")
+		}
+		date := c.QueryParam("date")
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "date required (YYYY-MM-DD)")
+		}
+
+		list, err := svc.Roster(c.Request().Context(), schoolID, entryID, date)
+		if errors.Is(err, services.ErrEntryNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "timetable entry not found")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get roster")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/i18n"
+	"github.com/Monstroxx/eduko-backend/internal/ical"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+const (
+	defaultFeedWeeks = 4
+	maxFeedWeeks     = 26
+)
+
+// GetCalendarFeed reports whether the user has a subscription URL. The token
+// itself is only shown when it is generated.
+func GetCalendarFeed(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCalendarFeedService(db)
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		feed, err := svc.Get(c.Request().Context(), userID)
+		if errors.Is(err, services.ErrFeedNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "no calendar feed")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get calendar feed")
+		}
+		return c.JSON(http.StatusOK, feed)
+	}
+}
+
+// CreateCalendarFeed generates a new subscription URL for the user. An
+// existing URL stops working.
+func CreateCalendarFeed(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCalendarFeedService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		userID := c.Get("user_id").(uuid.UUID)
+		token, feed, err := svc.Regenerate(c.Request().Context(), schoolID, userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create calendar feed")
+		}
+		path := "/ical/" + token + ".ics"
+		return c.JSON(http.StatusCreated, map[string]interface{}{
+			"user_id":    feed.UserID,
+			"school_id":  feed.SchoolID,
+			"created_at": feed.CreatedAt,
+			"token":      token,
+			"path":       path,
+			"url":        c.Scheme() + "://" + c.Request().Host + path,
+		})
+	}
+}
+
+func DeleteCalendarFeed(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCalendarFeedService(db)
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		err := svc.Revoke(c.Request().Context(), userID)
+		if errors.Is(err, services.ErrFeedNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "no calendar feed")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to revoke calendar feed")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// ServeCalendarFeed renders /ical/<token>.ics: the owner's resolved
+// timetable from the start of the current week for ?weeks= weeks (default 4)
+// plus appointments. No JWT; the secret token authorizes the request.
+func ServeCalendarFeed(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCalendarFeedService(db)
+	return func(c echo.Context) error {
+		token, ok := strings.CutSuffix(c.Param("file"), ".ics")
+		if !ok || token == "" {
+			return echo.NewHTTPError(http.StatusNotFound, "calendar feed not found")
+		}
+		weeks := defaultFeedWeeks
+		if v := c.QueryParam("weeks"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxFeedWeeks {
+				return echo.NewHTTPError(http.StatusBadRequest, "weeks must be between 1 and 26")
+			}
+			weeks = n
+		}
+
+		ctx := c.Request().Context()
+		owner, err := svc.Resolve(ctx, token)
+		if errors.Is(err, services.ErrFeedNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "calendar feed not found")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to load calendar feed")
+		}
+
+		candidates := []string{c.QueryParam("lang")}
+		if owner.Locale != nil {
+			candidates = append(candidates, *owner.Locale)
+		}
+		tr := i18n.For(append(candidates, owner.SchoolLocale)...)
+
+		loc, err := time.LoadLocation(owner.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		from := services.WeekStart(time.Now().In(loc))
+		to := from.AddDate(0, 0, 7*weeks-1)
+		events, err := svc.Events(ctx, owner, from, to, tr)
+		if errors.Is(err, services.ErrInvalidABReference) {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to load calendar feed")
+		}
+
+		var buf bytes.Buffer
+		if err := ical.Write(&buf, "Eduko – "+tr.T("timetable.title"), events, time.Now()); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to render calendar feed")
+		}
+		c.Response().Header().Set("Cache-Control", "private, max-age=900")
+		return c.Blob(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+	}
+}
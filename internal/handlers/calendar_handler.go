@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+// GetCalendar returns the school years and the holidays and non-teaching days
+// between ?from= and ?to= (default: the current year).
+func GetCalendar(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCalendarService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		now := time.Now().UTC()
+		from := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(now.Year(), 12, 31, 0, 0, 0, 0, time.UTC)
+		var err error
+		if v := c.QueryParam("from"); v != "" {
+			if from, err = time.Parse("2006-01-02", v); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid from")
+			}
+		}
+		if v := c.QueryParam("to"); v != "" {
+			if to, err = time.Parse("2006-01-02", v); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid to")
+			}
+		}
+
+		years, err := svc.ListSchoolYears(c.Request().Context(), schoolID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get calendar")
+		}
+		holidays, err := svc.ListHolidays(c.Request().Context(), schoolID, from, to)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get calendar")
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"school_years": years,
+			"holidays":     holidays,
+		})
+	}
+}
+
+func CreateSchoolYear(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCalendarService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		var req services.CreateSchoolYearInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		year, err := svc.CreateSchoolYear(c.Request().Context(), schoolID, req)
+		if errors.Is(err, services.ErrCalendarInvalidRange) {
+			return echo.NewHTTPError(http.StatusBadRequest, "name, start_date and end_date required, end_date not before start_date")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create school year")
+		}
+		return c.JSON(http.StatusCreated, year)
+	}
+}
+
+func DeleteSchoolYear(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCalendarService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		err = svc.DeleteSchoolYear(c.Request().Context(), schoolID, id)
+		if errors.Is(err, services.ErrCalendarNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "school year not found")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete school year")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func CreateHoliday(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCalendarService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		var req services.CreateHolidayInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		if req.Kind != "" && req.Kind != "holiday" && req.Kind != "non_teaching_day" {
+			return echo.NewHTTPError(http.StatusBadRequest, "kind must be holiday or non_teaching_day")
+		}
+		holiday, err := svc.CreateHoliday(c.Request().Context(), schoolID, req)
+		if errors.Is(err, services.ErrCalendarInvalidRange) {
+			return echo.NewHTTPError(http.StatusBadRequest, "name and date_from required, date_to not before date_from")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create holiday")
+		}
+		return c.JSON(http.StatusCreated, holiday)
+	}
+}
+
+func DeleteHoliday(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCalendarService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		err = svc.DeleteHoliday(c.Request().Context(), schoolID, id)
+		if errors.Is(err, services.ErrCalendarNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "holiday not found")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete holiday")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+// ListCourseGroups returns the school's course groups, optionally filtered by
+// ?class_id= or ?student_id=.
+func ListCourseGroups(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCourseGroupService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		list, err := svc.List(c.Request().Context(), schoolID, c.QueryParam("class_id"), c.QueryParam("student_id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list course groups")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+func GetCourseGroup(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCourseGroupService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		groupID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		group, err := svc.GetByID(c.Request().Context(), schoolID, groupID)
+		if errors.Is(err, services.ErrGroupNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "course group not found")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get course group")
+		}
+		return c.JSON(http.StatusOK, group)
+	}
+}
+
+func CreateCourseGroup(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCourseGroupService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		var req services.CreateCourseGroupInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		if req.Name == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "name required")
+		}
+		group, err := svc.Create(c.Request().Context(), schoolID, req)
+		if errors.Is(err, services.ErrGroupMember) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create course group")
+		}
+		return c.JSON(http.StatusCreated, group)
+	}
+}
+
+func UpdateCourseGroup(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCourseGroupService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		groupID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		var req services.CreateCourseGroupInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		if req.Name == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "name required")
+		}
+		group, err := svc.Update(c.Request().Context(), schoolID, groupID, req)
+		if errors.Is(err, services.ErrGroupNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "course group not found")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update course group")
+		}
+		return c.JSON(http.StatusOK, group)
+	}
+}
+
+func DeleteCourseGroup(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCourseGroupService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		groupID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		err = svc.Delete(c.Request().Context(), schoolID, groupID)
+		if errors.Is(err, services.ErrGroupNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "course group not found")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete course group")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func ListCourseGroupMembers(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCourseGroupService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		groupID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		if _, err := svc.GetByID(c.Request().Context(), schoolID, groupID); errors.Is(err, services.ErrGroupNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "course group not found")
+		}
+		list, err := svc.Members(c.Request().Context(), schoolID, groupID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list group members")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+func AddCourseGroupMembers(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCourseGroupService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		groupID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		var req struct {
+			StudentIDs []uuid.UUID `json:"student_ids"`
+		}
+		if err := c.Bind(&req); err != nil || len(req.StudentIDs) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "student_ids required")
+		}
+		err = svc.AddMembers(c.Request().Context(), schoolID, groupID, req.StudentIDs)
+		if errors.Is(err, services.ErrGroupNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "course group not found")
+		}
+		if errors.Is(err, services.ErrGroupMember) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to add group members")
+		}
+		list, err := svc.Members(c.Request().Context(), schoolID, groupID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list group members")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+func RemoveCourseGroupMember(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewCourseGroupService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		groupID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		studentID, err := uuid.Parse(c.Param("studentId"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid student id")
+		}
+		err = svc.RemoveMember(c.Request().Context(), schoolID, groupID, studentID)
+		if errors.Is(err, services.ErrGroupNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "group member not found")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to remove group member")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
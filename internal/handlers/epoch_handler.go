@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+func ListEpochs(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewEpochService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		list, err := svc.List(c.Request().Context(), schoolID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list epochs")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+func CreateEpoch(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewEpochService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		var req services.CreateEpochInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		epoch, err := svc.Create(c.Request().Context(), schoolID, req)
+		if errors.Is(err, services.ErrEpochInvalidRange) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create epoch")
+		}
+		return c.JSON(http.StatusCreated, epoch)
+	}
+}
+
+func UpdateEpoch(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewEpochService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		var req services.CreateEpochInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		epoch, err := svc.Update(c.Request().Context(), schoolID, id, req)
+		if errors.Is(err, services.ErrEpochInvalidRange) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, services.ErrEpochNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "epoch not found")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update epoch")
+		}
+		return c.JSON(http.StatusOK, epoch)
+	}
+}
+
+func DeleteEpoch(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewEpochService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		err = svc.Delete(c.Request().Context(), schoolID, id)
+		if errors.Is(err, services.ErrEpochNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "epoch not found")
+		}
+		if errors.Is(err, services.ErrEpochInUse) {
+			return echo.NewHTTPError(http.StatusConflict, "epoch has timetable entries")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete epoch")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
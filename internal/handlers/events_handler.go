@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/events"
+)
+
+// eventsKeepAlive is how often an idle stream sends a comment, so proxies
+// don't close it.
+const eventsKeepAlive = 25 * time.Second
+
+// StreamEvents streams the user's events as Server-Sent Events until the
+// client disconnects. Events missed while disconnected are not replayed;
+// clients reload after connecting.
+func StreamEvents(hub *events.Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		userID := c.Get("user_id").(uuid.UUID)
+		ch, cancel := hub.Subscribe(schoolID, userID)
+		defer cancel()
+
+		w := c.Response()
+		w.Header().Set(echo.HeaderContentType, "text/event-stream")
+		w.Header().Set(echo.HeaderCacheControl, "no-cache")
+		w.Header().Set(echo.HeaderConnection, "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "retry: 5000\n: connected\n\n")
+		w.Flush()
+
+		ticker := time.NewTicker(eventsKeepAlive)
+		defer ticker.Stop()
+		ctx := c.Request().Context()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case ev, ok := <-ch:
+				if !ok {
+					return nil // too far behind; the client reconnects
+				}
+				data, err := json.Marshal(ev.Data)
+				if err != nil {
+					return nil
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+				w.Flush()
+			case <-ticker.C:
+				fmt.Fprint(w, ": ping\n\n")
+				w.Flush()
+			}
+		}
+	}
+}
@@ -1,40 +1,63 @@
 package handlers
 
 import (
-	"encoding/csv"
+	"bytes"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/labstack/echo/v4"
 
+	"github.com/Monstroxx/eduko-backend/internal/encryption"
+	"github.com/Monstroxx/eduko-backend/internal/i18n"
+	"github.com/Monstroxx/eduko-backend/internal/importer"
+	"github.com/Monstroxx/eduko-backend/internal/models"
+	"github.com/Monstroxx/eduko-backend/internal/pdf"
+	"github.com/Monstroxx/eduko-backend/internal/scanner"
 	"github.com/Monstroxx/eduko-backend/internal/services"
+	"github.com/Monstroxx/eduko-backend/internal/storage"
 )
 
 func CreateExcuse(db *pgxpool.Pool) echo.HandlerFunc {
 	svc := services.NewExcuseService(db)
 	return func(c echo.Context) error {
 		schoolID := c.Get("school_id").(uuid.UUID)
-		userID := c.Get("user_id").(uuid.UUID)
+		role := c.Get("role").(string)
 
 		var req services.CreateExcuseInput
 		if err := c.Bind(&req); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
 		}
 
-		// Look up student ID from user ID
 		var studentID uuid.UUID
-		err := db.QueryRow(c.Request().Context(),
-			`SELECT id FROM students WHERE user_id = $1 AND school_id = $2`, userID, schoolID,
-		).Scan(&studentID)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, "user is not a student")
+		if role == "teacher" || role == "admin" {
+			// Teachers record paper excuses handed in by a student.
+			if req.StudentID == nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "student_id required")
+			}
+			var exists bool
+			err := db.QueryRow(c.Request().Context(),
+				`SELECT EXISTS(SELECT 1 FROM students WHERE id = $1 AND school_id = $2)`,
+				*req.StudentID, schoolID,
+			).Scan(&exists)
+			if err != nil || !exists {
+				return echo.NewHTTPError(http.StatusBadRequest, "student not found")
+			}
+			studentID = *req.StudentID
+			req.SubmissionType = "paper"
+			req.PaperReceived = true
+		} else {
+			// Look up student ID from user ID
+			id, err := studentIDForUser(c, db)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "user is not a student")
+			}
+			studentID = id
 		}
 
 		// TODO: validate deadline, attestation rules from school settings
@@ -132,152 +155,226 @@ func RejectExcuse(db *pgxpool.Pool) echo.HandlerFunc {
 	}
 }
 
-func UploadExcuseForm(db *pgxpool.Pool) echo.HandlerFunc {
+// BulkExcuses approves, rejects or marks the paper form as received for many
+// excuses at once, e.g. when a class teacher processes the pile after holidays.
+func BulkExcuses(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewExcuseService(db)
 	return func(c echo.Context) error {
 		schoolID := c.Get("school_id").(uuid.UUID)
-		excuseID, err := uuid.Parse(c.FormValue("excuse_id"))
+		userID := c.Get("user_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "teacher" && role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "teachers only")
+		}
+
+		var req services.BulkExcuseInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		if len(req.IDs) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "ids required")
+		}
+		if len(req.IDs) > 500 {
+			return echo.NewHTTPError(http.StatusBadRequest, "too many ids (max 500)")
+		}
+
+		result, err := svc.Bulk(c.Request().Context(), schoolID, userID, req)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidBulkAction) {
+				return echo.NewHTTPError(http.StatusBadRequest, "action must be approve, reject or paper_received")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to process excuses")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+// excuseForUpload loads the excuse an attachment belongs to, for the users
+// who may see its files (see ExcuseService.CanViewAttachments).
+func excuseForUpload(c echo.Context, svc *services.ExcuseService, excuseID uuid.UUID) (*models.Excuse, error) {
+	schoolID := c.Get("school_id").(uuid.UUID)
+	excuse, err := svc.GetByID(c.Request().Context(), schoolID, excuseID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "excuse not found")
+	}
+	ok, err := svc.CanViewAttachments(c.Request().Context(), excuse,
+		c.Get("user_id").(uuid.UUID), c.Get("role").(string))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to check access")
+	}
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "excuse not found")
+	}
+	return excuse, nil
+}
+
+// UploadExcuseForm attaches a file to an excuse. The excuse is taken from the
+// route (`/excuses/:id/attachments`) or the `excuse_id` form field
+// (`/excuses/upload`). An excuse can have several attachments. Only PDF, JPEG,
+// PNG and HEIC are accepted; see saveUpload.
+func UploadExcuseForm(db *pgxpool.Pool, store storage.Store, scan scanner.Scanner) echo.HandlerFunc {
+	svc := services.NewExcuseService(db)
+	keys := encryption.NewKeys(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		userID := c.Get("user_id").(uuid.UUID)
+		idParam := c.Param("id")
+		if idParam == "" {
+			idParam = c.FormValue("excuse_id")
+		}
+		excuseID, err := uuid.Parse(idParam)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid excuse_id")
 		}
+		if _, err := excuseForUpload(c, svc, excuseID); err != nil {
+			return err
+		}
 
 		file, err := c.FormFile("file")
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "file required")
 		}
-
-		// Max 10MB
-		if file.Size > 10<<20 {
-			return echo.NewHTTPError(http.StatusBadRequest, "file too large (max 10MB)")
+		up, err := saveUpload(c.Request().Context(), store, keys, scan, schoolID, file)
+		if err != nil {
+			return err
 		}
 
-		uploadDir := os.Getenv("UPLOAD_DIR")
-		if uploadDir == "" {
-			uploadDir = "./uploads"
+		attachment, err := svc.AddAttachment(c.Request().Context(), schoolID, excuseID, userID, services.AddAttachmentInput{
+			StorageKey:  up.Key,
+			SHA256:      up.SHA256,
+			FileName:    up.FileName,
+			ContentType: up.ContentType,
+			SizeBytes:   up.Size,
+			ScanStatus:  string(up.ScanStatus),
+			DataKeyID:   up.DataKeyID,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update excuse")
 		}
-
-		// Ensure directory exists.
-		if err := os.MkdirAll(uploadDir, 0755); err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "upload dir error")
+		if attachment.StorageKey != up.Key {
+			// Same file already attached, encrypted under an older data key.
+			ctx := c.Request().Context()
+			if referenced, err := services.BlobReferenced(ctx, db, up.Key); err == nil && !referenced {
+				store.Delete(ctx, up.Key)
+			}
 		}
+		return c.JSON(http.StatusCreated, attachment)
+	}
+}
 
-		ext := filepath.Ext(file.Filename)
-		filename := fmt.Sprintf("%s_%s%s", excuseID.String(), uuid.New().String()[:8], ext)
-		dst := filepath.Join(uploadDir, filename)
-
-		src, err := file.Open()
+func ListExcuseAttachments(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewExcuseService(db)
+	return func(c echo.Context) error {
+		excuseID, err := uuid.Parse(c.Param("id"))
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
 		}
-		defer src.Close()
-
-		out, err := os.Create(dst)
+		excuse, err := excuseForUpload(c, svc, excuseID)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to save file")
+			return err
 		}
-		defer out.Close()
+		return c.JSON(http.StatusOK, excuse.Attachments)
+	}
+}
 
-		if _, err := io.Copy(out, src); err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to write file")
+// DeleteExcuseAttachment removes an attachment. The blob itself is deleted
+// once no other attachment references the same content.
+func DeleteExcuseAttachment(db *pgxpool.Pool, store storage.Store) echo.HandlerFunc {
+	svc := services.NewExcuseService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		excuseID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
 		}
-
-		// Update excuse with file path.
-		_, err = db.Exec(c.Request().Context(),
-			`UPDATE excuses SET file_path = $1, updated_at = NOW() WHERE id = $2 AND school_id = $3`,
-			filename, excuseID, schoolID)
+		attachmentID, err := uuid.Parse(c.Param("attachmentId"))
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update excuse")
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid attachment id")
+		}
+		excuse, err := excuseForUpload(c, svc, excuseID)
+		if err != nil {
+			return err
+		}
+		// Evidence of a decided excuse stays; only admins may remove it.
+		if c.Get("role").(string) != "admin" && excuse.Status != models.ExcusePending {
+			return echo.NewHTTPError(http.StatusConflict, "excuse already decided")
 		}
 
-		return c.JSON(http.StatusOK, map[string]string{
-			"message":   "file uploaded",
-			"file_path": filename,
-		})
+		key, orphaned, err := svc.DeleteAttachment(c.Request().Context(), schoolID, excuseID, attachmentID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "attachment not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete attachment")
+		}
+		if orphaned {
+			if err := store.Delete(c.Request().Context(), key); err != nil {
+				c.Logger().Errorf("delete blob %s: %v", key, err)
+			}
+		}
+		return c.NoContent(http.StatusNoContent)
 	}
 }
 
+// GenerateExcusePDF renders the printable excuse form. The language is taken
+// from `?lang=`, then the requesting user's locale, then the school's locale.
 func GenerateExcusePDF(db *pgxpool.Pool) echo.HandlerFunc {
 	svc := services.NewExcuseService(db)
 	return func(c echo.Context) error {
 		schoolID := c.Get("school_id").(uuid.UUID)
+		userID := c.Get("user_id").(uuid.UUID)
 		excuseID, err := uuid.Parse(c.Param("id"))
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
 		}
+		ctx := c.Request().Context()
 
-		excuse, err := svc.GetByID(c.Request().Context(), schoolID, excuseID)
+		doc, err := svc.Document(ctx, schoolID, excuseID)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusNotFound, "excuse not found")
+			if errors.Is(err, pgx.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "excuse not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to load excuse")
 		}
 
-		// Get student + school info for the PDF.
-		var studentName, schoolName string
-		_ = db.QueryRow(c.Request().Context(),
-			`SELECT u.first_name || ' ' || u.last_name FROM students s JOIN users u ON u.id = s.user_id WHERE s.id = $1`,
-			excuse.StudentID).Scan(&studentName)
-		_ = db.QueryRow(c.Request().Context(),
-			`SELECT name FROM schools WHERE id = $1`, schoolID).Scan(&schoolName)
+		var userLocale *string
+		_ = db.QueryRow(ctx, `SELECT locale FROM users WHERE id = $1`, userID).Scan(&userLocale)
+		candidates := []string{c.QueryParam("lang")}
+		if userLocale != nil {
+			candidates = append(candidates, *userLocale)
+		}
+		tr := i18n.For(append(candidates, doc.SchoolLocale)...)
 
-		pdf := generateExcusePDFContent(excuse.DateFrom, excuse.DateTo, excuse.Status, excuse.Reason, excuse.SubmittedAt, excuse.SubmissionType, studentName, schoolName)
+		var buf bytes.Buffer
+		if err := pdf.RenderExcuse(&buf, doc, tr); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to render pdf")
+		}
 
-		c.Response().Header().Set("Content-Type", "application/pdf")
 		c.Response().Header().Set("Content-Disposition",
 			fmt.Sprintf("attachment; filename=entschuldigung_%s.pdf", excuseID.String()[:8]))
-		return c.Blob(http.StatusOK, "application/pdf", pdf)
-	}
-}
-
-// generateExcusePDFContent creates a minimal PDF document.
-// Uses raw PDF syntax to avoid external dependencies.
-func generateExcusePDFContent(dateFrom, dateTo time.Time, status interface{}, reason *string, submittedAt time.Time, submissionType interface{}, studentName, schoolName string) []byte {
-	reasonStr := "–"
-	if reason != nil {
-		reasonStr = *reason
+		return c.Blob(http.StatusOK, "application/pdf", buf.Bytes())
 	}
-
-	content := fmt.Sprintf(
-		"Entschuldigung\n\nSchule: %s\nSchueler: %s\nZeitraum: %s - %s\nStatus: %v\nGrund: %s\nEingereicht: %s\nTyp: %v",
-		schoolName, studentName, dateFrom.Format("02.01.2006"), dateTo.Format("02.01.2006"),
-		status, reasonStr, submittedAt.Format("02.01.2006 15:04"), submissionType,
-	)
-
-	// Minimal valid PDF with text content.
-	stream := fmt.Sprintf("BT /F1 12 Tf 50 750 Td (%s) Tj ET", escapePDF(content))
-	streamLen := len(stream)
-
-	pdf := fmt.Sprintf(`%%PDF-1.4
-1 0 obj<</Type/Catalog/Pages 2 0 R>>endobj
-2 0 obj<</Type/Pages/Kids[3 0 R]/Count 1>>endobj
-3 0 obj<</Type/Page/Parent 2 0 R/MediaBox[0 0 595 842]/Contents 4 0 R/Resources<</Font<</F1 5 0 R>>>>>>endobj
-4 0 obj<</Length %d>>
-stream
-%s
-endstream
-endobj
-5 0 obj<</Type/Font/Subtype/Type1/BaseFont/Helvetica>>endobj
-xref
-0 6
-0000000000 65535 f 
-0000000009 00000 n 
-0000000058 00000 n 
-0000000115 00000 n 
-trailer<</Size 6/Root 1 0 R>>
-startxref
-0
-%%%%EOF`, streamLen, stream)
-
-	return []byte(pdf)
 }
 
-func escapePDF(s string) string {
-	r := strings.NewReplacer(
-		"\\", "\\\\",
-		"(", "\\(",
-		")", "\\)",
-		"\n", ") Tj 0 -16 Td (",
-	)
-	return r.Replace(s)
+// studentKey identifies a student by class and full name (lower-cased).
+type studentKey struct {
+	classID   uuid.UUID
+	firstName string
+	lastName  string
 }
 
+// ImportExcusesCSV handles bulk excuse import via CSV.
+//
+// Expected CSV format (semicolon-delimited, UTF-8, header required):
+//
+//	username;class_name;first_name;last_name;date_from;date_to;submission_type;reason
+//
+// - student: username, class_name + first_name + last_name, or student_id
+// - date_from/date_to format: YYYY-MM-DD
+// - submission_type defaults to paper
+// - dry_run=true validates every row without committing
+// - report=csv returns the failed rows as a CSV instead of JSON
+// - admin-only endpoint
 func ImportExcusesCSV(db *pgxpool.Pool) echo.HandlerFunc {
 	svc := services.NewExcuseService(db)
 	return func(c echo.Context) error {
@@ -286,64 +383,126 @@ func ImportExcusesCSV(db *pgxpool.Pool) echo.HandlerFunc {
 		if role != "admin" {
 			return echo.NewHTTPError(http.StatusForbidden, "admin only")
 		}
+		ctx := c.Request().Context()
 
-		file, err := c.FormFile("file")
+		reader, report, closeFile, err := openImport(c)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, "CSV file required")
+			return err
 		}
+		defer closeFile()
 
-		src, err := file.Open()
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+		if err := reader.Require("date_from", "date_to"); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		byName := reader.Has("class_name") && reader.Has("first_name") && reader.Has("last_name")
+		if !reader.Has("username") && !reader.Has("student_id") && !byName {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				"missing student column: username, student_id or class_name + first_name + last_name")
 		}
-		defer src.Close()
 
-		reader := csv.NewReader(src)
-		reader.Comma = ';'
-		reader.LazyQuotes = true
+		classMap, err := loadClassMap(ctx, db, schoolID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to load classes")
+		}
 
-		// Skip header
-		if _, err := reader.Read(); err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, "invalid CSV")
+		// Pre-load students for username and class/name lookup
+		byUsername := map[string]uuid.UUID{}
+		byClassName := map[studentKey][]uuid.UUID{}
+		known := map[uuid.UUID]bool{}
+		rows, err := db.Query(ctx,
+			`SELECT s.id, s.class_id, u.username, u.first_name, u.last_name
+			 FROM students s JOIN users u ON u.id = s.user_id WHERE s.school_id = $1`, schoolID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to load students")
+		}
+		for rows.Next() {
+			var id uuid.UUID
+			var classID *uuid.UUID
+			var username, firstName, lastName string
+			if err := rows.Scan(&id, &classID, &username, &firstName, &lastName); err != nil {
+				rows.Close()
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to load students")
+			}
+			known[id] = true
+			byUsername[strings.ToLower(username)] = id
+			if classID != nil {
+				key := studentKey{*classID, strings.ToLower(firstName), strings.ToLower(lastName)}
+				byClassName[key] = append(byClassName[key], id)
+			}
+		}
+		rows.Close()
+
+		resolveStudent := func(row importer.Row) (uuid.UUID, error) {
+			if raw := row.Get("student_id"); raw != "" {
+				id, err := uuid.Parse(raw)
+				if err != nil || !known[id] {
+					return uuid.Nil, importer.Fieldf("student_id", "student '%s' not found", raw)
+				}
+				return id, nil
+			}
+			if username := row.Get("username"); username != "" {
+				id, ok := byUsername[strings.ToLower(username)]
+				if !ok {
+					return uuid.Nil, importer.Fieldf("username", "student '%s' not found", username)
+				}
+				return id, nil
+			}
+			className, firstName, lastName := row.Get("class_name"), row.Get("first_name"), row.Get("last_name")
+			if className == "" || firstName == "" || lastName == "" {
+				return uuid.Nil, importer.Rowf("no student given (username or class_name + first_name + last_name)")
+			}
+			classID, ok := classMap[strings.ToLower(className)]
+			if !ok {
+				return uuid.Nil, importer.Fieldf("class_name", "class '%s' not found", className)
+			}
+			ids := byClassName[studentKey{classID, strings.ToLower(firstName), strings.ToLower(lastName)}]
+			switch len(ids) {
+			case 0:
+				return uuid.Nil, importer.Fieldf("last_name", "no student '%s %s' in class %s", firstName, lastName, className)
+			case 1:
+				return ids[0], nil
+			default:
+				return uuid.Nil, importer.Fieldf("last_name",
+					"%d students named '%s %s' in class %s, use username", len(ids), firstName, lastName, className)
+			}
 		}
 
-		var imported int
-		var errors []string
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to start import")
+		}
+		defer tx.Rollback(ctx)
 
-		for {
-			record, err := reader.Read()
+		err = reader.Each(report, func(row importer.Row) error {
+			studentID, err := resolveStudent(row)
 			if err != nil {
-				break
+				return err
 			}
 
-			// Expected columns: student_id;date_from;date_to;submission_type;reason
-			if len(record) < 4 {
-				errors = append(errors, fmt.Sprintf("row %d: not enough columns", imported+2))
-				continue
+			dateFrom := row.Get("date_from")
+			from, err := time.Parse("2006-01-02", dateFrom)
+			if err != nil {
+				return importer.Fieldf("date_from", "invalid date '%s'", dateFrom)
 			}
-
-			studentID, err := uuid.Parse(strings.TrimSpace(record[0]))
+			dateTo := row.Get("date_to")
+			to, err := time.Parse("2006-01-02", dateTo)
 			if err != nil {
-				errors = append(errors, fmt.Sprintf("row %d: invalid student_id", imported+2))
-				continue
+				return importer.Fieldf("date_to", "invalid date '%s'", dateTo)
 			}
-
-			dateFrom := strings.TrimSpace(record[1])
-			if _, err := time.Parse("2006-01-02", dateFrom); err != nil {
-				errors = append(errors, fmt.Sprintf("row %d: invalid date_from", imported+2))
-				continue
+			if to.Before(from) {
+				return importer.Fieldf("date_to", "date_to before date_from")
 			}
 
-			dateTo := strings.TrimSpace(record[2])
-			if _, err := time.Parse("2006-01-02", dateTo); err != nil {
-				errors = append(errors, fmt.Sprintf("row %d: invalid date_to", imported+2))
-				continue
+			submissionType := row.Get("submission_type")
+			if submissionType == "" {
+				submissionType = "paper"
+			}
+			if submissionType != "paper" && submissionType != "digital" {
+				return importer.Fieldf("submission_type", "must be paper or digital, got '%s'", submissionType)
 			}
 
-			submissionType := strings.TrimSpace(record[3])
 			var reason *string
-			if len(record) > 4 && strings.TrimSpace(record[4]) != "" {
-				r := strings.TrimSpace(record[4])
+			if r := row.Get("reason"); r != "" {
 				reason = &r
 			}
 
@@ -353,18 +512,18 @@ func ImportExcusesCSV(db *pgxpool.Pool) echo.HandlerFunc {
 				SubmissionType: submissionType,
 				Reason:         reason,
 			}
-
-			_, err = svc.Create(c.Request().Context(), schoolID, studentID, input)
-			if err != nil {
-				errors = append(errors, fmt.Sprintf("row %d: %v", imported+2, err))
-				continue
-			}
-			imported++
+			return importer.Savepoint(ctx, tx, func(sp pgx.Tx) error {
+				_, err := svc.CreateTx(ctx, sp, schoolID, studentID, input)
+				return importer.Constraint(err)
+			})
+		})
+		if err != nil {
+			return importFailed(err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]interface{}{
-			"imported": imported,
-			"errors":   errors,
-		})
+		if err := importer.Finish(ctx, tx, report); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit import")
+		}
+		return respondImport(c, report, "excuses")
 	}
 }
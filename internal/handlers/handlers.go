@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -76,7 +77,8 @@ func GetStudentAbsences(db *pgxpool.Pool) echo.HandlerFunc {
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
 		}
-		list, err := svc.GetAbsences(c.Request().Context(), schoolID, id, c.QueryParam("from"), c.QueryParam("to"))
+		list, err := svc.GetAbsences(c.Request().Context(), schoolID, id,
+			c.QueryParam("from"), c.QueryParam("to"), c.QueryParam("status"))
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get absences")
 		}
@@ -97,6 +99,77 @@ func GetStudentExcuses(db *pgxpool.Pool) echo.HandlerFunc {
 	}
 }
 
+func ListStudentGuardians(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewStudentService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" && role != "teacher" {
+			return echo.NewHTTPError(http.StatusForbidden, "teachers/admin only")
+		}
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		list, err := svc.ListGuardians(c.Request().Context(), schoolID, id)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list guardians")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+func AddStudentGuardian(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewStudentService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		var req struct {
+			UserID uuid.UUID `json:"user_id"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		if err := svc.AddGuardian(c.Request().Context(), schoolID, id, req.UserID); err != nil {
+			if errors.Is(err, services.ErrGuardianInvalid) {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to add guardian")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func RemoveStudentGuardian(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewStudentService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		userID, err := uuid.Parse(c.Param("userId"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid user id")
+		}
+		if err := svc.RemoveGuardian(c.Request().Context(), schoolID, id, userID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to remove guardian")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
 // ── Teachers ────────────────────────────────────────────────
 
 func ListTeachers(db *pgxpool.Pool) echo.HandlerFunc {
@@ -129,11 +202,34 @@ func GetTeacher(db *pgxpool.Pool) echo.HandlerFunc {
 
 // ── Substitutions ───────────────────────────────────────────
 
+// substitutionError maps the validation errors of Create and Update. A busy
+// substitute teacher or room answers 409 with the lessons in the way;
+// resending with "force": true stores the substitution anyway.
+func substitutionError(err error) (*echo.HTTPError, bool) {
+	var conflict *services.SubstitutionConflictError
+	switch {
+	case errors.As(err, &conflict):
+		return echo.NewHTTPError(http.StatusConflict, map[string]interface{}{
+			"message":   "substitution conflict",
+			"conflicts": conflict.Conflicts,
+		}), true
+	case errors.Is(err, services.ErrSubstitutionNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error()), true
+	case errors.Is(err, services.ErrSubstitutionExists):
+		return echo.NewHTTPError(http.StatusConflict, err.Error()), true
+	case errors.Is(err, services.ErrSubstitutionInvalid), errors.Is(err, services.ErrSubstitutionDate),
+		errors.Is(err, services.ErrEntryNotFound):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()), true
+	}
+	return nil, false
+}
+
 func ListSubstitutions(db *pgxpool.Pool) echo.HandlerFunc {
 	svc := services.NewSubstitutionService(db)
 	return func(c echo.Context) error {
 		schoolID := c.Get("school_id").(uuid.UUID)
-		list, err := svc.List(c.Request().Context(), schoolID, c.QueryParam("date"), c.QueryParam("from"), c.QueryParam("to"))
+		list, err := svc.List(c.Request().Context(), schoolID, c.QueryParam("date"), c.QueryParam("from"), c.QueryParam("to"),
+			c.QueryParam("pending") == "true")
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list substitutions")
 		}
@@ -155,6 +251,9 @@ func CreateSubstitution(db *pgxpool.Pool) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
 		}
 		sub, err := svc.Create(c.Request().Context(), schoolID, userID, req)
+		if he, ok := substitutionError(err); ok {
+			return he
+		}
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create substitution")
 		}
@@ -179,6 +278,9 @@ func UpdateSubstitution(db *pgxpool.Pool) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
 		}
 		sub, err := svc.Update(c.Request().Context(), schoolID, id, req)
+		if he, ok := substitutionError(err); ok {
+			return he
+		}
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update substitution")
 		}
@@ -248,7 +350,7 @@ func ListLessonContent(db *pgxpool.Pool) echo.HandlerFunc {
 	svc := services.NewLessonService(db)
 	return func(c echo.Context) error {
 		schoolID := c.Get("school_id").(uuid.UUID)
-		list, err := svc.List(c.Request().Context(), schoolID, c.QueryParam("class_id"), c.QueryParam("subject_id"), c.QueryParam("from"), c.QueryParam("to"))
+		list, err := svc.List(c.Request().Context(), schoolID, c.QueryParam("class_id"), c.QueryParam("group_id"), c.QueryParam("subject_id"), c.QueryParam("from"), c.QueryParam("to"))
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list lessons")
 		}
@@ -262,7 +364,7 @@ func ListAppointments(db *pgxpool.Pool) echo.HandlerFunc {
 	svc := services.NewAppointmentService(db)
 	return func(c echo.Context) error {
 		schoolID := c.Get("school_id").(uuid.UUID)
-		list, err := svc.List(c.Request().Context(), schoolID, c.QueryParam("type"), c.QueryParam("class_id"), c.QueryParam("from"), c.QueryParam("to"))
+		list, err := svc.List(c.Request().Context(), schoolID, c.QueryParam("type"), c.QueryParam("class_id"), c.QueryParam("group_id"), c.QueryParam("from"), c.QueryParam("to"))
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list appointments")
 		}
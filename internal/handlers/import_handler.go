@@ -1,18 +1,91 @@
 package handlers
 
 import (
-	"encoding/csv"
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Monstroxx/eduko-backend/internal/importer"
 )
 
+// openImport reads the uploaded CSV header and prepares the report. Both
+// importers accept `dry_run=true` (query or form) to validate without
+// committing.
+func openImport(c echo.Context) (*importer.Reader, *importer.Report, func(), error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return nil, nil, nil, echo.NewHTTPError(http.StatusBadRequest, "CSV file required")
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, nil, nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+	}
+
+	reader, err := importer.NewReader(src)
+	if err != nil {
+		src.Close()
+		return nil, nil, nil, echo.NewHTTPError(http.StatusBadRequest, "invalid CSV: cannot read header")
+	}
+
+	report := importer.NewReport(c.FormValue("dry_run") == "true")
+	return reader, report, func() { src.Close() }, nil
+}
+
+// respondImport returns the import report as JSON, or as a downloadable CSV of
+// the failed rows when `report=csv` is requested.
+func respondImport(c echo.Context, report *importer.Report, name string) error {
+	if c.QueryParam("report") == "csv" {
+		c.Response().Header().Set("Content-Type", "text/csv; charset=utf-8")
+		c.Response().Header().Set("Content-Disposition",
+			fmt.Sprintf("attachment; filename=%s_errors.csv", name))
+		c.Response().WriteHeader(http.StatusOK)
+		return report.WriteCSV(c.Response())
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// importFailed turns an error from importer.Each into a response: a row that
+// failed unexpectedly aborts the import with 500, anything else is a broken
+// CSV.
+func importFailed(err error) error {
+	var rowErr *importer.RowError
+	if errors.As(err, &rowErr) {
+		log.Printf("[import] %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("import failed at row %d", rowErr.Row))
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, "invalid CSV: "+err.Error())
+}
+
+// loadClassMap maps lower-cased class names to IDs.
+func loadClassMap(ctx context.Context, db *pgxpool.Pool, schoolID uuid.UUID) (map[string]uuid.UUID, error) {
+	classMap := map[string]uuid.UUID{}
+	rows, err := db.Query(ctx, `SELECT id, name FROM classes WHERE school_id = $1`, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		classMap[strings.ToLower(strings.TrimSpace(name))] = id
+	}
+	return classMap, rows.Err()
+}
+
 // ImportStudentsCSV handles bulk student import via CSV.
 //
 // Expected CSV format (semicolon-delimited, UTF-8):
@@ -22,6 +95,8 @@ import (
 // - email is optional (can be empty)
 // - class_name must match an existing class name
 // - date_of_birth format: YYYY-MM-DD
+// - dry_run=true validates every row without committing
+// - report=csv returns the failed rows as a CSV instead of JSON
 // - admin-only endpoint
 func ImportStudentsCSV(db *pgxpool.Pool) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -30,121 +105,62 @@ func ImportStudentsCSV(db *pgxpool.Pool) echo.HandlerFunc {
 		if role != "admin" {
 			return echo.NewHTTPError(http.StatusForbidden, "admin only")
 		}
+		ctx := c.Request().Context()
 
-		file, err := c.FormFile("file")
+		reader, report, closeFile, err := openImport(c)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, "CSV file required")
+			return err
 		}
+		defer closeFile()
 
-		src, err := file.Open()
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+		if err := reader.Require("username", "password", "first_name", "last_name", "date_of_birth"); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
-		defer src.Close()
 
-		reader := csv.NewReader(src)
-		reader.Comma = ';'
-		reader.LazyQuotes = true
-		reader.TrimLeadingSpace = true
-
-		// Read header
-		header, err := reader.Read()
+		classMap, err := loadClassMap(ctx, db, schoolID)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, "invalid CSV: cannot read header")
-		}
-
-		// Build column index map
-		colIdx := map[string]int{}
-		for i, h := range header {
-			colIdx[strings.TrimSpace(strings.ToLower(h))] = i
-		}
-
-		// Validate required columns
-		required := []string{"username", "password", "first_name", "last_name", "date_of_birth"}
-		for _, col := range required {
-			if _, ok := colIdx[col]; !ok {
-				return echo.NewHTTPError(http.StatusBadRequest,
-					fmt.Sprintf("missing required column: %s (have: %s)", col, strings.Join(header, ", ")))
-			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to load classes")
 		}
 
-		// Pre-load classes for name→id mapping
-		classMap := map[string]uuid.UUID{}
-		rows, err := db.Query(c.Request().Context(),
-			`SELECT id, name FROM classes WHERE school_id = $1`, schoolID)
+		tx, err := db.Begin(ctx)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to load classes")
-		}
-		for rows.Next() {
-			var id uuid.UUID
-			var name string
-			if err := rows.Scan(&id, &name); err == nil {
-				classMap[strings.ToLower(strings.TrimSpace(name))] = id
-			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to start import")
 		}
-		rows.Close()
+		defer tx.Rollback(ctx)
 
-		var imported int
-		var errors []string
-		rowNum := 1 // 1-indexed, header is row 0
-
-		for {
-			record, err := reader.Read()
-			if err != nil {
-				break
-			}
-			rowNum++
-
-			getCol := func(name string) string {
-				if idx, ok := colIdx[name]; ok && idx < len(record) {
-					return strings.TrimSpace(record[idx])
-				}
-				return ""
-			}
-
-			username := getCol("username")
-			password := getCol("password")
-			firstName := getCol("first_name")
-			lastName := getCol("last_name")
-			email := getCol("email")
-			className := getCol("class_name")
-			dobStr := getCol("date_of_birth")
+		err = reader.Each(report, func(row importer.Row) error {
+			username := row.Get("username")
+			password := row.Get("password")
+			firstName := row.Get("first_name")
+			lastName := row.Get("last_name")
+			email := row.Get("email")
+			className := row.Get("class_name")
+			dobStr := row.Get("date_of_birth")
 
 			// Validate
 			if username == "" || password == "" || firstName == "" || lastName == "" {
-				errors = append(errors, fmt.Sprintf("row %d: missing required fields", rowNum))
-				continue
+				return importer.Rowf("missing required fields")
 			}
 
 			dob, err := time.Parse("2006-01-02", dobStr)
 			if err != nil {
-				errors = append(errors, fmt.Sprintf("row %d: invalid date_of_birth '%s'", rowNum, dobStr))
-				continue
+				return importer.Fieldf("date_of_birth", "invalid date '%s'", dobStr)
 			}
 
 			// Resolve class
 			var classID *uuid.UUID
 			if className != "" {
-				if id, ok := classMap[strings.ToLower(className)]; ok {
-					classID = &id
-				} else {
-					errors = append(errors, fmt.Sprintf("row %d: class '%s' not found", rowNum, className))
-					continue
+				id, ok := classMap[strings.ToLower(className)]
+				if !ok {
+					return importer.Fieldf("class_name", "class '%s' not found", className)
 				}
+				classID = &id
 			}
 
 			// Hash password
 			hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 			if err != nil {
-				errors = append(errors, fmt.Sprintf("row %d: password hash error", rowNum))
-				continue
-			}
-
-			// Transaction: create user + student
-			tx, err := db.Begin(c.Request().Context())
-			if err != nil {
-				errors = append(errors, fmt.Sprintf("row %d: tx error", rowNum))
-				continue
+				return importer.Fieldf("password", "password hash error")
 			}
 
 			var emailPtr *string
@@ -152,46 +168,40 @@ func ImportStudentsCSV(db *pgxpool.Pool) echo.HandlerFunc {
 				emailPtr = &email
 			}
 
-			var userID uuid.UUID
-			err = tx.QueryRow(c.Request().Context(),
-				`INSERT INTO users (school_id, email, username, password_hash, role, first_name, last_name)
-				 VALUES ($1, $2, $3, $4, 'student', $5, $6)
-				 RETURNING id`,
-				schoolID, emailPtr, username, string(hash), firstName, lastName,
-			).Scan(&userID)
-			if err != nil {
-				tx.Rollback(c.Request().Context())
-				if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
-					errors = append(errors, fmt.Sprintf("row %d: user '%s' already exists", rowNum, username))
-				} else {
-					errors = append(errors, fmt.Sprintf("row %d: user create error: %v", rowNum, err))
+			// Savepoint: create user + student
+			return importer.Savepoint(ctx, tx, func(sp pgx.Tx) error {
+				var userID uuid.UUID
+				err := sp.QueryRow(ctx,
+					`INSERT INTO users (school_id, email, username, password_hash, role, first_name, last_name)
+					 VALUES ($1, $2, $3, $4, 'student', $5, $6)
+					 RETURNING id`,
+					schoolID, emailPtr, username, string(hash), firstName, lastName,
+				).Scan(&userID)
+				if err != nil {
+					if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
+						return importer.Fieldf("username", "user '%s' already exists", username)
+					}
+					return importer.Constraint(fmt.Errorf("create user: %w", err))
 				}
-				continue
-			}
 
-			_, err = tx.Exec(c.Request().Context(),
-				`INSERT INTO students (user_id, school_id, class_id, date_of_birth, attestation_required)
-				 VALUES ($1, $2, $3, $4, false)`,
-				userID, schoolID, classID, dob,
-			)
-			if err != nil {
-				tx.Rollback(c.Request().Context())
-				errors = append(errors, fmt.Sprintf("row %d: student create error: %v", rowNum, err))
-				continue
-			}
-
-			if err := tx.Commit(c.Request().Context()); err != nil {
-				errors = append(errors, fmt.Sprintf("row %d: commit error", rowNum))
-				continue
-			}
-
-			imported++
+				_, err = sp.Exec(ctx,
+					`INSERT INTO students (user_id, school_id, class_id, date_of_birth, attestation_required)
+					 VALUES ($1, $2, $3, $4, false)`,
+					userID, schoolID, classID, dob,
+				)
+				if err != nil {
+					return importer.Constraint(fmt.Errorf("create student: %w", err))
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return importFailed(err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]interface{}{
-			"imported": imported,
-			"errors":   errors,
-			"total":    rowNum - 1,
-		})
+		if err := importer.Finish(ctx, tx, report); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit import")
+		}
+		return respondImport(c, report, "students")
 	}
 }
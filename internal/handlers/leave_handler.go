@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/encryption"
+	"github.com/Monstroxx/eduko-backend/internal/models"
+	"github.com/Monstroxx/eduko-backend/internal/scanner"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+	"github.com/Monstroxx/eduko-backend/internal/storage"
+)
+
+// studentIDForUser resolves the students.id of the authenticated user.
+func studentIDForUser(c echo.Context, db *pgxpool.Pool) (uuid.UUID, error) {
+	var studentID uuid.UUID
+	err := db.QueryRow(c.Request().Context(),
+		`SELECT id FROM students WHERE user_id = $1 AND school_id = $2`,
+		c.Get("user_id").(uuid.UUID), c.Get("school_id").(uuid.UUID),
+	).Scan(&studentID)
+	return studentID, err
+}
+
+// isGuardianOf reports whether the authenticated user is a guardian of the
+// student.
+func isGuardianOf(c echo.Context, db *pgxpool.Pool, studentID uuid.UUID) bool {
+	var ok bool
+	err := db.QueryRow(c.Request().Context(),
+		`SELECT EXISTS(SELECT 1 FROM student_guardians g JOIN students s ON s.id = g.student_id
+		                WHERE g.student_id = $1 AND g.user_id = $2 AND s.school_id = $3)`,
+		studentID, c.Get("user_id").(uuid.UUID), c.Get("school_id").(uuid.UUID),
+	).Scan(&ok)
+	return err == nil && ok
+}
+
+// canSeeLeave restricts students to their own leave requests and guardians
+// to their children's.
+func canSeeLeave(c echo.Context, db *pgxpool.Pool, leave *models.LeaveRequest) bool {
+	switch c.Get("role").(string) {
+	case "student":
+		id, err := studentIDForUser(c, db)
+		return err == nil && id == leave.StudentID
+	case "guardian":
+		return isGuardianOf(c, db, leave.StudentID)
+	}
+	return true
+}
+
+func leaveError(err error, fallback string) error {
+	switch {
+	case errors.Is(err, services.ErrLeaveNotPending):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrLeaveNotApprover):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrLeaveInvalidRange):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, fallback)
+}
+
+func CreateLeaveRequest(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewLeaveService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		userID := c.Get("user_id").(uuid.UUID)
+		role := c.Get("role").(string)
+
+		var req services.CreateLeaveInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		if req.Reason == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "reason required")
+		}
+
+		// Students apply for themselves; guardians for their children;
+		// teachers/admins on behalf of a student.
+		var studentID uuid.UUID
+		switch {
+		case role == "student":
+			id, err := studentIDForUser(c, db)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "user is not a student")
+			}
+			studentID = id
+		case req.StudentID == nil:
+			return echo.NewHTTPError(http.StatusBadRequest, "student_id required")
+		case role == "guardian":
+			if !isGuardianOf(c, db, *req.StudentID) {
+				return echo.NewHTTPError(http.StatusBadRequest, "student not found")
+			}
+			studentID = *req.StudentID
+		default:
+			var exists bool
+			err := db.QueryRow(c.Request().Context(),
+				`SELECT EXISTS(SELECT 1 FROM students WHERE id = $1 AND school_id = $2)`,
+				*req.StudentID, schoolID,
+			).Scan(&exists)
+			if err != nil || !exists {
+				return echo.NewHTTPError(http.StatusBadRequest, "student not found")
+			}
+			studentID = *req.StudentID
+		}
+
+		leave, err := svc.Create(c.Request().Context(), schoolID, studentID, userID, req)
+		if err != nil {
+			return leaveError(err, "failed to create leave request")
+		}
+		return c.JSON(http.StatusCreated, leave)
+	}
+}
+
+func ListLeaveRequests(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewLeaveService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+
+		studentID := c.QueryParam("student_id")
+		guardianID := ""
+		switch role {
+		case "student":
+			id, err := studentIDForUser(c, db)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusForbidden, "user is not a student")
+			}
+			studentID = id.String()
+		case "guardian":
+			guardianID = c.Get("user_id").(uuid.UUID).String()
+		}
+
+		list, err := svc.List(c.Request().Context(), schoolID, c.QueryParam("status"), studentID, c.QueryParam("class_id"), guardianID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list leave requests")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+func GetLeaveRequest(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewLeaveService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		leaveID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+
+		leave, err := svc.GetByID(c.Request().Context(), schoolID, leaveID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, "leave request not found")
+		}
+		if !canSeeLeave(c, db, leave) {
+			return echo.NewHTTPError(http.StatusNotFound, "leave request not found")
+		}
+		return c.JSON(http.StatusOK, leave)
+	}
+}
+
+func ApproveLeaveRequest(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewLeaveService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		userID := c.Get("user_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "teacher" && role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "teachers only")
+		}
+
+		leaveID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+
+		var req struct {
+			Note *string `json:"note,omitempty"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+
+		leave, err := svc.Approve(c.Request().Context(), schoolID, leaveID, userID, role, req.Note)
+		if err != nil {
+			return leaveError(err, "failed to approve leave request")
+		}
+		return c.JSON(http.StatusOK, leave)
+	}
+}
+
+func RejectLeaveRequest(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewLeaveService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		userID := c.Get("user_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "teacher" && role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "teachers only")
+		}
+
+		leaveID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+
+		var req struct {
+			Reason *string `json:"reason,omitempty"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+
+		leave, err := svc.Reject(c.Request().Context(), schoolID, leaveID, userID, role, req.Reason)
+		if err != nil {
+			return leaveError(err, "failed to reject leave request")
+		}
+		return c.JSON(http.StatusOK, leave)
+	}
+}
+
+// UploadLeaveFile attaches a supporting document (invitation, competition
+// notice, ...) to a leave request. Multipart form: file + leave_request_id.
+func UploadLeaveFile(db *pgxpool.Pool, store storage.Store, scan scanner.Scanner) echo.HandlerFunc {
+	svc := services.NewLeaveService(db)
+	keys := encryption.NewKeys(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		leaveID, err := uuid.Parse(c.FormValue("leave_request_id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid leave_request_id")
+		}
+
+		leave, err := svc.GetByID(c.Request().Context(), schoolID, leaveID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, "leave request not found")
+		}
+		if !canSeeLeave(c, db, leave) {
+			return echo.NewHTTPError(http.StatusNotFound, "leave request not found")
+		}
+
+		file, err := c.FormFile("file")
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "file required")
+		}
+
+		up, err := saveUpload(c.Request().Context(), store, keys, scan, schoolID, file)
+		if err != nil {
+			return err
+		}
+		// Leave proofs have no quarantine state, so they need a verdict now.
+		if up.ScanStatus == scanner.StatusPending {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "virus scanner unavailable, try again later")
+		}
+
+		if err := svc.SetFile(c.Request().Context(), schoolID, leaveID, up.Key, up.DataKeyID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update leave request")
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{
+			"message":   "file uploaded",
+			"file_path": up.Key,
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+const (
+	notificationsDefaultLimit = 50
+	notificationsMaxLimit     = 200
+)
+
+// ListNotifications returns the user's newest notifications, rendered in
+// ?lang or the user's language. ?unread=true leaves out read ones.
+func ListNotifications(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewNotificationService(db)
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		limit := notificationsDefaultLimit
+		if v := c.QueryParam("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > notificationsMaxLimit {
+				return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and 200")
+			}
+			limit = n
+		}
+		unread := c.QueryParam("unread") == "true"
+		list, err := svc.List(c.Request().Context(), userID, unread, limit, c.QueryParam("lang"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list notifications")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+func GetUnreadNotificationCount(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewNotificationService(db)
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		n, err := svc.UnreadCount(c.Request().Context(), userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to count notifications")
+		}
+		return c.JSON(http.StatusOK, map[string]int{"unread": n})
+	}
+}
+
+func MarkNotificationRead(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewNotificationService(db)
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		err = svc.MarkRead(c.Request().Context(), userID, id)
+		switch {
+		case errors.Is(err, services.ErrNotificationNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case err != nil:
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to mark notification read")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func MarkAllNotificationsRead(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewNotificationService(db)
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		n, err := svc.MarkAllRead(c.Request().Context(), userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to mark notifications read")
+		}
+		return c.JSON(http.StatusOK, map[string]int64{"marked": n})
+	}
+}
+
+func GetNotificationPreferences(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewNotificationService(db)
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		prefs, err := svc.Preferences(c.Request().Context(), userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get preferences")
+		}
+		return c.JSON(http.StatusOK, prefs)
+	}
+}
+
+// UpdateNotificationPreferences sets whether categories also go out by
+// e-mail or push; categories left out keep their setting.
+func UpdateNotificationPreferences(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewNotificationService(db)
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		var req []models.NotificationPreference
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		prefs, err := svc.SetPreferences(c.Request().Context(), userID, req)
+		switch {
+		case errors.Is(err, services.ErrNotificationCategory):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case err != nil:
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to save preferences")
+		}
+		return c.JSON(http.StatusOK, prefs)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -79,9 +80,34 @@ func UpdateSchoolSettings(db *pgxpool.Pool) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
 		}
 
+		if err := services.ValidateSetting(req.Key, req.Value); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
 		if err := svc.UpdateSetting(c.Request().Context(), schoolID, req.Key, req.Value); err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update setting")
 		}
 		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
 	}
 }
+
+// PreviewRetention reports what the retention job would delete or anonymize
+// for the school right now, without changing anything (admin only).
+func PreviewRetention(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewRetentionService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		if c.Get("role").(string) != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+
+		report, _, err := svc.Purge(c.Request().Context(), schoolID, true)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidRetentionPolicy) {
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to compute retention preview")
+		}
+		return c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/display"
+	"github.com/Monstroxx/eduko-backend/internal/i18n"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+const (
+	maxPlanDays        = 31
+	displayRefreshSecs = 300
+)
+
+// GetSubstitutionPlan returns the substitutions from ?from= to ?to= (default
+// today) grouped by date and class, with names instead of IDs.
+func GetSubstitutionPlan(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewSubstitutionService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		var err error
+		from := time.Now().UTC().Truncate(24 * time.Hour)
+		if v := c.QueryParam("from"); v != "" {
+			if from, err = time.Parse("2006-01-02", v); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid from")
+			}
+		}
+		to := from
+		if v := c.QueryParam("to"); v != "" {
+			if to, err = time.Parse("2006-01-02", v); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid to")
+			}
+		}
+		if to.Before(from) || to.Sub(from) >= maxPlanDays*24*time.Hour {
+			return echo.NewHTTPError(http.StatusBadRequest, "range must be 1 to 31 days")
+		}
+		plan, err := svc.Plan(c.Request().Context(), schoolID, from, to)
+		if errors.Is(err, services.ErrInvalidABReference) {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get substitution plan")
+		}
+		return c.JSON(http.StatusOK, plan)
+	}
+}
+
+func ListDisplayFeeds(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewDisplayFeedService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		list, err := svc.List(c.Request().Context(), schoolID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list displays")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateDisplayFeed sets up a hallway monitor. The token is only shown here.
+func CreateDisplayFeed(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewDisplayFeedService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		var req services.CreateDisplayFeedInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		token, feed, err := svc.Create(c.Request().Context(), schoolID, req)
+		if errors.Is(err, services.ErrDisplayInvalid) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create display")
+		}
+		path := "/display/" + token + ".html"
+		return c.JSON(http.StatusCreated, map[string]interface{}{
+			"id":         feed.ID,
+			"school_id":  feed.SchoolID,
+			"name":       feed.Name,
+			"days_ahead": feed.DaysAhead,
+			"created_at": feed.CreatedAt,
+			"token":      token,
+			"path":       path,
+			"url":        c.Scheme() + "://" + c.Request().Host + path,
+		})
+	}
+}
+
+func DeleteDisplayFeed(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewDisplayFeedService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		err = svc.Delete(c.Request().Context(), schoolID, id)
+		if errors.Is(err, services.ErrDisplayNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete display")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// ServeDisplay renders /display/<token>.json or /display/<token>.html for a
+// hallway monitor. No JWT; the secret token authorizes the request.
+func ServeDisplay(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewDisplayFeedService(db)
+	return func(c echo.Context) error {
+		file := c.Param("file")
+		token, html := strings.CutSuffix(file, ".html")
+		if !html {
+			var ok bool
+			if token, ok = strings.CutSuffix(file, ".json"); !ok {
+				return echo.NewHTTPError(http.StatusNotFound, "display not found")
+			}
+		}
+		if token == "" {
+			return echo.NewHTTPError(http.StatusNotFound, "display not found")
+		}
+
+		d, err := svc.Show(c.Request().Context(), token, time.Now())
+		if errors.Is(err, services.ErrDisplayNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "display not found")
+		}
+		if errors.Is(err, services.ErrInvalidABReference) {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to load display")
+		}
+		c.Response().Header().Set("Cache-Control", "no-store")
+		if !html {
+			return c.JSON(http.StatusOK, d)
+		}
+
+		tr := i18n.For(c.QueryParam("lang"), d.Locale)
+		var buf bytes.Buffer
+		if err := display.Write(&buf, d, tr, displayRefreshSecs); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to render display")
+		}
+		return c.HTMLBlob(http.StatusOK, buf.Bytes())
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+func ListTeacherAbsences(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTeacherAbsenceService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		teacherID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		list, err := svc.List(c.Request().Context(), schoolID, teacherID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list absences")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateTeacherAbsence records an absence and opens a substitution for each
+// of the teacher's lessons in it.
+func CreateTeacherAbsence(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTeacherAbsenceService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		userID := c.Get("user_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		teacherID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		var req services.CreateTeacherAbsenceInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		absence, err := svc.Create(c.Request().Context(), schoolID, teacherID, userID, req)
+		switch {
+		case errors.Is(err, services.ErrAbsenceInvalid):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrTeacherNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case errors.Is(err, services.ErrAbsenceOverlap):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		case err != nil:
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create absence")
+		}
+		return c.JSON(http.StatusCreated, absence)
+	}
+}
+
+func DeleteTeacherAbsence(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTeacherAbsenceService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		teacherID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		absenceID, err := uuid.Parse(c.Param("absenceId"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid absence id")
+		}
+		err = svc.Delete(c.Request().Context(), schoolID, teacherID, absenceID)
+		if errors.Is(err, services.ErrAbsenceNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete absence")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// ListSubstituteCandidates ranks the teachers free to cover a substitution.
+func ListSubstituteCandidates(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTeacherAbsenceService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		list, err := svc.Candidates(c.Request().Context(), schoolID, id)
+		switch {
+		case errors.Is(err, services.ErrSubstitutionNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case errors.Is(err, services.ErrSubstitutionNoLesson):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		case err != nil:
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list candidates")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+// ConfirmSubstitutes assigns substitute teachers to several substitutions at
+// once.
+func ConfirmSubstitutes(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTeacherAbsenceService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		var req []services.ConfirmSubstituteInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		list, err := svc.Confirm(c.Request().Context(), schoolID, req)
+		switch {
+		case errors.Is(err, services.ErrConfirmInvalid):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrSubstituteBusy):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		case err != nil:
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to confirm substitutes")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+// draftError maps the errors shared by the draft endpoints; ok is false for
+// unexpected errors.
+func draftError(err error) (*echo.HTTPError, bool) {
+	switch {
+	case errors.Is(err, services.ErrDraftNotFound), errors.Is(err, services.ErrDraftEntryNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error()), true
+	case errors.Is(err, services.ErrDraftPublished), errors.Is(err, services.ErrDraftOutdated):
+		return echo.NewHTTPError(http.StatusConflict, err.Error()), true
+	case errors.Is(err, services.ErrDraftInvalid), errors.Is(err, services.ErrDraftPastDate),
+		errors.Is(err, services.ErrTimetableNoAudience), errors.Is(err, services.ErrTimetableBlock),
+		errors.Is(err, services.ErrTimetableRange), errors.Is(err, services.ErrEpochNotFound):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()), true
+	}
+	return nil, false
+}
+
+// draftParams checks the admin role and parses :id and, with entry set,
+// :entryId.
+func draftParams(c echo.Context, entry bool) (draftID, entryID uuid.UUID, err error) {
+	if c.Get("role").(string) != "admin" {
+		return draftID, entryID, echo.NewHTTPError(http.StatusForbidden, "admin only")
+	}
+	if draftID, err = uuid.Parse(c.Param("id")); err != nil {
+		return draftID, entryID, echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	if entry {
+		if entryID, err = uuid.Parse(c.Param("entryId")); err != nil {
+			return draftID, entryID, echo.NewHTTPError(http.StatusBadRequest, "invalid entry id")
+		}
+	}
+	return draftID, entryID, nil
+}
+
+func ListTimetableDrafts(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableDraftService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		status := c.QueryParam("status")
+		if status != "" && status != "draft" && status != "published" {
+			return echo.NewHTTPError(http.StatusBadRequest, "status must be draft or published")
+		}
+		list, err := svc.List(c.Request().Context(), schoolID, status)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list drafts")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateTimetableDraft starts a draft as a copy of the plan valid from
+// effective_from.
+func CreateTimetableDraft(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableDraftService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		userID := c.Get("user_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		var req services.CreateDraftInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		draft, err := svc.Create(c.Request().Context(), schoolID, userID, req)
+		if he, ok := draftError(err); ok {
+			return he
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create draft")
+		}
+		return c.JSON(http.StatusCreated, draft)
+	}
+}
+
+func GetTimetableDraft(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableDraftService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		draftID, _, err := draftParams(c, false)
+		if err != nil {
+			return err
+		}
+		draft, err := svc.Get(c.Request().Context(), schoolID, draftID)
+		if he, ok := draftError(err); ok {
+			return he
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get draft")
+		}
+		return c.JSON(http.StatusOK, draft)
+	}
+}
+
+func DeleteTimetableDraft(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableDraftService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		draftID, _, err := draftParams(c, false)
+		if err != nil {
+			return err
+		}
+		err = svc.Delete(c.Request().Context(), schoolID, draftID)
+		if he, ok := draftError(err); ok {
+			return he
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete draft")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func CreateTimetableDraftEntry(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableDraftService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		draftID, _, err := draftParams(c, false)
+		if err != nil {
+			return err
+		}
+		var req services.CreateTimetableInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		entry, err := svc.CreateEntry(c.Request().Context(), schoolID, draftID, req)
+		if he, ok := draftError(err); ok {
+			return he
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create entry")
+		}
+		return c.JSON(http.StatusCreated, entry)
+	}
+}
+
+func UpdateTimetableDraftEntry(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableDraftService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		draftID, entryID, err := draftParams(c, true)
+		if err != nil {
+			return err
+		}
+		var req services.CreateTimetableInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		entry, err := svc.UpdateEntry(c.Request().Context(), schoolID, draftID, entryID, req)
+		if he, ok := draftError(err); ok {
+			return he
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update entry")
+		}
+		return c.JSON(http.StatusOK, entry)
+	}
+}
+
+func DeleteTimetableDraftEntry(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableDraftService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		draftID, entryID, err := draftParams(c, true)
+		if err != nil {
+			return err
+		}
+		err = svc.DeleteEntry(c.Request().Context(), schoolID, draftID, entryID)
+		if he, ok := draftError(err); ok {
+			return he
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete entry")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// GetTimetableDraftDiff compares a draft with the published plan from
+// ?date= (default the draft's effective date) on.
+func GetTimetableDraftDiff(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableDraftService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		draftID, _, err := draftParams(c, false)
+		if err != nil {
+			return err
+		}
+		diff, err := svc.Diff(c.Request().Context(), schoolID, draftID, c.QueryParam("date"))
+		if he, ok := draftError(err); ok {
+			return he
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to compare draft")
+		}
+		return c.JSON(http.StatusOK, diff)
+	}
+}
+
+// GetTimetableDraftConflicts lists the double bookings within a draft.
+func GetTimetableDraftConflicts(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableDraftService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		draftID, _, err := draftParams(c, false)
+		if err != nil {
+			return err
+		}
+		conflicts, err := svc.Conflicts(c.Request().Context(), schoolID, draftID, c.QueryParam("date"))
+		if he, ok := draftError(err); ok {
+			return he
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to check draft")
+		}
+		return c.JSON(http.StatusOK, conflicts)
+	}
+}
+
+// PublishTimetableDraft makes the draft the timetable from its effective
+// date on. A draft with conflicts answers 409 unless "force" is set.
+func PublishTimetableDraft(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableDraftService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		userID := c.Get("user_id").(uuid.UUID)
+		draftID, _, err := draftParams(c, false)
+		if err != nil {
+			return err
+		}
+		var req services.PublishDraftInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		result, err := svc.Publish(c.Request().Context(), schoolID, draftID, userID, req)
+		if he, ok := draftError(err); ok {
+			return he
+		}
+		var conflict *services.ConflictError
+		if errors.As(err, &conflict) {
+			return timetableConflict(c, conflict)
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to publish draft")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -14,8 +16,20 @@ func GetTimetable(db *pgxpool.Pool) echo.HandlerFunc {
 	svc := services.NewTimetableService(db)
 	return func(c echo.Context) error {
 		schoolID := c.Get("school_id").(uuid.UUID)
-		entries, err := svc.GetEnriched(c.Request().Context(), schoolID,
-			c.QueryParam("class_id"), c.QueryParam("teacher_id"), c.QueryParam("date"))
+		f, err := timetableFilter(c, db)
+		if err != nil {
+			return err
+		}
+		if date := c.QueryParam("date"); date != "" {
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid date")
+			}
+		}
+		weekType := c.QueryParam("week_type")
+		if weekType != "" && weekType != "A" && weekType != "B" {
+			return echo.NewHTTPError(http.StatusBadRequest, "week_type must be A or B")
+		}
+		entries, err := svc.GetEnriched(c.Request().Context(), schoolID, f, c.QueryParam("date"), weekType)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get timetable")
 		}
@@ -23,6 +37,131 @@ func GetTimetable(db *pgxpool.Pool) echo.HandlerFunc {
 	}
 }
 
+// timetableFilter reads the optional class_id, student_id and teacher_id
+// query parameters. Students without a filter get their own timetable,
+// including their course groups.
+func timetableFilter(c echo.Context, db *pgxpool.Pool) (services.TimetableFilter, error) {
+	var f services.TimetableFilter
+	for _, p := range []struct {
+		name string
+		dst  **uuid.UUID
+	}{{"class_id", &f.ClassID}, {"student_id", &f.StudentID}, {"teacher_id", &f.TeacherID}} {
+		v := c.QueryParam(p.name)
+		if v == "" {
+			continue
+		}
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return f, echo.NewHTTPError(http.StatusBadRequest, "invalid "+p.name)
+		}
+		*p.dst = &id
+	}
+	if c.Get("role").(string) == "student" && f.ClassID == nil && f.StudentID == nil && f.TeacherID == nil {
+		studentID, err := studentIDForUser(c, db)
+		if err != nil {
+			return f, echo.NewHTTPError(http.StatusForbidden, "no student record for user")
+		}
+		f.StudentID = &studentID
+	}
+	return f, nil
+}
+
+// timetableDate parses the date query parameter name, by default today in
+// the school's time zone.
+func timetableDate(c echo.Context, schools *services.SchoolService, schoolID uuid.UUID, name string) (time.Time, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		today, err := schools.Today(c.Request().Context(), schoolID)
+		if err != nil {
+			return today, echo.NewHTTPError(http.StatusInternalServerError, "failed to get timetable")
+		}
+		return today, nil
+	}
+	date, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return date, echo.NewHTTPError(http.StatusBadRequest, "invalid "+name)
+	}
+	return date, nil
+}
+
+// GetTimetableDay returns the lessons that actually take place on ?date=
+// (default today), with A/B weeks, holidays and substitutions applied.
+func GetTimetableDay(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableService(db)
+	schools := services.NewSchoolService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		f, err := timetableFilter(c, db)
+		if err != nil {
+			return err
+		}
+		date, err := timetableDate(c, schools, schoolID, "date")
+		if err != nil {
+			return err
+		}
+		day, err := svc.Day(c.Request().Context(), schoolID, f, date)
+		if errors.Is(err, services.ErrInvalidABReference) {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get timetable")
+		}
+		return c.JSON(http.StatusOK, day)
+	}
+}
+
+// GetTimetableWeek returns Monday to Sunday of the week containing ?start=
+// (default the current week).
+func GetTimetableWeek(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableService(db)
+	schools := services.NewSchoolService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		f, err := timetableFilter(c, db)
+		if err != nil {
+			return err
+		}
+		start, err := timetableDate(c, schools, schoolID, "start")
+		if err != nil {
+			return err
+		}
+		week, err := svc.Week(c.Request().Context(), schoolID, f, start)
+		if errors.Is(err, services.ErrInvalidABReference) {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get timetable")
+		}
+		return c.JSON(http.StatusOK, week)
+	}
+}
+
+// timetableConflict answers 409 with the entries that are already booked.
+// Resending the request with "force": true stores the entry anyway.
+func timetableConflict(c echo.Context, err *services.ConflictError) error {
+	return c.JSON(http.StatusConflict, map[string]interface{}{
+		"message":   "timetable conflict",
+		"conflicts": err.Conflicts,
+	})
+}
+
+// GetTimetableConflicts lists all double bookings of the school (admin only).
+func GetTimetableConflicts(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		conflicts, err := svc.Conflicts(c.Request().Context(), schoolID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to check timetable")
+		}
+		return c.JSON(http.StatusOK, conflicts)
+	}
+}
+
 func CreateTimetableEntry(db *pgxpool.Pool) echo.HandlerFunc {
 	svc := services.NewTimetableService(db)
 	return func(c echo.Context) error {
@@ -36,6 +175,14 @@ func CreateTimetableEntry(db *pgxpool.Pool) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
 		}
 		entry, err := svc.Create(c.Request().Context(), schoolID, req)
+		if errors.Is(err, services.ErrTimetableNoAudience) || errors.Is(err, services.ErrTimetableBlock) ||
+			errors.Is(err, services.ErrTimetableRange) || errors.Is(err, services.ErrEpochNotFound) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		var conflict *services.ConflictError
+		if errors.As(err, &conflict) {
+			return timetableConflict(c, conflict)
+		}
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create entry")
 		}
@@ -60,6 +207,14 @@ func UpdateTimetableEntry(db *pgxpool.Pool) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
 		}
 		entry, err := svc.Update(c.Request().Context(), schoolID, entryID, req)
+		if errors.Is(err, services.ErrTimetableNoAudience) || errors.Is(err, services.ErrTimetableBlock) ||
+			errors.Is(err, services.ErrTimetableRange) || errors.Is(err, services.ErrEpochNotFound) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		var conflict *services.ConflictError
+		if errors.As(err, &conflict) {
+			return timetableConflict(c, conflict)
+		}
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update entry")
 		}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/asc"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+	"github.com/Monstroxx/eduko-backend/internal/untis"
+)
+
+// importOptions reads the form values shared by the timetable importers:
+// school_year (required), valid_from (default today), valid_until and
+// dry_run.
+func importOptions(c echo.Context) (services.ImportOptions, error) {
+	opts := services.ImportOptions{
+		SchoolYear: c.FormValue("school_year"),
+		ValidFrom:  time.Now().UTC().Truncate(24 * time.Hour),
+		DryRun:     c.FormValue("dry_run") == "true",
+	}
+	if v := c.FormValue("valid_from"); v != "" {
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, "invalid valid_from")
+		}
+		opts.ValidFrom = d
+	}
+	if v := c.FormValue("valid_until"); v != "" {
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil || d.Before(opts.ValidFrom) {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, "invalid valid_until")
+		}
+		opts.ValidUntil = &d
+	}
+	return opts, nil
+}
+
+// ImportUntis takes over a timetable from Untis GPU exports (admin only).
+// The files are uploaded as the form fields gpu001 (timetable), gpu003
+// (classes), gpu004 (teachers), gpu005 (rooms), gpu006 (subjects) and
+// time_grid; each is optional. dry_run=true returns the changes without
+// storing them.
+func ImportUntis(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableImportService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		opts, err := importOptions(c)
+		if err != nil {
+			return err
+		}
+
+		var data untis.Data
+		found := false
+		for _, f := range []struct {
+			field string
+			read  func(io.Reader) error
+		}{
+			{"time_grid", data.ReadTimeGrid},
+			{"gpu006", data.ReadSubjects},
+			{"gpu005", data.ReadRooms},
+			{"gpu003", data.ReadClasses},
+			{"gpu004", data.ReadTeachers},
+			{"gpu001", data.ReadTimetable},
+		} {
+			file, err := c.FormFile(f.field)
+			if errors.Is(err, http.ErrMissingFile) {
+				continue
+			}
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid upload")
+			}
+			src, err := file.Open()
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+			}
+			err = f.read(src)
+			src.Close()
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			found = true
+		}
+		if !found {
+			return echo.NewHTTPError(http.StatusBadRequest, untis.ErrEmpty.Error())
+		}
+
+		report, err := svc.Import(c.Request().Context(), schoolID, services.FromUntis(&data), opts)
+		if errors.Is(err, services.ErrImportSchoolYear) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to import timetable")
+		}
+		return c.JSON(http.StatusOK, report)
+	}
+}
+
+// ImportASc takes over a timetable from an aSc Timetables XML export
+// uploaded as the form field file (admin only), with the same options and
+// report as ImportUntis.
+func ImportASc(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableImportService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		opts, err := importOptions(c)
+		if err != nil {
+			return err
+		}
+
+		file, err := c.FormFile("file")
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "XML file required")
+		}
+		src, err := file.Open()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+		}
+		defer src.Close()
+		timetable, err := asc.Parse(src)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		report, err := svc.Import(c.Request().Context(), schoolID, services.FromASc(timetable), opts)
+		if errors.Is(err, services.ErrImportSchoolYear) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to import timetable")
+		}
+		return c.JSON(http.StatusOK, report)
+	}
+}
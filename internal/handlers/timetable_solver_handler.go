@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+func ListTeachingAssignments(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableSolverService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		list, err := svc.ListAssignments(c.Request().Context(), schoolID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list assignments")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+// ReplaceTeachingAssignments replaces all teaching assignments with the
+// request's list.
+func ReplaceTeachingAssignments(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableSolverService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		var req []services.TeachingAssignmentInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		list, err := svc.ReplaceAssignments(c.Request().Context(), schoolID, req)
+		if errors.Is(err, services.ErrAssignmentInvalid) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to save assignments")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+func ListTeacherUnavailability(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableSolverService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		list, err := svc.ListUnavailability(c.Request().Context(), schoolID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list unavailability")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+// ReplaceTeacherUnavailability replaces the teachers' unavailable times with
+// the request's list.
+func ReplaceTeacherUnavailability(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableSolverService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		var req []services.UnavailabilityInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		list, err := svc.ReplaceUnavailability(c.Request().Context(), schoolID, req)
+		if errors.Is(err, services.ErrUnavailabilityInvalid) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to save unavailability")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+func ListSolverRuns(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableSolverService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		list, err := svc.ListRuns(c.Request().Context(), schoolID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list solver runs")
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateSolverRun queues a run of the timetable solver; the background job
+// picks it up. Poll GET /timetable/solver/runs/:id for its progress.
+func CreateSolverRun(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableSolverService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		userID := c.Get("user_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		var req services.CreateSolverRunInput
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+		}
+		run, err := svc.CreateRun(c.Request().Context(), schoolID, userID, req)
+		if errors.Is(err, services.ErrSolverRunInvalid) || errors.Is(err, services.ErrSolverNoAssignments) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to start solver")
+		}
+		return c.JSON(http.StatusAccepted, run)
+	}
+}
+
+func GetSolverRun(db *pgxpool.Pool) echo.HandlerFunc {
+	svc := services.NewTimetableSolverService(db)
+	return func(c echo.Context) error {
+		schoolID := c.Get("school_id").(uuid.UUID)
+		role := c.Get("role").(string)
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "admin only")
+		}
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+		}
+		run, err := svc.GetRun(c.Request().Context(), schoolID, id)
+		if errors.Is(err, services.ErrSolverRunNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get solver run")
+		}
+		return c.JSON(http.StatusOK, run)
+	}
+}
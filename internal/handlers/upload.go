@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Monstroxx/eduko-backend/internal/encryption"
+	"github.com/Monstroxx/eduko-backend/internal/scanner"
+	"github.com/Monstroxx/eduko-backend/internal/storage"
+	"github.com/Monstroxx/eduko-backend/internal/uploads"
+)
+
+const maxUploadSize = 10 << 20 // 10MB
+
+// upload is a validated, stored multipart file. SHA256 and Size describe the
+// plaintext; Key addresses the stored (encrypted) blob.
+type upload struct {
+	Key         string
+	SHA256      string
+	Size        int64
+	DataKeyID   *uuid.UUID
+	FileName    string
+	ContentType string
+	ScanStatus  scanner.Status
+}
+
+// saveUpload sniffs and sanitizes the file, scans it, encrypts it with the
+// school's data key and stores it content-addressed. Infected files are
+// rejected; if the scanner is unreachable the file is stored with status
+// pending (quarantined) and rescanned by the background job.
+func saveUpload(ctx context.Context, store storage.Store, keys *encryption.Keys, scan scanner.Scanner, schoolID uuid.UUID, fh *multipart.FileHeader) (*upload, error) {
+	if fh.Size > maxUploadSize {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "file too large (max 10MB)")
+	}
+	src, err := fh.Open()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, maxUploadSize+1))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+	}
+	if len(data) > maxUploadSize {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "file too large (max 10MB)")
+	}
+
+	data, contentType, err := uploads.Sanitize(data)
+	if err != nil {
+		if errors.Is(err, uploads.ErrUnsupportedType) {
+			return nil, echo.NewHTTPError(http.StatusUnsupportedMediaType, err.Error())
+		}
+		return nil, echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	status := scanner.StatusPending
+	result, err := scan.Scan(ctx, bytes.NewReader(data))
+	if err != nil {
+		log.Printf("[upload] scan failed, quarantining %s: %v", fh.Filename, err)
+	} else {
+		status = result.Status
+	}
+	if status == scanner.StatusInfected {
+		return nil, echo.NewHTTPError(http.StatusUnprocessableEntity, "file rejected by virus scanner")
+	}
+
+	sum := sha256.Sum256(data)
+	sealed, keyID, err := keys.EncryptBlob(ctx, schoolID, data)
+	if err != nil {
+		log.Printf("[upload] encrypt %s: %v", fh.Filename, err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to save file")
+	}
+	blob, err := storage.PutBytes(ctx, store, sealed, contentType)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to save file")
+	}
+	return &upload{
+		Key:         blob.Key,
+		SHA256:      hex.EncodeToString(sum[:]),
+		Size:        int64(len(data)),
+		DataKeyID:   keyID,
+		FileName:    uploads.FileName(fh.Filename, contentType),
+		ContentType: contentType,
+		ScanStatus:  status,
+	}, nil
+}
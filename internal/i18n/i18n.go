@@ -0,0 +1,128 @@
+// Package i18n looks up translations from the embedded locale files.
+//
+// Keys are dotted paths into the JSON files, e.g. "excuses.approved". Missing
+// keys fall back to the default locale and finally to the key itself.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Monstroxx/eduko-backend/locales"
+)
+
+const DefaultLocale = "de"
+
+var (
+	loadOnce sync.Once
+	catalogs map[string]map[string]string
+	loadErr  error
+)
+
+func load() {
+	catalogs = map[string]map[string]string{}
+	files, err := locales.FS.ReadDir(".")
+	if err != nil {
+		loadErr = err
+		return
+	}
+	for _, f := range files {
+		if path.Ext(f.Name()) != ".json" {
+			continue
+		}
+		data, err := locales.FS.ReadFile(f.Name())
+		if err != nil {
+			loadErr = err
+			return
+		}
+		var tree map[string]interface{}
+		if err := json.Unmarshal(data, &tree); err != nil {
+			loadErr = fmt.Errorf("parse %s: %w", f.Name(), err)
+			return
+		}
+		flat := map[string]string{}
+		flatten("", tree, flat)
+		catalogs[strings.TrimSuffix(f.Name(), ".json")] = flat
+	}
+}
+
+func flatten(prefix string, tree map[string]interface{}, out map[string]string) {
+	for k, v := range tree {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flatten(key, v, out)
+		case string:
+			out[key] = v
+		}
+	}
+}
+
+// Supported reports whether a locale file exists for locale.
+func Supported(locale string) bool {
+	loadOnce.Do(load)
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Translator translates keys for one locale.
+type Translator struct {
+	Locale string
+}
+
+// For returns a translator for the first supported locale in candidates, or
+// for the default locale. Region suffixes ("de-AT") are ignored.
+func For(candidates ...string) Translator {
+	for _, c := range candidates {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if i := strings.IndexAny(c, "-_"); i > 0 {
+			c = c[:i]
+		}
+		if c != "" && Supported(c) {
+			return Translator{Locale: c}
+		}
+	}
+	return Translator{Locale: DefaultLocale}
+}
+
+// T returns the translation of key.
+func (t Translator) T(key string) string {
+	loadOnce.Do(load)
+	if loadErr != nil {
+		return key
+	}
+	if s, ok := catalogs[t.Locale][key]; ok {
+		return s
+	}
+	if s, ok := catalogs[DefaultLocale][key]; ok {
+		return s
+	}
+	return key
+}
+
+// Format translates key and fills in its {name} placeholders from params.
+func (t Translator) Format(key string, params map[string]string) string {
+	s := t.T(key)
+	if len(params) == 0 {
+		return s
+	}
+	pairs := make([]string, 0, 2*len(params))
+	for k, v := range params {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+// DateFormat is the Go layout for dates in this locale.
+func (t Translator) DateFormat() string {
+	if t.Locale == "en" {
+		return "2006-01-02"
+	}
+	return "02.01.2006"
+}
@@ -0,0 +1,143 @@
+// Package ical reads the parts of iCalendar (RFC 5545) files that Eduko
+// needs: all-day events such as the holiday calendars published by the
+// federal states. It also writes the calendar subscription feeds.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrInvalid = errors.New("invalid iCalendar data")
+
+// Event is a VEVENT reduced to dates. End is the last day of the event
+// (inclusive), unlike DTEND which is exclusive.
+type Event struct {
+	UID     string
+	Summary string
+	Start   time.Time
+	End     time.Time
+}
+
+// unfold joins folded content lines (continuations start with a space or tab).
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, sc.Err()
+}
+
+// property splits "NAME;PARAM=x:VALUE" into the upper-cased name, the
+// parameters and the value.
+func property(line string) (name string, params map[string]string, value string, ok bool) {
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return "", nil, "", false
+	}
+	parts := strings.Split(line[:colon], ";")
+	params = map[string]string{}
+	for _, p := range parts[1:] {
+		if k, v, found := strings.Cut(p, "="); found {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:], true
+}
+
+var textEscapes = strings.NewReplacer(`\\`, `\`, `\;`, `;`, `\,`, `,`, `\n`, "\n", `\N`, "\n")
+
+// parseDate reads a DATE or DATE-TIME value. Times are converted to the
+// TZID's zone (or UTC) before the date is taken.
+func parseDate(value string, params map[string]string) (t time.Time, allDay bool, err error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err = time.Parse("20060102", value)
+		return t, true, err
+	}
+	loc := time.UTC
+	if tz := params["TZID"]; tz != "" {
+		if l, err := time.LoadLocation(tz); err == nil {
+			loc = l
+		}
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+		t = t.In(loc)
+	} else {
+		t, err = time.ParseInLocation("20060102T150405", value, loc)
+	}
+	if err != nil {
+		return t, false, err
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), false, nil
+}
+
+// Parse returns the events of an iCalendar stream. Recurrence rules are not
+// expanded; holiday calendars list every occurrence as its own event.
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("%w: missing BEGIN:VCALENDAR", ErrInvalid)
+	}
+
+	var events []Event
+	var ev *Event
+	var endAllDay, hasEnd bool
+	for i, line := range lines {
+		name, params, value, ok := property(line)
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d", ErrInvalid, i+1)
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			ev, hasEnd = &Event{}, false
+		case name == "END" && strings.EqualFold(value, "VEVENT") && ev != nil:
+			if ev.Start.IsZero() {
+				return nil, fmt.Errorf("%w: event %q without DTSTART", ErrInvalid, ev.Summary)
+			}
+			switch {
+			case !hasEnd:
+				ev.End = ev.Start
+			case endAllDay:
+				// DTEND of all-day events is the day after the last one.
+				ev.End = ev.End.AddDate(0, 0, -1)
+			}
+			if ev.End.Before(ev.Start) {
+				ev.End = ev.Start
+			}
+			events = append(events, *ev)
+			ev = nil
+		case ev == nil:
+		case name == "UID":
+			ev.UID = value
+		case name == "SUMMARY":
+			ev.Summary = textEscapes.Replace(value)
+		case name == "DTSTART":
+			if ev.Start, _, err = parseDate(value, params); err != nil {
+				return nil, fmt.Errorf("%w: line %d: DTSTART %q", ErrInvalid, i+1, value)
+			}
+		case name == "DTEND":
+			if ev.End, endAllDay, err = parseDate(value, params); err != nil {
+				return nil, fmt.Errorf("%w: line %d: DTEND %q", ErrInvalid, i+1, value)
+			}
+			hasEnd = true
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,93 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// VEvent is an event to publish. Timed events are written in UTC; all-day
+// events use the dates of Start and End (inclusive).
+type VEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Cancelled   bool
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// maxLine is the line length limit of RFC 5545 in octets, without CRLF.
+const maxLine = 75
+
+// writeLine folds line into 75-octet chunks without splitting UTF-8
+// sequences and terminates every chunk with CRLF.
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLine
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts.
+		limit = maxLine - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+// Write renders events as an iCalendar stream named name. now is the
+// DTSTAMP of all events.
+func Write(out io.Writer, name string, events []VEvent, now time.Time) error {
+	w := bufio.NewWriter(out)
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, line := range []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Eduko//Eduko//DE",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + textEscaper.Replace(name),
+		"REFRESH-INTERVAL;VALUE=DURATION:PT1H",
+		"X-PUBLISHED-TTL:PT1H",
+	} {
+		writeLine(w, line)
+	}
+	for _, ev := range events {
+		writeLine(w, "BEGIN:VEVENT")
+		writeLine(w, "UID:"+ev.UID)
+		writeLine(w, "DTSTAMP:"+stamp)
+		if ev.AllDay {
+			writeLine(w, "DTSTART;VALUE=DATE:"+ev.Start.Format("20060102"))
+			// DTEND of all-day events is exclusive.
+			writeLine(w, "DTEND;VALUE=DATE:"+ev.End.AddDate(0, 0, 1).Format("20060102"))
+		} else {
+			writeLine(w, "DTSTART:"+ev.Start.UTC().Format("20060102T150405Z"))
+			writeLine(w, "DTEND:"+ev.End.UTC().Format("20060102T150405Z"))
+		}
+		writeLine(w, "SUMMARY:"+textEscaper.Replace(ev.Summary))
+		if ev.Description != "" {
+			writeLine(w, "DESCRIPTION:"+textEscaper.Replace(ev.Description))
+		}
+		if ev.Location != "" {
+			writeLine(w, "LOCATION:"+textEscaper.Replace(ev.Location))
+		}
+		if ev.Cancelled {
+			writeLine(w, "STATUS:CANCELLED")
+		} else {
+			writeLine(w, "STATUS:CONFIRMED")
+		}
+		writeLine(w, "END:VEVENT")
+	}
+	writeLine(w, "END:VCALENDAR")
+	return w.Flush()
+}
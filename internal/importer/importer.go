@@ -0,0 +1,240 @@
+// Package importer contains the CSV plumbing shared by the bulk importers:
+// header-based column lookup, accurate row numbers, per-row diagnostics,
+// dry-run transactions and a downloadable error report.
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Issue is a single row-level diagnostic. Row is the 1-based line number in the
+// uploaded file (the header is line 1).
+type Issue struct {
+	Row     int      `json:"row"`
+	Column  string   `json:"column,omitempty"`
+	Message string   `json:"message"`
+	Record  []string `json:"-"`
+}
+
+// FieldError is a row that fails validation, pointing at the offending
+// column if there is one.
+type FieldError struct {
+	Column  string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if e.Column == "" {
+		return e.Message
+	}
+	return e.Column + ": " + e.Message
+}
+
+// Fieldf builds a FieldError for the given column.
+func Fieldf(column, format string, args ...interface{}) error {
+	return &FieldError{Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+// Rowf builds a FieldError for the row as a whole.
+func Rowf(format string, args ...interface{}) error {
+	return &FieldError{Message: fmt.Sprintf(format, args...)}
+}
+
+// Constraint turns the constraint violations and invalid values Postgres
+// reports for a row into a FieldError. Other errors are returned unchanged.
+func Constraint(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch {
+	case pgErr.Code == "23505": // unique_violation
+		return &FieldError{Column: pgErr.ColumnName, Message: "already exists"}
+	case pgErr.Code == "23503": // foreign_key_violation
+		return &FieldError{Column: pgErr.ColumnName, Message: "refers to a record that does not exist"}
+	case pgErr.Code == "23502": // not_null_violation
+		return &FieldError{Column: pgErr.ColumnName, Message: "required"}
+	case pgErr.Code == "23514": // check_violation
+		return &FieldError{Column: pgErr.ColumnName, Message: "value not allowed"}
+	case strings.HasPrefix(pgErr.Code, "22"): // data_exception
+		return &FieldError{Column: pgErr.ColumnName, Message: "invalid value"}
+	}
+	return err
+}
+
+// RowError is an unexpected error a row handler returned, e.g. a lost
+// database connection. It aborts the import.
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e *RowError) Error() string { return fmt.Sprintf("row %d: %v", e.Row, e.Err) }
+
+func (e *RowError) Unwrap() error { return e.Err }
+
+type Report struct {
+	DryRun   bool     `json:"dry_run"`
+	Total    int      `json:"total"`
+	Imported int      `json:"imported"`
+	Failed   int      `json:"failed"`
+	Errors   []string `json:"errors"`
+	Issues   []Issue  `json:"issues"`
+	header   []string
+}
+
+func NewReport(dryRun bool) *Report {
+	return &Report{DryRun: dryRun, Errors: []string{}, Issues: []Issue{}}
+}
+
+func (r *Report) add(issue Issue) {
+	r.Failed++
+	r.Issues = append(r.Issues, issue)
+	msg := fmt.Sprintf("row %d: %s", issue.Row, issue.Message)
+	if issue.Column != "" {
+		msg = fmt.Sprintf("row %d: %s: %s", issue.Row, issue.Column, issue.Message)
+	}
+	r.Errors = append(r.Errors, msg)
+}
+
+// WriteCSV writes the diagnostics as a semicolon-separated CSV: the row number,
+// column and message followed by the original record, so admins can fix the
+// rows in place and re-import them.
+func (r *Report) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Comma = ';'
+	if err := out.Write(append([]string{"row", "column", "error"}, r.header...)); err != nil {
+		return err
+	}
+	for _, issue := range r.Issues {
+		line := append([]string{fmt.Sprint(issue.Row), issue.Column, issue.Message}, issue.Record...)
+		if err := out.Write(line); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// Reader reads a semicolon-delimited UTF-8 CSV with a header line.
+type Reader struct {
+	r      *csv.Reader
+	header []string
+	cols   map[string]int
+}
+
+func NewReader(src io.Reader) (*Reader, error) {
+	r := csv.NewReader(src)
+	r.Comma = ';'
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read header: %w", err)
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		h = strings.TrimPrefix(h, "\uFEFF") // Excel writes a BOM
+		cols[strings.TrimSpace(strings.ToLower(h))] = i
+	}
+	return &Reader{r: r, header: header, cols: cols}, nil
+}
+
+func (r *Reader) Header() []string { return r.header }
+
+func (r *Reader) Has(col string) bool {
+	_, ok := r.cols[col]
+	return ok
+}
+
+// Require returns an error naming the first missing column.
+func (r *Reader) Require(cols ...string) error {
+	for _, col := range cols {
+		if !r.Has(col) {
+			return fmt.Errorf("missing required column: %s (have: %s)", col, strings.Join(r.header, ", "))
+		}
+	}
+	return nil
+}
+
+type Row struct {
+	Line   int
+	Record []string
+	cols   map[string]int
+}
+
+// Get returns the trimmed value of the named column, or "" if absent.
+func (row Row) Get(name string) string {
+	if idx, ok := row.cols[name]; ok && idx < len(row.Record) {
+		return strings.TrimSpace(row.Record[idx])
+	}
+	return ""
+}
+
+// Each calls fn for every data row. Malformed lines and FieldErrors returned
+// by fn are recorded on the report with the line they occurred on; iteration
+// continues with the next line. I/O errors abort, and so do other errors
+// from fn, wrapped in a *RowError.
+func (r *Reader) Each(report *Report, fn func(Row) error) error {
+	report.header = r.header
+	for {
+		record, err := r.r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if !errors.As(err, &perr) {
+				return err
+			}
+			report.Total++
+			report.add(Issue{Row: perr.StartLine, Message: perr.Err.Error(), Record: record})
+			continue
+		}
+
+		line, _ := r.r.FieldPos(0)
+		report.Total++
+		row := Row{Line: line, Record: record, cols: r.cols}
+		if err := fn(row); err != nil {
+			var ferr *FieldError
+			if !errors.As(err, &ferr) {
+				return &RowError{Row: line, Err: err}
+			}
+			report.add(Issue{Row: line, Column: ferr.Column, Message: ferr.Message, Record: record})
+			continue
+		}
+		report.Imported++
+	}
+}
+
+// Savepoint runs fn in a nested transaction so a failing row does not abort
+// the surrounding import transaction.
+func Savepoint(ctx context.Context, tx pgx.Tx, fn func(pgx.Tx) error) error {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fn(sp); err != nil {
+		sp.Rollback(ctx)
+		return err
+	}
+	return sp.Commit(ctx)
+}
+
+// Finish commits the import transaction, or rolls it back for dry runs.
+func Finish(ctx context.Context, tx pgx.Tx, report *Report) error {
+	if report.DryRun {
+		return tx.Rollback(ctx)
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/encryption"
+	"github.com/Monstroxx/eduko-backend/internal/scanner"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+	"github.com/Monstroxx/eduko-backend/internal/storage"
+)
+
+// AttachmentScan rescans quarantined attachments whose scan failed at upload
+// time (scanner unreachable) or that were imported by edukoctl.
+type AttachmentScan struct {
+	excuses *services.ExcuseService
+	keys    *encryption.Keys
+	store   storage.Store
+	scanner scanner.Scanner
+}
+
+func NewAttachmentScan(db *pgxpool.Pool, store storage.Store, scan scanner.Scanner) *AttachmentScan {
+	return &AttachmentScan{
+		excuses: services.NewExcuseService(db),
+		keys:    encryption.NewKeys(db),
+		store:   store,
+		scanner: scan,
+	}
+}
+
+func (j *AttachmentScan) Name() string { return "attachment_scan" }
+
+func (j *AttachmentScan) Run(ctx context.Context) error {
+	keys, err := j.excuses.PendingScans(ctx, 100)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		r, err := j.store.Get(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			log.Printf("[jobs] attachment_scan: blob %s missing", key)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sealed, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		data, err := j.keys.DecryptBlob(ctx, sealed)
+		if err != nil {
+			log.Printf("[jobs] attachment_scan: blob %s: %v", key, err)
+			continue
+		}
+		result, err := j.scanner.Scan(ctx, bytes.NewReader(data))
+		if err != nil {
+			return err // scanner still down; retry on the next run
+		}
+
+		var signature *string
+		if result.Status == scanner.StatusInfected {
+			signature = &result.Signature
+			log.Printf("[jobs] attachment_scan: %s infected (%s)", key, result.Signature)
+		}
+		if err := j.excuses.SetScanResult(ctx, key, string(result.Status), signature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+// ExcuseReminders notifies students (or their guardians) about absences that
+// still need an excuse and marks absences past the deadline as unexcused.
+//
+// Reminders go out when the number of days left until the deadline matches one
+// of the school's excuse_reminder_days; each one is sent at most once, as a
+// notification (and by e-mail unless the recipient opted out).
+type ExcuseReminders struct {
+	db            *pgxpool.Pool
+	notifications *services.NotificationService
+	excuses       *services.ExcuseService
+	students      *services.StudentService
+	schools       *services.SchoolService
+}
+
+func NewExcuseReminders(db *pgxpool.Pool) *ExcuseReminders {
+	return &ExcuseReminders{
+		db:            db,
+		notifications: services.NewNotificationService(db),
+		excuses:       services.NewExcuseService(db),
+		students:      services.NewStudentService(db),
+		schools:       services.NewSchoolService(db),
+	}
+}
+
+func (j *ExcuseReminders) Name() string { return "excuse_reminders" }
+
+func (j *ExcuseReminders) Run(ctx context.Context) error {
+	rows, err := j.db.Query(ctx, `SELECT id FROM schools`)
+	if err != nil {
+		return fmt.Errorf("list schools: %w", err)
+	}
+	var schools []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan school: %w", err)
+		}
+		schools = append(schools, id)
+	}
+	rows.Close()
+
+	for _, id := range schools {
+		if err := j.runSchool(ctx, id); err != nil {
+			log.Printf("[jobs] excuse_reminders: school %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func (j *ExcuseReminders) runSchool(ctx context.Context, schoolID uuid.UUID) error {
+	deadline := j.schools.GetIntSetting(ctx, schoolID, "excuse_deadline_days", 14)
+	remindAt := j.schools.GetIntListSetting(ctx, schoolID, "excuse_reminder_days", []int{7, 3, 1})
+
+	missing, err := j.excuses.MissingExcuses(ctx, schoolID, deadline)
+	if err != nil {
+		return err
+	}
+	for _, m := range missing {
+		if !slices.Contains(remindAt, m.DaysLeft) {
+			continue
+		}
+		claimed, err := j.excuses.ClaimReminder(ctx, schoolID, m.StudentID, m.AbsenceDate, m.DaysLeft)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		if err := j.remind(ctx, schoolID, m); err != nil {
+			log.Printf("[jobs] excuse_reminders: student %s: %v", m.StudentID, err)
+		}
+	}
+
+	n, err := j.excuses.MarkExpiredUnexcused(ctx, schoolID, deadline)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("[jobs] excuse_reminders: school %s: %d lesson(s) marked unexcused", schoolID, n)
+	}
+	return nil
+}
+
+func (j *ExcuseReminders) remind(ctx context.Context, schoolID uuid.UUID, m services.MissingExcuse) error {
+	student, err := j.students.GetByID(ctx, schoolID, m.StudentID)
+	if err != nil {
+		return err
+	}
+	contacts, err := j.students.Contacts(ctx, schoolID, m.StudentID)
+	if err != nil {
+		return err
+	}
+
+	users := make([]uuid.UUID, 0, len(contacts))
+	for _, contact := range contacts {
+		users = append(users, contact.UserID)
+	}
+	return j.notifications.ExcuseReminder(ctx, schoolID, users, student.FirstName+" "+student.LastName, m)
+}
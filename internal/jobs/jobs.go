@@ -0,0 +1,92 @@
+// Package jobs runs periodic background work (reminders, clean-up, ...).
+//
+// Every run is guarded by a PostgreSQL advisory lock so that only one backend
+// replica executes a given job at a time.
+package jobs
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Job interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+type scheduled struct {
+	job      Job
+	interval time.Duration
+}
+
+type Scheduler struct {
+	db   *pgxpool.Pool
+	jobs []scheduled
+}
+
+func NewScheduler(db *pgxpool.Pool) *Scheduler {
+	return &Scheduler{db: db}
+}
+
+// Every registers job to run once at start-up and then every interval.
+func (s *Scheduler) Every(interval time.Duration, job Job) {
+	s.jobs = append(s.jobs, scheduled{job: job, interval: interval})
+}
+
+// Start launches one goroutine per job. They stop when ctx is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, sj := range s.jobs {
+		go s.loop(ctx, sj)
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, sj scheduled) {
+	ticker := time.NewTicker(sj.interval)
+	defer ticker.Stop()
+	for {
+		s.RunOnce(ctx, sj.job)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce executes job if no other replica currently holds its lock.
+func (s *Scheduler) RunOnce(ctx context.Context, job Job) {
+	conn, err := s.db.Acquire(ctx)
+	if err != nil {
+		log.Printf("[jobs] %s: acquire connection: %v", job.Name(), err)
+		return
+	}
+	defer conn.Release()
+
+	key := lockKey(job.Name())
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		log.Printf("[jobs] %s: lock: %v", job.Name(), err)
+		return
+	}
+	if !locked {
+		return
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+
+	start := time.Now()
+	if err := job.Run(ctx); err != nil {
+		log.Printf("[jobs] %s failed after %s: %v", job.Name(), time.Since(start).Round(time.Millisecond), err)
+		return
+	}
+	log.Printf("[jobs] %s done in %s", job.Name(), time.Since(start).Round(time.Millisecond))
+}
+
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("eduko:" + name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"context"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/notify"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+// mailerBatch is how many notifications one run e-mails at most.
+const mailerBatch = 200
+
+// NotificationMailer e-mails the notifications whose recipients want their
+// category by e-mail, in the recipient's language.
+type NotificationMailer struct {
+	notifier      notify.Notifier
+	notifications *services.NotificationService
+}
+
+func NewNotificationMailer(db *pgxpool.Pool, notifier notify.Notifier) *NotificationMailer {
+	return &NotificationMailer{notifier: notifier, notifications: services.NewNotificationService(db)}
+}
+
+func (j *NotificationMailer) Name() string { return "notification_mailer" }
+
+func (j *NotificationMailer) Run(ctx context.Context) error {
+	pending, err := j.notifications.PendingEmails(ctx, mailerBatch)
+	if err != nil {
+		return err
+	}
+	for _, p := range pending {
+		msg := notify.Message{To: []string{p.To}, Subject: p.Title, Body: p.Body + "\n"}
+		if err := j.notifier.Send(ctx, msg); err != nil {
+			gaveUp, markErr := j.notifications.MarkEmailFailed(ctx, p.ID, err)
+			if markErr != nil {
+				return markErr
+			}
+			if gaveUp {
+				log.Printf("[jobs] notification_mailer: notification %s: %v; giving up", p.ID, err)
+			} else {
+				log.Printf("[jobs] notification_mailer: notification %s: %v; will retry", p.ID, err)
+			}
+			continue
+		}
+		if err := j.notifications.MarkEmailed(ctx, p.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/services"
+	"github.com/Monstroxx/eduko-backend/internal/storage"
+)
+
+// Retention purges excuses, attachments, attendance and leave requests past
+// the retention period configured per school (setting "retention") and
+// deletes files that are no longer referenced. Each run writes a summary to
+// audit_log.
+type Retention struct {
+	db        *pgxpool.Pool
+	store     storage.Store
+	retention *services.RetentionService
+}
+
+func NewRetention(db *pgxpool.Pool, store storage.Store) *Retention {
+	return &Retention{db: db, store: store, retention: services.NewRetentionService(db)}
+}
+
+func (j *Retention) Name() string { return "retention" }
+
+func (j *Retention) Run(ctx context.Context) error {
+	rows, err := j.db.Query(ctx, `SELECT id FROM schools`)
+	if err != nil {
+		return fmt.Errorf("list schools: %w", err)
+	}
+	var schools []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan school: %w", err)
+		}
+		schools = append(schools, id)
+	}
+	rows.Close()
+
+	for _, id := range schools {
+		report, orphaned, err := j.retention.Purge(ctx, id, false)
+		if err != nil {
+			log.Printf("[jobs] retention: school %s: %v", id, err)
+			continue
+		}
+		for _, key := range orphaned {
+			if err := j.store.Delete(ctx, key); err != nil {
+				log.Printf("[jobs] retention: delete blob %s: %v", key, err)
+			}
+		}
+		for _, item := range report.Items {
+			if item.Rows > 0 {
+				log.Printf("[jobs] retention: school %s: %s %s: %d row(s) up to %s",
+					id, item.Action, item.Entity, item.Rows, item.Cutoff)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+// SubstitutionNotices notifies students and guardians about substitutions
+// once they are due for the next school day. Substitutions entered or changed
+// that close are notified right away; this catches those entered further
+// ahead, each one once.
+type SubstitutionNotices struct {
+	db            *pgxpool.Pool
+	notifications *services.NotificationService
+}
+
+func NewSubstitutionNotices(db *pgxpool.Pool) *SubstitutionNotices {
+	return &SubstitutionNotices{db: db, notifications: services.NewNotificationService(db)}
+}
+
+func (j *SubstitutionNotices) Name() string { return "substitution_notices" }
+
+func (j *SubstitutionNotices) Run(ctx context.Context) error {
+	rows, err := j.db.Query(ctx, `SELECT id FROM schools`)
+	if err != nil {
+		return fmt.Errorf("list schools: %w", err)
+	}
+	var schools []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan school: %w", err)
+		}
+		schools = append(schools, id)
+	}
+	rows.Close()
+
+	for _, id := range schools {
+		n, err := j.notifications.NotifyUpcomingSubstitutions(ctx, id)
+		if err != nil {
+			log.Printf("[jobs] substitution_notices: school %s: %v", id, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("[jobs] substitution_notices: school %s: %d substitution(s) notified", id, n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"context"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+// TimetableSolver executes queued timetable solver runs one after another.
+// Progress is written to the run while it is solved; the plan ends up in a
+// new timetable draft.
+type TimetableSolver struct {
+	solver *services.TimetableSolverService
+}
+
+func NewTimetableSolver(db *pgxpool.Pool) *TimetableSolver {
+	return &TimetableSolver{solver: services.NewTimetableSolverService(db)}
+}
+
+func (j *TimetableSolver) Name() string { return "timetable_solver" }
+
+func (j *TimetableSolver) Run(ctx context.Context) error {
+	// The job's lock is held, so runs still marked running were cut off by
+	// a restart.
+	if err := j.solver.FailInterrupted(ctx); err != nil {
+		return err
+	}
+	for {
+		run, err := j.solver.ClaimRun(ctx)
+		if err != nil {
+			return err
+		}
+		if run == nil {
+			return nil
+		}
+		if err := j.solver.Execute(ctx, run); err != nil {
+			log.Printf("[jobs] timetable_solver: run %s: %v", run.ID, err)
+		}
+	}
+}
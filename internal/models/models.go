@@ -31,9 +31,10 @@ type SchoolSetting struct {
 type UserRole string
 
 const (
-	RoleStudent UserRole = "student"
-	RoleTeacher UserRole = "teacher"
-	RoleAdmin   UserRole = "admin"
+	RoleStudent  UserRole = "student"
+	RoleTeacher  UserRole = "teacher"
+	RoleAdmin    UserRole = "admin"
+	RoleGuardian UserRole = "guardian"
 )
 
 type User struct {
@@ -121,6 +122,71 @@ type TimeSlot struct {
 	Label      *string   `json:"label,omitempty" db:"label"`
 }
 
+// ── Course group ────────────────────────────────────────────
+
+// CourseGroup is a set of students taught together independently of their
+// class (religion/ethics, language groups, upper-school courses).
+type CourseGroup struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	SchoolID    uuid.UUID  `json:"school_id" db:"school_id"`
+	Name        string     `json:"name" db:"name"`
+	ClassID     *uuid.UUID `json:"class_id,omitempty" db:"class_id"`
+	SubjectID   *uuid.UUID `json:"subject_id,omitempty" db:"subject_id"`
+	MemberCount int        `json:"member_count"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ── School calendar ─────────────────────────────────────────
+
+type SchoolYear struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	SchoolID  uuid.UUID `json:"school_id" db:"school_id"`
+	Name      string    `json:"name" db:"name"`
+	StartDate time.Time `json:"start_date" db:"start_date"`
+	EndDate   time.Time `json:"end_date" db:"end_date"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type CalendarDayKind string
+
+const (
+	DayHoliday     CalendarDayKind = "holiday"
+	DayNonTeaching CalendarDayKind = "non_teaching_day"
+)
+
+// Holiday is a range of dates without lessons, either school holidays or a
+// single non-teaching day.
+type Holiday struct {
+	ID        uuid.UUID       `json:"id" db:"id"`
+	SchoolID  uuid.UUID       `json:"school_id" db:"school_id"`
+	Name      string          `json:"name" db:"name"`
+	Kind      CalendarDayKind `json:"kind" db:"kind"`
+	DateFrom  time.Time       `json:"date_from" db:"date_from"`
+	DateTo    time.Time       `json:"date_to" db:"date_to"`
+	UID       *string         `json:"uid,omitempty" db:"uid"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+// CalendarFeed is a user's ICS subscription. The token itself is only
+// returned when it is generated.
+type CalendarFeed struct {
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	SchoolID   uuid.UUID  `json:"school_id" db:"school_id"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+}
+
+// DisplayFeed is a secret URL showing the substitution plan on a hallway
+// monitor. The token itself is only returned when it is generated.
+type DisplayFeed struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	SchoolID   uuid.UUID  `json:"school_id" db:"school_id"`
+	Name       string     `json:"name" db:"name"`
+	DaysAhead  int        `json:"days_ahead" db:"days_ahead"` // school days shown after today
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+}
+
 // ── Timetable ───────────────────────────────────────────────
 
 type WeekType string
@@ -131,14 +197,30 @@ const (
 	WeekB   WeekType = "B"
 )
 
+// Epoch is a phase of the school year in which epoch subjects are taught in
+// concentrated form. Timetable entries with an epoch only take place within
+// its dates; giving each class the same slot in a different epoch rotates the
+// subject between classes.
+type Epoch struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	SchoolID  uuid.UUID `json:"school_id" db:"school_id"`
+	Name      string    `json:"name" db:"name"`
+	StartDate time.Time `json:"start_date" db:"start_date"`
+	EndDate   time.Time `json:"end_date" db:"end_date"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
 type TimetableEntry struct {
 	ID         uuid.UUID  `json:"id" db:"id"`
 	SchoolID   uuid.UUID  `json:"school_id" db:"school_id"`
-	ClassID    uuid.UUID  `json:"class_id" db:"class_id"`
+	ClassID    *uuid.UUID `json:"class_id,omitempty" db:"class_id"`
+	GroupID    *uuid.UUID `json:"group_id,omitempty" db:"group_id"`
 	SubjectID  uuid.UUID  `json:"subject_id" db:"subject_id"`
 	TeacherID  uuid.UUID  `json:"teacher_id" db:"teacher_id"`
 	RoomID     *uuid.UUID `json:"room_id,omitempty" db:"room_id"`
 	TimeSlotID uuid.UUID  `json:"time_slot_id" db:"time_slot_id"`
+	SlotCount  int        `json:"slot_count" db:"slot_count"` // consecutive slots from TimeSlotID (2 = double period)
+	EpochID    *uuid.UUID `json:"epoch_id,omitempty" db:"epoch_id"`
 	DayOfWeek  int        `json:"day_of_week" db:"day_of_week"`
 	WeekType   WeekType   `json:"week_type" db:"week_type"`
 	ValidFrom  time.Time  `json:"valid_from" db:"valid_from"`
@@ -151,16 +233,102 @@ type TimetableEntry struct {
 // so clients don't need to fetch and join subjects/teachers/rooms separately.
 type TimetableEntryEnriched struct {
 	TimetableEntry
-	SubjectName         *string `json:"subject_name,omitempty"`
-	SubjectAbbreviation *string `json:"subject_abbreviation,omitempty"`
-	SubjectColor        *string `json:"subject_color,omitempty"`
-	TeacherName         *string `json:"teacher_name,omitempty"`
-	TeacherAbbreviation *string `json:"teacher_abbreviation,omitempty"`
-	RoomName            *string `json:"room_name,omitempty"`
-	ClassName           *string `json:"class_name,omitempty"`
-	TimeSlotLabel       *string `json:"time_slot_label,omitempty"`
-	TimeSlotStart       *string `json:"time_slot_start,omitempty"`
-	TimeSlotEnd         *string `json:"time_slot_end,omitempty"`
+	SubjectName         *string    `json:"subject_name,omitempty"`
+	SubjectAbbreviation *string    `json:"subject_abbreviation,omitempty"`
+	SubjectColor        *string    `json:"subject_color,omitempty"`
+	TeacherName         *string    `json:"teacher_name,omitempty"`
+	TeacherAbbreviation *string    `json:"teacher_abbreviation,omitempty"`
+	RoomName            *string    `json:"room_name,omitempty"`
+	ClassName           *string    `json:"class_name,omitempty"`
+	GroupName           *string    `json:"group_name,omitempty"`
+	TimeSlotLabel       *string    `json:"time_slot_label,omitempty"`
+	TimeSlotStart       *string    `json:"time_slot_start,omitempty"`
+	TimeSlotEnd         *string    `json:"time_slot_end,omitempty"` // end of the last slot of a block
+	EpochName           *string    `json:"epoch_name,omitempty"`
+	EpochStart          *time.Time `json:"epoch_start,omitempty"`
+	EpochEnd            *time.Time `json:"epoch_end,omitempty"`
+}
+
+type DraftStatus string
+
+const (
+	DraftOpen      DraftStatus = "draft"
+	DraftPublished DraftStatus = "published"
+)
+
+// TimetableDraft is a copy of the timetable that admins edit before
+// publishing it effective on EffectiveFrom.
+type TimetableDraft struct {
+	ID            uuid.UUID   `json:"id" db:"id"`
+	SchoolID      uuid.UUID   `json:"school_id" db:"school_id"`
+	Name          string      `json:"name" db:"name"`
+	Status        DraftStatus `json:"status" db:"status"`
+	EffectiveFrom time.Time   `json:"effective_from" db:"effective_from"`
+	CreatedBy     *uuid.UUID  `json:"created_by,omitempty" db:"created_by"`
+	PublishedBy   *uuid.UUID  `json:"published_by,omitempty" db:"published_by"`
+	PublishedAt   *time.Time  `json:"published_at,omitempty" db:"published_at"`
+	CreatedAt     time.Time   `json:"created_at" db:"created_at"`
+}
+
+// TimetableDraftEntry is an entry of a draft. SourceEntryID is the published
+// entry it was copied from.
+type TimetableDraftEntry struct {
+	TimetableEntryEnriched
+	DraftID       uuid.UUID  `json:"draft_id"`
+	SourceEntryID *uuid.UUID `json:"source_entry_id,omitempty"`
+}
+
+// TeachingAssignment is an input of the timetable solver: TeacherID teaches
+// SubjectID to ClassID for PeriodsPerWeek periods.
+type TeachingAssignment struct {
+	ID             uuid.UUID   `json:"id" db:"id"`
+	SchoolID       uuid.UUID   `json:"school_id" db:"school_id"`
+	ClassID        uuid.UUID   `json:"class_id" db:"class_id"`
+	SubjectID      uuid.UUID   `json:"subject_id" db:"subject_id"`
+	TeacherID      uuid.UUID   `json:"teacher_id" db:"teacher_id"`
+	PeriodsPerWeek int         `json:"periods_per_week" db:"periods_per_week"`
+	DoublePeriods  int         `json:"double_periods" db:"double_periods"`
+	RoomIDs        []uuid.UUID `json:"room_ids" db:"room_ids"` // allowed rooms; empty: no room
+	CreatedAt      time.Time   `json:"created_at" db:"created_at"`
+}
+
+// TeacherUnavailability blocks a slot (or with TimeSlotID nil the whole day)
+// for the timetable solver.
+type TeacherUnavailability struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	SchoolID   uuid.UUID  `json:"school_id" db:"school_id"`
+	TeacherID  uuid.UUID  `json:"teacher_id" db:"teacher_id"`
+	DayOfWeek  int        `json:"day_of_week" db:"day_of_week"`
+	TimeSlotID *uuid.UUID `json:"time_slot_id,omitempty" db:"time_slot_id"`
+	Note       *string    `json:"note,omitempty" db:"note"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+type SolverStatus string
+
+const (
+	SolverQueued  SolverStatus = "queued"
+	SolverRunning SolverStatus = "running"
+	SolverDone    SolverStatus = "done"
+	SolverFailed  SolverStatus = "failed"
+)
+
+// TimetableSolverRun is a background run of the timetable solver. The plan
+// it generates is stored in draft DraftID.
+type TimetableSolverRun struct {
+	ID            uuid.UUID    `json:"id" db:"id"`
+	SchoolID      uuid.UUID    `json:"school_id" db:"school_id"`
+	Name          string       `json:"name" db:"name"`
+	EffectiveFrom time.Time    `json:"effective_from" db:"effective_from"`
+	Status        SolverStatus `json:"status" db:"status"`
+	Progress      int          `json:"progress" db:"progress"` // percent
+	DraftID       *uuid.UUID   `json:"draft_id,omitempty" db:"draft_id"`
+	Result        interface{}  `json:"result,omitempty" db:"result"`
+	Error         *string      `json:"error,omitempty" db:"error"`
+	CreatedBy     *uuid.UUID   `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt     time.Time    `json:"created_at" db:"created_at"`
+	StartedAt     *time.Time   `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt    *time.Time   `json:"finished_at,omitempty" db:"finished_at"`
 }
 
 // ── Substitution ────────────────────────────────────────────
@@ -183,12 +351,26 @@ type Substitution struct {
 	SubstituteTeacherID *uuid.UUID       `json:"substitute_teacher_id,omitempty" db:"substitute_teacher_id"`
 	SubstituteRoomID    *uuid.UUID       `json:"substitute_room_id,omitempty" db:"substitute_room_id"`
 	SubstituteSubjectID *uuid.UUID       `json:"substitute_subject_id,omitempty" db:"substitute_subject_id"`
+	TeacherAbsenceID    *uuid.UUID       `json:"teacher_absence_id,omitempty" db:"teacher_absence_id"`
 	Note                *string          `json:"note,omitempty" db:"note"`
 	CreatedBy           uuid.UUID        `json:"created_by" db:"created_by"`
 	CreatedAt           time.Time        `json:"created_at" db:"created_at"`
 	UpdatedAt           time.Time        `json:"updated_at" db:"updated_at"`
 }
 
+// TeacherAbsence is a period in which a teacher gives no lessons. Their
+// lessons in it get substitutions linked by TeacherAbsenceID.
+type TeacherAbsence struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	SchoolID  uuid.UUID `json:"school_id" db:"school_id"`
+	TeacherID uuid.UUID `json:"teacher_id" db:"teacher_id"`
+	DateFrom  time.Time `json:"date_from" db:"date_from"`
+	DateTo    time.Time `json:"date_to" db:"date_to"`
+	Note      *string   `json:"note,omitempty" db:"note"`
+	CreatedBy uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
 // ── Attendance ──────────────────────────────────────────────
 
 type AttendanceStatus string
@@ -198,6 +380,8 @@ const (
 	StatusAbsent       AttendanceStatus = "absent"
 	StatusLate         AttendanceStatus = "late"
 	StatusExcusedLeave AttendanceStatus = "excused_leave"
+	// StatusUnexcused is set by the reminder job once the excuse deadline has passed.
+	StatusUnexcused AttendanceStatus = "unexcused"
 )
 
 type Attendance struct {
@@ -243,11 +427,73 @@ type Excuse struct {
 	Reason               *string          `json:"reason,omitempty" db:"reason"`
 	AttestationProvided  bool             `json:"attestation_provided" db:"attestation_provided"`
 	FilePath             *string          `json:"file_path,omitempty" db:"file_path"`
+	PaperReceivedAt      *time.Time       `json:"paper_received_at,omitempty" db:"paper_received_at"`
 	SubmittedAt          time.Time        `json:"submitted_at" db:"submitted_at"`
 	ApprovedBy           *uuid.UUID       `json:"approved_by,omitempty" db:"approved_by"`
 	ApprovedAt           *time.Time       `json:"approved_at,omitempty" db:"approved_at"`
 	CreatedAt            time.Time        `json:"created_at" db:"created_at"`
 	UpdatedAt            time.Time        `json:"updated_at" db:"updated_at"`
+	Attachments          []ExcuseAttachment `json:"attachments,omitempty" db:"-"`
+}
+
+// ExcuseAttachment is an uploaded file (scan of the signed form, medical
+// certificate, ...). StorageKey is content-addressed, so identical uploads
+// share one blob.
+type ExcuseAttachment struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	ExcuseID    uuid.UUID `json:"excuse_id" db:"excuse_id"`
+	SchoolID    uuid.UUID `json:"school_id" db:"school_id"`
+	StorageKey  string    `json:"-" db:"storage_key"`
+	SHA256      string    `json:"sha256" db:"sha256"`
+	FileName    string    `json:"file_name" db:"file_name"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	SizeBytes   int64     `json:"size_bytes" db:"size_bytes"`
+	UploadedBy  uuid.UUID `json:"uploaded_by" db:"uploaded_by"`
+	// ScanStatus is pending, clean, infected or skipped (no scanner configured).
+	ScanStatus  string    `json:"scan_status" db:"scan_status"`
+	// DataKeyID is the school data key the blob is encrypted with (nil: plaintext).
+	DataKeyID   *uuid.UUID `json:"-" db:"data_key_id"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// ── Leave Request ──────────────────────────────────────────
+
+// LeaveStatus tracks a planned absence (Beurlaubung) through approval.
+type LeaveStatus string
+
+const (
+	LeavePending  LeaveStatus = "pending"
+	LeaveApproved LeaveStatus = "approved"
+	LeaveRejected LeaveStatus = "rejected"
+)
+
+// LeaveApprovalLevel determines who may grant a leave request. Short leaves
+// are granted by the class teacher, longer ones by the head of school (admin).
+type LeaveApprovalLevel string
+
+const (
+	ApprovalClassTeacher LeaveApprovalLevel = "class_teacher"
+	ApprovalHead         LeaveApprovalLevel = "head"
+)
+
+type LeaveRequest struct {
+	ID            uuid.UUID          `json:"id" db:"id"`
+	SchoolID      uuid.UUID          `json:"school_id" db:"school_id"`
+	StudentID     uuid.UUID          `json:"student_id" db:"student_id"`
+	DateFrom      time.Time          `json:"date_from" db:"date_from"`
+	DateTo        time.Time          `json:"date_to" db:"date_to"`
+	SlotFrom      *int               `json:"slot_from,omitempty" db:"slot_from"`
+	SlotTo        *int               `json:"slot_to,omitempty" db:"slot_to"`
+	Reason        string             `json:"reason" db:"reason"`
+	FilePath      *string            `json:"file_path,omitempty" db:"file_path"`
+	Status        LeaveStatus        `json:"status" db:"status"`
+	ApprovalLevel LeaveApprovalLevel `json:"approval_level" db:"approval_level"`
+	SubmittedBy   uuid.UUID          `json:"submitted_by" db:"submitted_by"`
+	DecidedBy     *uuid.UUID         `json:"decided_by,omitempty" db:"decided_by"`
+	DecidedAt     *time.Time         `json:"decided_at,omitempty" db:"decided_at"`
+	DecisionNote  *string            `json:"decision_note,omitempty" db:"decision_note"`
+	CreatedAt     time.Time          `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" db:"updated_at"`
 }
 
 // ── Lesson Content ──────────────────────────────────────────
@@ -292,6 +538,7 @@ type Appointment struct {
 	Type        AppointmentType  `json:"type" db:"type"`
 	Scope       AppointmentScope `json:"scope" db:"scope"`
 	ClassID     *uuid.UUID       `json:"class_id,omitempty" db:"class_id"`
+	GroupID     *uuid.UUID       `json:"group_id,omitempty" db:"group_id"`
 	SubjectID   *uuid.UUID       `json:"subject_id,omitempty" db:"subject_id"`
 	Date        time.Time        `json:"date" db:"date"`
 	TimeSlotID  *uuid.UUID       `json:"time_slot_id,omitempty" db:"time_slot_id"`
@@ -299,3 +546,33 @@ type Appointment struct {
 	CreatedAt   time.Time        `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time        `json:"updated_at" db:"updated_at"`
 }
+
+type NotificationCategory string
+
+const (
+	NotifySubstitution   NotificationCategory = "substitution"
+	NotifyExcuse         NotificationCategory = "excuse"
+	NotifyExam           NotificationCategory = "exam"
+	NotifyExcuseReminder NotificationCategory = "excuse_reminder"
+)
+
+// Notification is an in-app message. Title and Body are rendered from Type
+// and Params in the reader's language.
+type Notification struct {
+	ID        uuid.UUID            `json:"id" db:"id"`
+	SchoolID  uuid.UUID            `json:"school_id" db:"school_id"`
+	UserID    uuid.UUID            `json:"user_id" db:"user_id"`
+	Category  NotificationCategory `json:"category" db:"category"`
+	Type      string               `json:"type" db:"type"`
+	Params    map[string]string    `json:"params" db:"params"`
+	Title     string               `json:"title" db:"-"`
+	Body      string               `json:"body" db:"-"`
+	ReadAt    *time.Time           `json:"read_at,omitempty" db:"read_at"`
+	CreatedAt time.Time            `json:"created_at" db:"created_at"`
+}
+
+type NotificationPreference struct {
+	Category NotificationCategory `json:"category" db:"category"`
+	Email    bool                 `json:"email" db:"email"`
+	Push     bool                 `json:"push" db:"push"`
+}
@@ -0,0 +1,72 @@
+// Package notify delivers messages to users outside the app (currently e-mail).
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"strings"
+
+	"github.com/Monstroxx/eduko-backend/internal/config"
+)
+
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns an SMTP notifier when SMTP_HOST is configured and a logging
+// notifier otherwise, so development setups work without a mail server.
+func New(cfg *config.Config) Notifier {
+	if cfg.SMTPHost == "" {
+		return LogNotifier{}
+	}
+	return &SMTPNotifier{
+		addr: cfg.SMTPHost + ":" + cfg.SMTPPort,
+		host: cfg.SMTPHost,
+		user: cfg.SMTPUser,
+		pass: cfg.SMTPPassword,
+		from: cfg.SMTPFrom,
+	}
+}
+
+type LogNotifier struct{}
+
+func (LogNotifier) Send(_ context.Context, msg Message) error {
+	log.Printf("[notify] to=%s subject=%q", strings.Join(msg.To, ","), msg.Subject)
+	return nil
+}
+
+type SMTPNotifier struct {
+	addr, host, user, pass, from string
+}
+
+func (n *SMTPNotifier) Send(_ context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return nil
+	}
+	var auth smtp.Auth
+	if n.user != "" {
+		auth = smtp.PlainAuth("", n.user, n.pass, n.host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	if err := smtp.SendMail(n.addr, auth, n.from, msg.To, []byte(b.String())); err != nil {
+		return fmt.Errorf("send mail: %w", err)
+	}
+	return nil
+}
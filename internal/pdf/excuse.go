@@ -0,0 +1,193 @@
+// Package pdf renders printable documents (excuse forms, ...).
+//
+// Documents embed the Go font family so any text from the locale files or the
+// database, including umlauts and ß, renders without relying on the viewer's
+// built-in fonts.
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+
+	"github.com/Monstroxx/eduko-backend/internal/i18n"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+const (
+	fontFamily = "go"
+	margin     = 20.0
+	lineHeight = 6.0
+)
+
+func newDocument(tr i18n.Translator) *fpdf.Fpdf {
+	doc := fpdf.New("P", "mm", "A4", "")
+	doc.SetMargins(margin, margin, margin)
+	doc.SetAutoPageBreak(true, margin)
+	doc.AddUTF8FontFromBytes(fontFamily, "", goregular.TTF)
+	doc.AddUTF8FontFromBytes(fontFamily, "B", gobold.TTF)
+	doc.AliasNbPages("")
+	doc.SetFooterFunc(func() {
+		doc.SetY(-15)
+		doc.SetFont(fontFamily, "", 8)
+		doc.SetTextColor(120, 120, 120)
+		doc.CellFormat(0, 5, fmt.Sprintf("%s %d/{nb}", tr.T("excuse_pdf.page"), doc.PageNo()), "", 0, "C", false, 0, "")
+	})
+	return doc
+}
+
+// letterhead prints the school name and address followed by a rule.
+func letterhead(doc *fpdf.Fpdf, name, address string) {
+	doc.SetFont(fontFamily, "B", 14)
+	doc.SetTextColor(0, 0, 0)
+	doc.MultiCell(0, 7, name, "", "L", false)
+	if address != "" {
+		doc.SetFont(fontFamily, "", 9)
+		doc.SetTextColor(80, 80, 80)
+		doc.MultiCell(0, 4.5, address, "", "L", false)
+	}
+	doc.Ln(2)
+	x, y := doc.GetXY()
+	pageW, _ := doc.GetPageSize()
+	doc.SetDrawColor(160, 160, 160)
+	doc.Line(x, y, pageW-margin, y)
+	doc.Ln(8)
+	doc.SetTextColor(0, 0, 0)
+}
+
+// field prints a label/value pair; long values wrap within the value column.
+func field(doc *fpdf.Fpdf, label, value string) {
+	const labelW = 45.0
+	doc.SetFont(fontFamily, "B", 10)
+	doc.CellFormat(labelW, lineHeight, label, "", 0, "L", false, 0, "")
+	doc.SetFont(fontFamily, "", 10)
+	doc.MultiCell(0, lineHeight, value, "", "L", false)
+}
+
+// RenderExcuse writes the excuse form for data to w.
+func RenderExcuse(w io.Writer, data *services.ExcuseDocument, tr i18n.Translator) error {
+	doc := newDocument(tr)
+	doc.AddPage()
+	dateFmt := tr.DateFormat()
+	e := data.Excuse
+
+	letterhead(doc, data.SchoolName, data.SchoolAddress)
+
+	doc.SetFont(fontFamily, "B", 16)
+	doc.CellFormat(0, 10, tr.T("excuse_pdf.title"), "", 1, "L", false, 0, "")
+	doc.Ln(2)
+
+	field(doc, tr.T("excuse_pdf.student"), data.StudentName)
+	if data.ClassName != "" {
+		field(doc, tr.T("excuse_pdf.class"), data.ClassName)
+	}
+	period := e.DateFrom.Format(dateFmt)
+	if !e.DateTo.Equal(e.DateFrom) {
+		period += " – " + e.DateTo.Format(dateFmt)
+	}
+	field(doc, tr.T("excuse_pdf.period"), period)
+	field(doc, tr.T("excuse_pdf.status"), tr.T("excuses."+string(e.Status)))
+	field(doc, tr.T("excuse_pdf.submission_type"), tr.T("excuses."+string(e.SubmissionType)))
+	field(doc, tr.T("excuse_pdf.submitted_at"), e.SubmittedAt.Format(dateFmt+" 15:04"))
+	attestation := tr.T("excuse_pdf.no")
+	if e.AttestationProvided {
+		attestation = tr.T("excuse_pdf.yes")
+	}
+	field(doc, tr.T("excuse_pdf.attestation"), attestation)
+	reason := "–"
+	if e.Reason != nil && strings.TrimSpace(*e.Reason) != "" {
+		reason = *e.Reason
+	}
+	field(doc, tr.T("excuse_pdf.reason"), reason)
+
+	doc.Ln(6)
+	lessonTable(doc, data.Lessons, tr)
+
+	doc.Ln(16)
+	signer := tr.T("excuse_pdf.signature_guardian")
+	if data.StudentAdult {
+		signer = tr.T("excuse_pdf.signature_student")
+	}
+	teacher := tr.T("excuse_pdf.signature_class_teacher")
+	if data.ClassTeacher != "" {
+		teacher += " (" + data.ClassTeacher + ")"
+	}
+	signatures(doc, tr, signer, teacher)
+
+	return doc.Output(w)
+}
+
+func lessonTable(doc *fpdf.Fpdf, lessons []services.ExcuseLesson, tr i18n.Translator) {
+	doc.SetFont(fontFamily, "B", 11)
+	doc.CellFormat(0, 8, tr.T("excuse_pdf.lessons"), "", 1, "L", false, 0, "")
+	if len(lessons) == 0 {
+		doc.SetFont(fontFamily, "", 10)
+		doc.CellFormat(0, lineHeight, tr.T("excuse_pdf.no_lessons"), "", 1, "L", false, 0, "")
+		return
+	}
+
+	cols := []struct {
+		title string
+		width float64
+	}{
+		{tr.T("excuse_pdf.date"), 28},
+		{tr.T("excuse_pdf.slot"), 14},
+		{tr.T("excuse_pdf.time"), 28},
+		{tr.T("timetable.subject"), 50},
+		{tr.T("timetable.teacher"), 20},
+		{tr.T("excuse_pdf.status"), 30},
+	}
+	header := func() {
+		doc.SetFont(fontFamily, "B", 9)
+		doc.SetFillColor(230, 230, 230)
+		for _, col := range cols {
+			doc.CellFormat(col.width, 7, col.title, "1", 0, "L", true, 0, "")
+		}
+		doc.Ln(-1)
+		doc.SetFont(fontFamily, "", 9)
+	}
+	header()
+
+	_, pageH := doc.GetPageSize()
+	for _, l := range lessons {
+		if doc.GetY()+7 > pageH-margin {
+			doc.AddPage()
+			header()
+		}
+		cells := []string{
+			l.Date.Format(tr.DateFormat()),
+			fmt.Sprint(l.SlotNumber),
+			l.StartTime + "–" + l.EndTime,
+			l.Subject,
+			l.Teacher,
+			tr.T("attendance." + l.Status),
+		}
+		for i, col := range cols {
+			doc.CellFormat(col.width, 7, cells[i], "1", 0, "L", false, 0, "")
+		}
+		doc.Ln(-1)
+	}
+}
+
+// signatures prints two side-by-side signature lines.
+func signatures(doc *fpdf.Fpdf, tr i18n.Translator, left, right string) {
+	pageW, pageH := doc.GetPageSize()
+	if doc.GetY()+30 > pageH-margin {
+		doc.AddPage()
+	}
+	width := (pageW - 2*margin - 10) / 2
+	y := doc.GetY() + 12
+	doc.SetDrawColor(0, 0, 0)
+	doc.Line(margin, y, margin+width, y)
+	doc.Line(margin+width+10, y, pageW-margin, y)
+
+	doc.SetY(y + 1)
+	doc.SetFont(fontFamily, "", 8)
+	doc.CellFormat(width, 4, tr.T("excuse_pdf.place_date")+", "+left, "", 0, "L", false, 0, "")
+	doc.SetX(margin + width + 10)
+	doc.MultiCell(width, 4, tr.T("excuse_pdf.place_date")+", "+right, "", "L", false)
+}
@@ -0,0 +1,139 @@
+// Package scanner checks uploaded files for malware before they are released.
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Monstroxx/eduko-backend/internal/config"
+)
+
+type Status string
+
+const (
+	// StatusPending means the file has not been scanned yet (scanner
+	// unavailable); it stays quarantined until a later scan succeeds.
+	StatusPending  Status = "pending"
+	StatusClean    Status = "clean"
+	StatusInfected Status = "infected"
+	// StatusSkipped is used when no scanner is configured.
+	StatusSkipped Status = "skipped"
+)
+
+// Released reports whether files with this status may be downloaded.
+func (s Status) Released() bool {
+	return s == StatusClean || s == StatusSkipped
+}
+
+type Result struct {
+	Status    Status
+	Signature string // name of the detected malware, if infected
+}
+
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+	// Enabled is false for the no-op scanner.
+	Enabled() bool
+}
+
+// New returns a clamd scanner when CLAMD_ADDRESS is set, otherwise a no-op
+// scanner that marks every file as skipped.
+func New(cfg *config.Config) Scanner {
+	if cfg.ClamdAddress == "" {
+		return None{}
+	}
+	return NewClamd(cfg.ClamdAddress)
+}
+
+type None struct{}
+
+func (None) Scan(context.Context, io.Reader) (Result, error) {
+	return Result{Status: StatusSkipped}, nil
+}
+
+func (None) Enabled() bool { return false }
+
+// Clamd talks to a ClamAV daemon using the INSTREAM command.
+type Clamd struct {
+	network, address string
+	timeout          time.Duration
+}
+
+// NewClamd accepts a Unix socket path ("/run/clamav/clamd.ctl") or a TCP
+// address ("clamav:3310").
+func NewClamd(address string) *Clamd {
+	network := "tcp"
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	} else if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		network, address = "unix", path
+	}
+	return &Clamd{network: network, address: address, timeout: 2 * time.Minute}
+}
+
+func (c *Clamd) Enabled() bool { return true }
+
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Result{}, fmt.Errorf("connect clamd: %w", err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(c.timeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Result{}, fmt.Errorf("write clamd: %w", err)
+	}
+	buf := make([]byte, 32<<10)
+	var size [4]byte
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			if _, werr := conn.Write(append(size[:], buf[:n]...)); werr != nil {
+				return Result{}, fmt.Errorf("write clamd: %w", werr)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Result{}, fmt.Errorf("read file: %w", err)
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return Result{}, fmt.Errorf("write clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Result{}, fmt.Errorf("read clamd: %w", err)
+	}
+	return parseReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+// parseReply interprets "stream: OK" / "stream: Eicar-Signature FOUND".
+func parseReply(reply string) (Result, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return Result{Status: StatusClean}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Result{Status: StatusInfected, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("clamd: %s", reply)
+	}
+}
@@ -3,10 +3,12 @@ package services
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/Monstroxx/eduko-backend/internal/events"
 	"github.com/Monstroxx/eduko-backend/internal/models"
 )
 
@@ -24,14 +26,16 @@ type CreateAppointmentInput struct {
 	Type        string     `json:"type"`
 	Scope       string     `json:"scope"`
 	ClassID     *uuid.UUID `json:"class_id,omitempty"`
+	GroupID     *uuid.UUID `json:"group_id,omitempty"`
 	SubjectID   *uuid.UUID `json:"subject_id,omitempty"`
 	Date        string     `json:"date"`
 	TimeSlotID  *uuid.UUID `json:"time_slot_id,omitempty"`
 }
 
-func (s *AppointmentService) List(ctx context.Context, schoolID uuid.UUID, apType, classID, from, to string) ([]models.Appointment, error) {
-	query := `SELECT id, school_id, title, description, type, scope, class_id, subject_id, date, time_slot_id, created_by, created_at, updated_at
-	          FROM appointments WHERE school_id = $1`
+// List returns appointments. classID includes school-wide appointments and
+// those of course groups with students of that class.
+func (s *AppointmentService) List(ctx context.Context, schoolID uuid.UUID, apType, classID, groupID, from, to string) ([]models.Appointment, error) {
+	query := `SELECT ` + appointmentColumns + ` FROM appointments a WHERE school_id = $1`
 	args := []interface{}{schoolID}
 	n := 2
 
@@ -41,10 +45,15 @@ func (s *AppointmentService) List(ctx context.Context, schoolID uuid.UUID, apTyp
 		n++
 	}
 	if classID != "" {
-		query += fmt.Sprintf(` AND (class_id = $%d OR scope = 'school')`, n)
+		query += ` AND (scope = 'school' OR ` + entryForClass("a", fmt.Sprintf("$%d::uuid", n)) + `)`
 		args = append(args, classID)
 		n++
 	}
+	if groupID != "" {
+		query += fmt.Sprintf(` AND group_id = $%d`, n)
+		args = append(args, groupID)
+		n++
+	}
 	if from != "" {
 		query += fmt.Sprintf(` AND date >= $%d`, n)
 		args = append(args, from)
@@ -56,7 +65,40 @@ func (s *AppointmentService) List(ctx context.Context, schoolID uuid.UUID, apTyp
 		n++
 	}
 	query += ` ORDER BY date`
+	return s.query(ctx, query, args...)
+}
 
+// ForStudent returns the appointments a student takes part in between from
+// and to: school-wide ones, those of the class and those of the student's
+// course groups.
+func (s *AppointmentService) ForStudent(ctx context.Context, schoolID, studentID uuid.UUID, from, to string) ([]models.Appointment, error) {
+	return s.query(ctx,
+		`SELECT `+appointmentColumns+` FROM appointments a
+		 WHERE a.school_id = $1 AND a.date BETWEEN $3 AND $4
+		   AND (a.scope = 'school'
+		        OR (a.group_id IS NULL AND a.class_id = (SELECT class_id FROM students WHERE id = $2))
+		        OR a.group_id IN (SELECT group_id FROM course_group_members WHERE student_id = $2))
+		 ORDER BY a.date`, schoolID, studentID, from, to)
+}
+
+// ForTeacher returns school-wide appointments, those the teacher created and
+// those of classes and groups the teacher teaches between from and to.
+func (s *AppointmentService) ForTeacher(ctx context.Context, schoolID, teacherID, userID uuid.UUID, from, to string) ([]models.Appointment, error) {
+	return s.query(ctx,
+		`SELECT `+appointmentColumns+` FROM appointments a
+		 WHERE a.school_id = $1 AND a.date BETWEEN $4 AND $5
+		   AND (a.scope = 'school' OR a.created_by = $3
+		        OR EXISTS (SELECT 1 FROM timetable_entries t
+		                   WHERE t.teacher_id = $2 AND t.valid_from <= a.date
+		                     AND (t.valid_until IS NULL OR t.valid_until >= a.date)
+		                     AND (t.group_id = a.group_id OR (a.group_id IS NULL AND t.class_id = a.class_id))))
+		 ORDER BY a.date`, schoolID, teacherID, userID, from, to)
+}
+
+const appointmentColumns = `a.id, a.school_id, a.title, a.description, a.type, a.scope, a.class_id, a.group_id,
+	a.subject_id, a.date, a.time_slot_id, a.created_by, a.created_at, a.updated_at`
+
+func (s *AppointmentService) query(ctx context.Context, query string, args ...interface{}) ([]models.Appointment, error) {
 	rows, err := s.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("list appointments: %w", err)
@@ -67,41 +109,50 @@ func (s *AppointmentService) List(ctx context.Context, schoolID uuid.UUID, apTyp
 	for rows.Next() {
 		var a models.Appointment
 		if err := rows.Scan(&a.ID, &a.SchoolID, &a.Title, &a.Description, &a.Type, &a.Scope,
-			&a.ClassID, &a.SubjectID, &a.Date, &a.TimeSlotID, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			&a.ClassID, &a.GroupID, &a.SubjectID, &a.Date, &a.TimeSlotID, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan appointment: %w", err)
 		}
 		list = append(list, a)
 	}
-	return list, nil
+	return list, rows.Err()
 }
 
 func (s *AppointmentService) Create(ctx context.Context, schoolID, createdBy uuid.UUID, input CreateAppointmentInput) (*models.Appointment, error) {
 	var a models.Appointment
 	err := s.db.QueryRow(ctx,
-		`INSERT INTO appointments (school_id, title, description, type, scope, class_id, subject_id, date, time_slot_id, created_by)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		 RETURNING id, school_id, title, description, type, scope, class_id, subject_id, date, time_slot_id, created_by, created_at, updated_at`,
-		schoolID, input.Title, input.Description, input.Type, input.Scope, input.ClassID, input.SubjectID, input.Date, input.TimeSlotID, createdBy,
+		`INSERT INTO appointments (school_id, title, description, type, scope, class_id, subject_id, date, time_slot_id, created_by, group_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		 RETURNING id, school_id, title, description, type, scope, class_id, group_id, subject_id, date, time_slot_id, created_by, created_at, updated_at`,
+		schoolID, input.Title, input.Description, input.Type, input.Scope, input.ClassID, input.SubjectID, input.Date, input.TimeSlotID, createdBy, input.GroupID,
 	).Scan(&a.ID, &a.SchoolID, &a.Title, &a.Description, &a.Type, &a.Scope,
-		&a.ClassID, &a.SubjectID, &a.Date, &a.TimeSlotID, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt)
+		&a.ClassID, &a.GroupID, &a.SubjectID, &a.Date, &a.TimeSlotID, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("create appointment: %w", err)
 	}
+	if err := publishAppointment(ctx, s.db, events.AppointmentCreated, &a); err != nil {
+		log.Printf("[events] %v", err)
+	}
+	if err := notifyExam(ctx, s.db, &a); err != nil {
+		log.Printf("[notifications] %v", err)
+	}
 	return &a, nil
 }
 
 func (s *AppointmentService) Update(ctx context.Context, schoolID, apID uuid.UUID, input CreateAppointmentInput) (*models.Appointment, error) {
 	var a models.Appointment
 	err := s.db.QueryRow(ctx,
-		`UPDATE appointments SET title=$3, description=$4, type=$5, scope=$6, class_id=$7, subject_id=$8, date=$9, time_slot_id=$10, updated_at=now()
+		`UPDATE appointments SET title=$3, description=$4, type=$5, scope=$6, class_id=$7, subject_id=$8, date=$9, time_slot_id=$10, group_id=$11, updated_at=now()
 		 WHERE id=$1 AND school_id=$2
-		 RETURNING id, school_id, title, description, type, scope, class_id, subject_id, date, time_slot_id, created_by, created_at, updated_at`,
-		apID, schoolID, input.Title, input.Description, input.Type, input.Scope, input.ClassID, input.SubjectID, input.Date, input.TimeSlotID,
+		 RETURNING id, school_id, title, description, type, scope, class_id, group_id, subject_id, date, time_slot_id, created_by, created_at, updated_at`,
+		apID, schoolID, input.Title, input.Description, input.Type, input.Scope, input.ClassID, input.SubjectID, input.Date, input.TimeSlotID, input.GroupID,
 	).Scan(&a.ID, &a.SchoolID, &a.Title, &a.Description, &a.Type, &a.Scope,
-		&a.ClassID, &a.SubjectID, &a.Date, &a.TimeSlotID, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt)
+		&a.ClassID, &a.GroupID, &a.SubjectID, &a.Date, &a.TimeSlotID, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("update appointment: %w", err)
 	}
+	if err := publishAppointment(ctx, s.db, events.AppointmentUpdated, &a); err != nil {
+		log.Printf("[events] %v", err)
+	}
 	return &a, nil
 }
 
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+var ErrEntryNotFound = errors.New("timetable entry not found")
+
+// Roster is a student expected in a lesson, with the attendance recorded for
+// the date if any.
+type Roster struct {
+	StudentID    uuid.UUID                `json:"student_id"`
+	ClassID      *uuid.UUID               `json:"class_id,omitempty"`
+	ClassName    *string                  `json:"class_name,omitempty"`
+	FirstName    string                   `json:"first_name"`
+	LastName     string                   `json:"last_name"`
+	AttendanceID *uuid.UUID               `json:"attendance_id,omitempty"`
+	Status       *models.AttendanceStatus `json:"status,omitempty"`
+	Note         *string                  `json:"note,omitempty"`
+}
+
+// Roster lists the students of a lesson on date: the group members for group
+// lessons, otherwise the class.
+func (s *AttendanceService) Roster(ctx context.Context, schoolID, entryID uuid.UUID, date string) ([]Roster, error) {
+	var exists bool
+	if err := s.db.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM timetable_entries WHERE id = $1 AND school_id = $2)`,
+		entryID, schoolID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("get timetable entry: %w", err)
+	}
+	if !exists {
+		return nil, ErrEntryNotFound
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT st.id, st.class_id, c.name, u.first_name, u.last_name, a.id, a.status, a.note
+		 FROM timetable_entries t
+		 JOIN students st ON st.school_id = t.school_id AND `+attends("st", "t")+`
+		 JOIN users u ON u.id = st.user_id
+		 LEFT JOIN classes c ON c.id = st.class_id
+		 LEFT JOIN attendance a ON a.student_id = st.id AND a.timetable_entry_id = t.id AND a.date = $3
+		 WHERE t.id = $1 AND t.school_id = $2
+		 ORDER BY c.name, u.last_name, u.first_name`,
+		entryID, schoolID, date)
+	if err != nil {
+		return nil, fmt.Errorf("get roster: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]Roster, 0)
+	for rows.Next() {
+		var r Roster
+		if err := rows.Scan(&r.StudentID, &r.ClassID, &r.ClassName, &r.FirstName, &r.LastName,
+			&r.AttendanceID, &r.Status, &r.Note); err != nil {
+			return nil, fmt.Errorf("scan roster: %w", err)
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
@@ -3,8 +3,10 @@ package services
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/Monstroxx/eduko-backend/internal/models"
@@ -41,13 +43,20 @@ type BatchAttendanceInput struct {
 	} `json:"entries"`
 }
 
+// keepLeaveStatus is the ON CONFLICT status expression for attendance upserts:
+// a lesson pre-filled as excused_leave by a granted leave request is not
+// downgraded to absent when the teacher records the rest of the class.
+const keepLeaveStatus = `CASE WHEN attendance.status = 'excused_leave' AND EXCLUDED.status = 'absent'
+	     AND EXISTS (SELECT 1 FROM leave_attendance la WHERE la.attendance_id = attendance.id)
+	THEN attendance.status ELSE EXCLUDED.status END`
+
 func (s *AttendanceService) Record(ctx context.Context, schoolID, recordedBy uuid.UUID, input RecordAttendanceInput) (*models.Attendance, error) {
 	var a models.Attendance
 	err := s.db.QueryRow(ctx,
 		`INSERT INTO attendance (school_id, student_id, timetable_entry_id, date, status, recorded_by, note)
 		 VALUES ($1, $2, $3, $4, $5, $6, $7)
 		 ON CONFLICT (student_id, timetable_entry_id, date)
-		 DO UPDATE SET status = $5, note = $7, recorded_by = $6, updated_at = now()
+		 DO UPDATE SET status = `+keepLeaveStatus+`, note = $7, recorded_by = $6, updated_at = now()
 		 RETURNING id, school_id, student_id, timetable_entry_id, date, status, recorded_by, note, created_at, updated_at`,
 		schoolID, input.StudentID, input.TimetableEntryID, input.Date, input.Status, recordedBy, input.Note,
 	).Scan(&a.ID, &a.SchoolID, &a.StudentID, &a.TimetableEntryID, &a.Date,
@@ -55,6 +64,9 @@ func (s *AttendanceService) Record(ctx context.Context, schoolID, recordedBy uui
 	if err != nil {
 		return nil, fmt.Errorf("record attendance: %w", err)
 	}
+	if err := publishAttendance(ctx, s.db, &a); err != nil {
+		log.Printf("[events] %v", err)
+	}
 	return &a, nil
 }
 
@@ -67,16 +79,21 @@ func (s *AttendanceService) RecordBatch(ctx context.Context, schoolID, recordedB
 
 	count := 0
 	for _, entry := range input.Entries {
-		_, err := tx.Exec(ctx,
+		var a models.Attendance
+		err := tx.QueryRow(ctx,
 			`INSERT INTO attendance (school_id, student_id, timetable_entry_id, date, status, recorded_by, note)
 			 VALUES ($1, $2, $3, $4, $5, $6, $7)
 			 ON CONFLICT (student_id, timetable_entry_id, date)
-			 DO UPDATE SET status = $5, note = $7, recorded_by = $6, updated_at = now()`,
+			 DO UPDATE SET status = `+keepLeaveStatus+`, note = $7, recorded_by = $6, updated_at = now()
+			 RETURNING id, school_id, student_id, timetable_entry_id, date, status`,
 			schoolID, entry.StudentID, input.TimetableEntryID, input.Date, entry.Status, recordedBy, entry.Note,
-		)
+		).Scan(&a.ID, &a.SchoolID, &a.StudentID, &a.TimetableEntryID, &a.Date, &a.Status)
 		if err != nil {
 			return 0, fmt.Errorf("record attendance entry: %w", err)
 		}
+		if err := savepoint(ctx, tx, func(db pgx.Tx) error { return publishAttendance(ctx, db, &a) }); err != nil {
+			log.Printf("[events] %v", err)
+		}
 		count++
 	}
 
@@ -98,17 +115,21 @@ func (s *AttendanceService) Update(ctx context.Context, schoolID, attendanceID u
 	if err != nil {
 		return nil, fmt.Errorf("update attendance: %w", err)
 	}
+	if err := publishAttendance(ctx, s.db, &a); err != nil {
+		log.Printf("[events] %v", err)
+	}
 	return &a, nil
 }
 
 func (s *AttendanceService) GetByClass(ctx context.Context, schoolID, classID uuid.UUID, date string) ([]models.Attendance, error) {
 	rows, err := s.db.Query(ctx,
 		`SELECT a.id, a.school_id, a.student_id, a.timetable_entry_id, a.date, a.status, a.recorded_by, a.note, a.created_at, a.updated_at,
-		        s.first_name || ' ' || s.last_name AS student_name
+		        u.first_name || ' ' || u.last_name AS student_name
 		 FROM attendance a
 		 JOIN students s ON s.id = a.student_id
+		 JOIN users u ON u.id = s.user_id
 		 WHERE a.school_id = $1 AND s.class_id = $2 AND a.date = $3
-		 ORDER BY s.last_name, s.first_name`,
+		 ORDER BY u.last_name, u.first_name`,
 		schoolID, classID, date)
 	if err != nil {
 		return nil, fmt.Errorf("get class attendance: %w", err)
@@ -130,11 +151,12 @@ func (s *AttendanceService) GetByClass(ctx context.Context, schoolID, classID uu
 func (s *AttendanceService) GetByDate(ctx context.Context, schoolID uuid.UUID, date string) ([]models.Attendance, error) {
 	rows, err := s.db.Query(ctx,
 		`SELECT a.id, a.school_id, a.student_id, a.timetable_entry_id, a.date, a.status, a.recorded_by, a.note, a.created_at, a.updated_at,
-		        s.first_name || ' ' || s.last_name AS student_name
+		        u.first_name || ' ' || u.last_name AS student_name
 		 FROM attendance a
 		 JOIN students s ON s.id = a.student_id
+		 JOIN users u ON u.id = s.user_id
 		 WHERE a.school_id = $1 AND a.date = $2
-		 ORDER BY s.last_name, s.first_name`,
+		 ORDER BY u.last_name, u.first_name`,
 		schoolID, date)
 	if err != nil {
 		return nil, fmt.Errorf("get attendance by date: %w", err)
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/i18n"
+	"github.com/Monstroxx/eduko-backend/internal/ical"
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+var ErrFeedNotFound = errors.New("calendar feed not found")
+
+// CalendarFeedService manages the secret ICS subscription URLs and renders
+// their content: the effective timetable and appointments of the owner.
+type CalendarFeedService struct {
+	db *pgxpool.Pool
+}
+
+func NewCalendarFeedService(db *pgxpool.Pool) *CalendarFeedService {
+	return &CalendarFeedService{db: db}
+}
+
+func hashFeedToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+const calendarFeedColumns = `user_id, school_id, created_at, last_used_at`
+
+func scanCalendarFeed(row pgx.Row) (*models.CalendarFeed, error) {
+	var f models.CalendarFeed
+	if err := row.Scan(&f.UserID, &f.SchoolID, &f.CreatedAt, &f.LastUsedAt); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Get returns the user's feed without its token.
+func (s *CalendarFeedService) Get(ctx context.Context, userID uuid.UUID) (*models.CalendarFeed, error) {
+	f, err := scanCalendarFeed(s.db.QueryRow(ctx,
+		`SELECT `+calendarFeedColumns+` FROM calendar_feeds WHERE user_id = $1`, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrFeedNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get calendar feed: %w", err)
+	}
+	return f, nil
+}
+
+// Regenerate creates a new token for the user, replacing (and so revoking)
+// any previous one. The token is only returned here.
+func (s *CalendarFeedService) Regenerate(ctx context.Context, schoolID, userID uuid.UUID) (string, *models.CalendarFeed, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("generate feed token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	f, err := scanCalendarFeed(s.db.QueryRow(ctx,
+		`INSERT INTO calendar_feeds (user_id, school_id, token_hash)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (user_id) DO UPDATE
+		 SET token_hash = EXCLUDED.token_hash, created_at = now(), last_used_at = NULL
+		 RETURNING `+calendarFeedColumns,
+		userID, schoolID, hashFeedToken(token)))
+	if err != nil {
+		return "", nil, fmt.Errorf("create calendar feed: %w", err)
+	}
+	return token, f, nil
+}
+
+func (s *CalendarFeedService) Revoke(ctx context.Context, userID uuid.UUID) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM calendar_feeds WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("revoke calendar feed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFeedNotFound
+	}
+	return nil
+}
+
+// FeedOwner is the user a feed token belongs to.
+type FeedOwner struct {
+	UserID       uuid.UUID
+	SchoolID     uuid.UUID
+	Role         string
+	Locale       *string
+	SchoolLocale string
+	Timezone     string
+}
+
+// Resolve looks up the owner of token and records the access.
+func (s *CalendarFeedService) Resolve(ctx context.Context, token string) (*FeedOwner, error) {
+	var o FeedOwner
+	err := s.db.QueryRow(ctx,
+		`UPDATE calendar_feeds f SET last_used_at = now()
+		 FROM users u, schools sc
+		 WHERE f.token_hash = $1 AND u.id = f.user_id AND sc.id = f.school_id AND u.is_active
+		 RETURNING f.user_id, f.school_id, u.role, u.locale, sc.locale, sc.timezone`,
+		hashFeedToken(token)).Scan(&o.UserID, &o.SchoolID, &o.Role, &o.Locale, &o.SchoolLocale, &o.Timezone)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrFeedNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolve calendar feed: %w", err)
+	}
+	return &o, nil
+}
+
+// Events returns the owner's lessons and appointments in [from, to]:
+// students and guardians get the students' timetables, teachers their own.
+// Every lesson keeps its UID when it is substituted or cancelled, so
+// subscribed calendars update the event instead of adding one.
+func (s *CalendarFeedService) Events(ctx context.Context, o *FeedOwner, from, to time.Time, tr i18n.Translator) ([]ical.VEvent, error) {
+	loc, err := time.LoadLocation(o.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	fromDate, toDate := from.Format(dateLayout), to.Format(dateLayout)
+	timetables := NewTimetableService(s.db)
+	appointmentSvc := NewAppointmentService(s.db)
+
+	var filters []TimetableFilter
+	var appointments []models.Appointment
+	teacherView := false
+	switch o.Role {
+	case "student", "guardian":
+		query := `SELECT id FROM students WHERE user_id = $1 AND school_id = $2`
+		if o.Role == "guardian" {
+			query = `SELECT s.id FROM student_guardians g JOIN students s ON s.id = g.student_id
+			         WHERE g.user_id = $1 AND s.school_id = $2`
+		}
+		rows, err := s.db.Query(ctx, query, o.UserID, o.SchoolID)
+		if err != nil {
+			return nil, fmt.Errorf("get feed students: %w", err)
+		}
+		var studentIDs []uuid.UUID
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scan feed student: %w", err)
+			}
+			studentIDs = append(studentIDs, id)
+		}
+		rows.Close()
+		for i := range studentIDs {
+			filters = append(filters, TimetableFilter{StudentID: &studentIDs[i]})
+			list, err := appointmentSvc.ForStudent(ctx, o.SchoolID, studentIDs[i], fromDate, toDate)
+			if err != nil {
+				return nil, err
+			}
+			appointments = append(appointments, list...)
+		}
+	case "teacher":
+		var teacherID uuid.UUID
+		err := s.db.QueryRow(ctx, `SELECT id FROM teachers WHERE user_id = $1 AND school_id = $2`,
+			o.UserID, o.SchoolID).Scan(&teacherID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get feed teacher: %w", err)
+		}
+		teacherView = true
+		filters = append(filters, TimetableFilter{TeacherID: &teacherID})
+		if appointments, err = appointmentSvc.ForTeacher(ctx, o.SchoolID, teacherID, o.UserID, fromDate, toDate); err != nil {
+			return nil, err
+		}
+	default:
+		if appointments, err = appointmentSvc.List(ctx, o.SchoolID, "", "", "", fromDate, toDate); err != nil {
+			return nil, err
+		}
+	}
+
+	events := make([]ical.VEvent, 0)
+	seen := map[string]bool{}
+	add := func(ev ical.VEvent) {
+		// Siblings in one class share lessons.
+		if !seen[ev.UID] {
+			seen[ev.UID] = true
+			events = append(events, ev)
+		}
+	}
+
+	for _, f := range filters {
+		days, err := timetables.Effective(ctx, o.SchoolID, f, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, day := range days {
+			date, _ := time.ParseInLocation(dateLayout, day.Date, loc)
+			for _, l := range day.Lessons {
+				add(lessonEvent(l, date, teacherView, tr))
+			}
+		}
+	}
+
+	slots, err := NewResourceService(s.db).ListTimeSlots(ctx, o.SchoolID)
+	if err != nil {
+		return nil, err
+	}
+	slotByID := map[uuid.UUID]models.TimeSlot{}
+	for _, ts := range slots {
+		slotByID[ts.ID] = ts
+	}
+	for _, a := range appointments {
+		add(appointmentEvent(a, slotByID, loc, tr))
+	}
+	return events, nil
+}
+
+// atTime returns date (midnight in the school's zone) at clock, a TIME value
+// such as "08:00:00".
+func atTime(date time.Time, clock *string) (time.Time, bool) {
+	if clock == nil {
+		return date, false
+	}
+	t, err := time.Parse("15:04:05", *clock)
+	if err != nil {
+		if t, err = time.Parse("15:04", *clock); err != nil {
+			return date, false
+		}
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), 0, 0, date.Location()), true
+}
+
+func lessonEvent(l EffectiveLesson, date time.Time, teacherView bool, tr i18n.Translator) ical.VEvent {
+	ev := ical.VEvent{UID: fmt.Sprintf("lesson-%s-%s@eduko", l.ID, date.Format("20060102"))}
+	if l.Status == LessonExtra && l.Change != nil {
+		ev.UID = fmt.Sprintf("substitution-%s@eduko", l.Change.SubstitutionID)
+	}
+
+	if l.SubjectName != nil {
+		ev.Summary = *l.SubjectName
+	} else if l.SubjectAbbreviation != nil {
+		ev.Summary = *l.SubjectAbbreviation
+	}
+	if teacherView {
+		switch {
+		case l.GroupName != nil:
+			ev.Summary += " " + *l.GroupName
+		case l.ClassName != nil:
+			ev.Summary += " " + *l.ClassName
+		}
+	}
+	if l.Change != nil {
+		ev.Summary = tr.T("substitutions."+string(l.Change.Type)) + ": " + ev.Summary
+		if l.Change.Note != nil {
+			ev.Description = *l.Change.Note
+		}
+	}
+	ev.Cancelled = l.Status == LessonCancelled
+	if l.RoomName != nil {
+		ev.Location = *l.RoomName
+	}
+	if !teacherView && l.TeacherName != nil {
+		if ev.Description != "" {
+			ev.Description = *l.TeacherName + "\n" + ev.Description
+		} else {
+			ev.Description = *l.TeacherName
+		}
+	}
+
+	var okStart, okEnd bool
+	ev.Start, okStart = atTime(date, l.TimeSlotStart)
+	ev.End, okEnd = atTime(date, l.TimeSlotEnd)
+	if !okStart || !okEnd {
+		ev.Start, ev.End, ev.AllDay = date, date, true
+	}
+	return ev
+}
+
+func appointmentEvent(a models.Appointment, slots map[uuid.UUID]models.TimeSlot, loc *time.Location, tr i18n.Translator) ical.VEvent {
+	date := time.Date(a.Date.Year(), a.Date.Month(), a.Date.Day(), 0, 0, 0, 0, loc)
+	ev := ical.VEvent{
+		UID:     fmt.Sprintf("appointment-%s@eduko", a.ID),
+		Summary: tr.T("appointments."+string(a.Type)) + ": " + a.Title,
+		Start:   date,
+		End:     date,
+		AllDay:  true,
+	}
+	if a.Description != nil {
+		ev.Description = *a.Description
+	}
+	if a.TimeSlotID != nil {
+		if ts, ok := slots[*a.TimeSlotID]; ok {
+			start, okStart := atTime(date, &ts.StartTime)
+			end, okEnd := atTime(date, &ts.EndTime)
+			if okStart && okEnd {
+				ev.Start, ev.End, ev.AllDay = start, end, false
+			}
+		}
+	}
+	return ev
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/ical"
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+var (
+	ErrCalendarInvalidRange = errors.New("invalid date range")
+	ErrCalendarNotFound     = errors.New("calendar entry not found")
+)
+
+// lessonFree is the SQL condition for dates without lessons: dates in a
+// holiday or non-teaching day, and, once the school has school years, dates
+// outside all of them. school and date are SQL expressions.
+func lessonFree(school, date string) string {
+	return `(EXISTS (SELECT 1 FROM holidays h WHERE h.school_id = ` + school + `
+	                 AND ` + date + ` BETWEEN h.date_from AND h.date_to)
+	 OR (EXISTS (SELECT 1 FROM school_years y WHERE y.school_id = ` + school + `)
+	     AND NOT EXISTS (SELECT 1 FROM school_years y WHERE y.school_id = ` + school + `
+	                     AND ` + date + ` BETWEEN y.start_date AND y.end_date)))`
+}
+
+// schoolDay is the SQL condition for Monday–Friday dates with lessons.
+func schoolDay(school, date string) string {
+	return `(EXTRACT(ISODOW FROM ` + date + `) < 6 AND NOT ` + lessonFree(school, date) + `)`
+}
+
+// addSchoolDays is the SQL expression for the date n school days after date
+// (date itself when n is 0).
+func addSchoolDays(school, date, n string) string {
+	return `(CASE WHEN ` + n + ` <= 0 THEN ` + date + ` ELSE
+	    (SELECT d::date FROM generate_series(` + date + ` + 1, ` + date + ` + 7 * ` + n + ` + 366, interval '1 day') d
+	     WHERE ` + schoolDay(school, "d::date") + `
+	     ORDER BY d OFFSET ` + n + ` - 1 LIMIT 1) END)`
+}
+
+type CalendarService struct {
+	db *pgxpool.Pool
+}
+
+func NewCalendarService(db *pgxpool.Pool) *CalendarService {
+	return &CalendarService{db: db}
+}
+
+// Calendar answers date questions for one school within a loaded range.
+type Calendar struct {
+	holidays map[string]string
+	years    []models.SchoolYear
+}
+
+// Holiday returns the name of the holiday or non-teaching day on d.
+func (c *Calendar) Holiday(d time.Time) (string, bool) {
+	name, ok := c.holidays[d.Format(dateLayout)]
+	return name, ok
+}
+
+// InSchoolYear reports whether d lies in a school year. Without any school
+// years every date does.
+func (c *Calendar) InSchoolYear(d time.Time) bool {
+	if len(c.years) == 0 {
+		return true
+	}
+	for _, y := range c.years {
+		if !d.Before(y.StartDate) && !d.After(y.EndDate) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasLessons reports whether lessons can take place on d at all.
+func (c *Calendar) HasLessons(d time.Time) bool {
+	_, holiday := c.Holiday(d)
+	return !holiday && c.InSchoolYear(d)
+}
+
+// IsSchoolDay reports whether d is a Monday–Friday with lessons.
+func (c *Calendar) IsSchoolDay(d time.Time) bool {
+	return isoWeekday(d) < 6 && c.HasLessons(d)
+}
+
+// SchoolDays counts the school days in [from, to].
+func (c *Calendar) SchoolDays(from, to time.Time) int {
+	n := 0
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if c.IsSchoolDay(d) {
+			n++
+		}
+	}
+	return n
+}
+
+// Load reads the school years and holidays that touch [from, to]. The
+// Calendar only answers for dates in that range.
+func (s *CalendarService) Load(ctx context.Context, schoolID uuid.UUID, from, to time.Time) (*Calendar, error) {
+	c := &Calendar{holidays: map[string]string{}}
+	years, err := s.ListSchoolYears(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	c.years = years
+
+	holidays, err := s.ListHolidays(ctx, schoolID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range holidays {
+		for d := h.DateFrom; !d.After(h.DateTo); d = d.AddDate(0, 0, 1) {
+			if _, ok := c.holidays[d.Format(dateLayout)]; !ok {
+				c.holidays[d.Format(dateLayout)] = h.Name
+			}
+		}
+	}
+	return c, nil
+}
+
+// ── School years ────────────────────────────────────────────
+
+const schoolYearColumns = `id, school_id, name, start_date, end_date, created_at`
+
+func scanSchoolYear(row pgx.Row) (*models.SchoolYear, error) {
+	var y models.SchoolYear
+	if err := row.Scan(&y.ID, &y.SchoolID, &y.Name, &y.StartDate, &y.EndDate, &y.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &y, nil
+}
+
+func (s *CalendarService) ListSchoolYears(ctx context.Context, schoolID uuid.UUID) ([]models.SchoolYear, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+schoolYearColumns+` FROM school_years WHERE school_id = $1 ORDER BY start_date`, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list school years: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.SchoolYear, 0)
+	for rows.Next() {
+		y, err := scanSchoolYear(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan school year: %w", err)
+		}
+		list = append(list, *y)
+	}
+	return list, rows.Err()
+}
+
+type CreateSchoolYearInput struct {
+	Name      string `json:"name"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
+
+func (s *CalendarService) CreateSchoolYear(ctx context.Context, schoolID uuid.UUID, input CreateSchoolYearInput) (*models.SchoolYear, error) {
+	if _, _, err := parseRange(input.StartDate, input.EndDate); err != nil || input.Name == "" {
+		return nil, ErrCalendarInvalidRange
+	}
+	y, err := scanSchoolYear(s.db.QueryRow(ctx,
+		`INSERT INTO school_years (school_id, name, start_date, end_date)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+schoolYearColumns,
+		schoolID, input.Name, input.StartDate, input.EndDate))
+	if err != nil {
+		return nil, fmt.Errorf("create school year: %w", err)
+	}
+	return y, nil
+}
+
+func (s *CalendarService) DeleteSchoolYear(ctx context.Context, schoolID, id uuid.UUID) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM school_years WHERE id = $1 AND school_id = $2`, id, schoolID)
+	if err != nil {
+		return fmt.Errorf("delete school year: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCalendarNotFound
+	}
+	return nil
+}
+
+// ── Holidays and non-teaching days ──────────────────────────
+
+const holidayColumns = `id, school_id, name, kind, date_from, date_to, uid, created_at`
+
+func scanHoliday(row pgx.Row) (*models.Holiday, error) {
+	var h models.Holiday
+	if err := row.Scan(&h.ID, &h.SchoolID, &h.Name, &h.Kind, &h.DateFrom, &h.DateTo, &h.UID, &h.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func parseRange(from, to string) (time.Time, time.Time, error) {
+	f, err := time.Parse(dateLayout, from)
+	if err != nil {
+		return f, f, ErrCalendarInvalidRange
+	}
+	t, err := time.Parse(dateLayout, to)
+	if err != nil || t.Before(f) {
+		return f, t, ErrCalendarInvalidRange
+	}
+	return f, t, nil
+}
+
+// ListHolidays returns the holidays and non-teaching days overlapping
+// [from, to].
+func (s *CalendarService) ListHolidays(ctx context.Context, schoolID uuid.UUID, from, to time.Time) ([]models.Holiday, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+holidayColumns+` FROM holidays
+		 WHERE school_id = $1 AND date_from <= $3 AND date_to >= $2
+		 ORDER BY date_from`, schoolID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("list holidays: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.Holiday, 0)
+	for rows.Next() {
+		h, err := scanHoliday(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan holiday: %w", err)
+		}
+		list = append(list, *h)
+	}
+	return list, rows.Err()
+}
+
+type CreateHolidayInput struct {
+	Name     string                 `json:"name"`
+	Kind     models.CalendarDayKind `json:"kind"`
+	DateFrom string                 `json:"date_from"`
+	DateTo   string                 `json:"date_to"`
+}
+
+func (s *CalendarService) CreateHoliday(ctx context.Context, schoolID uuid.UUID, input CreateHolidayInput) (*models.Holiday, error) {
+	if input.DateTo == "" {
+		input.DateTo = input.DateFrom
+	}
+	if input.Kind == "" {
+		input.Kind = models.DayHoliday
+	}
+	if _, _, err := parseRange(input.DateFrom, input.DateTo); err != nil || input.Name == "" {
+		return nil, ErrCalendarInvalidRange
+	}
+	h, err := scanHoliday(s.db.QueryRow(ctx,
+		`INSERT INTO holidays (school_id, name, kind, date_from, date_to)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING `+holidayColumns,
+		schoolID, input.Name, input.Kind, input.DateFrom, input.DateTo))
+	if err != nil {
+		return nil, fmt.Errorf("create holiday: %w", err)
+	}
+	return h, nil
+}
+
+func (s *CalendarService) DeleteHoliday(ctx context.Context, schoolID, id uuid.UUID) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM holidays WHERE id = $1 AND school_id = $2`, id, schoolID)
+	if err != nil {
+		return fmt.Errorf("delete holiday: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCalendarNotFound
+	}
+	return nil
+}
+
+// ImportHolidays stores the events of an ICS file as holidays. Events are
+// matched by UID, so importing an updated file changes existing entries
+// instead of duplicating them. Events without UID are always inserted.
+func (s *CalendarService) ImportHolidays(ctx context.Context, schoolID uuid.UUID, events []ical.Event) (inserted, updated int, err error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, ev := range events {
+		var uid *string
+		if ev.UID != "" {
+			uid = &ev.UID
+		}
+		name := ev.Summary
+		if name == "" {
+			name = "Ferien"
+		}
+		var wasInserted bool
+		err := tx.QueryRow(ctx,
+			`INSERT INTO holidays (school_id, name, date_from, date_to, uid)
+			 VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (school_id, uid) DO UPDATE
+			 SET name = EXCLUDED.name, date_from = EXCLUDED.date_from, date_to = EXCLUDED.date_to
+			 RETURNING xmax = 0`,
+			schoolID, name, ev.Start, ev.End, uid).Scan(&wasInserted)
+		if err != nil {
+			return 0, 0, fmt.Errorf("import holiday %q: %w", name, err)
+		}
+		if wasInserted {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("commit: %w", err)
+	}
+	return inserted, updated, nil
+}
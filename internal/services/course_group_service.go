@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+var (
+	ErrGroupNotFound = errors.New("course group not found")
+	ErrGroupMember   = errors.New("student not found in this school")
+)
+
+// attends is the SQL condition for "student st takes part in timetable entry
+// t": members of the entry's group, or the whole class when it has none. st
+// and t are table aliases.
+func attends(st, t string) string {
+	return `(CASE WHEN ` + t + `.group_id IS NULL THEN ` + st + `.class_id = ` + t + `.class_id
+	 ELSE EXISTS (SELECT 1 FROM course_group_members gm
+	              WHERE gm.group_id = ` + t + `.group_id AND gm.student_id = ` + st + `.id) END)`
+}
+
+// entryForClass is the SQL condition for entries a class takes part in: its
+// own lessons and the groups any of its students belong to.
+func entryForClass(t, classID string) string {
+	return `(` + t + `.class_id = ` + classID + `
+	 OR EXISTS (SELECT 1 FROM course_group_members gm JOIN students gs ON gs.id = gm.student_id
+	            WHERE gm.group_id = ` + t + `.group_id AND gs.class_id = ` + classID + `))`
+}
+
+// entryForStudent is the SQL condition for entries a student attends.
+func entryForStudent(t, studentID string) string {
+	return `EXISTS (SELECT 1 FROM students st WHERE st.id = ` + studentID + ` AND ` + attends("st", t) + `)`
+}
+
+type CourseGroupService struct {
+	db *pgxpool.Pool
+}
+
+func NewCourseGroupService(db *pgxpool.Pool) *CourseGroupService {
+	return &CourseGroupService{db: db}
+}
+
+const courseGroupColumns = `g.id, g.school_id, g.name, g.class_id, g.subject_id,
+	(SELECT COUNT(*) FROM course_group_members m WHERE m.group_id = g.id), g.created_at`
+
+func scanCourseGroup(row pgx.Row) (*models.CourseGroup, error) {
+	var g models.CourseGroup
+	if err := row.Scan(&g.ID, &g.SchoolID, &g.Name, &g.ClassID, &g.SubjectID, &g.MemberCount, &g.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// List returns the school's groups. classID restricts it to groups with
+// students of that class, studentID to the groups of one student.
+func (s *CourseGroupService) List(ctx context.Context, schoolID uuid.UUID, classID, studentID string) ([]models.CourseGroup, error) {
+	query := `SELECT ` + courseGroupColumns + ` FROM course_groups g WHERE g.school_id = $1`
+	args := []interface{}{schoolID}
+	n := 2
+
+	if classID != "" {
+		query += fmt.Sprintf(` AND (g.class_id = $%d OR EXISTS (
+		    SELECT 1 FROM course_group_members m JOIN students st ON st.id = m.student_id
+		    WHERE m.group_id = g.id AND st.class_id = $%d))`, n, n)
+		args = append(args, classID)
+		n++
+	}
+	if studentID != "" {
+		query += fmt.Sprintf(` AND EXISTS (SELECT 1 FROM course_group_members m WHERE m.group_id = g.id AND m.student_id = $%d)`, n)
+		args = append(args, studentID)
+		n++
+	}
+	query += ` ORDER BY g.name`
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list course groups: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.CourseGroup, 0)
+	for rows.Next() {
+		g, err := scanCourseGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan course group: %w", err)
+		}
+		list = append(list, *g)
+	}
+	return list, rows.Err()
+}
+
+func (s *CourseGroupService) GetByID(ctx context.Context, schoolID, groupID uuid.UUID) (*models.CourseGroup, error) {
+	g, err := scanCourseGroup(s.db.QueryRow(ctx,
+		`SELECT `+courseGroupColumns+` FROM course_groups g WHERE g.id = $1 AND g.school_id = $2`,
+		groupID, schoolID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get course group: %w", err)
+	}
+	return g, nil
+}
+
+type CreateCourseGroupInput struct {
+	Name       string      `json:"name"`
+	ClassID    *uuid.UUID  `json:"class_id,omitempty"`
+	SubjectID  *uuid.UUID  `json:"subject_id,omitempty"`
+	StudentIDs []uuid.UUID `json:"student_ids,omitempty"`
+}
+
+// Create stores a group together with its initial members.
+func (s *CourseGroupService) Create(ctx context.Context, schoolID uuid.UUID, input CreateCourseGroupInput) (*models.CourseGroup, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var groupID uuid.UUID
+	err = tx.QueryRow(ctx,
+		`INSERT INTO course_groups (school_id, name, class_id, subject_id)
+		 VALUES ($1, $2, $3, $4) RETURNING id`,
+		schoolID, input.Name, input.ClassID, input.SubjectID).Scan(&groupID)
+	if err != nil {
+		return nil, fmt.Errorf("create course group: %w", err)
+	}
+	if err := addMembers(ctx, tx, schoolID, groupID, input.StudentIDs); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return s.GetByID(ctx, schoolID, groupID)
+}
+
+func (s *CourseGroupService) Update(ctx context.Context, schoolID, groupID uuid.UUID, input CreateCourseGroupInput) (*models.CourseGroup, error) {
+	tag, err := s.db.Exec(ctx,
+		`UPDATE course_groups SET name = $3, class_id = $4, subject_id = $5
+		 WHERE id = $1 AND school_id = $2`,
+		groupID, schoolID, input.Name, input.ClassID, input.SubjectID)
+	if err != nil {
+		return nil, fmt.Errorf("update course group: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrGroupNotFound
+	}
+	return s.GetByID(ctx, schoolID, groupID)
+}
+
+// Delete removes the group and, through ON DELETE CASCADE, its timetable
+// entries and appointments.
+func (s *CourseGroupService) Delete(ctx context.Context, schoolID, groupID uuid.UUID) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM course_groups WHERE id = $1 AND school_id = $2`, groupID, schoolID)
+	if err != nil {
+		return fmt.Errorf("delete course group: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// Members returns the students of a group, ordered by class and name.
+func (s *CourseGroupService) Members(ctx context.Context, schoolID, groupID uuid.UUID) ([]Roster, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT st.id, st.class_id, c.name, u.first_name, u.last_name
+		 FROM course_group_members m
+		 JOIN course_groups g ON g.id = m.group_id
+		 JOIN students st ON st.id = m.student_id
+		 JOIN users u ON u.id = st.user_id
+		 LEFT JOIN classes c ON c.id = st.class_id
+		 WHERE m.group_id = $1 AND g.school_id = $2
+		 ORDER BY c.name, u.last_name, u.first_name`, groupID, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list group members: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]Roster, 0)
+	for rows.Next() {
+		var r Roster
+		if err := rows.Scan(&r.StudentID, &r.ClassID, &r.ClassName, &r.FirstName, &r.LastName); err != nil {
+			return nil, fmt.Errorf("scan group member: %w", err)
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// AddMembers adds students to a group; students already in it are skipped.
+func (s *CourseGroupService) AddMembers(ctx context.Context, schoolID, groupID uuid.UUID, studentIDs []uuid.UUID) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	if err := tx.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM course_groups WHERE id = $1 AND school_id = $2)`,
+		groupID, schoolID).Scan(&exists); err != nil {
+		return fmt.Errorf("get course group: %w", err)
+	}
+	if !exists {
+		return ErrGroupNotFound
+	}
+	if err := addMembers(ctx, tx, schoolID, groupID, studentIDs); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func addMembers(ctx context.Context, tx pgx.Tx, schoolID, groupID uuid.UUID, studentIDs []uuid.UUID) error {
+	for _, studentID := range studentIDs {
+		tag, err := tx.Exec(ctx,
+			`INSERT INTO course_group_members (group_id, student_id)
+			 SELECT $1, id FROM students WHERE id = $2 AND school_id = $3
+			 ON CONFLICT DO NOTHING`,
+			groupID, studentID, schoolID)
+		if err != nil {
+			return fmt.Errorf("add group member: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			var member bool
+			tx.QueryRow(ctx,
+				`SELECT EXISTS(SELECT 1 FROM course_group_members WHERE group_id = $1 AND student_id = $2)`,
+				groupID, studentID).Scan(&member)
+			if !member {
+				return fmt.Errorf("%w: %s", ErrGroupMember, studentID)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *CourseGroupService) RemoveMember(ctx context.Context, schoolID, groupID, studentID uuid.UUID) error {
+	tag, err := s.db.Exec(ctx,
+		`DELETE FROM course_group_members m USING course_groups g
+		 WHERE m.group_id = g.id AND g.id = $1 AND g.school_id = $2 AND m.student_id = $3`,
+		groupID, schoolID, studentID)
+	if err != nil {
+		return fmt.Errorf("remove group member: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+var (
+	ErrDisplayNotFound = errors.New("display feed not found")
+	ErrDisplayInvalid  = errors.New("name required, days_ahead between 0 and 14")
+)
+
+const maxDisplayDaysAhead = 14
+
+// DisplayFeedService manages the secret URLs of the hallway monitors and
+// renders the substitution plan they show.
+type DisplayFeedService struct {
+	db *pgxpool.Pool
+}
+
+func NewDisplayFeedService(db *pgxpool.Pool) *DisplayFeedService {
+	return &DisplayFeedService{db: db}
+}
+
+const displayFeedColumns = `id, school_id, name, days_ahead, created_at, last_used_at`
+
+func scanDisplayFeed(row pgx.Row) (*models.DisplayFeed, error) {
+	var f models.DisplayFeed
+	if err := row.Scan(&f.ID, &f.SchoolID, &f.Name, &f.DaysAhead, &f.CreatedAt, &f.LastUsedAt); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (s *DisplayFeedService) List(ctx context.Context, schoolID uuid.UUID) ([]models.DisplayFeed, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+displayFeedColumns+` FROM display_feeds WHERE school_id = $1 ORDER BY name`, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list display feeds: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.DisplayFeed, 0)
+	for rows.Next() {
+		f, err := scanDisplayFeed(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan display feed: %w", err)
+		}
+		list = append(list, *f)
+	}
+	return list, rows.Err()
+}
+
+type CreateDisplayFeedInput struct {
+	Name      string `json:"name"`
+	DaysAhead *int   `json:"days_ahead,omitempty"` // default 1
+}
+
+// Create adds a display with a new token. The token is only returned here.
+func (s *DisplayFeedService) Create(ctx context.Context, schoolID uuid.UUID, input CreateDisplayFeedInput) (string, *models.DisplayFeed, error) {
+	days := 1
+	if input.DaysAhead != nil {
+		days = *input.DaysAhead
+	}
+	if input.Name == "" || days < 0 || days > maxDisplayDaysAhead {
+		return "", nil, ErrDisplayInvalid
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("generate display token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	f, err := scanDisplayFeed(s.db.QueryRow(ctx,
+		`INSERT INTO display_feeds (school_id, name, token_hash, days_ahead)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+displayFeedColumns,
+		schoolID, input.Name, hashFeedToken(token), days))
+	if err != nil {
+		return "", nil, fmt.Errorf("create display feed: %w", err)
+	}
+	return token, f, nil
+}
+
+func (s *DisplayFeedService) Delete(ctx context.Context, schoolID, id uuid.UUID) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM display_feeds WHERE id = $1 AND school_id = $2`, id, schoolID)
+	if err != nil {
+		return fmt.Errorf("delete display feed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDisplayNotFound
+	}
+	return nil
+}
+
+// DisplayEntry is a plan entry reduced to what may hang in a hallway: no
+// notes, no names and not which teacher is missing.
+type DisplayEntry struct {
+	Type            models.SubstitutionType `json:"type"`
+	Open            bool                    `json:"open,omitempty"`
+	TimeSlotLabel   *string                 `json:"time_slot_label,omitempty"`
+	TimeSlotStart   *string                 `json:"time_slot_start,omitempty"`
+	TimeSlotEnd     *string                 `json:"time_slot_end,omitempty"`
+	GroupName       *string                 `json:"group_name,omitempty"`
+	Subject         *string                 `json:"subject,omitempty"`
+	OriginalSubject *string                 `json:"original_subject,omitempty"`
+	Teacher         *string                 `json:"teacher,omitempty"`
+	Room            *string                 `json:"room,omitempty"`
+	OriginalRoom    *string                 `json:"original_room,omitempty"`
+}
+
+type DisplayClass struct {
+	Class   string         `json:"class"`
+	Entries []DisplayEntry `json:"entries"`
+}
+
+type DisplayDay struct {
+	Date      string         `json:"date"`
+	DayOfWeek int            `json:"day_of_week"`
+	Classes   []DisplayClass `json:"classes"`
+}
+
+// Display is what a hallway monitor shows.
+type Display struct {
+	School    string       `json:"school"`
+	Name      string       `json:"name"`
+	Locale    string       `json:"-"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Days      []DisplayDay `json:"days"`
+}
+
+// Show resolves token and returns the plan of today and the next days_ahead
+// school days in the school's time zone, recording the access.
+func (s *DisplayFeedService) Show(ctx context.Context, token string, now time.Time) (*Display, error) {
+	var f models.DisplayFeed
+	var d Display
+	var timezone string
+	err := s.db.QueryRow(ctx,
+		`UPDATE display_feeds f SET last_used_at = now()
+		 FROM schools sc
+		 WHERE f.token_hash = $1 AND sc.id = f.school_id
+		 RETURNING f.school_id, f.name, f.days_ahead, sc.name, sc.locale, sc.timezone`,
+		hashFeedToken(token)).Scan(&f.SchoolID, &d.Name, &f.DaysAhead, &d.School, &d.Locale, &timezone)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDisplayNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolve display feed: %w", err)
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	// Holidays can push the next school days out; three weeks cover that
+	// and the longest allowed lookahead.
+	until := today.AddDate(0, 0, 2*maxDisplayDaysAhead+7)
+	calendar, err := NewCalendarService(s.db).Load(ctx, f.SchoolID, today, until)
+	if err != nil {
+		return nil, err
+	}
+	shown := map[string]bool{today.Format(dateLayout): true}
+	last := today
+	for day, n := today.AddDate(0, 0, 1), 0; n < f.DaysAhead && !day.After(until); day = day.AddDate(0, 0, 1) {
+		if calendar.IsSchoolDay(day) {
+			shown[day.Format(dateLayout)] = true
+			last = day
+			n++
+		}
+	}
+
+	plan, err := NewSubstitutionService(s.db).Plan(ctx, f.SchoolID, today, last)
+	if err != nil {
+		return nil, err
+	}
+	d.UpdatedAt = local
+	d.Days = make([]DisplayDay, 0, len(shown))
+	for _, pd := range plan {
+		if !shown[pd.Date] {
+			continue
+		}
+		day := DisplayDay{Date: pd.Date, DayOfWeek: pd.DayOfWeek, Classes: make([]DisplayClass, 0, len(pd.Classes))}
+		for _, pc := range pd.Classes {
+			dc := DisplayClass{Class: pc.Class, Entries: make([]DisplayEntry, 0, len(pc.Entries))}
+			for _, e := range pc.Entries {
+				dc.Entries = append(dc.Entries, DisplayEntry{
+					Type: e.Type, Open: e.Open, TimeSlotLabel: e.TimeSlotLabel,
+					TimeSlotStart: e.TimeSlotStart, TimeSlotEnd: e.TimeSlotEnd, GroupName: e.GroupName,
+					Subject: e.Subject, OriginalSubject: e.OriginalSubject, Teacher: e.Teacher,
+					Room: e.Room, OriginalRoom: e.OriginalRoom,
+				})
+			}
+			day.Classes = append(day.Classes, dc)
+		}
+		d.Days = append(d.Days, day)
+	}
+	return &d, nil
+}
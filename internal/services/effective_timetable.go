@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+const dateLayout = "2006-01-02"
+
+// LessonStatus describes how a lesson differs from the regular plan.
+type LessonStatus string
+
+const (
+	LessonRegular      LessonStatus = "regular"
+	LessonSubstitution LessonStatus = "substitution"
+	LessonCancelled    LessonStatus = "cancelled"
+	LessonRoomChange   LessonStatus = "room_change"
+	LessonExtra        LessonStatus = "extra_lesson"
+)
+
+// LessonChange is the substitution applied to a lesson together with the
+// planned values it replaced.
+type LessonChange struct {
+	SubstitutionID              uuid.UUID               `json:"substitution_id"`
+	Type                        models.SubstitutionType `json:"type"`
+	Note                        *string                 `json:"note,omitempty"`
+	OriginalTeacherID           uuid.UUID               `json:"original_teacher_id"`
+	OriginalTeacherAbbreviation *string                 `json:"original_teacher_abbreviation,omitempty"`
+	OriginalRoomID              *uuid.UUID              `json:"original_room_id,omitempty"`
+	OriginalRoomName            *string                 `json:"original_room_name,omitempty"`
+	OriginalSubjectID           uuid.UUID               `json:"original_subject_id"`
+	OriginalSubjectName         *string                 `json:"original_subject_name,omitempty"`
+	OriginalSubjectAbbreviation *string                 `json:"original_subject_abbreviation,omitempty"`
+	// Open is set while a substitution has no substitute teacher yet.
+	Open bool `json:"open,omitempty"`
+}
+
+// EffectiveLesson is a lesson as it actually takes place on Date: teacher,
+// room and subject already reflect any substitution.
+type EffectiveLesson struct {
+	models.TimetableEntryEnriched
+	Date   string        `json:"date"`
+	Status LessonStatus  `json:"status"`
+	Change *LessonChange `json:"change,omitempty"`
+}
+
+// EffectiveDay holds the lessons of one date. On holidays and non-teaching
+// days Holiday is set and Lessons is empty, as it is outside the school years.
+type EffectiveDay struct {
+	Date              string            `json:"date"`
+	DayOfWeek         int               `json:"day_of_week"`
+	WeekType          models.WeekType   `json:"week_type"`
+	Holiday           *string           `json:"holiday,omitempty"`
+	OutsideSchoolYear bool              `json:"outside_school_year,omitempty"`
+	Lessons           []EffectiveLesson `json:"lessons"`
+}
+
+// EffectiveWeek is the timetable for the ISO week starting on Start (Monday).
+type EffectiveWeek struct {
+	Start    string          `json:"start"`
+	WeekType models.WeekType `json:"week_type"`
+	Days     []EffectiveDay  `json:"days"`
+}
+
+// TimetableFilter selects whose timetable is resolved. A class sees its own
+// lessons and those of groups its students belong to, a student only the
+// lessons they attend. A teacher's timetable also contains lessons they cover
+// as a substitute.
+type TimetableFilter struct {
+	ClassID   *uuid.UUID
+	StudentID *uuid.UUID
+	TeacherID *uuid.UUID
+}
+
+var ErrInvalidABReference = errors.New("invalid ab_week_reference setting")
+
+// isoWeekday returns 1 (Monday) … 7 (Sunday) like timetable_entries.day_of_week.
+func isoWeekday(d time.Time) int {
+	wd := int(d.Weekday())
+	if wd == 0 {
+		return 7
+	}
+	return wd
+}
+
+// WeekStart returns the Monday of d's week.
+func WeekStart(d time.Time) time.Time {
+	d = time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)
+	return d.AddDate(0, 0, 1-isoWeekday(d))
+}
+
+// WeekTypeFor returns A or B for date. reference is any date in an A week;
+// without one, odd ISO weeks are A weeks.
+func WeekTypeFor(date time.Time, reference *time.Time) models.WeekType {
+	if reference == nil {
+		if _, week := date.ISOWeek(); week%2 == 1 {
+			return models.WeekA
+		}
+		return models.WeekB
+	}
+	weeks := int(WeekStart(date).Sub(WeekStart(*reference)).Hours() / (24 * 7))
+	if weeks%2 == 0 {
+		return models.WeekA
+	}
+	return models.WeekB
+}
+
+// inWeek is the SQL condition for "entry t takes place in the A/B week of
+// date", like WeekTypeFor. reference is an SQL date expression, NULL without
+// ab_week_reference.
+func inWeek(t, date, reference string) string {
+	return `(` + t + `.week_type = 'all' OR ` + t + `.week_type::text =
+	         CASE WHEN ` + reference + ` IS NULL
+	              THEN CASE WHEN EXTRACT(WEEK FROM ` + date + `)::int % 2 = 1 THEN 'A' ELSE 'B' END
+	              ELSE CASE WHEN ((date_trunc('week', ` + date + `)::date - date_trunc('week', ` + reference + `)::date) / 7) % 2 = 0
+	                        THEN 'A' ELSE 'B' END
+	         END)`
+}
+
+// abReference reads the school setting ab_week_reference ("YYYY-MM-DD").
+func (s *TimetableService) abReference(ctx context.Context, schoolID uuid.UUID) (*time.Time, error) {
+	var value string
+	err := s.db.QueryRow(ctx,
+		`SELECT value #>> '{}' FROM school_settings WHERE school_id = $1 AND key = 'ab_week_reference'`,
+		schoolID).Scan(&value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load ab_week_reference: %w", err)
+	}
+	ref, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return nil, ErrInvalidABReference
+	}
+	return &ref, nil
+}
+
+// entriesBetween loads the entries valid at some point in [from, to].
+func (s *TimetableService) entriesBetween(ctx context.Context, schoolID uuid.UUID, f TimetableFilter, from, to time.Time) ([]models.TimetableEntryEnriched, error) {
+	query := enrichedTimetableQuery + ` AND t.valid_from <= $3 AND (t.valid_until IS NULL OR t.valid_until >= $2)
+		AND (ep.id IS NULL OR (ep.start_date <= $3 AND ep.end_date >= $2))`
+	args := []interface{}{schoolID, from, to}
+	if f.ClassID != nil {
+		query += ` AND ` + entryForClass("t", fmt.Sprintf("$%d::uuid", len(args)+1))
+		args = append(args, *f.ClassID)
+	}
+	if f.StudentID != nil {
+		query += ` AND ` + entryForStudent("t", fmt.Sprintf("$%d::uuid", len(args)+1))
+		args = append(args, *f.StudentID)
+	}
+	if f.TeacherID != nil {
+		query += fmt.Sprintf(` AND (t.teacher_id = $%[1]d OR EXISTS (
+		    SELECT 1 FROM substitutions sx WHERE sx.timetable_entry_id = t.id
+		      AND sx.substitute_teacher_id = $%[1]d AND sx.date BETWEEN $2 AND $3))`, len(args)+1)
+		args = append(args, *f.TeacherID)
+	}
+	query += ` ORDER BY ts.slot_number`
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get timetable: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]models.TimetableEntryEnriched, 0)
+	for rows.Next() {
+		e, err := scanEnrichedEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan timetable: %w", err)
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
+
+// lessonSubstitution is a substitution with the display data of its
+// replacement teacher, room and subject.
+type lessonSubstitution struct {
+	models.Substitution
+	TeacherName         *string
+	TeacherAbbreviation *string
+	RoomName            *string
+	SubjectName         *string
+	SubjectAbbreviation *string
+	SubjectColor        *string
+}
+
+// substitutionsBetween returns the substitutions in [from, to] for the given
+// entries, keyed by entry ID and date. When an entry has several for one date
+// the most recent wins.
+func (s *TimetableService) substitutionsBetween(ctx context.Context, schoolID uuid.UUID, entryIDs []uuid.UUID, from, to time.Time) (map[uuid.UUID]map[string]*lessonSubstitution, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT s.id, s.school_id, s.timetable_entry_id, s.date, s.type, s.substitute_teacher_id,
+		        s.substitute_room_id, s.substitute_subject_id, s.note, s.created_by, s.created_at, s.updated_at,
+		        u.first_name || ' ' || u.last_name, tch.abbreviation, r.name, sub.name, sub.abbreviation, sub.color
+		 FROM substitutions s
+		 LEFT JOIN teachers tch ON tch.id = s.substitute_teacher_id
+		 LEFT JOIN users u ON u.id = tch.user_id
+		 LEFT JOIN rooms r ON r.id = s.substitute_room_id
+		 LEFT JOIN subjects sub ON sub.id = s.substitute_subject_id
+		 WHERE s.school_id = $1 AND s.date BETWEEN $2 AND $3 AND s.timetable_entry_id = ANY($4)
+		 ORDER BY s.created_at`, schoolID, from, to, entryIDs)
+	if err != nil {
+		return nil, fmt.Errorf("list substitutions: %w", err)
+	}
+	defer rows.Close()
+
+	result := map[uuid.UUID]map[string]*lessonSubstitution{}
+	for rows.Next() {
+		var ls lessonSubstitution
+		sub := &ls.Substitution
+		if err := rows.Scan(&sub.ID, &sub.SchoolID, &sub.TimetableEntryID, &sub.Date, &sub.Type,
+			&sub.SubstituteTeacherID, &sub.SubstituteRoomID, &sub.SubstituteSubjectID, &sub.Note,
+			&sub.CreatedBy, &sub.CreatedAt, &sub.UpdatedAt,
+			&ls.TeacherName, &ls.TeacherAbbreviation, &ls.RoomName,
+			&ls.SubjectName, &ls.SubjectAbbreviation, &ls.SubjectColor); err != nil {
+			return nil, fmt.Errorf("scan substitution: %w", err)
+		}
+		if result[sub.TimetableEntryID] == nil {
+			result[sub.TimetableEntryID] = map[string]*lessonSubstitution{}
+		}
+		result[sub.TimetableEntryID][sub.Date.Format(dateLayout)] = &ls
+	}
+	return result, rows.Err()
+}
+
+// validOn reports whether the entry's validity range and, for epoch lessons,
+// its epoch contain d.
+func validOn(e *models.TimetableEntryEnriched, d time.Time) bool {
+	if e.ValidFrom.After(d) || (e.ValidUntil != nil && e.ValidUntil.Before(d)) {
+		return false
+	}
+	if e.EpochID != nil && e.EpochStart != nil && e.EpochEnd != nil {
+		return !e.EpochStart.After(d) && !e.EpochEnd.Before(d)
+	}
+	return true
+}
+
+// applySubstitution overlays sub on the lesson.
+func applySubstitution(l *EffectiveLesson, sub *lessonSubstitution) {
+	l.Change = &LessonChange{
+		SubstitutionID:              sub.ID,
+		Type:                        sub.Type,
+		Note:                        sub.Note,
+		OriginalTeacherID:           l.TeacherID,
+		OriginalTeacherAbbreviation: l.TeacherAbbreviation,
+		OriginalRoomID:              l.RoomID,
+		OriginalRoomName:            l.RoomName,
+		OriginalSubjectID:           l.SubjectID,
+		OriginalSubjectName:         l.SubjectName,
+		OriginalSubjectAbbreviation: l.SubjectAbbreviation,
+		Open:                        sub.Type == models.SubTypeSubstitution && sub.SubstituteTeacherID == nil,
+	}
+	switch sub.Type {
+	case models.SubTypeCancellation:
+		l.Status = LessonCancelled
+	case models.SubTypeRoomChange:
+		l.Status = LessonRoomChange
+	case models.SubTypeExtraLesson:
+		l.Status = LessonExtra
+	default:
+		l.Status = LessonSubstitution
+	}
+	if sub.Type == models.SubTypeCancellation {
+		return
+	}
+	if sub.SubstituteTeacherID != nil {
+		l.TeacherID = *sub.SubstituteTeacherID
+		l.TeacherName = sub.TeacherName
+		l.TeacherAbbreviation = sub.TeacherAbbreviation
+	}
+	if sub.SubstituteRoomID != nil {
+		l.RoomID = sub.SubstituteRoomID
+		l.RoomName = sub.RoomName
+	}
+	if sub.SubstituteSubjectID != nil {
+		l.SubjectID = *sub.SubstituteSubjectID
+		l.SubjectName = sub.SubjectName
+		l.SubjectAbbreviation = sub.SubjectAbbreviation
+		l.SubjectColor = sub.SubjectColor
+	}
+}
+
+// Effective resolves the lessons that take place on each date in [from, to]:
+// entries valid on the date whose weekday and A/B week match, skipping dates
+// without lessons in the school calendar, with substitutions applied. Extra
+// lessons are added on their date.
+func (s *TimetableService) Effective(ctx context.Context, schoolID uuid.UUID, f TimetableFilter, from, to time.Time) ([]EffectiveDay, error) {
+	reference, err := s.abReference(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	calendar, err := NewCalendarService(s.db).Load(ctx, schoolID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.entriesBetween(ctx, schoolID, f, from, to)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(entries))
+	for i := range entries {
+		ids[i] = entries[i].ID
+	}
+	subs, err := s.substitutionsBetween(ctx, schoolID, ids, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	days := make([]EffectiveDay, 0)
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		key := d.Format(dateLayout)
+		day := EffectiveDay{Date: key, DayOfWeek: isoWeekday(d), WeekType: WeekTypeFor(d, reference),
+			Lessons: make([]EffectiveLesson, 0)}
+		if name, ok := calendar.Holiday(d); ok {
+			day.Holiday = &name
+			days = append(days, day)
+			continue
+		}
+		if !calendar.InSchoolYear(d) {
+			day.OutsideSchoolYear = true
+			days = append(days, day)
+			continue
+		}
+
+		for i := range entries {
+			e := &entries[i]
+			sub := subs[e.ID][key]
+			scheduled := e.DayOfWeek == day.DayOfWeek && validOn(e, d) &&
+				(e.WeekType == models.WeekAll || e.WeekType == day.WeekType)
+			extra := sub != nil && sub.Type == models.SubTypeExtraLesson
+			if !scheduled && !extra {
+				continue
+			}
+
+			lesson := EffectiveLesson{TimetableEntryEnriched: *e, Date: key, Status: LessonRegular}
+			if sub != nil {
+				applySubstitution(&lesson, sub)
+			}
+			// A teacher's view only shows lessons they plan to give or cover.
+			if f.TeacherID != nil && e.TeacherID != *f.TeacherID && lesson.TeacherID != *f.TeacherID {
+				continue
+			}
+			day.Lessons = append(day.Lessons, lesson)
+		}
+		sort.SliceStable(day.Lessons, func(i, j int) bool {
+			return startOf(day.Lessons[i]) < startOf(day.Lessons[j])
+		})
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+func startOf(l EffectiveLesson) string {
+	if l.TimeSlotStart == nil {
+		return ""
+	}
+	return *l.TimeSlotStart
+}
+
+// Day resolves the timetable for one date.
+func (s *TimetableService) Day(ctx context.Context, schoolID uuid.UUID, f TimetableFilter, date time.Time) (*EffectiveDay, error) {
+	days, err := s.Effective(ctx, schoolID, f, date, date)
+	if err != nil {
+		return nil, err
+	}
+	return &days[0], nil
+}
+
+// Week resolves Monday to Sunday of the week containing start.
+func (s *TimetableService) Week(ctx context.Context, schoolID uuid.UUID, f TimetableFilter, start time.Time) (*EffectiveWeek, error) {
+	monday := WeekStart(start)
+	days, err := s.Effective(ctx, schoolID, f, monday, monday.AddDate(0, 0, 6))
+	if err != nil {
+		return nil, err
+	}
+	return &EffectiveWeek{Start: monday.Format(dateLayout), WeekType: days[0].WeekType, Days: days}, nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+var (
+	ErrEpochNotFound     = errors.New("epoch not found")
+	ErrEpochInvalidRange = errors.New("name, start_date and end_date required, end_date not before start_date")
+	ErrEpochInUse        = errors.New("epoch has timetable entries")
+)
+
+// inEpoch is the SQL condition for "entry t takes place on date as far as its
+// epoch is concerned": entries without epoch always do.
+func inEpoch(t, date string) string {
+	return `(` + t + `.epoch_id IS NULL OR EXISTS (SELECT 1 FROM epochs ep WHERE ep.id = ` + t + `.epoch_id
+	         AND ` + date + ` BETWEEN ep.start_date AND ep.end_date))`
+}
+
+type EpochService struct {
+	db *pgxpool.Pool
+}
+
+func NewEpochService(db *pgxpool.Pool) *EpochService {
+	return &EpochService{db: db}
+}
+
+const epochColumns = `id, school_id, name, start_date, end_date, created_at`
+
+func scanEpoch(row pgx.Row) (*models.Epoch, error) {
+	var e models.Epoch
+	if err := row.Scan(&e.ID, &e.SchoolID, &e.Name, &e.StartDate, &e.EndDate, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (s *EpochService) List(ctx context.Context, schoolID uuid.UUID) ([]models.Epoch, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+epochColumns+` FROM epochs WHERE school_id = $1 ORDER BY start_date, name`, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list epochs: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.Epoch, 0)
+	for rows.Next() {
+		e, err := scanEpoch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan epoch: %w", err)
+		}
+		list = append(list, *e)
+	}
+	return list, rows.Err()
+}
+
+type CreateEpochInput struct {
+	Name      string `json:"name"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
+
+func (s *EpochService) Create(ctx context.Context, schoolID uuid.UUID, input CreateEpochInput) (*models.Epoch, error) {
+	if _, _, err := parseRange(input.StartDate, input.EndDate); err != nil || input.Name == "" {
+		return nil, ErrEpochInvalidRange
+	}
+	e, err := scanEpoch(s.db.QueryRow(ctx,
+		`INSERT INTO epochs (school_id, name, start_date, end_date)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+epochColumns,
+		schoolID, input.Name, input.StartDate, input.EndDate))
+	if err != nil {
+		return nil, fmt.Errorf("create epoch: %w", err)
+	}
+	return e, nil
+}
+
+// Update changes the name or dates. The entries of the epoch move with it;
+// they are not re-checked for conflicts.
+func (s *EpochService) Update(ctx context.Context, schoolID, epochID uuid.UUID, input CreateEpochInput) (*models.Epoch, error) {
+	if _, _, err := parseRange(input.StartDate, input.EndDate); err != nil || input.Name == "" {
+		return nil, ErrEpochInvalidRange
+	}
+	e, err := scanEpoch(s.db.QueryRow(ctx,
+		`UPDATE epochs SET name = $3, start_date = $4, end_date = $5
+		 WHERE id = $1 AND school_id = $2
+		 RETURNING `+epochColumns,
+		epochID, schoolID, input.Name, input.StartDate, input.EndDate))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrEpochNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update epoch: %w", err)
+	}
+	return e, nil
+}
+
+// Delete removes an epoch that no timetable entry uses any more.
+func (s *EpochService) Delete(ctx context.Context, schoolID, epochID uuid.UUID) error {
+	var used bool
+	if err := s.db.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM timetable_entries WHERE epoch_id = $1)
+		     OR EXISTS(SELECT 1 FROM timetable_draft_entries WHERE epoch_id = $1)`, epochID).Scan(&used); err != nil {
+		return fmt.Errorf("check epoch usage: %w", err)
+	}
+	if used {
+		return ErrEpochInUse
+	}
+	tag, err := s.db.Exec(ctx, `DELETE FROM epochs WHERE id = $1 AND school_id = $2`, epochID, schoolID)
+	if err != nil {
+		return fmt.Errorf("delete epoch: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEpochNotFound
+	}
+	return nil
+}
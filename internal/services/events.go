@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/Monstroxx/eduko-backend/internal/events"
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+// Recipients of real-time events and notifications. Each query selects user
+// IDs; whatever concerns a student also goes to the student's guardians.
+
+// studentRecipients selects the users of the students $1 and their guardians.
+const studentRecipients = `SELECT user_id FROM students WHERE id = ANY($1::uuid[])
+	UNION SELECT user_id FROM student_guardians WHERE student_id = ANY($1::uuid[])`
+
+// lessonStudentRecipients selects the students attending the entries $1 and
+// their guardians.
+var lessonStudentRecipients = `WITH st AS (
+	    SELECT st.id, st.user_id FROM timetable_entries t JOIN students st ON ` + attends("st", "t") + `
+	    WHERE t.id = ANY($1::uuid[]))
+	SELECT user_id FROM st
+	UNION SELECT g.user_id FROM student_guardians g JOIN st ON st.id = g.student_id`
+
+// lessonRecipients adds the teachers of the entries $1 and the teachers $2
+// (substitutes).
+var lessonRecipients = lessonStudentRecipients + `
+	UNION SELECT tc.user_id FROM timetable_entries t JOIN teachers tc ON tc.id = t.teacher_id WHERE t.id = ANY($1::uuid[])
+	UNION SELECT user_id FROM teachers WHERE id = ANY($2::uuid[])`
+
+// appointmentStudentRecipients selects the students appointment $1 is for,
+// all of the school's for school-wide ones, and their guardians.
+const appointmentStudentRecipients = `WITH a AS (SELECT school_id, scope, class_id, group_id, date FROM appointments WHERE id = $1),
+	st AS (
+	    SELECT s.id, s.user_id FROM students s JOIN a ON a.school_id = s.school_id
+	    WHERE a.scope = 'school' OR (a.group_id IS NULL AND s.class_id = a.class_id)
+	       OR s.id IN (SELECT student_id FROM course_group_members WHERE group_id = a.group_id))
+	SELECT user_id FROM st
+	UNION SELECT g.user_id FROM student_guardians g JOIN st ON st.id = g.student_id`
+
+// appointmentRecipients adds the teachers of the class or group on the
+// appointment's date.
+const appointmentRecipients = appointmentStudentRecipients + `
+	UNION SELECT tc.user_id FROM a
+	      JOIN timetable_entries t ON t.valid_from <= a.date AND (t.valid_until IS NULL OR t.valid_until >= a.date)
+	           AND (t.group_id = a.group_id OR (a.group_id IS NULL AND t.class_id = a.class_id))
+	      JOIN teachers tc ON tc.id = t.teacher_id`
+
+// dbtx is a pool or a transaction.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// recipients runs one of the recipient queries.
+func recipients(ctx context.Context, db dbtx, query string, args ...interface{}) ([]uuid.UUID, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var users []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan recipient: %w", err)
+		}
+		users = append(users, id)
+	}
+	return users, rows.Err()
+}
+
+// savepoint runs fn in a savepoint of tx. Real-time events and
+// notifications are best-effort: callers log the error and the change still
+// commits, as it does outside a transaction.
+func savepoint(ctx context.Context, tx pgx.Tx, fn func(pgx.Tx) error) error {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("savepoint: %w", err)
+	}
+	if err := fn(sp); err != nil {
+		sp.Rollback(ctx)
+		return err
+	}
+	if err := sp.Commit(ctx); err != nil {
+		return fmt.Errorf("release savepoint: %w", err)
+	}
+	return nil
+}
+
+// publish sends ev to the users the recipients query selects. Called inside
+// a transaction, the event goes out when it commits.
+func publish(ctx context.Context, db dbtx, schoolID uuid.UUID, ev events.Event, query string, args ...interface{}) error {
+	users, err := recipients(ctx, db, query, args...)
+	if err != nil {
+		return err
+	}
+	return events.Publish(ctx, db, schoolID, users, ev)
+}
+
+// publishSubstitution notifies everyone whose timetable sub changes, with
+// prev the substitution before an update: a lesson or substitute teacher it
+// no longer concerns is told too.
+func publishSubstitution(ctx context.Context, db dbtx, typ string, sub, prev *models.Substitution) error {
+	entries := []uuid.UUID{sub.TimetableEntryID}
+	var teachers []uuid.UUID
+	if sub.SubstituteTeacherID != nil {
+		teachers = append(teachers, *sub.SubstituteTeacherID)
+	}
+	if prev != nil {
+		entries = append(entries, prev.TimetableEntryID)
+		if prev.SubstituteTeacherID != nil {
+			teachers = append(teachers, *prev.SubstituteTeacherID)
+		}
+	}
+	ev := events.Event{Type: typ, Data: map[string]interface{}{
+		"id":                 sub.ID,
+		"timetable_entry_id": sub.TimetableEntryID,
+		"date":               sub.Date.Format(dateLayout),
+		"type":               sub.Type,
+	}}
+	return publish(ctx, db, sub.SchoolID, ev, lessonRecipients, entries, teachers)
+}
+
+func publishAttendance(ctx context.Context, db dbtx, a *models.Attendance) error {
+	ev := events.Event{Type: events.AttendanceRecorded, Data: map[string]interface{}{
+		"id":                 a.ID,
+		"student_id":         a.StudentID,
+		"timetable_entry_id": a.TimetableEntryID,
+		"date":               a.Date.Format(dateLayout),
+		"status":             a.Status,
+	}}
+	return publish(ctx, db, a.SchoolID, ev, studentRecipients, []uuid.UUID{a.StudentID})
+}
+
+func publishExcuseStatus(ctx context.Context, db dbtx, e *models.Excuse) error {
+	ev := events.Event{Type: events.ExcuseStatusChanged, Data: map[string]interface{}{
+		"id":         e.ID,
+		"student_id": e.StudentID,
+		"status":     e.Status,
+	}}
+	return publish(ctx, db, e.SchoolID, ev, studentRecipients, []uuid.UUID{e.StudentID})
+}
+
+func publishAppointment(ctx context.Context, db dbtx, typ string, a *models.Appointment) error {
+	ev := events.Event{Type: typ, Data: map[string]interface{}{
+		"id":    a.ID,
+		"title": a.Title,
+		"type":  a.Type,
+		"date":  a.Date.Format(dateLayout),
+	}}
+	if a.Scope == models.ScopeSchool {
+		return events.PublishSchool(ctx, db, a.SchoolID, ev)
+	}
+	return publish(ctx, db, a.SchoolID, ev, appointmentRecipients, a.ID)
+}
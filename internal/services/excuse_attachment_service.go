@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+const attachmentColumns = `id, excuse_id, school_id, storage_key, sha256, file_name, content_type, size_bytes,
+	uploaded_by, scan_status, data_key_id, created_at`
+
+func scanAttachment(row pgx.Row) (*models.ExcuseAttachment, error) {
+	var a models.ExcuseAttachment
+	err := row.Scan(&a.ID, &a.ExcuseID, &a.SchoolID, &a.StorageKey, &a.SHA256, &a.FileName,
+		&a.ContentType, &a.SizeBytes, &a.UploadedBy, &a.ScanStatus, &a.DataKeyID, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+type AddAttachmentInput struct {
+	StorageKey  string
+	SHA256      string
+	FileName    string
+	ContentType string
+	SizeBytes   int64
+	ScanStatus  string
+	DataKeyID   *uuid.UUID
+}
+
+// AddAttachment records an uploaded blob for an excuse. Uploading the same
+// content twice returns the existing attachment.
+func (s *ExcuseService) AddAttachment(ctx context.Context, schoolID, excuseID, uploadedBy uuid.UUID, in AddAttachmentInput) (*models.ExcuseAttachment, error) {
+	a, err := scanAttachment(s.db.QueryRow(ctx,
+		`INSERT INTO excuse_attachments (excuse_id, school_id, storage_key, sha256, file_name, content_type, size_bytes,
+		                                 uploaded_by, scan_status, scanned_at, data_key_id)
+		 SELECT e.id, e.school_id, $3, $4, $5, $6, $7, $8, $9,
+		        CASE WHEN $9::scan_status IN ('clean', 'infected') THEN now() END, $10
+		 FROM excuses e WHERE e.id = $1 AND e.school_id = $2
+		 ON CONFLICT (excuse_id, sha256) DO UPDATE SET file_name = excuse_attachments.file_name
+		 RETURNING `+attachmentColumns,
+		excuseID, schoolID, in.StorageKey, in.SHA256, in.FileName, in.ContentType, in.SizeBytes, uploadedBy,
+		in.ScanStatus, in.DataKeyID))
+	if err != nil {
+		return nil, fmt.Errorf("add attachment: %w", err)
+	}
+	_, _ = s.db.Exec(ctx, `UPDATE excuses SET updated_at = now() WHERE id = $1`, excuseID)
+	return a, nil
+}
+
+func (s *ExcuseService) ListAttachments(ctx context.Context, excuseID uuid.UUID) ([]models.ExcuseAttachment, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+attachmentColumns+` FROM excuse_attachments WHERE excuse_id = $1 ORDER BY created_at`, excuseID)
+	if err != nil {
+		return nil, fmt.Errorf("list attachments: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.ExcuseAttachment, 0)
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan attachment: %w", err)
+		}
+		list = append(list, *a)
+	}
+	return list, rows.Err()
+}
+
+func (s *ExcuseService) GetAttachment(ctx context.Context, schoolID, excuseID, attachmentID uuid.UUID) (*models.ExcuseAttachment, error) {
+	a, err := scanAttachment(s.db.QueryRow(ctx,
+		`SELECT `+attachmentColumns+` FROM excuse_attachments WHERE id = $1 AND excuse_id = $2 AND school_id = $3`,
+		attachmentID, excuseID, schoolID))
+	if err != nil {
+		return nil, fmt.Errorf("get attachment: %w", err)
+	}
+	return a, nil
+}
+
+// DeleteAttachment removes the attachment row. It reports whether the blob is
+// no longer referenced anywhere and may be deleted from storage.
+func (s *ExcuseService) DeleteAttachment(ctx context.Context, schoolID, excuseID, attachmentID uuid.UUID) (storageKey string, orphaned bool, err error) {
+	err = s.db.QueryRow(ctx,
+		`DELETE FROM excuse_attachments WHERE id = $1 AND excuse_id = $2 AND school_id = $3
+		 RETURNING storage_key`, attachmentID, excuseID, schoolID).Scan(&storageKey)
+	if err != nil {
+		return "", false, fmt.Errorf("delete attachment: %w", err)
+	}
+	referenced, err := BlobReferenced(ctx, s.db, storageKey)
+	if err != nil {
+		return storageKey, false, err
+	}
+	return storageKey, !referenced, nil
+}
+
+// BlobReferenced reports whether any row still points at the storage key.
+func BlobReferenced(ctx context.Context, db *pgxpool.Pool, key string) (bool, error) {
+	var referenced bool
+	err := db.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM excuse_attachments WHERE storage_key = $1)
+		     OR EXISTS(SELECT 1 FROM leave_requests WHERE file_path = $1)`, key).Scan(&referenced)
+	if err != nil {
+		return false, fmt.Errorf("check blob references: %w", err)
+	}
+	return referenced, nil
+}
+
+// GetAttachmentByID loads an attachment without school scope. Only use it
+// after the caller proved access otherwise, e.g. with a signed URL.
+func (s *ExcuseService) GetAttachmentByID(ctx context.Context, attachmentID uuid.UUID) (*models.ExcuseAttachment, error) {
+	a, err := scanAttachment(s.db.QueryRow(ctx,
+		`SELECT `+attachmentColumns+` FROM excuse_attachments WHERE id = $1`, attachmentID))
+	if err != nil {
+		return nil, fmt.Errorf("get attachment: %w", err)
+	}
+	return a, nil
+}
+
+// CanViewAttachments reports whether the user may read an excuse's files:
+// admins, the student, the student's guardians, the class teacher and the
+// teacher who approved the excuse.
+func (s *ExcuseService) CanViewAttachments(ctx context.Context, e *models.Excuse, userID uuid.UUID, role string) (bool, error) {
+	switch models.UserRole(role) {
+	case models.RoleAdmin:
+		return true, nil
+	case models.RoleTeacher:
+		if e.ApprovedBy != nil && *e.ApprovedBy == userID {
+			return true, nil
+		}
+	}
+
+	var ok bool
+	err := s.db.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM students WHERE id = $1 AND user_id = $2)
+		     OR EXISTS(SELECT 1 FROM student_guardians WHERE student_id = $1 AND user_id = $2)
+		     OR EXISTS(SELECT 1 FROM students s
+		               JOIN classes c ON c.id = s.class_id
+		               JOIN teachers t ON t.id = c.class_teacher_id
+		               WHERE s.id = $1 AND t.user_id = $2)`,
+		e.StudentID, userID).Scan(&ok)
+	if err != nil {
+		return false, fmt.Errorf("check attachment access: %w", err)
+	}
+	return ok, nil
+}
+
+// PendingScans returns storage keys of quarantined attachments, oldest first.
+func (s *ExcuseService) PendingScans(ctx context.Context, limit int) ([]string, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT storage_key FROM excuse_attachments WHERE scan_status = 'pending'
+		 GROUP BY storage_key ORDER BY MIN(created_at) LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list pending scans: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("scan pending key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// SetScanResult records the verdict for every attachment sharing the blob.
+func (s *ExcuseService) SetScanResult(ctx context.Context, storageKey, status string, signature *string) error {
+	_, err := s.db.Exec(ctx,
+		`UPDATE excuse_attachments SET scan_status = $2, scan_signature = $3, scanned_at = now()
+		 WHERE storage_key = $1 AND scan_status = 'pending'`, storageKey, status, signature)
+	if err != nil {
+		return fmt.Errorf("set scan result: %w", err)
+	}
+	return nil
+}
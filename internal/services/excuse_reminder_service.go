@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// uncoveredAbsence matches attendance rows (alias a) that no pending or
+// approved excuse accounts for, either by explicit link or by date range.
+const uncoveredAbsence = `
+	NOT EXISTS (SELECT 1 FROM excuse_attendance ea JOIN excuses e ON e.id = ea.excuse_id
+	            WHERE ea.attendance_id = a.id AND e.status <> 'rejected')
+	AND NOT EXISTS (SELECT 1 FROM excuses e
+	                WHERE e.student_id = a.student_id AND e.status <> 'rejected'
+	                  AND a.date BETWEEN e.date_from AND e.date_to)`
+
+// MissingExcuse is one absence day of a student that still needs an excuse.
+type MissingExcuse struct {
+	StudentID   uuid.UUID `json:"student_id"`
+	AbsenceDate time.Time `json:"absence_date"`
+	Deadline    time.Time `json:"deadline"`
+	DaysLeft    int       `json:"days_left"`
+	Lessons     int       `json:"lessons"`
+}
+
+// excuseDeadline is the last day to excuse the absence a: deadline school
+// days after it, so holidays and weekends don't count.
+var excuseDeadline = addSchoolDays("a.school_id", "a.date", "$2::int")
+
+// MissingExcuses lists absence days without an excuse whose deadline
+// (deadlineDays school days after the absence) has not passed yet.
+func (s *ExcuseService) MissingExcuses(ctx context.Context, schoolID uuid.UUID, deadlineDays int) ([]MissingExcuse, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT student_id, date, deadline, deadline - CURRENT_DATE, lessons FROM (
+		     SELECT a.student_id, a.date, `+excuseDeadline+` AS deadline, COUNT(*) AS lessons
+		     FROM attendance a
+		     WHERE a.school_id = $1 AND a.status = 'absent'
+		       AND a.date >= CURRENT_DATE - (7 * $2::int + 366)
+		       AND `+uncoveredAbsence+`
+		     GROUP BY a.school_id, a.student_id, a.date
+		 ) m
+		 WHERE deadline >= CURRENT_DATE
+		 ORDER BY date`,
+		schoolID, deadlineDays)
+	if err != nil {
+		return nil, fmt.Errorf("list missing excuses: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]MissingExcuse, 0)
+	for rows.Next() {
+		var m MissingExcuse
+		if err := rows.Scan(&m.StudentID, &m.AbsenceDate, &m.Deadline, &m.DaysLeft, &m.Lessons); err != nil {
+			return nil, fmt.Errorf("scan missing excuse: %w", err)
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// ClaimReminder records that the reminder for daysBefore was sent. It returns
+// false if it had already been sent, so callers notify at most once.
+func (s *ExcuseService) ClaimReminder(ctx context.Context, schoolID, studentID uuid.UUID, absenceDate time.Time, daysBefore int) (bool, error) {
+	tag, err := s.db.Exec(ctx,
+		`INSERT INTO excuse_reminders (school_id, student_id, absence_date, days_before)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (student_id, absence_date, days_before) DO NOTHING`,
+		schoolID, studentID, absenceDate, daysBefore)
+	if err != nil {
+		return false, fmt.Errorf("claim reminder: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// MarkExpiredUnexcused flips absences without excuse past the deadline to
+// unexcused and returns the number of attendance rows changed.
+func (s *ExcuseService) MarkExpiredUnexcused(ctx context.Context, schoolID uuid.UUID, deadlineDays int) (int64, error) {
+	tag, err := s.db.Exec(ctx,
+		`UPDATE attendance a SET status = 'unexcused', updated_at = now()
+		 WHERE a.school_id = $1 AND a.status = 'absent'
+		   AND a.date < CURRENT_DATE AND `+excuseDeadline+` < CURRENT_DATE
+		   AND `+uncoveredAbsence,
+		schoolID, deadlineDays)
+	if err != nil {
+		return 0, fmt.Errorf("mark unexcused: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -2,29 +2,40 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/Monstroxx/eduko-backend/internal/encryption"
 	"github.com/Monstroxx/eduko-backend/internal/models"
 )
 
+// ExcuseService stores excuse reasons encrypted with the school's data key and
+// decrypts them on every read.
 type ExcuseService struct {
-	db *pgxpool.Pool
+	db   *pgxpool.Pool
+	keys *encryption.Keys
 }
 
 func NewExcuseService(db *pgxpool.Pool) *ExcuseService {
-	return &ExcuseService{db: db}
+	return &ExcuseService{db: db, keys: encryption.NewKeys(db)}
 }
 
 type CreateExcuseInput struct {
-	DateFrom             string `json:"date_from"`
-	DateTo               string `json:"date_to"`
-	SubmissionType       string `json:"submission_type"`
-	Reason               *string `json:"reason,omitempty"`
-	AttestationProvided  bool   `json:"attestation_provided"`
+	// StudentID is only honoured when a teacher/admin records an excuse on behalf of a student.
+	StudentID           *uuid.UUID `json:"student_id,omitempty"`
+	DateFrom            string     `json:"date_from"`
+	DateTo              string     `json:"date_to"`
+	SubmissionType      string     `json:"submission_type"`
+	Reason              *string    `json:"reason,omitempty"`
+	AttestationProvided bool       `json:"attestation_provided"`
+	// PaperReceived marks the paper form as already handed in (set by the handler).
+	PaperReceived bool `json:"-"`
 }
 
 type ExcuseWithLinks struct {
@@ -32,6 +43,35 @@ type ExcuseWithLinks struct {
 	LinkedAbsences int `json:"linked_absences"`
 }
 
+const excuseColumns = `e.id, e.school_id, e.student_id, e.date_from, e.date_to, e.submission_type, e.status, e.reason,
+	e.attestation_provided, e.file_path, e.paper_received_at, e.submitted_at, e.approved_by, e.approved_at,
+	e.created_at, e.updated_at`
+
+func scanExcuse(row pgx.Row) (*models.Excuse, error) {
+	var e models.Excuse
+	err := row.Scan(&e.ID, &e.SchoolID, &e.StudentID, &e.DateFrom, &e.DateTo,
+		&e.SubmissionType, &e.Status, &e.Reason, &e.AttestationProvided,
+		&e.FilePath, &e.PaperReceivedAt, &e.SubmittedAt, &e.ApprovedBy, &e.ApprovedAt,
+		&e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// decrypt replaces the stored (possibly encrypted) reason with its plaintext.
+func (s *ExcuseService) decrypt(ctx context.Context, e *models.Excuse) error {
+	if e.Reason == nil {
+		return nil
+	}
+	reason, err := s.keys.DecryptString(ctx, *e.Reason)
+	if err != nil {
+		return fmt.Errorf("decrypt reason: %w", err)
+	}
+	e.Reason = &reason
+	return nil
+}
+
 func (s *ExcuseService) Create(ctx context.Context, schoolID, studentID uuid.UUID, input CreateExcuseInput) (*ExcuseWithLinks, error) {
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
@@ -39,21 +79,41 @@ func (s *ExcuseService) Create(ctx context.Context, schoolID, studentID uuid.UUI
 	}
 	defer tx.Rollback(ctx)
 
-	var excuse models.Excuse
-	err = tx.QueryRow(ctx,
-		`INSERT INTO excuses (school_id, student_id, date_from, date_to, submission_type, status, reason, attestation_provided)
-		 VALUES ($1, $2, $3, $4, $5, 'pending', $6, $7)
-		 RETURNING id, school_id, student_id, date_from, date_to, submission_type, status, reason,
-		           attestation_provided, file_path, submitted_at, approved_by, approved_at, created_at, updated_at`,
+	result, err := s.CreateTx(ctx, tx, schoolID, studentID, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return result, nil
+}
+
+// CreateTx inserts an excuse inside the caller's transaction and links it to
+// the student's absences in the covered date range.
+func (s *ExcuseService) CreateTx(ctx context.Context, tx pgx.Tx, schoolID, studentID uuid.UUID, input CreateExcuseInput) (*ExcuseWithLinks, error) {
+	reason := input.Reason
+	if reason != nil && *reason != "" {
+		sealed, err := s.keys.EncryptString(ctx, schoolID, *reason)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt reason: %w", err)
+		}
+		reason = &sealed
+	}
+
+	excuse, err := scanExcuse(tx.QueryRow(ctx,
+		`INSERT INTO excuses AS e (school_id, student_id, date_from, date_to, submission_type, status, reason,
+		                           attestation_provided, paper_received_at)
+		 VALUES ($1, $2, $3, $4, $5, 'pending', $6, $7, CASE WHEN $8::bool THEN now() END)
+		 RETURNING `+excuseColumns,
 		schoolID, studentID, input.DateFrom, input.DateTo, input.SubmissionType,
-		input.Reason, input.AttestationProvided,
-	).Scan(&excuse.ID, &excuse.SchoolID, &excuse.StudentID, &excuse.DateFrom, &excuse.DateTo,
-		&excuse.SubmissionType, &excuse.Status, &excuse.Reason, &excuse.AttestationProvided,
-		&excuse.FilePath, &excuse.SubmittedAt, &excuse.ApprovedBy, &excuse.ApprovedAt,
-		&excuse.CreatedAt, &excuse.UpdatedAt)
+		reason, input.AttestationProvided, input.PaperReceived,
+	))
 	if err != nil {
 		return nil, fmt.Errorf("insert excuse: %w", err)
 	}
+	excuse.Reason = input.Reason
 
 	// Auto-link to matching attendance records
 	result, err := tx.Exec(ctx,
@@ -61,27 +121,20 @@ func (s *ExcuseService) Create(ctx context.Context, schoolID, studentID uuid.UUI
 		 SELECT $1, a.id FROM attendance a
 		 WHERE a.student_id = $2 AND a.school_id = $3
 		   AND a.date >= $4 AND a.date <= $5
-		   AND a.status = 'absent'`,
+		   AND a.status IN ('absent', 'unexcused')`,
 		excuse.ID, studentID, schoolID, input.DateFrom, input.DateTo)
 	if err != nil {
 		return nil, fmt.Errorf("link attendance: %w", err)
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return nil, fmt.Errorf("commit: %w", err)
-	}
-
 	return &ExcuseWithLinks{
-		Excuse:         excuse,
+		Excuse:         *excuse,
 		LinkedAbsences: int(result.RowsAffected()),
 	}, nil
 }
 
 func (s *ExcuseService) List(ctx context.Context, schoolID uuid.UUID, status, studentID, classID string) ([]models.Excuse, error) {
-	query := `SELECT e.id, e.school_id, e.student_id, e.date_from, e.date_to, e.submission_type,
-	                 e.status, e.reason, e.attestation_provided, e.file_path, e.submitted_at,
-	                 e.approved_by, e.approved_at, e.created_at, e.updated_at
-	          FROM excuses e`
+	query := `SELECT ` + excuseColumns + ` FROM excuses e`
 	args := []interface{}{schoolID}
 	where := ` WHERE e.school_id = $1`
 	n := 2
@@ -111,53 +164,42 @@ func (s *ExcuseService) List(ctx context.Context, schoolID uuid.UUID, status, st
 
 	list := make([]models.Excuse, 0)
 	for rows.Next() {
-		var e models.Excuse
-		if err := rows.Scan(&e.ID, &e.SchoolID, &e.StudentID, &e.DateFrom, &e.DateTo,
-			&e.SubmissionType, &e.Status, &e.Reason, &e.AttestationProvided,
-			&e.FilePath, &e.SubmittedAt, &e.ApprovedBy, &e.ApprovedAt,
-			&e.CreatedAt, &e.UpdatedAt); err != nil {
+		e, err := scanExcuse(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan excuse: %w", err)
 		}
-		list = append(list, e)
+		if err := s.decrypt(ctx, e); err != nil {
+			return nil, err
+		}
+		list = append(list, *e)
 	}
 	return list, nil
 }
 
 func (s *ExcuseService) GetByID(ctx context.Context, schoolID, excuseID uuid.UUID) (*models.Excuse, error) {
-	var e models.Excuse
-	err := s.db.QueryRow(ctx,
-		`SELECT id, school_id, student_id, date_from, date_to, submission_type, status, reason,
-		        attestation_provided, file_path, submitted_at, approved_by, approved_at, created_at, updated_at
-		 FROM excuses WHERE id = $1 AND school_id = $2`, excuseID, schoolID,
-	).Scan(&e.ID, &e.SchoolID, &e.StudentID, &e.DateFrom, &e.DateTo,
-		&e.SubmissionType, &e.Status, &e.Reason, &e.AttestationProvided,
-		&e.FilePath, &e.SubmittedAt, &e.ApprovedBy, &e.ApprovedAt,
-		&e.CreatedAt, &e.UpdatedAt)
+	e, err := scanExcuse(s.db.QueryRow(ctx,
+		`SELECT `+excuseColumns+` FROM excuses e WHERE e.id = $1 AND e.school_id = $2`, excuseID, schoolID))
 	if err != nil {
 		return nil, fmt.Errorf("get excuse: %w", err)
 	}
-	return &e, nil
-}
-
-func (s *ExcuseService) Approve(ctx context.Context, schoolID, excuseID, approvedBy uuid.UUID) (*models.Excuse, error) {
-	tx, err := s.db.Begin(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("begin tx: %w", err)
+	if err := s.decrypt(ctx, e); err != nil {
+		return nil, err
 	}
-	defer tx.Rollback(ctx)
+	if e.Attachments, err = s.ListAttachments(ctx, excuseID); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
 
-	var e models.Excuse
+// approveTx approves an excuse and moves its linked absences to excused_leave.
+func approveTx(ctx context.Context, tx pgx.Tx, schoolID, excuseID, approvedBy uuid.UUID) (*models.Excuse, error) {
 	now := time.Now()
-	err = tx.QueryRow(ctx,
-		`UPDATE excuses SET status = 'approved', approved_by = $3, approved_at = $4, updated_at = $4
-		 WHERE id = $1 AND school_id = $2
-		 RETURNING id, school_id, student_id, date_from, date_to, submission_type, status, reason,
-		           attestation_provided, file_path, submitted_at, approved_by, approved_at, created_at, updated_at`,
+	e, err := scanExcuse(tx.QueryRow(ctx,
+		`UPDATE excuses e SET status = 'approved', approved_by = $3, approved_at = $4, updated_at = $4
+		 WHERE e.id = $1 AND e.school_id = $2
+		 RETURNING `+excuseColumns,
 		excuseID, schoolID, approvedBy, now,
-	).Scan(&e.ID, &e.SchoolID, &e.StudentID, &e.DateFrom, &e.DateTo,
-		&e.SubmissionType, &e.Status, &e.Reason, &e.AttestationProvided,
-		&e.FilePath, &e.SubmittedAt, &e.ApprovedBy, &e.ApprovedAt,
-		&e.CreatedAt, &e.UpdatedAt)
+	))
 	if err != nil {
 		return nil, fmt.Errorf("approve excuse: %w", err)
 	}
@@ -170,27 +212,271 @@ func (s *ExcuseService) Approve(ctx context.Context, schoolID, excuseID, approve
 	if err != nil {
 		return nil, fmt.Errorf("update linked attendance: %w", err)
 	}
+	if err := savepoint(ctx, tx, func(db pgx.Tx) error { return publishExcuseStatus(ctx, db, e) }); err != nil {
+		log.Printf("[events] %v", err)
+	}
+	if err := savepoint(ctx, tx, func(db pgx.Tx) error { return notifyExcuseDecision(ctx, db, e) }); err != nil {
+		log.Printf("[notifications] %v", err)
+	}
+	return e, nil
+}
+
+func rejectTx(ctx context.Context, tx pgx.Tx, schoolID, excuseID uuid.UUID) (*models.Excuse, error) {
+	e, err := scanExcuse(tx.QueryRow(ctx,
+		`UPDATE excuses e SET status = 'rejected', updated_at = now()
+		 WHERE e.id = $1 AND e.school_id = $2
+		 RETURNING `+excuseColumns,
+		excuseID, schoolID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("reject excuse: %w", err)
+	}
+	if err := savepoint(ctx, tx, func(db pgx.Tx) error { return publishExcuseStatus(ctx, db, e) }); err != nil {
+		log.Printf("[events] %v", err)
+	}
+	if err := savepoint(ctx, tx, func(db pgx.Tx) error { return notifyExcuseDecision(ctx, db, e) }); err != nil {
+		log.Printf("[notifications] %v", err)
+	}
+	return e, nil
+}
+
+func paperReceivedTx(ctx context.Context, tx pgx.Tx, schoolID, excuseID uuid.UUID) (*models.Excuse, error) {
+	e, err := scanExcuse(tx.QueryRow(ctx,
+		`UPDATE excuses e SET paper_received_at = COALESCE(paper_received_at, now()), updated_at = now()
+		 WHERE e.id = $1 AND e.school_id = $2
+		 RETURNING `+excuseColumns,
+		excuseID, schoolID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("mark paper received: %w", err)
+	}
+	return e, nil
+}
+
+func (s *ExcuseService) Approve(ctx context.Context, schoolID, excuseID, approvedBy uuid.UUID) (*models.Excuse, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	e, err := approveTx(ctx, tx, schoolID, excuseID, approvedBy)
+	if err != nil {
+		return nil, err
+	}
 
 	if err := tx.Commit(ctx); err != nil {
 		return nil, fmt.Errorf("commit: %w", err)
 	}
-	return &e, nil
+	if err := s.decrypt(ctx, e); err != nil {
+		return nil, err
+	}
+	return e, nil
 }
 
 func (s *ExcuseService) Reject(ctx context.Context, schoolID, excuseID uuid.UUID, reason string) (*models.Excuse, error) {
-	var e models.Excuse
-	err := s.db.QueryRow(ctx,
-		`UPDATE excuses SET status = 'rejected', updated_at = now()
-		 WHERE id = $1 AND school_id = $2
-		 RETURNING id, school_id, student_id, date_from, date_to, submission_type, status, reason,
-		           attestation_provided, file_path, submitted_at, approved_by, approved_at, created_at, updated_at`,
-		excuseID, schoolID,
-	).Scan(&e.ID, &e.SchoolID, &e.StudentID, &e.DateFrom, &e.DateTo,
-		&e.SubmissionType, &e.Status, &e.Reason, &e.AttestationProvided,
-		&e.FilePath, &e.SubmittedAt, &e.ApprovedBy, &e.ApprovedAt,
-		&e.CreatedAt, &e.UpdatedAt)
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("reject excuse: %w", err)
+		return nil, fmt.Errorf("begin tx: %w", err)
 	}
-	return &e, nil
+	defer tx.Rollback(ctx)
+
+	e, err := rejectTx(ctx, tx, schoolID, excuseID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	if err := s.decrypt(ctx, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ── Bulk operations ─────────────────────────────────────────
+
+type BulkExcuseAction string
+
+const (
+	BulkApprove       BulkExcuseAction = "approve"
+	BulkReject        BulkExcuseAction = "reject"
+	BulkPaperReceived BulkExcuseAction = "paper_received"
+)
+
+var ErrInvalidBulkAction = errors.New("invalid bulk action")
+
+type BulkExcuseInput struct {
+	Action BulkExcuseAction `json:"action"`
+	IDs    []uuid.UUID      `json:"ids"`
+	Reason string           `json:"reason,omitempty"`
+}
+
+type BulkExcuseItemResult struct {
+	ID     uuid.UUID      `json:"id"`
+	OK     bool           `json:"ok"`
+	Error  string         `json:"error,omitempty"`
+	Excuse *models.Excuse `json:"excuse,omitempty"`
+}
+
+type BulkExcuseResult struct {
+	Action    BulkExcuseAction       `json:"action"`
+	Succeeded int                    `json:"succeeded"`
+	Failed    int                    `json:"failed"`
+	Results   []BulkExcuseItemResult `json:"results"`
+}
+
+// Bulk applies one action to many excuses in a single transaction. Each item
+// runs in its own savepoint so an unknown ID is reported without aborting the
+// rest of the batch; the batch as a whole commits atomically.
+func (s *ExcuseService) Bulk(ctx context.Context, schoolID, userID uuid.UUID, input BulkExcuseInput) (*BulkExcuseResult, error) {
+	var apply func(pgx.Tx, uuid.UUID) (*models.Excuse, error)
+	switch input.Action {
+	case BulkApprove:
+		apply = func(tx pgx.Tx, id uuid.UUID) (*models.Excuse, error) { return approveTx(ctx, tx, schoolID, id, userID) }
+	case BulkReject:
+		apply = func(tx pgx.Tx, id uuid.UUID) (*models.Excuse, error) { return rejectTx(ctx, tx, schoolID, id) }
+	case BulkPaperReceived:
+		apply = func(tx pgx.Tx, id uuid.UUID) (*models.Excuse, error) { return paperReceivedTx(ctx, tx, schoolID, id) }
+	default:
+		return nil, ErrInvalidBulkAction
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result := &BulkExcuseResult{Action: input.Action, Results: make([]BulkExcuseItemResult, 0, len(input.IDs))}
+	for _, id := range input.IDs {
+		item := BulkExcuseItemResult{ID: id}
+
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("savepoint: %w", err)
+		}
+		e, err := apply(sp, id)
+		if err != nil {
+			sp.Rollback(ctx)
+			item.Error = "failed"
+			if errors.Is(err, pgx.ErrNoRows) {
+				item.Error = "not found"
+			}
+			result.Failed++
+		} else {
+			if err := sp.Commit(ctx); err != nil {
+				return nil, fmt.Errorf("release savepoint: %w", err)
+			}
+			if err := s.decrypt(ctx, e); err != nil {
+				return nil, err
+			}
+			item.OK = true
+			item.Excuse = e
+			result.Succeeded++
+		}
+		result.Results = append(result.Results, item)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return result, nil
+}
+
+// ExcuseLesson is one lesson covered by an excuse.
+type ExcuseLesson struct {
+	Date       time.Time `json:"date"`
+	SlotNumber int       `json:"slot_number"`
+	StartTime  string    `json:"start_time"`
+	EndTime    string    `json:"end_time"`
+	Subject    string    `json:"subject"`
+	Teacher    string    `json:"teacher"`
+	Status     string    `json:"status"`
+}
+
+// Lessons lists the attendance rows linked to an excuse in chronological order.
+func (s *ExcuseService) Lessons(ctx context.Context, excuseID uuid.UUID) ([]ExcuseLesson, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT a.date, ts.slot_number, to_char(ts.start_time, 'HH24:MI'), to_char(COALESCE(tse.end_time, ts.end_time), 'HH24:MI'),
+		        sub.name, t.abbreviation, a.status
+		 FROM excuse_attendance ea
+		 JOIN attendance a ON a.id = ea.attendance_id
+		 JOIN timetable_entries te ON te.id = a.timetable_entry_id
+		 JOIN time_slots ts ON ts.id = te.time_slot_id
+		 LEFT JOIN time_slots tse ON tse.school_id = ts.school_id AND tse.slot_number = ts.slot_number + te.slot_count - 1
+		 JOIN subjects sub ON sub.id = te.subject_id
+		 JOIN teachers t ON t.id = te.teacher_id
+		 WHERE ea.excuse_id = $1
+		 ORDER BY a.date, ts.slot_number`, excuseID)
+	if err != nil {
+		return nil, fmt.Errorf("list excuse lessons: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]ExcuseLesson, 0)
+	for rows.Next() {
+		var l ExcuseLesson
+		if err := rows.Scan(&l.Date, &l.SlotNumber, &l.StartTime, &l.EndTime,
+			&l.Subject, &l.Teacher, &l.Status); err != nil {
+			return nil, fmt.Errorf("scan excuse lesson: %w", err)
+		}
+		list = append(list, l)
+	}
+	return list, rows.Err()
+}
+
+// ExcuseDocument is everything needed to print an excuse form.
+type ExcuseDocument struct {
+	Excuse        *models.Excuse
+	Lessons       []ExcuseLesson
+	SchoolName    string
+	SchoolAddress string
+	SchoolLocale  string
+	StudentName   string
+	StudentAdult  bool
+	ClassName     string
+	ClassTeacher  string
+}
+
+func (s *ExcuseService) Document(ctx context.Context, schoolID, excuseID uuid.UUID) (*ExcuseDocument, error) {
+	e, err := s.GetByID(ctx, schoolID, excuseID)
+	if err != nil {
+		return nil, err
+	}
+	doc := &ExcuseDocument{Excuse: e}
+
+	var address, className, classTeacher *string
+	err = s.db.QueryRow(ctx,
+		`SELECT sch.name, sch.address, sch.locale,
+		        u.first_name || ' ' || u.last_name,
+		        (st.date_of_birth <= CURRENT_DATE - INTERVAL '18 years'),
+		        c.name, tu.first_name || ' ' || tu.last_name
+		 FROM students st
+		 JOIN schools sch ON sch.id = st.school_id
+		 JOIN users u ON u.id = st.user_id
+		 LEFT JOIN classes c ON c.id = st.class_id
+		 LEFT JOIN teachers t ON t.id = c.class_teacher_id
+		 LEFT JOIN users tu ON tu.id = t.user_id
+		 WHERE st.id = $1`, e.StudentID,
+	).Scan(&doc.SchoolName, &address, &doc.SchoolLocale, &doc.StudentName, &doc.StudentAdult,
+		&className, &classTeacher)
+	if err != nil {
+		return nil, fmt.Errorf("load excuse document: %w", err)
+	}
+	if address != nil {
+		doc.SchoolAddress = *address
+	}
+	if className != nil {
+		doc.ClassName = *className
+	}
+	if classTeacher != nil {
+		doc.ClassTeacher = *classTeacher
+	}
+
+	if doc.Lessons, err = s.Lessons(ctx, excuseID); err != nil {
+		return nil, err
+	}
+	return doc, nil
 }
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+var (
+	ErrLeaveNotPending   = errors.New("leave request already decided")
+	ErrLeaveNotApprover  = errors.New("not allowed to decide this leave request")
+	ErrLeaveInvalidRange = errors.New("invalid date or lesson range")
+)
+
+type LeaveService struct {
+	db *pgxpool.Pool
+}
+
+func NewLeaveService(db *pgxpool.Pool) *LeaveService {
+	return &LeaveService{db: db}
+}
+
+type CreateLeaveInput struct {
+	// StudentID is only honoured for teachers/admins submitting on behalf of a student.
+	StudentID *uuid.UUID `json:"student_id,omitempty"`
+	DateFrom  string     `json:"date_from"`
+	DateTo    string     `json:"date_to"`
+	SlotFrom  *int       `json:"slot_from,omitempty"`
+	SlotTo    *int       `json:"slot_to,omitempty"`
+	Reason    string     `json:"reason"`
+}
+
+type LeaveWithAttendance struct {
+	models.LeaveRequest
+	PrefilledLessons int `json:"prefilled_lessons"`
+}
+
+const leaveColumns = `id, school_id, student_id, date_from, date_to, slot_from, slot_to, reason, file_path,
+	status, approval_level, submitted_by, decided_by, decided_at, decision_note, created_at, updated_at`
+
+func scanLeave(row pgx.Row) (*models.LeaveRequest, error) {
+	var l models.LeaveRequest
+	err := row.Scan(&l.ID, &l.SchoolID, &l.StudentID, &l.DateFrom, &l.DateTo, &l.SlotFrom, &l.SlotTo,
+		&l.Reason, &l.FilePath, &l.Status, &l.ApprovalLevel, &l.SubmittedBy, &l.DecidedBy,
+		&l.DecidedAt, &l.DecisionNote, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// Create stores a new pending leave request. Requests spanning more school days
+// than the leave_head_approval_days setting must be granted by the head of school.
+func (s *LeaveService) Create(ctx context.Context, schoolID, studentID, submittedBy uuid.UUID, input CreateLeaveInput) (*models.LeaveRequest, error) {
+	from, err := time.Parse("2006-01-02", input.DateFrom)
+	if err != nil {
+		return nil, ErrLeaveInvalidRange
+	}
+	to, err := time.Parse("2006-01-02", input.DateTo)
+	if err != nil || to.Before(from) {
+		return nil, ErrLeaveInvalidRange
+	}
+	if from.Equal(to) && input.SlotFrom != nil && input.SlotTo != nil && *input.SlotTo < *input.SlotFrom {
+		return nil, ErrLeaveInvalidRange
+	}
+
+	headDays := NewSchoolService(s.db).GetIntSetting(ctx, schoolID, "leave_head_approval_days", 3)
+	calendar, err := NewCalendarService(s.db).Load(ctx, schoolID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	level := models.ApprovalClassTeacher
+	if calendar.SchoolDays(from, to) > headDays {
+		level = models.ApprovalHead
+	}
+
+	l, err := scanLeave(s.db.QueryRow(ctx,
+		`INSERT INTO leave_requests (school_id, student_id, date_from, date_to, slot_from, slot_to, reason, approval_level, submitted_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 RETURNING `+leaveColumns,
+		schoolID, studentID, input.DateFrom, input.DateTo, input.SlotFrom, input.SlotTo,
+		input.Reason, level, submittedBy,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("insert leave request: %w", err)
+	}
+	return l, nil
+}
+
+// List returns the school's leave requests; with guardianID only those of the
+// guardian's children.
+func (s *LeaveService) List(ctx context.Context, schoolID uuid.UUID, status, studentID, classID, guardianID string) ([]models.LeaveRequest, error) {
+	query := `SELECT l.id, l.school_id, l.student_id, l.date_from, l.date_to, l.slot_from, l.slot_to, l.reason,
+	                 l.file_path, l.status, l.approval_level, l.submitted_by, l.decided_by, l.decided_at,
+	                 l.decision_note, l.created_at, l.updated_at
+	          FROM leave_requests l`
+	args := []interface{}{schoolID}
+	where := ` WHERE l.school_id = $1`
+	n := 2
+
+	if status != "" {
+		where += fmt.Sprintf(` AND l.status = $%d`, n)
+		args = append(args, status)
+		n++
+	}
+	if studentID != "" {
+		where += fmt.Sprintf(` AND l.student_id = $%d`, n)
+		args = append(args, studentID)
+		n++
+	}
+	if guardianID != "" {
+		where += fmt.Sprintf(` AND l.student_id IN (SELECT student_id FROM student_guardians WHERE user_id = $%d)`, n)
+		args = append(args, guardianID)
+		n++
+	}
+	if classID != "" {
+		query += ` JOIN students s ON s.id = l.student_id`
+		where += fmt.Sprintf(` AND s.class_id = $%d`, n)
+		args = append(args, classID)
+		n++
+	}
+
+	rows, err := s.db.Query(ctx, query+where+` ORDER BY l.date_from DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list leave requests: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.LeaveRequest, 0)
+	for rows.Next() {
+		l, err := scanLeave(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan leave request: %w", err)
+		}
+		list = append(list, *l)
+	}
+	return list, nil
+}
+
+func (s *LeaveService) GetByID(ctx context.Context, schoolID, leaveID uuid.UUID) (*models.LeaveRequest, error) {
+	l, err := scanLeave(s.db.QueryRow(ctx,
+		`SELECT `+leaveColumns+` FROM leave_requests WHERE id = $1 AND school_id = $2`, leaveID, schoolID))
+	if err != nil {
+		return nil, fmt.Errorf("get leave request: %w", err)
+	}
+	return l, nil
+}
+
+// canDecide reports whether the user may grant or reject the request: admins
+// always, the student's class teacher only for class_teacher-level requests.
+func (s *LeaveService) canDecide(ctx context.Context, l *models.LeaveRequest, userID uuid.UUID, role string) (bool, error) {
+	if role == string(models.RoleAdmin) {
+		return true, nil
+	}
+	if role != string(models.RoleTeacher) || l.ApprovalLevel != models.ApprovalClassTeacher {
+		return false, nil
+	}
+	var isClassTeacher bool
+	err := s.db.QueryRow(ctx,
+		`SELECT EXISTS(
+		     SELECT 1 FROM students s
+		     JOIN classes c ON c.id = s.class_id
+		     JOIN teachers t ON t.id = c.class_teacher_id
+		     WHERE s.id = $1 AND t.user_id = $2)`,
+		l.StudentID, userID,
+	).Scan(&isClassTeacher)
+	if err != nil {
+		return false, fmt.Errorf("check class teacher: %w", err)
+	}
+	return isClassTeacher, nil
+}
+
+// Approve grants a pending leave request and pre-fills attendance for every
+// covered lesson of the student's class as excused_leave. Attendance already
+// recorded stays, unless the student was marked absent.
+func (s *LeaveService) Approve(ctx context.Context, schoolID, leaveID, userID uuid.UUID, role string, note *string) (*LeaveWithAttendance, error) {
+	l, err := s.GetByID(ctx, schoolID, leaveID)
+	if err != nil {
+		return nil, err
+	}
+	if l.Status != models.LeavePending {
+		return nil, ErrLeaveNotPending
+	}
+	ok, err := s.canDecide(ctx, l, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLeaveNotApprover
+	}
+
+	reference, err := NewTimetableService(s.db).abReference(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	l, err = scanLeave(tx.QueryRow(ctx,
+		`UPDATE leave_requests SET status = 'approved', decided_by = $3, decided_at = now(),
+		        decision_note = $4, updated_at = now()
+		 WHERE id = $1 AND school_id = $2 AND status = 'pending'
+		 RETURNING `+leaveColumns,
+		leaveID, schoolID, userID, note))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrLeaveNotPending
+		}
+		return nil, fmt.Errorf("approve leave request: %w", err)
+	}
+
+	result, err := tx.Exec(ctx,
+		`WITH filled AS (
+		     INSERT INTO attendance (school_id, student_id, timetable_entry_id, date, status, recorded_by, note)
+		     SELECT $2, s.id, t.id, d::date, 'excused_leave', $3, $4
+		     FROM leave_requests l
+		     JOIN students s ON s.id = l.student_id
+		     CROSS JOIN generate_series(l.date_from, l.date_to, interval '1 day') d
+		     JOIN timetable_entries t ON t.school_id = s.school_id AND `+attends("s", "t")+`
+		          AND t.day_of_week = EXTRACT(ISODOW FROM d)
+		          AND t.valid_from <= d::date
+		          AND (t.valid_until IS NULL OR t.valid_until >= d::date)
+		          AND `+inEpoch("t", "d::date")+`
+		          AND `+inWeek("t", "d::date", "$5::date")+`
+		     JOIN time_slots ts ON ts.id = t.time_slot_id
+		     WHERE l.id = $1 AND NOT `+lessonFree("l.school_id", "d::date")+`
+		       AND (d::date > l.date_from OR l.slot_from IS NULL OR ts.slot_number + t.slot_count - 1 >= l.slot_from)
+		       AND (d::date < l.date_to OR l.slot_to IS NULL OR ts.slot_number <= l.slot_to)
+		     ON CONFLICT (student_id, timetable_entry_id, date)
+		     DO UPDATE SET status = 'excused_leave', note = EXCLUDED.note, updated_at = now()
+		     WHERE attendance.status = 'absent'
+		     RETURNING id
+		 )
+		 INSERT INTO leave_attendance (leave_request_id, attendance_id)
+		 SELECT $1, id FROM filled
+		 ON CONFLICT DO NOTHING`,
+		leaveID, schoolID, userID, "Beurlaubung", reference)
+	if err != nil {
+		return nil, fmt.Errorf("prefill attendance: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &LeaveWithAttendance{
+		LeaveRequest:     *l,
+		PrefilledLessons: int(result.RowsAffected()),
+	}, nil
+}
+
+func (s *LeaveService) Reject(ctx context.Context, schoolID, leaveID, userID uuid.UUID, role string, reason *string) (*models.LeaveRequest, error) {
+	l, err := s.GetByID(ctx, schoolID, leaveID)
+	if err != nil {
+		return nil, err
+	}
+	if l.Status != models.LeavePending {
+		return nil, ErrLeaveNotPending
+	}
+	ok, err := s.canDecide(ctx, l, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLeaveNotApprover
+	}
+
+	l, err = scanLeave(s.db.QueryRow(ctx,
+		`UPDATE leave_requests SET status = 'rejected', decided_by = $3, decided_at = now(),
+		        decision_note = $4, updated_at = now()
+		 WHERE id = $1 AND school_id = $2 AND status = 'pending'
+		 RETURNING `+leaveColumns,
+		leaveID, schoolID, userID, reason))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrLeaveNotPending
+		}
+		return nil, fmt.Errorf("reject leave request: %w", err)
+	}
+	return l, nil
+}
+
+// SetFile stores the storage key of the uploaded proof and the data key it is
+// encrypted with (nil for plaintext).
+func (s *LeaveService) SetFile(ctx context.Context, schoolID, leaveID uuid.UUID, filePath string, dataKeyID *uuid.UUID) error {
+	tag, err := s.db.Exec(ctx,
+		`UPDATE leave_requests SET file_path = $1, file_data_key_id = $4, updated_at = now()
+		 WHERE id = $2 AND school_id = $3`,
+		filePath, leaveID, schoolID, dataKeyID)
+	if err != nil {
+		return fmt.Errorf("set leave file: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
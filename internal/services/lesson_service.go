@@ -55,7 +55,9 @@ func (s *LessonService) Update(ctx context.Context, schoolID, lessonID uuid.UUID
 	return &l, nil
 }
 
-func (s *LessonService) List(ctx context.Context, schoolID uuid.UUID, classID, subjectID, from, to string) ([]models.LessonContent, error) {
+// List returns recorded lesson content. classID includes the course groups
+// with students of that class.
+func (s *LessonService) List(ctx context.Context, schoolID uuid.UUID, classID, groupID, subjectID, from, to string) ([]models.LessonContent, error) {
 	query := `SELECT l.id, l.school_id, l.timetable_entry_id, l.date, l.topic, l.homework, l.notes, l.recorded_by, l.created_at, l.updated_at
 	          FROM lesson_content l
 	          JOIN timetable_entries t ON t.id = l.timetable_entry_id
@@ -64,10 +66,15 @@ func (s *LessonService) List(ctx context.Context, schoolID uuid.UUID, classID, s
 	n := 2
 
 	if classID != "" {
-		query += fmt.Sprintf(` AND t.class_id = $%d`, n)
+		query += ` AND ` + entryForClass("t", fmt.Sprintf("$%d::uuid", n))
 		args = append(args, classID)
 		n++
 	}
+	if groupID != "" {
+		query += fmt.Sprintf(` AND t.group_id = $%d`, n)
+		args = append(args, groupID)
+		n++
+	}
 	if subjectID != "" {
 		query += fmt.Sprintf(` AND t.subject_id = $%d`, n)
 		args = append(args, subjectID)
@@ -0,0 +1,485 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/events"
+	"github.com/Monstroxx/eduko-backend/internal/i18n"
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+var (
+	ErrNotificationNotFound = errors.New("notification not found")
+	ErrNotificationCategory = errors.New("unknown notification category")
+)
+
+// NotificationCategories lists the categories in display order.
+var NotificationCategories = []models.NotificationCategory{
+	models.NotifySubstitution, models.NotifyExcuse, models.NotifyExam, models.NotifyExcuseReminder,
+}
+
+// Without a preference, missing excuse reminders go out by e-mail as they
+// always did; everything else stays in the app. Push is on by default.
+var defaultEmail = map[models.NotificationCategory]bool{models.NotifyExcuseReminder: true}
+
+const defaultPush = true
+
+// notificationTypes maps each notification type to its category. The texts
+// are "notifications.<type>.title" and ".body" in the locale files.
+var notificationTypes = map[string]models.NotificationCategory{
+	"substitution":    models.NotifySubstitution,
+	"excuse_approved": models.NotifyExcuse,
+	"excuse_rejected": models.NotifyExcuse,
+	"exam":            models.NotifyExam,
+	"test":            models.NotifyExam,
+	"excuse_reminder": models.NotifyExcuseReminder,
+}
+
+// notificationDates are the params holding dates (YYYY-MM-DD), shown in the
+// reader's date format.
+var notificationDates = []string{"date", "date_from", "date_to", "deadline"}
+
+type NotificationService struct {
+	db *pgxpool.Pool
+}
+
+func NewNotificationService(db *pgxpool.Pool) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+// notify stores a notification of typ for users and tells their open event
+// streams. Users who want the category by e-mail and have an address get it
+// from the notification mailer job.
+func notify(ctx context.Context, db dbtx, schoolID uuid.UUID, users []uuid.UUID, typ string, params map[string]string) error {
+	if len(users) == 0 {
+		return nil
+	}
+	category, ok := notificationTypes[typ]
+	if !ok {
+		return fmt.Errorf("unknown notification type %q", typ)
+	}
+	_, err := db.Exec(ctx,
+		`INSERT INTO notifications (school_id, user_id, category, type, params, email_pending)
+		 SELECT $1::uuid, u.id, $2::notification_category, $3::varchar, $4::jsonb,
+		        COALESCE(p.email, $5::boolean) AND COALESCE(u.email, '') <> ''
+		 FROM users u
+		 LEFT JOIN notification_preferences p ON p.user_id = u.id AND p.category = $2::notification_category
+		 WHERE u.id = ANY($6::uuid[]) AND u.school_id = $1::uuid AND u.is_active`,
+		schoolID, category, typ, params, defaultEmail[category], users)
+	if err != nil {
+		return fmt.Errorf("create notifications: %w", err)
+	}
+	return events.Publish(ctx, db, schoolID, users, events.Event{
+		Type: events.NotificationCreated,
+		Data: map[string]interface{}{"category": category, "type": typ},
+	})
+}
+
+// render fills in Title and Body in tr's language.
+func render(tr i18n.Translator, n *models.Notification) {
+	params := make(map[string]string, len(n.Params))
+	for k, v := range n.Params {
+		params[k] = v
+	}
+	for _, k := range notificationDates {
+		if d, err := time.Parse(dateLayout, params[k]); err == nil {
+			params[k] = d.Format(tr.DateFormat())
+		}
+	}
+	if change, ok := params["change"]; ok {
+		params["change"] = tr.T("substitutions." + change)
+	}
+	n.Title = tr.Format("notifications."+n.Type+".title", params)
+	n.Body = tr.Format("notifications."+n.Type+".body", params)
+}
+
+// translator picks the language for a user: lang if given, else the user's
+// locale, else the school's.
+func (s *NotificationService) translator(ctx context.Context, userID uuid.UUID, lang string) (i18n.Translator, error) {
+	var locale *string
+	var schoolLocale string
+	err := s.db.QueryRow(ctx,
+		`SELECT u.locale, sc.locale FROM users u JOIN schools sc ON sc.id = u.school_id WHERE u.id = $1`,
+		userID).Scan(&locale, &schoolLocale)
+	if err != nil {
+		return i18n.Translator{}, fmt.Errorf("get locale: %w", err)
+	}
+	candidates := []string{lang}
+	if locale != nil {
+		candidates = append(candidates, *locale)
+	}
+	return i18n.For(append(candidates, schoolLocale)...), nil
+}
+
+const notificationColumns = `id, school_id, user_id, category, type, params, read_at, created_at`
+
+func scanNotification(row pgx.Row) (*models.Notification, error) {
+	var n models.Notification
+	if err := row.Scan(&n.ID, &n.SchoolID, &n.UserID, &n.Category, &n.Type, &n.Params, &n.ReadAt, &n.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// List returns the user's newest notifications, only unread ones with
+// unread, rendered in lang or the user's language.
+func (s *NotificationService) List(ctx context.Context, userID uuid.UUID, unread bool, limit int, lang string) ([]models.Notification, error) {
+	tr, err := s.translator(ctx, userID, lang)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + notificationColumns + ` FROM notifications WHERE user_id = $1`
+	if unread {
+		query += ` AND read_at IS NULL`
+	}
+	query += ` ORDER BY created_at DESC LIMIT $2`
+	rows, err := s.db.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list notifications: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.Notification, 0)
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan notification: %w", err)
+		}
+		render(tr, n)
+		list = append(list, *n)
+	}
+	return list, rows.Err()
+}
+
+func (s *NotificationService) UnreadCount(ctx context.Context, userID uuid.UUID) (int, error) {
+	var n int
+	err := s.db.QueryRow(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count notifications: %w", err)
+	}
+	return n, nil
+}
+
+// MarkRead marks one of the user's notifications as read. Marking it again
+// keeps the first read_at.
+func (s *NotificationService) MarkRead(ctx context.Context, userID, id uuid.UUID) error {
+	tag, err := s.db.Exec(ctx,
+		`UPDATE notifications SET read_at = COALESCE(read_at, now()) WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("mark notification read: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks all the user's notifications as read and returns how
+// many were unread.
+func (s *NotificationService) MarkAllRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	tag, err := s.db.Exec(ctx,
+		`UPDATE notifications SET read_at = now() WHERE user_id = $1 AND read_at IS NULL`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("mark notifications read: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Preferences returns the user's setting for every category, defaults
+// included.
+func (s *NotificationService) Preferences(ctx context.Context, userID uuid.UUID) ([]models.NotificationPreference, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT category, email, push FROM notification_preferences WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	stored := map[models.NotificationCategory]models.NotificationPreference{}
+	for rows.Next() {
+		var p models.NotificationPreference
+		if err := rows.Scan(&p.Category, &p.Email, &p.Push); err != nil {
+			return nil, fmt.Errorf("scan notification preference: %w", err)
+		}
+		stored[p.Category] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	list := make([]models.NotificationPreference, 0, len(NotificationCategories))
+	for _, c := range NotificationCategories {
+		p, ok := stored[c]
+		if !ok {
+			p = models.NotificationPreference{Category: c, Email: defaultEmail[c], Push: defaultPush}
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+// SetPreferences stores the given categories; the others keep their setting.
+func (s *NotificationService) SetPreferences(ctx context.Context, userID uuid.UUID, prefs []models.NotificationPreference) ([]models.NotificationPreference, error) {
+	for _, p := range prefs {
+		if !isNotificationCategory(p.Category) {
+			return nil, fmt.Errorf("%w: %q", ErrNotificationCategory, p.Category)
+		}
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, p := range prefs {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO notification_preferences (user_id, category, email, push)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (user_id, category) DO UPDATE SET email = $3, push = $4`,
+			userID, p.Category, p.Email, p.Push); err != nil {
+			return nil, fmt.Errorf("save notification preference: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return s.Preferences(ctx, userID)
+}
+
+func isNotificationCategory(c models.NotificationCategory) bool {
+	for _, known := range NotificationCategories {
+		if c == known {
+			return true
+		}
+	}
+	return false
+}
+
+// PendingEmail is a notification still to be e-mailed, rendered in the
+// recipient's language.
+type PendingEmail struct {
+	ID    uuid.UUID
+	To    string
+	Title string
+	Body  string
+}
+
+// maxEmailAttempts is how often sending a notification e-mail is tried
+// before it is given up.
+const maxEmailAttempts = 5
+
+// PendingEmails returns up to limit notifications due for e-mail, oldest
+// first. Notifications whose recipient no longer has an e-mail address are
+// dropped from the queue.
+func (s *NotificationService) PendingEmails(ctx context.Context, limit int) ([]PendingEmail, error) {
+	if _, err := s.db.Exec(ctx,
+		`UPDATE notifications n SET email_pending = false, email_error = 'no e-mail address'
+		 FROM users u
+		 WHERE u.id = n.user_id AND n.email_pending AND COALESCE(u.email, '') = ''`); err != nil {
+		return nil, fmt.Errorf("drop e-mails without address: %w", err)
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT n.id, n.type, n.params, u.email, u.locale, sc.locale
+		 FROM notifications n
+		 JOIN users u ON u.id = n.user_id
+		 JOIN schools sc ON sc.id = n.school_id
+		 WHERE n.email_pending AND (n.email_retry_at IS NULL OR n.email_retry_at <= now())
+		 ORDER BY n.created_at
+		 LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list pending e-mails: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]PendingEmail, 0)
+	for rows.Next() {
+		var n models.Notification
+		var email, locale *string
+		var schoolLocale string
+		if err := rows.Scan(&n.ID, &n.Type, &n.Params, &email, &locale, &schoolLocale); err != nil {
+			return nil, fmt.Errorf("scan pending e-mail: %w", err)
+		}
+		candidates := []string{schoolLocale}
+		if locale != nil {
+			candidates = []string{*locale, schoolLocale}
+		}
+		render(i18n.For(candidates...), &n)
+		to := ""
+		if email != nil {
+			to = *email
+		}
+		list = append(list, PendingEmail{ID: n.ID, To: to, Title: n.Title, Body: n.Body})
+	}
+	return list, rows.Err()
+}
+
+func (s *NotificationService) MarkEmailed(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.db.Exec(ctx, `UPDATE notifications SET email_pending = false WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("mark notification e-mailed: %w", err)
+	}
+	return nil
+}
+
+// MarkEmailFailed records a failed send. The next attempt waits 5 minutes,
+// doubling with every failure; after maxEmailAttempts the e-mail is given up
+// (gaveUp), the notification stays in the app.
+func (s *NotificationService) MarkEmailFailed(ctx context.Context, id uuid.UUID, sendErr error) (gaveUp bool, err error) {
+	err = s.db.QueryRow(ctx,
+		`UPDATE notifications
+		 SET email_attempts = email_attempts + 1,
+		     email_error = $2,
+		     email_retry_at = now() + make_interval(mins => 5 * (2 ^ email_attempts)::int),
+		     email_pending = email_attempts + 1 < $3
+		 WHERE id = $1
+		 RETURNING NOT email_pending`, id, sendErr.Error(), maxEmailAttempts).Scan(&gaveUp)
+	if err != nil {
+		return false, fmt.Errorf("mark notification e-mail failed: %w", err)
+	}
+	return gaveUp, nil
+}
+
+// ── Publishers ──────────────────────────────────────────────
+
+// schoolToday is the SQL expression for today in the time zone of school sc.
+const schoolToday = `(now() AT TIME ZONE sc.timezone)::date`
+
+// notifySubstitution tells the students of a lesson and their guardians
+// about a substitution for today up to the next school day (in the school's
+// time zone) and marks it notified. Later ones are left to the
+// substitution_notices job.
+func notifySubstitution(ctx context.Context, db dbtx, sub *models.Substitution) error {
+	var class, subject string
+	var period int
+	var soon bool
+	err := db.QueryRow(ctx,
+		`SELECT COALESCE(c.name, g.name, ''), sj.name, ts.slot_number,
+		        $2::date BETWEEN `+schoolToday+` AND `+addSchoolDays("sc.id", schoolToday, "1")+`
+		 FROM timetable_entries t
+		 JOIN schools sc ON sc.id = t.school_id
+		 JOIN subjects sj ON sj.id = t.subject_id
+		 JOIN time_slots ts ON ts.id = t.time_slot_id
+		 LEFT JOIN classes c ON c.id = t.class_id
+		 LEFT JOIN course_groups g ON g.id = t.group_id
+		 WHERE t.id = $1`,
+		sub.TimetableEntryID, sub.Date).Scan(&class, &subject, &period, &soon)
+	if err != nil {
+		return fmt.Errorf("get substituted lesson: %w", err)
+	}
+	if !soon {
+		return nil
+	}
+	users, err := recipients(ctx, db, lessonStudentRecipients, []uuid.UUID{sub.TimetableEntryID})
+	if err != nil {
+		return err
+	}
+	err = notify(ctx, db, sub.SchoolID, users, "substitution", map[string]string{
+		"change":  string(sub.Type),
+		"date":    sub.Date.Format(dateLayout),
+		"class":   class,
+		"period":  strconv.Itoa(period),
+		"subject": subject,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(ctx, `UPDATE substitutions SET notified_at = now() WHERE id = $1`, sub.ID); err != nil {
+		return fmt.Errorf("mark substitution notified: %w", err)
+	}
+	return nil
+}
+
+// notifyExcuseDecision tells the student and their guardians that an excuse
+// was approved or rejected.
+func notifyExcuseDecision(ctx context.Context, db dbtx, e *models.Excuse) error {
+	var student string
+	err := db.QueryRow(ctx,
+		`SELECT u.first_name || ' ' || u.last_name FROM students s JOIN users u ON u.id = s.user_id WHERE s.id = $1`,
+		e.StudentID).Scan(&student)
+	if err != nil {
+		return fmt.Errorf("get student: %w", err)
+	}
+	users, err := recipients(ctx, db, studentRecipients, []uuid.UUID{e.StudentID})
+	if err != nil {
+		return err
+	}
+	return notify(ctx, db, e.SchoolID, users, "excuse_"+string(e.Status), map[string]string{
+		"student":   student,
+		"date_from": e.DateFrom.Format(dateLayout),
+		"date_to":   e.DateTo.Format(dateLayout),
+	})
+}
+
+// notifyExam tells the students an exam or test is for and their guardians.
+func notifyExam(ctx context.Context, db dbtx, a *models.Appointment) error {
+	if a.Type != models.AppointExam && a.Type != models.AppointTest {
+		return nil
+	}
+	users, err := recipients(ctx, db, appointmentStudentRecipients, a.ID)
+	if err != nil {
+		return err
+	}
+	return notify(ctx, db, a.SchoolID, users, string(a.Type), map[string]string{
+		"title": a.Title,
+		"date":  a.Date.Format(dateLayout),
+	})
+}
+
+// ExcuseReminder notifies users that the absence m of student still needs an
+// excuse.
+func (s *NotificationService) ExcuseReminder(ctx context.Context, schoolID uuid.UUID, users []uuid.UUID, student string, m MissingExcuse) error {
+	return notify(ctx, s.db, schoolID, users, "excuse_reminder", map[string]string{
+		"student":   student,
+		"date":      m.AbsenceDate.Format(dateLayout),
+		"deadline":  m.Deadline.Format(dateLayout),
+		"lessons":   strconv.Itoa(m.Lessons),
+		"days_left": strconv.Itoa(m.DaysLeft),
+	})
+}
+
+// NotifyUpcomingSubstitutions notifies about the school's substitutions for
+// today up to the next school day that nobody was told about yet: those
+// entered further ahead or changed since. It returns how many it notified.
+func (s *NotificationService) NotifyUpcomingSubstitutions(ctx context.Context, schoolID uuid.UUID) (int, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+substitutionColumns+` FROM substitutions
+		 WHERE school_id = $1 AND notified_at IS NULL
+		   AND date BETWEEN (SELECT `+schoolToday+` FROM schools sc WHERE sc.id = $1)
+		                AND (SELECT `+addSchoolDays("sc.id", schoolToday, "1")+` FROM schools sc WHERE sc.id = $1)
+		 ORDER BY date`, schoolID)
+	if err != nil {
+		return 0, fmt.Errorf("list upcoming substitutions: %w", err)
+	}
+	var subs []*models.Substitution
+	for rows.Next() {
+		sub, err := scanSubstitution(rows)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan substitution: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("list upcoming substitutions: %w", err)
+	}
+
+	n := 0
+	for _, sub := range subs {
+		if err := notifySubstitution(ctx, s.db, sub); err != nil {
+			log.Printf("[notifications] substitution %s: %v", sub.ID, err)
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Entity types that can carry a retention policy (school setting "retention").
+const (
+	RetentionExcuses       = "excuses"
+	RetentionAttachments   = "attachments"
+	RetentionAttendance    = "attendance"
+	RetentionLeaveRequests = "leave_requests"
+)
+
+// RetentionAction is what happens to expired rows: delete removes them,
+// anonymize keeps the row for statistics but clears free text and files.
+type RetentionAction string
+
+const (
+	RetentionDelete    RetentionAction = "delete"
+	RetentionAnonymize RetentionAction = "anonymize"
+)
+
+// RetentionPolicy keeps rows until Years full school years after the end of
+// the school year they belong to.
+type RetentionPolicy struct {
+	Years  int             `json:"years"`
+	Action RetentionAction `json:"action"`
+}
+
+// RetentionPolicies maps entity types to their policy. Entity types without a
+// policy are never purged.
+type RetentionPolicies map[string]RetentionPolicy
+
+var ErrInvalidRetentionPolicy = errors.New("invalid retention policy")
+
+// retentionActions lists the actions each entity type supports.
+var retentionActions = map[string][]RetentionAction{
+	RetentionExcuses:       {RetentionDelete, RetentionAnonymize},
+	RetentionAttachments:   {RetentionDelete},
+	RetentionAttendance:    {RetentionDelete, RetentionAnonymize},
+	RetentionLeaveRequests: {RetentionDelete, RetentionAnonymize},
+}
+
+// Validate checks entity types, actions and periods.
+func (p RetentionPolicies) Validate() error {
+	for entity, policy := range p {
+		actions, ok := retentionActions[entity]
+		if !ok {
+			return fmt.Errorf("%w: unknown entity type %q", ErrInvalidRetentionPolicy, entity)
+		}
+		supported := false
+		for _, a := range actions {
+			supported = supported || a == policy.Action
+		}
+		if !supported {
+			return fmt.Errorf("%w: %s: action %q not supported", ErrInvalidRetentionPolicy, entity, policy.Action)
+		}
+		if policy.Years < 0 || policy.Years > 50 {
+			return fmt.Errorf("%w: %s: years must be between 0 and 50", ErrInvalidRetentionPolicy, entity)
+		}
+	}
+	return nil
+}
+
+// ParseSchoolYearEnd parses the school_year_end setting ("MM-DD").
+func ParseSchoolYearEnd(s string) (time.Month, int, error) {
+	t, err := time.Parse("01-02", s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: school_year_end must be MM-DD", ErrInvalidRetentionPolicy)
+	}
+	return t.Month(), t.Day(), nil
+}
+
+// RetentionCutoff returns the last date whose rows have expired on today:
+// the end of the school year that ended `years` years before the most recent
+// school year end. Rows dated on or before the cutoff are purged.
+func RetentionCutoff(today time.Time, endMonth time.Month, endDay, years int) time.Time {
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	lastEnd := time.Date(today.Year(), endMonth, endDay, 0, 0, 0, 0, time.UTC)
+	if lastEnd.After(today) {
+		lastEnd = lastEnd.AddDate(-1, 0, 0)
+	}
+	return time.Date(lastEnd.Year()-years, endMonth, endDay, 0, 0, 0, 0, time.UTC)
+}
+
+// RetentionItem reports what a policy removed (or would remove).
+type RetentionItem struct {
+	Entity string          `json:"entity"`
+	Action RetentionAction `json:"action"`
+	Years  int             `json:"years"`
+	Cutoff string          `json:"cutoff"`
+	Rows   int64           `json:"rows"`
+	Files  int             `json:"files"`
+	Bytes  int64           `json:"bytes"`
+}
+
+// RetentionReport summarises one purge run for a school.
+type RetentionReport struct {
+	SchoolID uuid.UUID       `json:"school_id"`
+	DryRun   bool            `json:"dry_run"`
+	Today    string          `json:"today"`
+	Items    []RetentionItem `json:"items"`
+	// FilesDeleted counts blobs no longer referenced after the purge.
+	FilesDeleted int `json:"files_deleted"`
+}
+
+type RetentionService struct {
+	db *pgxpool.Pool
+}
+
+func NewRetentionService(db *pgxpool.Pool) *RetentionService {
+	return &RetentionService{db: db}
+}
+
+// Policies loads the school's retention settings.
+func (s *RetentionService) Policies(ctx context.Context, schoolID uuid.UUID) (RetentionPolicies, time.Month, int, error) {
+	policies := RetentionPolicies{}
+	err := s.db.QueryRow(ctx,
+		`SELECT value FROM school_settings WHERE school_id = $1 AND key = 'retention'`, schoolID).Scan(&policies)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, 0, fmt.Errorf("load retention policies: %w", err)
+	}
+	if err := policies.Validate(); err != nil {
+		return nil, 0, 0, err
+	}
+
+	yearEnd := "07-31"
+	err = s.db.QueryRow(ctx,
+		`SELECT value #>> '{}' FROM school_settings WHERE school_id = $1 AND key = 'school_year_end'`,
+		schoolID).Scan(&yearEnd)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, 0, fmt.Errorf("load school_year_end: %w", err)
+	}
+	month, day, err := ParseSchoolYearEnd(yearEnd)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return policies, month, day, nil
+}
+
+// Purge applies the school's retention policies in one transaction. With
+// dryRun the transaction is rolled back, so the report is an exact preview.
+// It returns the storage keys of blobs that are no longer referenced; the
+// caller deletes them from storage after a real run.
+func (s *RetentionService) Purge(ctx context.Context, schoolID uuid.UUID, dryRun bool) (*RetentionReport, []string, error) {
+	policies, endMonth, endDay, err := s.Policies(ctx, schoolID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tz string
+	if err := s.db.QueryRow(ctx, `SELECT timezone FROM schools WHERE id = $1`, schoolID).Scan(&tz); err != nil {
+		return nil, nil, fmt.Errorf("load school: %w", err)
+	}
+	now := time.Now()
+	if loc, err := time.LoadLocation(tz); err == nil {
+		now = now.In(loc)
+	}
+	report := &RetentionReport{SchoolID: schoolID, DryRun: dryRun, Today: now.Format("2006-01-02"),
+		Items: make([]RetentionItem, 0, len(policies))}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var released []string
+	// Attachments first, so a shorter attachment period is reported on its own
+	// before the excuses policy removes the remaining files with their excuses.
+	for _, entity := range []string{RetentionAttachments, RetentionExcuses, RetentionAttendance, RetentionLeaveRequests} {
+		policy, ok := policies[entity]
+		if !ok {
+			continue
+		}
+		cutoff := RetentionCutoff(now, endMonth, endDay, policy.Years)
+		item := RetentionItem{Entity: entity, Action: policy.Action, Years: policy.Years,
+			Cutoff: cutoff.Format("2006-01-02")}
+
+		var keys []string
+		switch entity {
+		case RetentionAttachments:
+			keys, err = purgeAttachments(ctx, tx, schoolID, cutoff, &item)
+		case RetentionExcuses:
+			keys, err = purgeExcuses(ctx, tx, schoolID, cutoff, &item)
+		case RetentionAttendance:
+			err = purgeAttendance(ctx, tx, schoolID, cutoff, &item)
+		case RetentionLeaveRequests:
+			keys, err = purgeLeaveRequests(ctx, tx, schoolID, cutoff, &item)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("purge %s: %w", entity, err)
+		}
+		released = append(released, keys...)
+		report.Items = append(report.Items, item)
+	}
+
+	orphaned, err := unreferencedBlobs(ctx, tx, released)
+	if err != nil {
+		return nil, nil, err
+	}
+	report.FilesDeleted = len(orphaned)
+
+	if dryRun {
+		return report, nil, nil
+	}
+	summary, err := json.Marshal(report)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal report: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO audit_log (school_id, action, entity_type, entity_id, new_value)
+		 VALUES ($1, 'retention_purge', 'school', $1, $2)`, schoolID, summary); err != nil {
+		return nil, nil, fmt.Errorf("write audit log: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("commit: %w", err)
+	}
+	return report, orphaned, nil
+}
+
+// deleteExpiredAttachments removes the attachments of excuses ending on or
+// before cutoff and accounts for their files.
+func deleteExpiredAttachments(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, cutoff time.Time, item *RetentionItem) ([]string, error) {
+	rows, err := tx.Query(ctx,
+		`DELETE FROM excuse_attachments a USING excuses e
+		 WHERE a.excuse_id = e.id AND e.school_id = $1 AND e.date_to <= $2
+		 RETURNING a.storage_key, a.size_bytes`, schoolID, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		var size int64
+		if err := rows.Scan(&key, &size); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		item.Files++
+		item.Bytes += size
+	}
+	return keys, rows.Err()
+}
+
+func purgeAttachments(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, cutoff time.Time, item *RetentionItem) ([]string, error) {
+	keys, err := deleteExpiredAttachments(ctx, tx, schoolID, cutoff, item)
+	item.Rows = int64(item.Files)
+	return keys, err
+}
+
+func purgeExcuses(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, cutoff time.Time, item *RetentionItem) ([]string, error) {
+	keys, err := deleteExpiredAttachments(ctx, tx, schoolID, cutoff, item)
+	if err != nil {
+		return nil, err
+	}
+	// Legacy uploads (excuses.file_path) are released like attachments.
+	var sql string
+	if item.Action == RetentionAnonymize {
+		sql = `WITH expired AS (
+		           SELECT id, file_path FROM excuses
+		           WHERE school_id = $1 AND date_to <= $2 AND (reason IS NOT NULL OR file_path IS NOT NULL)
+		           FOR UPDATE)
+		       UPDATE excuses e SET reason = NULL, file_path = NULL, updated_at = now()
+		       FROM expired WHERE e.id = expired.id
+		       RETURNING expired.file_path`
+	} else {
+		sql = `DELETE FROM excuses WHERE school_id = $1 AND date_to <= $2 RETURNING file_path`
+	}
+	rows, err := tx.Query(ctx, sql, schoolID, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key *string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		item.Rows++
+		if key != nil && *key != "" {
+			keys = append(keys, *key)
+			item.Files++
+		}
+	}
+	return keys, rows.Err()
+}
+
+func purgeAttendance(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, cutoff time.Time, item *RetentionItem) error {
+	if item.Action == RetentionAnonymize {
+		tag, err := tx.Exec(ctx,
+			`UPDATE attendance SET note = NULL, updated_at = now()
+			 WHERE school_id = $1 AND date <= $2 AND note IS NOT NULL`, schoolID, cutoff)
+		if err != nil {
+			return err
+		}
+		item.Rows = tag.RowsAffected()
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM excuse_attendance ea USING attendance a
+		 WHERE ea.attendance_id = a.id AND a.school_id = $1 AND a.date <= $2`, schoolID, cutoff); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM excuse_reminders WHERE school_id = $1 AND absence_date <= $2`, schoolID, cutoff); err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM attendance WHERE school_id = $1 AND date <= $2`, schoolID, cutoff)
+	if err != nil {
+		return err
+	}
+	item.Rows = tag.RowsAffected()
+	return nil
+}
+
+func purgeLeaveRequests(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, cutoff time.Time, item *RetentionItem) ([]string, error) {
+	var sql string
+	if item.Action == RetentionAnonymize {
+		sql = `WITH expired AS (
+		           SELECT id, file_path FROM leave_requests
+		           WHERE school_id = $1 AND date_to <= $2
+		             AND (reason <> '' OR decision_note IS NOT NULL OR file_path IS NOT NULL)
+		           FOR UPDATE)
+		       UPDATE leave_requests l SET reason = '', decision_note = NULL, file_path = NULL,
+		                                   file_data_key_id = NULL, updated_at = now()
+		       FROM expired WHERE l.id = expired.id
+		       RETURNING expired.file_path`
+	} else {
+		sql = `DELETE FROM leave_requests WHERE school_id = $1 AND date_to <= $2 RETURNING file_path`
+	}
+	rows, err := tx.Query(ctx, sql, schoolID, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key *string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		item.Rows++
+		if key != nil && *key != "" {
+			keys = append(keys, *key)
+			item.Files++
+		}
+	}
+	return keys, rows.Err()
+}
+
+// unreferencedBlobs filters keys down to those no row points at anymore.
+func unreferencedBlobs(ctx context.Context, tx pgx.Tx, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	rows, err := tx.Query(ctx,
+		`SELECT DISTINCT k FROM unnest($1::text[]) AS k
+		 WHERE NOT EXISTS (SELECT 1 FROM excuse_attachments WHERE storage_key = k)
+		   AND NOT EXISTS (SELECT 1 FROM excuses WHERE file_path = k)
+		   AND NOT EXISTS (SELECT 1 FROM leave_requests WHERE file_path = k)`, keys)
+	if err != nil {
+		return nil, fmt.Errorf("check blob references: %w", err)
+	}
+	defer rows.Close()
+	var orphaned []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("scan blob key: %w", err)
+		}
+		orphaned = append(orphaned, key)
+	}
+	return orphaned, rows.Err()
+}
@@ -3,7 +3,9 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -87,3 +89,90 @@ func (s *SchoolService) UpdateSetting(ctx context.Context, schoolID uuid.UUID, k
 	}
 	return nil
 }
+
+// Today returns the current date in the school's time zone, at midnight UTC
+// like dates parsed from requests.
+func (s *SchoolService) Today(ctx context.Context, schoolID uuid.UUID) (time.Time, error) {
+	var tz string
+	if err := s.db.QueryRow(ctx, `SELECT timezone FROM schools WHERE id = $1`, schoolID).Scan(&tz); err != nil {
+		return time.Time{}, fmt.Errorf("get school: %w", err)
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		loc = time.UTC
+	}
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// GetIntSetting reads a numeric school setting, falling back to def when the
+// key is missing or not a number.
+func (s *SchoolService) GetIntSetting(ctx context.Context, schoolID uuid.UUID, key string, def int) int {
+	var value int
+	err := s.db.QueryRow(ctx,
+		`SELECT value FROM school_settings WHERE school_id = $1 AND key = $2`, schoolID, key,
+	).Scan(&value)
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// GetIntListSetting reads a setting holding a JSON array of numbers.
+func (s *SchoolService) GetIntListSetting(ctx context.Context, schoolID uuid.UUID, key string, def []int) []int {
+	var value []int
+	err := s.db.QueryRow(ctx,
+		`SELECT value FROM school_settings WHERE school_id = $1 AND key = $2`, schoolID, key,
+	).Scan(&value)
+	if err != nil || value == nil {
+		return def
+	}
+	return value
+}
+
+// ValidateSetting checks the value of the settings the services read; other
+// keys are accepted as they are.
+func ValidateSetting(key string, value interface{}) error {
+	switch key {
+	case "retention":
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		var policies RetentionPolicies
+		if err := json.Unmarshal(raw, &policies); err != nil {
+			return fmt.Errorf("%w: expected {\"<entity>\": {\"years\": n, \"action\": \"delete|anonymize\"}}", ErrInvalidRetentionPolicy)
+		}
+		return policies.Validate()
+	case "school_year_end":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%w: school_year_end must be MM-DD", ErrInvalidRetentionPolicy)
+		}
+		_, _, err := ParseSchoolYearEnd(s)
+		return err
+	case "ab_week_reference":
+		s, ok := value.(string)
+		if !ok {
+			return ErrInvalidABReference
+		}
+		if _, err := time.Parse(dateLayout, s); err != nil {
+			return fmt.Errorf("%w: expected YYYY-MM-DD of a day in an A week", ErrInvalidABReference)
+		}
+	case "max_periods_per_day":
+		if n, ok := value.(float64); !ok || n < 1 || n != float64(int(n)) {
+			return errors.New("max_periods_per_day must be a positive whole number")
+		}
+	case "school_days":
+		days, ok := value.([]interface{})
+		if !ok || len(days) == 0 {
+			return errors.New("school_days must be a list of weekdays (1 = Monday)")
+		}
+		for _, d := range days {
+			if n, ok := d.(float64); !ok || n < 1 || n > 7 || n != float64(int(n)) {
+				return errors.New("school_days must be a list of weekdays (1 = Monday)")
+			}
+		}
+	}
+	return nil
+}
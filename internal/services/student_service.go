@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
@@ -10,6 +11,8 @@ import (
 	"github.com/Monstroxx/eduko-backend/internal/models"
 )
 
+var ErrGuardianInvalid = errors.New("user is not a guardian of this school")
+
 type StudentService struct {
 	db *pgxpool.Pool
 }
@@ -109,11 +112,16 @@ func (s *StudentService) Update(ctx context.Context, schoolID, studentID uuid.UU
 	return s.GetByID(ctx, schoolID, studentID)
 }
 
-func (s *StudentService) GetAbsences(ctx context.Context, schoolID, studentID uuid.UUID, from, to string) ([]models.Attendance, error) {
+func (s *StudentService) GetAbsences(ctx context.Context, schoolID, studentID uuid.UUID, from, to, status string) ([]models.Attendance, error) {
 	query := `SELECT id, school_id, student_id, timetable_entry_id, date, status, recorded_by, note, created_at, updated_at
 	          FROM attendance WHERE school_id = $1 AND student_id = $2 AND status != 'present'`
 	args := []interface{}{schoolID, studentID}
 	n := 3
+	if status != "" {
+		query += fmt.Sprintf(` AND status = $%d`, n)
+		args = append(args, status)
+		n++
+	}
 	if from != "" {
 		query += fmt.Sprintf(` AND date >= $%d`, n)
 		args = append(args, from)
@@ -143,3 +151,110 @@ func (s *StudentService) GetAbsences(ctx context.Context, schoolID, studentID uu
 	}
 	return list, nil
 }
+
+// Guardians
+
+type Guardian struct {
+	UserID    uuid.UUID `json:"user_id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     *string   `json:"email,omitempty"`
+	Locale    *string   `json:"locale,omitempty"`
+}
+
+func (s *StudentService) ListGuardians(ctx context.Context, schoolID, studentID uuid.UUID) ([]Guardian, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT u.id, u.first_name, u.last_name, u.email, u.locale
+		 FROM student_guardians sg
+		 JOIN students s ON s.id = sg.student_id
+		 JOIN users u ON u.id = sg.user_id
+		 WHERE sg.student_id = $1 AND s.school_id = $2 AND u.is_active
+		 ORDER BY u.last_name, u.first_name`, studentID, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list guardians: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]Guardian, 0)
+	for rows.Next() {
+		var g Guardian
+		if err := rows.Scan(&g.UserID, &g.FirstName, &g.LastName, &g.Email, &g.Locale); err != nil {
+			return nil, fmt.Errorf("scan guardian: %w", err)
+		}
+		list = append(list, g)
+	}
+	return list, nil
+}
+
+// AddGuardian links a user with role guardian to a student of the same school.
+func (s *StudentService) AddGuardian(ctx context.Context, schoolID, studentID, userID uuid.UUID) error {
+	tag, err := s.db.Exec(ctx,
+		`INSERT INTO student_guardians (student_id, user_id)
+		 SELECT s.id, u.id FROM students s, users u
+		 WHERE s.id = $1 AND s.school_id = $3 AND u.id = $2 AND u.school_id = $3 AND u.role = 'guardian'
+		 ON CONFLICT DO NOTHING`, studentID, userID, schoolID)
+	if err != nil {
+		return fmt.Errorf("add guardian: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		var linked bool
+		_ = s.db.QueryRow(ctx,
+			`SELECT EXISTS(SELECT 1 FROM student_guardians WHERE student_id = $1 AND user_id = $2)`,
+			studentID, userID).Scan(&linked)
+		if !linked {
+			return ErrGuardianInvalid
+		}
+	}
+	return nil
+}
+
+func (s *StudentService) RemoveGuardian(ctx context.Context, schoolID, studentID, userID uuid.UUID) error {
+	_, err := s.db.Exec(ctx,
+		`DELETE FROM student_guardians sg USING students s
+		 WHERE sg.student_id = s.id AND s.id = $1 AND s.school_id = $2 AND sg.user_id = $3`,
+		studentID, schoolID, userID)
+	if err != nil {
+		return fmt.Errorf("remove guardian: %w", err)
+	}
+	return nil
+}
+
+// IsGuardian reports whether userID is a registered guardian of studentID.
+func (s *StudentService) IsGuardian(ctx context.Context, studentID, userID uuid.UUID) (bool, error) {
+	var ok bool
+	err := s.db.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM student_guardians WHERE student_id = $1 AND user_id = $2)`,
+		studentID, userID).Scan(&ok)
+	if err != nil {
+		return false, fmt.Errorf("check guardian: %w", err)
+	}
+	return ok, nil
+}
+
+// Contacts returns who should be told about a student's affairs: the
+// guardians for minors, the student themself for adults or when no guardian
+// is registered.
+func (s *StudentService) Contacts(ctx context.Context, schoolID, studentID uuid.UUID) ([]Guardian, error) {
+	student, err := s.GetByID(ctx, schoolID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	if !student.IsAdult {
+		guardians, err := s.ListGuardians(ctx, schoolID, studentID)
+		if err != nil {
+			return nil, err
+		}
+		if len(guardians) > 0 {
+			return guardians, nil
+		}
+	}
+	var locale *string
+	_ = s.db.QueryRow(ctx, `SELECT locale FROM users WHERE id = $1`, student.UserID).Scan(&locale)
+	return []Guardian{{
+		UserID:    student.UserID,
+		FirstName: student.FirstName,
+		LastName:  student.LastName,
+		Email:     student.Email,
+		Locale:    locale,
+	}}, nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+// SubstitutionPlanEntry is one changed lesson with display names instead of
+// IDs. Teacher, Room and Subject are what takes place; the Original fields
+// what was planned. Teacher is empty for cancellations and open
+// substitutions.
+type SubstitutionPlanEntry struct {
+	SubstitutionID  uuid.UUID               `json:"substitution_id"`
+	Type            models.SubstitutionType `json:"type"`
+	Open            bool                    `json:"open,omitempty"`
+	TimeSlotLabel   *string                 `json:"time_slot_label,omitempty"`
+	TimeSlotStart   *string                 `json:"time_slot_start,omitempty"`
+	TimeSlotEnd     *string                 `json:"time_slot_end,omitempty"`
+	ClassName       *string                 `json:"class_name,omitempty"`
+	GroupName       *string                 `json:"group_name,omitempty"`
+	Subject         *string                 `json:"subject,omitempty"`
+	OriginalSubject *string                 `json:"original_subject,omitempty"`
+	Teacher         *string                 `json:"teacher,omitempty"`
+	OriginalTeacher *string                 `json:"original_teacher,omitempty"`
+	Room            *string                 `json:"room,omitempty"`
+	OriginalRoom    *string                 `json:"original_room,omitempty"`
+	Note            *string                 `json:"note,omitempty"`
+}
+
+// SubstitutionPlanClass holds the changes of one class, or of a course group
+// without class, in lesson order.
+type SubstitutionPlanClass struct {
+	Class   string                  `json:"class"`
+	Entries []SubstitutionPlanEntry `json:"entries"`
+}
+
+type SubstitutionPlanDay struct {
+	Date      string                  `json:"date"`
+	DayOfWeek int                     `json:"day_of_week"`
+	Holiday   *string                 `json:"holiday,omitempty"`
+	Classes   []SubstitutionPlanClass `json:"classes"`
+}
+
+// planEntry turns a changed lesson into a plan entry.
+func planEntry(l *EffectiveLesson) SubstitutionPlanEntry {
+	ch := l.Change
+	entry := SubstitutionPlanEntry{
+		SubstitutionID:  ch.SubstitutionID,
+		Type:            ch.Type,
+		Open:            ch.Open,
+		TimeSlotLabel:   l.TimeSlotLabel,
+		TimeSlotStart:   l.TimeSlotStart,
+		TimeSlotEnd:     l.TimeSlotEnd,
+		ClassName:       l.ClassName,
+		GroupName:       l.GroupName,
+		Subject:         l.SubjectAbbreviation,
+		OriginalSubject: ch.OriginalSubjectAbbreviation,
+		OriginalTeacher: ch.OriginalTeacherAbbreviation,
+		OriginalRoom:    ch.OriginalRoomName,
+		Room:            l.RoomName,
+		Note:            ch.Note,
+	}
+	if ch.Type != models.SubTypeCancellation && !ch.Open {
+		entry.Teacher = l.TeacherAbbreviation
+	}
+	if ch.Type == models.SubTypeCancellation {
+		entry.Room = nil
+	}
+	return entry
+}
+
+// Plan returns the substitutions in [from, to] as they take effect, by date
+// and class. Substitutions on holidays or for lessons that don't take place
+// are left out, as they are in the timetable.
+func (s *SubstitutionService) Plan(ctx context.Context, schoolID uuid.UUID, from, to time.Time) ([]SubstitutionPlanDay, error) {
+	days, err := NewTimetableService(s.db).Effective(ctx, schoolID, TimetableFilter{}, from, to)
+	if err != nil {
+		return nil, err
+	}
+	plan := make([]SubstitutionPlanDay, 0, len(days))
+	for _, day := range days {
+		pd := SubstitutionPlanDay{Date: day.Date, DayOfWeek: day.DayOfWeek, Holiday: day.Holiday,
+			Classes: make([]SubstitutionPlanClass, 0)}
+		byClass := map[string]int{}
+		for i := range day.Lessons {
+			l := &day.Lessons[i]
+			if l.Change == nil {
+				continue
+			}
+			var class string
+			if l.ClassName != nil {
+				class = *l.ClassName
+			} else if l.GroupName != nil {
+				class = *l.GroupName
+			}
+			k, ok := byClass[class]
+			if !ok {
+				k = len(pd.Classes)
+				byClass[class] = k
+				pd.Classes = append(pd.Classes, SubstitutionPlanClass{Class: class})
+			}
+			pd.Classes[k].Entries = append(pd.Classes[k].Entries, planEntry(l))
+		}
+		sort.SliceStable(pd.Classes, func(i, j int) bool { return pd.Classes[i].Class < pd.Classes[j].Class })
+		plan = append(plan, pd)
+	}
+	return plan, nil
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+var (
+	ErrSubstitutionInvalid = errors.New("invalid substitution")
+	ErrSubstitutionDate    = errors.New("date doesn't fit the lesson")
+	ErrSubstitutionExists  = errors.New("lesson already has a substitution on this date")
+)
+
+// SubstitutionConflict is a lesson that already occupies the substitute
+// teacher or room while the substituted lesson takes place. Resources lists
+// which of them ("teacher", "room").
+type SubstitutionConflict struct {
+	Resources []string        `json:"resources"`
+	Lesson    EffectiveLesson `json:"lesson"`
+}
+
+// SubstitutionConflictError is returned by Create and Update when the
+// substitute teacher or room is busy and Force is not set.
+type SubstitutionConflictError struct {
+	Conflicts []SubstitutionConflict
+}
+
+func (e *SubstitutionConflictError) Error() string {
+	return fmt.Sprintf("substitution conflicts with %d lessons", len(e.Conflicts))
+}
+
+// lessonTaken reports whether err is the unique index on lesson and date:
+// another request stored a substitution after validate checked.
+func lessonTaken(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_substitutions_lesson"
+}
+
+// checkSubstitutionFields enforces which substitute fields each type takes.
+// open allows a substitution without teacher: teacher absences create those
+// until a substitute is confirmed.
+func checkSubstitutionFields(in CreateSubstitutionInput, open bool) error {
+	switch models.SubstitutionType(in.Type) {
+	case models.SubTypeCancellation:
+		if in.SubstituteTeacherID != nil || in.SubstituteRoomID != nil || in.SubstituteSubjectID != nil {
+			return fmt.Errorf("%w: a cancellation has no substitute teacher, room or subject", ErrSubstitutionInvalid)
+		}
+	case models.SubTypeRoomChange:
+		if in.SubstituteRoomID == nil {
+			return fmt.Errorf("%w: a room change needs substitute_room_id", ErrSubstitutionInvalid)
+		}
+		if in.SubstituteTeacherID != nil || in.SubstituteSubjectID != nil {
+			return fmt.Errorf("%w: a room change only changes the room", ErrSubstitutionInvalid)
+		}
+	case models.SubTypeSubstitution:
+		if in.SubstituteTeacherID == nil && !open {
+			return fmt.Errorf("%w: a substitution needs substitute_teacher_id", ErrSubstitutionInvalid)
+		}
+	case models.SubTypeExtraLesson:
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrSubstitutionInvalid, in.Type)
+	}
+	return nil
+}
+
+func (s *SubstitutionService) loadEntry(ctx context.Context, schoolID, entryID uuid.UUID) (*models.TimetableEntryEnriched, error) {
+	e, err := scanEnrichedEntry(s.db.QueryRow(ctx, enrichedTimetableQuery+` AND t.id = $2`, schoolID, entryID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrEntryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get timetable entry: %w", err)
+	}
+	return e, nil
+}
+
+// checkDate makes sure the entry takes place on date, or for an extra lesson
+// that it is valid but doesn't take place then anyway.
+func (s *SubstitutionService) checkDate(ctx context.Context, schoolID uuid.UUID, e *models.TimetableEntryEnriched, date time.Time, extra bool) error {
+	calendar, err := NewCalendarService(s.db).Load(ctx, schoolID, date, date)
+	if err != nil {
+		return err
+	}
+	if !calendar.HasLessons(date) {
+		return fmt.Errorf("%w: no lessons on %s", ErrSubstitutionDate, date.Format(dateLayout))
+	}
+	if !validOn(e, date) {
+		return fmt.Errorf("%w: the entry isn't valid on %s", ErrSubstitutionDate, date.Format(dateLayout))
+	}
+	reference, err := NewTimetableService(s.db).abReference(ctx, schoolID)
+	if err != nil {
+		return err
+	}
+	weekType := WeekTypeFor(date, reference)
+	onWeekday := e.DayOfWeek == isoWeekday(date)
+	inWeek := e.WeekType == models.WeekAll || e.WeekType == weekType
+	switch {
+	case extra && onWeekday && inWeek:
+		return fmt.Errorf("%w: the lesson takes place on %s anyway", ErrSubstitutionDate, date.Format(dateLayout))
+	case !extra && !onWeekday:
+		return fmt.Errorf("%w: the lesson is on weekday %d", ErrSubstitutionDate, e.DayOfWeek)
+	case !extra && !inWeek:
+		return fmt.Errorf("%w: the lesson is in %s weeks only, %s is in a %s week",
+			ErrSubstitutionDate, e.WeekType, date.Format(dateLayout), weekType)
+	}
+	return nil
+}
+
+// conflicts lists the lessons on date that overlap the entry's time and are
+// given by teacher or held in room. Cancelled lessons and the entry itself
+// don't count; substitutions already planned that day do.
+func (s *SubstitutionService) conflicts(ctx context.Context, schoolID uuid.UUID, e *models.TimetableEntryEnriched, date time.Time, teacher, room *uuid.UUID) ([]SubstitutionConflict, error) {
+	if teacher == nil && room == nil {
+		return nil, nil
+	}
+	day, err := NewTimetableService(s.db).Day(ctx, schoolID, TimetableFilter{}, date)
+	if err != nil {
+		return nil, err
+	}
+	target := &EffectiveLesson{TimetableEntryEnriched: *e}
+	var list []SubstitutionConflict
+	for i := range day.Lessons {
+		l := &day.Lessons[i]
+		if l.ID == e.ID || l.Status == LessonCancelled || !lessonsOverlap(l, target) {
+			continue
+		}
+		var resources []string
+		if teacher != nil && l.TeacherID == *teacher {
+			resources = append(resources, "teacher")
+		}
+		if room != nil && l.RoomID != nil && *l.RoomID == *room {
+			resources = append(resources, "room")
+		}
+		if len(resources) > 0 {
+			list = append(list, SubstitutionConflict{Resources: resources, Lesson: *l})
+		}
+	}
+	return list, nil
+}
+
+// validate checks a substitution before Create (subID nil) or Update stores
+// it: the fields its type takes, that the lesson takes place on the date,
+// that the lesson has no other substitution then and, unless Force is set,
+// that the substitute teacher and room are free.
+func (s *SubstitutionService) validate(ctx context.Context, schoolID uuid.UUID, subID *uuid.UUID, in CreateSubstitutionInput, open bool) error {
+	if err := checkSubstitutionFields(in, open); err != nil {
+		return err
+	}
+	date, err := time.Parse(dateLayout, in.Date)
+	if err != nil {
+		return fmt.Errorf("%w: invalid date", ErrSubstitutionInvalid)
+	}
+	e, err := s.loadEntry(ctx, schoolID, in.TimetableEntryID)
+	if err != nil {
+		return err
+	}
+	extra := models.SubstitutionType(in.Type) == models.SubTypeExtraLesson
+	if err := s.checkDate(ctx, schoolID, e, date, extra); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := s.db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM substitutions
+		                WHERE timetable_entry_id = $1 AND date = $2 AND id IS DISTINCT FROM $3)`,
+		in.TimetableEntryID, date, subID).Scan(&exists); err != nil {
+		return fmt.Errorf("check substitutions: %w", err)
+	}
+	if exists {
+		return ErrSubstitutionExists
+	}
+
+	if in.Force {
+		return nil
+	}
+	// An extra lesson occupies the planned teacher and room unless replaced.
+	teacher, room := in.SubstituteTeacherID, in.SubstituteRoomID
+	if extra {
+		if teacher == nil {
+			teacher = &e.TeacherID
+		}
+		if room == nil {
+			room = e.RoomID
+		}
+	}
+	conflicts, err := s.conflicts(ctx, schoolID, e, date, teacher, room)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &SubstitutionConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
@@ -2,11 +2,15 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/Monstroxx/eduko-backend/internal/events"
 	"github.com/Monstroxx/eduko-backend/internal/models"
 )
 
@@ -26,12 +30,27 @@ type CreateSubstitutionInput struct {
 	SubstituteRoomID    *uuid.UUID `json:"substitute_room_id,omitempty"`
 	SubstituteSubjectID *uuid.UUID `json:"substitute_subject_id,omitempty"`
 	Note                *string    `json:"note,omitempty"`
+	// Force stores the substitution although the substitute teacher or room is busy.
+	Force bool `json:"force,omitempty"`
 }
 
-func (s *SubstitutionService) List(ctx context.Context, schoolID uuid.UUID, date, from, to string) ([]models.Substitution, error) {
-	query := `SELECT id, school_id, timetable_entry_id, date, type, substitute_teacher_id,
-	                 substitute_room_id, substitute_subject_id, note, created_by, created_at, updated_at
-	          FROM substitutions WHERE school_id = $1`
+const substitutionColumns = `id, school_id, timetable_entry_id, date, type, substitute_teacher_id,
+	substitute_room_id, substitute_subject_id, teacher_absence_id, note, created_by, created_at, updated_at`
+
+func scanSubstitution(row pgx.Row) (*models.Substitution, error) {
+	var sub models.Substitution
+	if err := row.Scan(&sub.ID, &sub.SchoolID, &sub.TimetableEntryID, &sub.Date, &sub.Type,
+		&sub.SubstituteTeacherID, &sub.SubstituteRoomID, &sub.SubstituteSubjectID, &sub.TeacherAbsenceID,
+		&sub.Note, &sub.CreatedBy, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// List returns the substitutions of a date or range. With pending only those
+// of teacher absences that still lack a substitute teacher are returned.
+func (s *SubstitutionService) List(ctx context.Context, schoolID uuid.UUID, date, from, to string, pending bool) ([]models.Substitution, error) {
+	query := `SELECT ` + substitutionColumns + ` FROM substitutions WHERE school_id = $1`
 	args := []interface{}{schoolID}
 	n := 2
 
@@ -51,6 +70,9 @@ func (s *SubstitutionService) List(ctx context.Context, schoolID uuid.UUID, date
 			n++
 		}
 	}
+	if pending {
+		query += ` AND teacher_absence_id IS NOT NULL AND substitute_teacher_id IS NULL AND type <> 'cancellation'`
+	}
 	query += ` ORDER BY date, created_at`
 
 	rows, err := s.db.Query(ctx, query, args...)
@@ -61,50 +83,78 @@ func (s *SubstitutionService) List(ctx context.Context, schoolID uuid.UUID, date
 
 	list := make([]models.Substitution, 0)
 	for rows.Next() {
-		var sub models.Substitution
-		if err := rows.Scan(&sub.ID, &sub.SchoolID, &sub.TimetableEntryID, &sub.Date, &sub.Type,
-			&sub.SubstituteTeacherID, &sub.SubstituteRoomID, &sub.SubstituteSubjectID,
-			&sub.Note, &sub.CreatedBy, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+		sub, err := scanSubstitution(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan substitution: %w", err)
 		}
-		list = append(list, sub)
+		list = append(list, *sub)
 	}
-	return list, nil
+	return list, rows.Err()
 }
 
+// Create stores a substitution after validate accepted it. It fails with a
+// *SubstitutionConflictError when the substitute teacher or room is busy.
 func (s *SubstitutionService) Create(ctx context.Context, schoolID, createdBy uuid.UUID, input CreateSubstitutionInput) (*models.Substitution, error) {
-	var sub models.Substitution
-	err := s.db.QueryRow(ctx,
+	if err := s.validate(ctx, schoolID, nil, input, false); err != nil {
+		return nil, err
+	}
+	sub, err := scanSubstitution(s.db.QueryRow(ctx,
 		`INSERT INTO substitutions (school_id, timetable_entry_id, date, type, substitute_teacher_id, substitute_room_id, substitute_subject_id, note, created_by)
 		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		 RETURNING id, school_id, timetable_entry_id, date, type, substitute_teacher_id, substitute_room_id, substitute_subject_id, note, created_by, created_at, updated_at`,
+		 RETURNING `+substitutionColumns,
 		schoolID, input.TimetableEntryID, input.Date, input.Type, input.SubstituteTeacherID,
 		input.SubstituteRoomID, input.SubstituteSubjectID, input.Note, createdBy,
-	).Scan(&sub.ID, &sub.SchoolID, &sub.TimetableEntryID, &sub.Date, &sub.Type,
-		&sub.SubstituteTeacherID, &sub.SubstituteRoomID, &sub.SubstituteSubjectID,
-		&sub.Note, &sub.CreatedBy, &sub.CreatedAt, &sub.UpdatedAt)
+	))
+	if lessonTaken(err) {
+		return nil, ErrSubstitutionExists
+	}
 	if err != nil {
 		return nil, fmt.Errorf("create substitution: %w", err)
 	}
-	return &sub, nil
+	if err := publishSubstitution(ctx, s.db, events.SubstitutionCreated, sub, nil); err != nil {
+		log.Printf("[events] %v", err)
+	}
+	if err := notifySubstitution(ctx, s.db, sub); err != nil {
+		log.Printf("[notifications] %v", err)
+	}
+	return sub, nil
 }
 
+// Update replaces a substitution, with the same checks as Create. Those of a
+// teacher absence may stay without a substitute teacher.
 func (s *SubstitutionService) Update(ctx context.Context, schoolID, subID uuid.UUID, input CreateSubstitutionInput) (*models.Substitution, error) {
-	var sub models.Substitution
-	err := s.db.QueryRow(ctx,
+	prev, err := scanSubstitution(s.db.QueryRow(ctx,
+		`SELECT `+substitutionColumns+` FROM substitutions WHERE id = $1 AND school_id = $2`, subID, schoolID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSubstitutionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get substitution: %w", err)
+	}
+	if err := s.validate(ctx, schoolID, &subID, input, prev.TeacherAbsenceID != nil); err != nil {
+		return nil, err
+	}
+	sub, err := scanSubstitution(s.db.QueryRow(ctx,
 		`UPDATE substitutions SET timetable_entry_id=$3, date=$4, type=$5, substitute_teacher_id=$6,
-		        substitute_room_id=$7, substitute_subject_id=$8, note=$9, updated_at=now()
+		        substitute_room_id=$7, substitute_subject_id=$8, note=$9, notified_at=NULL, updated_at=now()
 		 WHERE id=$1 AND school_id=$2
-		 RETURNING id, school_id, timetable_entry_id, date, type, substitute_teacher_id, substitute_room_id, substitute_subject_id, note, created_by, created_at, updated_at`,
+		 RETURNING `+substitutionColumns,
 		subID, schoolID, input.TimetableEntryID, input.Date, input.Type, input.SubstituteTeacherID,
 		input.SubstituteRoomID, input.SubstituteSubjectID, input.Note,
-	).Scan(&sub.ID, &sub.SchoolID, &sub.TimetableEntryID, &sub.Date, &sub.Type,
-		&sub.SubstituteTeacherID, &sub.SubstituteRoomID, &sub.SubstituteSubjectID,
-		&sub.Note, &sub.CreatedBy, &sub.CreatedAt, &sub.UpdatedAt)
+	))
+	if lessonTaken(err) {
+		return nil, ErrSubstitutionExists
+	}
 	if err != nil {
 		return nil, fmt.Errorf("update substitution: %w", err)
 	}
-	return &sub, nil
+	if err := publishSubstitution(ctx, s.db, events.SubstitutionUpdated, sub, prev); err != nil {
+		log.Printf("[events] %v", err)
+	}
+	if err := notifySubstitution(ctx, s.db, sub); err != nil {
+		log.Printf("[notifications] %v", err)
+	}
+	return sub, nil
 }
 
 func (s *SubstitutionService) Delete(ctx context.Context, schoolID, subID uuid.UUID) error {
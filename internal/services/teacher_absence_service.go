@@ -0,0 +1,474 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/events"
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+var (
+	ErrTeacherNotFound      = errors.New("teacher not found")
+	ErrAbsenceNotFound      = errors.New("teacher absence not found")
+	ErrAbsenceInvalid       = errors.New("invalid date range")
+	ErrAbsenceOverlap       = errors.New("teacher is already absent in this period")
+	ErrSubstitutionNotFound = errors.New("substitution not found")
+	ErrSubstitutionNoLesson = errors.New("no lesson takes place for this substitution")
+	ErrConfirmInvalid       = errors.New("invalid confirmation")
+	ErrSubstituteBusy       = errors.New("teacher can't substitute")
+)
+
+type TeacherAbsenceService struct {
+	db *pgxpool.Pool
+}
+
+func NewTeacherAbsenceService(db *pgxpool.Pool) *TeacherAbsenceService {
+	return &TeacherAbsenceService{db: db}
+}
+
+const teacherAbsenceColumns = `id, school_id, teacher_id, date_from, date_to, note, created_by, created_at`
+
+func scanTeacherAbsence(row pgx.Row) (*models.TeacherAbsence, error) {
+	var a models.TeacherAbsence
+	if err := row.Scan(&a.ID, &a.SchoolID, &a.TeacherID, &a.DateFrom, &a.DateTo, &a.Note,
+		&a.CreatedBy, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *TeacherAbsenceService) List(ctx context.Context, schoolID, teacherID uuid.UUID) ([]models.TeacherAbsence, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+teacherAbsenceColumns+` FROM teacher_absences
+		 WHERE school_id = $1 AND teacher_id = $2 ORDER BY date_from DESC`, schoolID, teacherID)
+	if err != nil {
+		return nil, fmt.Errorf("list teacher absences: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.TeacherAbsence, 0)
+	for rows.Next() {
+		a, err := scanTeacherAbsence(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan teacher absence: %w", err)
+		}
+		list = append(list, *a)
+	}
+	return list, rows.Err()
+}
+
+type CreateTeacherAbsenceInput struct {
+	DateFrom string  `json:"date_from"`
+	DateTo   string  `json:"date_to"`
+	Note     *string `json:"note,omitempty"`
+}
+
+// TeacherAbsenceDetail is an absence with the substitutions created for it.
+type TeacherAbsenceDetail struct {
+	models.TeacherAbsence
+	Substitutions []models.Substitution `json:"substitutions"`
+}
+
+// Create records the absence and opens a substitution for every lesson the
+// teacher would give in it: their own lessons, those they already cover and
+// their extra lessons. Holidays and cancelled lessons are skipped. A lesson
+// that already has a substitution keeps it with its room and subject, but it
+// now belongs to the absence and loses its substitute teacher.
+func (s *TeacherAbsenceService) Create(ctx context.Context, schoolID, teacherID, userID uuid.UUID, input CreateTeacherAbsenceInput) (*TeacherAbsenceDetail, error) {
+	from, err := time.Parse(dateLayout, input.DateFrom)
+	if err != nil {
+		return nil, ErrAbsenceInvalid
+	}
+	to, err := time.Parse(dateLayout, input.DateTo)
+	if err != nil || to.Before(from) || to.Sub(from) > 366*24*time.Hour {
+		return nil, ErrAbsenceInvalid
+	}
+
+	days, err := NewTimetableService(s.db).Effective(ctx, schoolID, TimetableFilter{TeacherID: &teacherID}, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the teacher serializes absences of the same teacher.
+	var id uuid.UUID
+	err = tx.QueryRow(ctx, `SELECT id FROM teachers WHERE id = $1 AND school_id = $2 FOR UPDATE`,
+		teacherID, schoolID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTeacherNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock teacher: %w", err)
+	}
+	var overlap bool
+	if err := tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM teacher_absences
+		                WHERE teacher_id = $1 AND date_from <= $3 AND date_to >= $2)`,
+		teacherID, from, to).Scan(&overlap); err != nil {
+		return nil, fmt.Errorf("check teacher absences: %w", err)
+	}
+	if overlap {
+		return nil, ErrAbsenceOverlap
+	}
+
+	a, err := scanTeacherAbsence(tx.QueryRow(ctx,
+		`INSERT INTO teacher_absences (school_id, teacher_id, date_from, date_to, note, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING `+teacherAbsenceColumns,
+		schoolID, teacherID, from, to, input.Note, userID))
+	if err != nil {
+		return nil, fmt.Errorf("insert teacher absence: %w", err)
+	}
+
+	detail := &TeacherAbsenceDetail{TeacherAbsence: *a, Substitutions: make([]models.Substitution, 0)}
+	for _, day := range days {
+		for _, l := range day.Lessons {
+			if l.Status == LessonCancelled || l.TeacherID != teacherID {
+				continue
+			}
+			var sub *models.Substitution
+			if l.Change != nil {
+				sub, err = scanSubstitution(tx.QueryRow(ctx,
+					`UPDATE substitutions
+					 SET replaced_type = type, replaced_teacher_id = substitute_teacher_id,
+					     replaced_absence_id = teacher_absence_id,
+					     type = CASE WHEN type = 'extra_lesson' THEN type ELSE 'substitution' END,
+					     substitute_teacher_id = NULL, teacher_absence_id = $2, notified_at = NULL, updated_at = now()
+					 WHERE id = $1
+					 RETURNING `+substitutionColumns,
+					l.Change.SubstitutionID, a.ID))
+			} else {
+				sub, err = scanSubstitution(tx.QueryRow(ctx,
+					`INSERT INTO substitutions (school_id, timetable_entry_id, date, type, teacher_absence_id, created_by)
+					 VALUES ($1, $2, $3, 'substitution', $4, $5)
+					 RETURNING `+substitutionColumns,
+					schoolID, l.ID, l.Date, a.ID, userID))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("insert substitution: %w", err)
+			}
+			// The absent teacher hears about it too, also where they were
+			// the substitute.
+			prev := &models.Substitution{TimetableEntryID: l.ID, SubstituteTeacherID: &teacherID}
+			typ := events.SubstitutionCreated
+			if l.Change != nil {
+				typ = events.SubstitutionUpdated
+			}
+			if err := savepoint(ctx, tx, func(db pgx.Tx) error { return publishSubstitution(ctx, db, typ, sub, prev) }); err != nil {
+				log.Printf("[events] %v", err)
+			}
+			if err := savepoint(ctx, tx, func(db pgx.Tx) error { return notifySubstitution(ctx, db, sub) }); err != nil {
+				log.Printf("[notifications] %v", err)
+			}
+			detail.Substitutions = append(detail.Substitutions, *sub)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return detail, nil
+}
+
+// Delete removes the absence together with the substitutions it opened,
+// including those already confirmed. Substitutions that existed before the
+// absence get their former type and substitute teacher back.
+func (s *TeacherAbsenceService) Delete(ctx context.Context, schoolID, teacherID, absenceID uuid.UUID) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	if err := tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM teacher_absences WHERE id = $1 AND school_id = $2 AND teacher_id = $3)`,
+		absenceID, schoolID, teacherID).Scan(&exists); err != nil {
+		return fmt.Errorf("get teacher absence: %w", err)
+	}
+	if !exists {
+		return ErrAbsenceNotFound
+	}
+
+	rows, err := tx.Query(ctx,
+		`UPDATE substitutions
+		 SET type = replaced_type, substitute_teacher_id = replaced_teacher_id,
+		     teacher_absence_id = replaced_absence_id,
+		     replaced_type = NULL, replaced_teacher_id = NULL, replaced_absence_id = NULL,
+		     notified_at = NULL, updated_at = now()
+		 WHERE teacher_absence_id = $1 AND replaced_type IS NOT NULL
+		 RETURNING `+substitutionColumns, absenceID)
+	if err != nil {
+		return fmt.Errorf("restore substitutions: %w", err)
+	}
+	var restored []*models.Substitution
+	for rows.Next() {
+		sub, err := scanSubstitution(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("scan substitution: %w", err)
+		}
+		restored = append(restored, sub)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("restore substitutions: %w", err)
+	}
+	for _, sub := range restored {
+		prev := &models.Substitution{TimetableEntryID: sub.TimetableEntryID}
+		if err := savepoint(ctx, tx, func(db pgx.Tx) error {
+			return publishSubstitution(ctx, db, events.SubstitutionUpdated, sub, prev)
+		}); err != nil {
+			log.Printf("[events] %v", err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM teacher_absences WHERE id = $1`, absenceID); err != nil {
+		return fmt.Errorf("delete teacher absence: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// SubstituteCandidate is a teacher free to cover a substitution.
+type SubstituteCandidate struct {
+	TeacherID      uuid.UUID `json:"teacher_id"`
+	FirstName      string    `json:"first_name"`
+	LastName       string    `json:"last_name"`
+	Abbreviation   string    `json:"abbreviation"`
+	TeachesClass   bool      `json:"teaches_class"`
+	TeachesSubject bool      `json:"teaches_subject"`
+	MonthPeriods   int       `json:"month_periods"` // periods covered as a substitute in the lesson's month
+}
+
+// lessonsOverlap reports whether the lessons' times intersect.
+func lessonsOverlap(a, b *EffectiveLesson) bool {
+	if a.TimeSlotStart == nil || a.TimeSlotEnd == nil || b.TimeSlotStart == nil || b.TimeSlotEnd == nil {
+		return false
+	}
+	return *a.TimeSlotStart < *b.TimeSlotEnd && *b.TimeSlotStart < *a.TimeSlotEnd
+}
+
+// teacherAway is an SQL condition: the teacher is absent on the date or
+// unavailable (the whole weekday or a slot overlapping start-end). The
+// arguments are SQL expressions.
+func teacherAway(teacher, date, weekday, start, end string) string {
+	return `(EXISTS (SELECT 1 FROM teacher_absences a
+	                 WHERE a.teacher_id = ` + teacher + ` AND ` + date + ` BETWEEN a.date_from AND a.date_to)
+	         OR EXISTS (SELECT 1 FROM teacher_unavailability tu
+	                    LEFT JOIN time_slots ts ON ts.id = tu.time_slot_id
+	                    WHERE tu.teacher_id = ` + teacher + ` AND tu.day_of_week = ` + weekday + `
+	                      AND (ts.id IS NULL OR (ts.start_time < ` + end + `::time AND ts.end_time > ` + start + `::time))))`
+}
+
+// Candidates ranks the teachers who could cover the substitution. Teachers
+// who give or cover another lesson at that time, are absent or unavailable
+// are left out, as is the lesson's planned teacher. The rest are ordered by
+// whether they teach the class, then the subject, then by the fewest periods
+// covered this month.
+func (s *TeacherAbsenceService) Candidates(ctx context.Context, schoolID, substitutionID uuid.UUID) ([]SubstituteCandidate, error) {
+	var entryID uuid.UUID
+	var date time.Time
+	err := s.db.QueryRow(ctx,
+		`SELECT timetable_entry_id, date FROM substitutions WHERE id = $1 AND school_id = $2`,
+		substitutionID, schoolID).Scan(&entryID, &date)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSubstitutionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get substitution: %w", err)
+	}
+
+	day, err := NewTimetableService(s.db).Day(ctx, schoolID, TimetableFilter{}, date)
+	if err != nil {
+		return nil, err
+	}
+	var lesson *EffectiveLesson
+	for i := range day.Lessons {
+		if day.Lessons[i].ID == entryID {
+			lesson = &day.Lessons[i]
+		}
+	}
+	if lesson == nil {
+		return nil, ErrSubstitutionNoLesson
+	}
+	teacher, subject := lesson.TeacherID, lesson.SubjectID
+	if lesson.Change != nil {
+		teacher, subject = lesson.Change.OriginalTeacherID, lesson.Change.OriginalSubjectID
+	}
+	excluded := map[uuid.UUID]bool{teacher: true}
+	for i := range day.Lessons {
+		l := &day.Lessons[i]
+		if l.ID != entryID && l.Status != LessonCancelled && lessonsOverlap(l, lesson) {
+			excluded[l.TeacherID] = true
+		}
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT t.id, u.first_name, u.last_name, t.abbreviation,
+		        EXISTS (SELECT 1 FROM timetable_entries e
+		                WHERE e.teacher_id = t.id AND (e.class_id = $3 OR e.group_id = $4)
+		                  AND e.valid_from <= $2 AND (e.valid_until IS NULL OR e.valid_until >= $2)),
+		        EXISTS (SELECT 1 FROM timetable_entries e
+		                WHERE e.teacher_id = t.id AND e.subject_id = $5
+		                  AND e.valid_from <= $2 AND (e.valid_until IS NULL OR e.valid_until >= $2)),
+		        COALESCE((SELECT SUM(e.slot_count) FROM substitutions sx
+		                  JOIN timetable_entries e ON e.id = sx.timetable_entry_id
+		                  WHERE sx.substitute_teacher_id = t.id AND sx.type <> 'cancellation'
+		                    AND date_trunc('month', sx.date) = date_trunc('month', $2::date)), 0)::int,
+		        `+teacherAway("t.id", "$2", "$6", "$7", "$8")+`
+		 FROM teachers t JOIN users u ON u.id = t.user_id
+		 WHERE t.school_id = $1`,
+		schoolID, date, lesson.ClassID, lesson.GroupID, subject, isoWeekday(date),
+		lesson.TimeSlotStart, lesson.TimeSlotEnd)
+	if err != nil {
+		return nil, fmt.Errorf("list substitute candidates: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]SubstituteCandidate, 0)
+	for rows.Next() {
+		var c SubstituteCandidate
+		var away bool
+		if err := rows.Scan(&c.TeacherID, &c.FirstName, &c.LastName, &c.Abbreviation,
+			&c.TeachesClass, &c.TeachesSubject, &c.MonthPeriods, &away); err != nil {
+			return nil, fmt.Errorf("scan substitute candidate: %w", err)
+		}
+		if away || excluded[c.TeacherID] {
+			continue
+		}
+		list = append(list, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list substitute candidates: %w", err)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.TeachesClass != b.TeachesClass {
+			return a.TeachesClass
+		}
+		if a.TeachesSubject != b.TeachesSubject {
+			return a.TeachesSubject
+		}
+		if a.MonthPeriods != b.MonthPeriods {
+			return a.MonthPeriods < b.MonthPeriods
+		}
+		return a.Abbreviation < b.Abbreviation
+	})
+	return list, nil
+}
+
+type ConfirmSubstituteInput struct {
+	SubstitutionID uuid.UUID `json:"substitution_id"`
+	TeacherID      uuid.UUID `json:"teacher_id"`
+}
+
+// Confirm assigns the chosen substitute teachers in one transaction; if one
+// of them fails, none is saved. Like in Candidates, the lesson's own teacher
+// and teachers who are absent, unavailable or busy at that time, also with
+// another lesson of the same request, are rejected with ErrSubstituteBusy.
+func (s *TeacherAbsenceService) Confirm(ctx context.Context, schoolID uuid.UUID, input []ConfirmSubstituteInput) ([]models.Substitution, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	subs := NewSubstitutionService(s.db)
+	type booking struct {
+		teacher uuid.UUID
+		date    time.Time
+		lesson  EffectiveLesson
+	}
+	var booked []booking
+	list := make([]models.Substitution, 0, len(input))
+	for i, in := range input {
+		var exists bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM teachers WHERE id = $1 AND school_id = $2)`,
+			in.TeacherID, schoolID).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("check teacher: %w", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: entry %d: teacher not found", ErrConfirmInvalid, i)
+		}
+		prev, err := scanSubstitution(tx.QueryRow(ctx,
+			`SELECT `+substitutionColumns+` FROM substitutions
+			 WHERE id = $1 AND school_id = $2 AND type <> 'cancellation' FOR UPDATE`,
+			in.SubstitutionID, schoolID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: entry %d: substitution not found", ErrConfirmInvalid, i)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get substitution: %w", err)
+		}
+		date := prev.Date
+		e, err := subs.loadEntry(ctx, schoolID, prev.TimetableEntryID)
+		if err != nil {
+			return nil, err
+		}
+		if in.TeacherID == e.TeacherID {
+			return nil, fmt.Errorf("%w: entry %d: teacher gives the lesson", ErrSubstituteBusy, i)
+		}
+		var away bool
+		if err := tx.QueryRow(ctx, `SELECT `+teacherAway("$1", "$2::date", "$3", "$4", "$5"),
+			in.TeacherID, date, isoWeekday(date), e.TimeSlotStart, e.TimeSlotEnd).Scan(&away); err != nil {
+			return nil, fmt.Errorf("check teacher absences: %w", err)
+		}
+		if away {
+			return nil, fmt.Errorf("%w: entry %d: teacher is absent or unavailable", ErrSubstituteBusy, i)
+		}
+		conflicts, err := subs.conflicts(ctx, schoolID, e, date, &in.TeacherID, nil)
+		if err != nil {
+			return nil, err
+		}
+		busy := len(conflicts) > 0
+		lesson := EffectiveLesson{TimetableEntryEnriched: *e}
+		for _, b := range booked {
+			if b.teacher == in.TeacherID && b.date.Equal(date) && lessonsOverlap(&b.lesson, &lesson) {
+				busy = true
+			}
+		}
+		if busy {
+			return nil, fmt.Errorf("%w: entry %d: teacher is busy at that time", ErrSubstituteBusy, i)
+		}
+		booked = append(booked, booking{teacher: in.TeacherID, date: date, lesson: lesson})
+
+		sub, err := scanSubstitution(tx.QueryRow(ctx,
+			`UPDATE substitutions SET substitute_teacher_id = $2, updated_at = now()
+			 WHERE id = $1
+			 RETURNING `+substitutionColumns,
+			in.SubstitutionID, in.TeacherID))
+		if err != nil {
+			return nil, fmt.Errorf("confirm substitution: %w", err)
+		}
+		if err := savepoint(ctx, tx, func(db pgx.Tx) error {
+			return publishSubstitution(ctx, db, events.SubstitutionUpdated, sub, prev)
+		}); err != nil {
+			log.Printf("[events] %v", err)
+		}
+		list = append(list, *sub)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return list, nil
+}
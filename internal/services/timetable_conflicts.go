@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+// Two entries (aliases a and b) overlap in time when they are on the same
+// weekday, their slots overlap (blocks span slot_count slots), their weeks
+// overlap ('all' overlaps A and B), their validity ranges overlap and they are
+// not in epochs with disjoint dates.
+var timetableOverlap = `
+	a.school_id = b.school_id AND a.day_of_week = b.day_of_week
+	AND ` + slotNumber("a") + ` < ` + slotNumber("b") + ` + b.slot_count
+	AND ` + slotNumber("b") + ` < ` + slotNumber("a") + ` + a.slot_count
+	AND (a.week_type = 'all' OR b.week_type = 'all' OR a.week_type = b.week_type)
+	AND a.valid_from <= COALESCE(b.valid_until, 'infinity') AND b.valid_from <= COALESCE(a.valid_until, 'infinity')
+	AND (a.epoch_id IS NULL OR b.epoch_id IS NULL OR a.epoch_id = b.epoch_id OR EXISTS (
+	     SELECT 1 FROM epochs ea JOIN epochs eb ON ea.start_date <= eb.end_date AND eb.start_date <= ea.end_date
+	     WHERE ea.id = a.epoch_id AND eb.id = b.epoch_id))`
+
+// slotNumber is the SQL expression for the number of entry t's first slot.
+func slotNumber(t string) string {
+	return `(SELECT slot_number FROM time_slots WHERE id = ` + t + `.time_slot_id)`
+}
+
+// conflictFlags selects which resources entries a and b share: teacher, room
+// and students. Lessons of the same class only share students when neither
+// is a group lesson or a student attends both, so parallel groups of one
+// class (religion/ethics) don't collide.
+var conflictFlags = `
+	a.teacher_id = b.teacher_id,
+	COALESCE(a.room_id = b.room_id, false),
+	CASE WHEN a.group_id IS NULL AND b.group_id IS NULL THEN a.class_id = b.class_id
+	     WHEN a.group_id = b.group_id THEN true
+	     ELSE EXISTS (SELECT 1 FROM students st WHERE st.school_id = a.school_id
+	                  AND ` + attends("st", "a") + ` AND ` + attends("st", "b") + `)
+	END`
+
+// TimetableConflict describes entries that double-book a teacher, a room or
+// students. Resources lists which of them ("teacher", "room", "students").
+type TimetableConflict struct {
+	Resources []string                        `json:"resources"`
+	Entries   []models.TimetableEntryEnriched `json:"entries"`
+}
+
+// ConflictError is returned by Create and Update when the entry collides with
+// existing ones and Force is not set.
+type ConflictError struct {
+	Conflicts []TimetableConflict
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("timetable entry conflicts with %d existing entries", len(e.Conflicts))
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// conflictPair is one row of a conflict query: the entry IDs (b is uuid.Nil
+// for the entry being checked) and the shared resources.
+type conflictPair struct {
+	a, b                    uuid.UUID
+	teacher, room, students bool
+}
+
+func (p conflictPair) resources() []string {
+	var shared []string
+	if p.teacher {
+		shared = append(shared, "teacher")
+	}
+	if p.room {
+		shared = append(shared, "room")
+	}
+	if p.students {
+		shared = append(shared, "students")
+	}
+	return shared
+}
+
+// collectConflicts reads rows of (a.id, b.id, teacher, room, students) and
+// loads the entries involved from table.
+func collectConflicts(ctx context.Context, db querier, schoolID uuid.UUID, table string, rows pgx.Rows) ([]TimetableConflict, error) {
+	var pairs []conflictPair
+	var ids []uuid.UUID
+	for rows.Next() {
+		var p conflictPair
+		if err := rows.Scan(&p.a, &p.b, &p.teacher, &p.room, &p.students); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan timetable conflict: %w", err)
+		}
+		pairs = append(pairs, p)
+		ids = append(ids, p.a, p.b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("scan timetable conflicts: %w", err)
+	}
+
+	conflicts := make([]TimetableConflict, 0, len(pairs))
+	if len(pairs) == 0 {
+		return conflicts, nil
+	}
+	rows, err := db.Query(ctx, enrichedQuery(table)+` AND t.id = ANY($2)`, schoolID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("load conflicting entries: %w", err)
+	}
+	defer rows.Close()
+	entries := map[uuid.UUID]*models.TimetableEntryEnriched{}
+	for rows.Next() {
+		e, err := scanEnrichedEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan timetable: %w", err)
+		}
+		entries[e.ID] = e
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load conflicting entries: %w", err)
+	}
+
+	for _, p := range pairs {
+		c := TimetableConflict{Resources: p.resources(), Entries: []models.TimetableEntryEnriched{*entries[p.a]}}
+		if e, ok := entries[p.b]; ok {
+			c.Entries = append(c.Entries, *e)
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, nil
+}
+
+// checkConflicts returns the existing entries the input would collide with.
+// exclude is the entry being updated.
+func (s *TimetableService) checkConflicts(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, exclude *uuid.UUID, input CreateTimetableInput) ([]TimetableConflict, error) {
+	// Serialise timetable writes per school so two concurrent requests cannot
+	// both pass the check.
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('timetable:' || $1::text))`, schoolID); err != nil {
+		return nil, fmt.Errorf("lock timetable: %w", err)
+	}
+
+	excluded := uuid.Nil
+	if exclude != nil {
+		excluded = *exclude
+	}
+	rows, err := tx.Query(ctx,
+		`SELECT * FROM (
+		     SELECT a.id, $11::uuid, `+conflictFlags+`
+		     FROM timetable_entries a,
+		          (SELECT $1::uuid AS school_id, $2::uuid AS time_slot_id, $3::int AS day_of_week,
+		                  $4::week_type AS week_type, $5::date AS valid_from, $6::date AS valid_until,
+		                  $7::uuid AS teacher_id, $8::uuid AS room_id, $9::uuid AS class_id,
+		                  $10::uuid AS group_id, $12::int AS slot_count, $13::uuid AS epoch_id) b
+		     WHERE a.school_id = $1 AND a.id <> $11 AND `+timetableOverlap+`
+		 ) x(a, b, teacher, room, students)
+		 WHERE teacher OR room OR students
+		 ORDER BY a`,
+		schoolID, input.TimeSlotID, input.DayOfWeek, input.WeekType, input.ValidFrom, input.ValidUntil,
+		input.TeacherID, input.RoomID, input.ClassID, input.GroupID, excluded,
+		input.SlotCount, input.EpochID)
+	if err != nil {
+		return nil, fmt.Errorf("check timetable conflicts: %w", err)
+	}
+	return collectConflicts(ctx, tx, schoolID, "timetable_entries", rows)
+}
+
+// Conflicts scans the school for pairs of colliding entries that are valid
+// today or later.
+func (s *TimetableService) Conflicts(ctx context.Context, schoolID uuid.UUID) ([]TimetableConflict, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT * FROM (
+		     SELECT a.id, b.id, `+conflictFlags+`
+		     FROM timetable_entries a
+		     JOIN timetable_entries b ON a.id < b.id AND `+timetableOverlap+`
+		     WHERE a.school_id = $1
+		       AND (a.valid_until IS NULL OR a.valid_until >= CURRENT_DATE)
+		       AND (b.valid_until IS NULL OR b.valid_until >= CURRENT_DATE)
+		 ) x(a, b, teacher, room, students)
+		 WHERE teacher OR room OR students
+		 ORDER BY a, b`, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("scan timetable conflicts: %w", err)
+	}
+	return collectConflicts(ctx, s.db, schoolID, "timetable_entries", rows)
+}
@@ -0,0 +1,611 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+)
+
+var (
+	ErrDraftNotFound      = errors.New("timetable draft not found")
+	ErrDraftEntryNotFound = errors.New("draft entry not found")
+	ErrDraftPublished     = errors.New("timetable draft is already published")
+	ErrDraftInvalid       = errors.New("name and effective_from required")
+	ErrDraftPastDate      = errors.New("effective_from must not be in the past")
+	ErrDraftOutdated      = errors.New("the published timetable changed since the draft was created")
+)
+
+// TimetableDraftService manages drafts of the timetable. A draft starts as a
+// copy of the lessons valid on its effective date; publishing it ends the
+// published lessons it changes or removes on the day before and adds its new
+// lessons from that date, so the old plan stays queryable by date.
+type TimetableDraftService struct {
+	db *pgxpool.Pool
+}
+
+func NewTimetableDraftService(db *pgxpool.Pool) *TimetableDraftService {
+	return &TimetableDraftService{db: db}
+}
+
+const timetableDraftColumns = `id, school_id, name, status, effective_from, created_by, published_by, published_at, created_at`
+
+func scanTimetableDraft(row pgx.Row) (*models.TimetableDraft, error) {
+	var d models.TimetableDraft
+	if err := row.Scan(&d.ID, &d.SchoolID, &d.Name, &d.Status, &d.EffectiveFrom, &d.CreatedBy,
+		&d.PublishedBy, &d.PublishedAt, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// enrichedDraftQuery selects the entries of draft $2 with their display data.
+var enrichedDraftQuery = enrichedQuery("timetable_draft_entries", "t.draft_id", "t.source_entry_id") +
+	` AND t.draft_id = $2`
+
+func scanDraftEntry(row pgx.Row) (*models.TimetableDraftEntry, error) {
+	var e models.TimetableDraftEntry
+	dst := append([]interface{}{&e.DraftID, &e.SourceEntryID}, enrichedEntryFields(&e.TimetableEntryEnriched)...)
+	if err := row.Scan(dst...); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// List returns the school's drafts, newest first. status filters by draft or
+// published.
+func (s *TimetableDraftService) List(ctx context.Context, schoolID uuid.UUID, status string) ([]models.TimetableDraft, error) {
+	query := `SELECT ` + timetableDraftColumns + ` FROM timetable_drafts WHERE school_id = $1`
+	args := []interface{}{schoolID}
+	if status != "" {
+		query += ` AND status = $2`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list timetable drafts: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.TimetableDraft, 0)
+	for rows.Next() {
+		d, err := scanTimetableDraft(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan timetable draft: %w", err)
+		}
+		list = append(list, *d)
+	}
+	return list, rows.Err()
+}
+
+type CreateDraftInput struct {
+	Name          string `json:"name"`
+	EffectiveFrom string `json:"effective_from"`
+}
+
+// Create stores a draft with a copy of the published lessons that are valid
+// on or after its effective date.
+func (s *TimetableDraftService) Create(ctx context.Context, schoolID, userID uuid.UUID, input CreateDraftInput) (*models.TimetableDraft, error) {
+	if _, err := time.Parse(dateLayout, input.EffectiveFrom); err != nil || input.Name == "" {
+		return nil, ErrDraftInvalid
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	d, err := scanTimetableDraft(tx.QueryRow(ctx,
+		`INSERT INTO timetable_drafts (school_id, name, effective_from, created_by)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+timetableDraftColumns,
+		schoolID, input.Name, input.EffectiveFrom, userID))
+	if err != nil {
+		return nil, fmt.Errorf("create timetable draft: %w", err)
+	}
+	if err := copyPublishedEntries(ctx, tx, schoolID, d.ID, d.EffectiveFrom, nil); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return d, nil
+}
+
+// copyPublishedEntries copies the published entries valid on or after from
+// into a draft, except the class lessons (not group lessons) of the classes
+// in replaced.
+func copyPublishedEntries(ctx context.Context, tx pgx.Tx, schoolID, draftID uuid.UUID, from time.Time, replaced []uuid.UUID) error {
+	if replaced == nil {
+		replaced = []uuid.UUID{}
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO timetable_draft_entries (draft_id, source_entry_id, source_updated_at, school_id, class_id, group_id,
+		                                      subject_id, teacher_id, room_id, time_slot_id, slot_count, epoch_id,
+		                                      day_of_week, week_type, valid_from, valid_until)
+		 SELECT $1, id, updated_at, school_id, class_id, group_id, subject_id, teacher_id, room_id, time_slot_id,
+		        slot_count, epoch_id, day_of_week, week_type, valid_from, valid_until
+		 FROM timetable_entries
+		 WHERE school_id = $2 AND (valid_until IS NULL OR valid_until >= $3)
+		   AND NOT (group_id IS NULL AND class_id = ANY($4))`,
+		draftID, schoolID, from, replaced); err != nil {
+		return fmt.Errorf("copy timetable entries: %w", err)
+	}
+	return nil
+}
+
+// TimetableDraftDetail is a draft with its entries.
+type TimetableDraftDetail struct {
+	models.TimetableDraft
+	Entries []models.TimetableDraftEntry `json:"entries"`
+}
+
+func (s *TimetableDraftService) Get(ctx context.Context, schoolID, draftID uuid.UUID) (*TimetableDraftDetail, error) {
+	d, err := scanTimetableDraft(s.db.QueryRow(ctx,
+		`SELECT `+timetableDraftColumns+` FROM timetable_drafts WHERE id = $1 AND school_id = $2`,
+		draftID, schoolID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDraftNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get timetable draft: %w", err)
+	}
+	entries, err := draftEntries(ctx, s.db, schoolID, draftID)
+	if err != nil {
+		return nil, err
+	}
+	return &TimetableDraftDetail{TimetableDraft: *d, Entries: entries}, nil
+}
+
+func draftEntries(ctx context.Context, db querier, schoolID, draftID uuid.UUID) ([]models.TimetableDraftEntry, error) {
+	rows, err := db.Query(ctx, enrichedDraftQuery+` ORDER BY t.day_of_week, ts.slot_number, c.name`,
+		schoolID, draftID)
+	if err != nil {
+		return nil, fmt.Errorf("list draft entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]models.TimetableDraftEntry, 0)
+	for rows.Next() {
+		e, err := scanDraftEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan draft entry: %w", err)
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
+
+// Delete discards an unpublished draft. Published drafts are kept as history.
+func (s *TimetableDraftService) Delete(ctx context.Context, schoolID, draftID uuid.UUID) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := openDraft(ctx, tx, schoolID, draftID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM timetable_drafts WHERE id = $1`, draftID); err != nil {
+		return fmt.Errorf("delete timetable draft: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// openDraft locks a draft that can still be edited.
+func openDraft(ctx context.Context, tx pgx.Tx, schoolID, draftID uuid.UUID) (*models.TimetableDraft, error) {
+	d, err := scanTimetableDraft(tx.QueryRow(ctx,
+		`SELECT `+timetableDraftColumns+` FROM timetable_drafts WHERE id = $1 AND school_id = $2 FOR UPDATE`,
+		draftID, schoolID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDraftNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get timetable draft: %w", err)
+	}
+	if d.Status != models.DraftOpen {
+		return nil, ErrDraftPublished
+	}
+	return d, nil
+}
+
+// CreateEntry adds a lesson to a draft. valid_from defaults to the draft's
+// effective date. Conflicts are not checked until the draft is validated or
+// published.
+func (s *TimetableDraftService) CreateEntry(ctx context.Context, schoolID, draftID uuid.UUID, input CreateTimetableInput) (*models.TimetableDraftEntry, error) {
+	return s.saveEntry(ctx, schoolID, draftID, nil, input)
+}
+
+// UpdateEntry replaces a lesson of a draft.
+func (s *TimetableDraftService) UpdateEntry(ctx context.Context, schoolID, draftID, entryID uuid.UUID, input CreateTimetableInput) (*models.TimetableDraftEntry, error) {
+	return s.saveEntry(ctx, schoolID, draftID, &entryID, input)
+}
+
+func (s *TimetableDraftService) saveEntry(ctx context.Context, schoolID, draftID uuid.UUID, entryID *uuid.UUID, input CreateTimetableInput) (*models.TimetableDraftEntry, error) {
+	if input.ClassID == nil && input.GroupID == nil {
+		return nil, ErrTimetableNoAudience
+	}
+	if input.WeekType == "" {
+		input.WeekType = models.WeekAll
+	}
+	if input.SlotCount < 1 {
+		input.SlotCount = 1
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	d, err := openDraft(ctx, tx, schoolID, draftID)
+	if err != nil {
+		return nil, err
+	}
+	if input.ValidFrom == "" {
+		input.ValidFrom = d.EffectiveFrom.Format(dateLayout)
+	}
+	if err := checkEntryReferences(ctx, tx, schoolID, input); err != nil {
+		return nil, err
+	}
+
+	var id uuid.UUID
+	if entryID == nil {
+		err = tx.QueryRow(ctx,
+			`INSERT INTO timetable_draft_entries (draft_id, school_id, class_id, group_id, subject_id, teacher_id, room_id,
+			                                      time_slot_id, day_of_week, week_type, valid_from, valid_until, slot_count, epoch_id)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			 RETURNING id`,
+			draftID, schoolID, input.ClassID, input.GroupID, input.SubjectID, input.TeacherID, input.RoomID,
+			input.TimeSlotID, input.DayOfWeek, input.WeekType, input.ValidFrom, input.ValidUntil,
+			input.SlotCount, input.EpochID).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("create draft entry: %w", err)
+		}
+	} else {
+		err = tx.QueryRow(ctx,
+			`UPDATE timetable_draft_entries SET class_id=$3, group_id=$4, subject_id=$5, teacher_id=$6, room_id=$7,
+			        time_slot_id=$8, day_of_week=$9, week_type=$10, valid_from=$11, valid_until=$12,
+			        slot_count=$13, epoch_id=$14, updated_at=now()
+			 WHERE id = $1 AND draft_id = $2
+			 RETURNING id`,
+			*entryID, draftID, input.ClassID, input.GroupID, input.SubjectID, input.TeacherID, input.RoomID,
+			input.TimeSlotID, input.DayOfWeek, input.WeekType, input.ValidFrom, input.ValidUntil,
+			input.SlotCount, input.EpochID).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrDraftEntryNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("update draft entry: %w", err)
+		}
+	}
+
+	e, err := scanDraftEntry(tx.QueryRow(ctx, enrichedDraftQuery+` AND t.id = $3`, schoolID, draftID, id))
+	if err != nil {
+		return nil, fmt.Errorf("get draft entry: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return e, nil
+}
+
+func (s *TimetableDraftService) DeleteEntry(ctx context.Context, schoolID, draftID, entryID uuid.UUID) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := openDraft(ctx, tx, schoolID, draftID); err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx, `DELETE FROM timetable_draft_entries WHERE id = $1 AND draft_id = $2`, entryID, draftID)
+	if err != nil {
+		return fmt.Errorf("delete draft entry: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDraftEntryNotFound
+	}
+	return tx.Commit(ctx)
+}
+
+// DraftChange is a published lesson and the draft lesson replacing it.
+type DraftChange struct {
+	Before models.TimetableEntryEnriched `json:"before"`
+	After  models.TimetableDraftEntry    `json:"after"`
+}
+
+// DraftDiff compares a draft with the published plan from EffectiveFrom on.
+type DraftDiff struct {
+	EffectiveFrom string                          `json:"effective_from"`
+	Added         []models.TimetableDraftEntry    `json:"added"`
+	Removed       []models.TimetableEntryEnriched `json:"removed"`
+	Changed       []DraftChange                   `json:"changed"`
+	Unchanged     int                             `json:"unchanged"`
+}
+
+// Diff compares the draft with the published lessons valid on or after date
+// (default: the draft's effective date). Draft lessons ending before date
+// are left out.
+func (s *TimetableDraftService) Diff(ctx context.Context, schoolID, draftID uuid.UUID, date string) (*DraftDiff, error) {
+	detail, err := s.Get(ctx, schoolID, draftID)
+	if err != nil {
+		return nil, err
+	}
+	from := detail.EffectiveFrom
+	if date != "" {
+		if from, err = time.Parse(dateLayout, date); err != nil {
+			return nil, ErrDraftInvalid
+		}
+	}
+	return diffDraft(ctx, s.db, schoolID, detail.Entries, from)
+}
+
+func diffDraft(ctx context.Context, db querier, schoolID uuid.UUID, draft []models.TimetableDraftEntry, from time.Time) (*DraftDiff, error) {
+	rows, err := db.Query(ctx,
+		enrichedTimetableQuery+` AND (t.valid_until IS NULL OR t.valid_until >= $2)
+		 ORDER BY t.day_of_week, ts.slot_number, c.name`, schoolID, from)
+	if err != nil {
+		return nil, fmt.Errorf("get timetable: %w", err)
+	}
+	published := map[uuid.UUID]*models.TimetableEntryEnriched{}
+	var order []uuid.UUID
+	for rows.Next() {
+		e, err := scanEnrichedEntry(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan timetable: %w", err)
+		}
+		published[e.ID] = e
+		order = append(order, e.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get timetable: %w", err)
+	}
+
+	diff := &DraftDiff{
+		EffectiveFrom: from.Format(dateLayout),
+		Added:         make([]models.TimetableDraftEntry, 0),
+		Removed:       make([]models.TimetableEntryEnriched, 0),
+		Changed:       make([]DraftChange, 0),
+	}
+	kept := map[uuid.UUID]bool{}
+	for _, e := range draft {
+		if e.ValidUntil != nil && e.ValidUntil.Before(from) {
+			continue
+		}
+		var source *models.TimetableEntryEnriched
+		if e.SourceEntryID != nil && !kept[*e.SourceEntryID] {
+			source = published[*e.SourceEntryID]
+		}
+		switch {
+		case source == nil:
+			diff.Added = append(diff.Added, e)
+		case sameLesson(source.TimetableEntry, e.TimetableEntry, from):
+			kept[source.ID] = true
+			diff.Unchanged++
+		default:
+			kept[source.ID] = true
+			diff.Changed = append(diff.Changed, DraftChange{Before: *source, After: e})
+		}
+	}
+	for _, id := range order {
+		if !kept[id] {
+			diff.Removed = append(diff.Removed, *published[id])
+		}
+	}
+	return diff, nil
+}
+
+// sameLesson reports whether a and b describe the same lesson from date on.
+func sameLesson(a, b models.TimetableEntry, date time.Time) bool {
+	return sameID(a.ClassID, b.ClassID) && sameID(a.GroupID, b.GroupID) && a.SubjectID == b.SubjectID &&
+		a.TeacherID == b.TeacherID && sameID(a.RoomID, b.RoomID) && a.TimeSlotID == b.TimeSlotID &&
+		a.SlotCount == b.SlotCount && sameID(a.EpochID, b.EpochID) && a.DayOfWeek == b.DayOfWeek &&
+		a.WeekType == b.WeekType && laterDate(a.ValidFrom, date).Equal(laterDate(b.ValidFrom, date)) &&
+		sameDate(a.ValidUntil, b.ValidUntil)
+}
+
+func sameID(a, b *uuid.UUID) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+func sameDate(a, b *time.Time) bool {
+	return a == nil && b == nil || a != nil && b != nil && a.Equal(*b)
+}
+
+func laterDate(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// Conflicts checks the draft for double bookings as it would be published
+// on date (default: the draft's effective date).
+func (s *TimetableDraftService) Conflicts(ctx context.Context, schoolID, draftID uuid.UUID, date string) ([]TimetableConflict, error) {
+	detail, err := s.Get(ctx, schoolID, draftID)
+	if err != nil {
+		return nil, err
+	}
+	from := detail.EffectiveFrom
+	if date != "" {
+		if from, err = time.Parse(dateLayout, date); err != nil {
+			return nil, ErrDraftInvalid
+		}
+	}
+	return draftConflicts(ctx, s.db, schoolID, draftID, from)
+}
+
+func draftConflicts(ctx context.Context, db querier, schoolID, draftID uuid.UUID, from time.Time) ([]TimetableConflict, error) {
+	rows, err := db.Query(ctx,
+		`WITH d AS (
+		     SELECT id, school_id, class_id, group_id, teacher_id, room_id, time_slot_id, slot_count, epoch_id,
+		            day_of_week, week_type, GREATEST(valid_from, $3) AS valid_from, valid_until
+		     FROM timetable_draft_entries
+		     WHERE draft_id = $2 AND (valid_until IS NULL OR valid_until >= $3)
+		 )
+		 SELECT * FROM (
+		     SELECT a.id, b.id, `+conflictFlags+`
+		     FROM d a
+		     JOIN d b ON a.id < b.id AND `+timetableOverlap+`
+		     WHERE a.school_id = $1
+		 ) x(a, b, teacher, room, students)
+		 WHERE teacher OR room OR students
+		 ORDER BY a, b`, schoolID, draftID, from)
+	if err != nil {
+		return nil, fmt.Errorf("scan draft conflicts: %w", err)
+	}
+	return collectConflicts(ctx, db, schoolID, "timetable_draft_entries", rows)
+}
+
+type PublishDraftInput struct {
+	// EffectiveFrom overrides the draft's effective date.
+	EffectiveFrom string `json:"effective_from,omitempty"`
+	// Force publishes the draft despite conflicts and changes to the
+	// published plan since the draft was created.
+	Force bool `json:"force,omitempty"`
+}
+
+// draftOutdated reports whether the published plan changed since draft d
+// copied it: a copied entry was edited or deleted, or an entry valid on or
+// after from was added. Publishing would silently undo those changes.
+func draftOutdated(ctx context.Context, tx pgx.Tx, d *models.TimetableDraft, from time.Time) (bool, error) {
+	var outdated bool
+	err := tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM timetable_draft_entries d
+		                LEFT JOIN timetable_entries t ON t.id = d.source_entry_id
+		                WHERE d.draft_id = $1 AND d.source_updated_at IS NOT NULL
+		                  AND (t.id IS NULL OR t.updated_at <> d.source_updated_at))
+		     OR EXISTS (SELECT 1 FROM timetable_entries t
+		                WHERE t.school_id = $2 AND t.created_at > $3
+		                  AND (t.valid_until IS NULL OR t.valid_until >= $4))`,
+		d.ID, d.SchoolID, d.CreatedAt, from).Scan(&outdated)
+	if err != nil {
+		return false, fmt.Errorf("check published timetable: %w", err)
+	}
+	return outdated, nil
+}
+
+// PublishResult counts the lessons publishing changed.
+type PublishResult struct {
+	Draft     models.TimetableDraft `json:"draft"`
+	Added     int                   `json:"added"`
+	Changed   int                   `json:"changed"`
+	Removed   int                   `json:"removed"`
+	Unchanged int                   `json:"unchanged"`
+}
+
+// Publish makes the draft the timetable from its effective date on, in one
+// transaction: published lessons the draft changes or removes end the day
+// before, changed and new lessons start on that date. Unless input.Force is
+// set it fails with a *ConflictError when the draft has double bookings and
+// with ErrDraftOutdated when the published plan changed since the draft was
+// created.
+func (s *TimetableDraftService) Publish(ctx context.Context, schoolID, draftID, userID uuid.UUID, input PublishDraftInput) (*PublishResult, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Same lock as timetable writes, so no entry changes while publishing.
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('timetable:' || $1::text))`, schoolID); err != nil {
+		return nil, fmt.Errorf("lock timetable: %w", err)
+	}
+	d, err := openDraft(ctx, tx, schoolID, draftID)
+	if err != nil {
+		return nil, err
+	}
+	from := d.EffectiveFrom
+	if input.EffectiveFrom != "" {
+		if from, err = time.Parse(dateLayout, input.EffectiveFrom); err != nil {
+			return nil, ErrDraftInvalid
+		}
+	}
+	var past bool
+	if err := tx.QueryRow(ctx, `SELECT $1::date < CURRENT_DATE`, from).Scan(&past); err != nil {
+		return nil, fmt.Errorf("check effective date: %w", err)
+	}
+	if past {
+		return nil, ErrDraftPastDate
+	}
+
+	if !input.Force {
+		outdated, err := draftOutdated(ctx, tx, d, from)
+		if err != nil {
+			return nil, err
+		}
+		if outdated {
+			return nil, ErrDraftOutdated
+		}
+		conflicts, err := draftConflicts(ctx, tx, schoolID, draftID, from)
+		if err != nil {
+			return nil, err
+		}
+		if len(conflicts) > 0 {
+			return nil, &ConflictError{Conflicts: conflicts}
+		}
+	}
+
+	entries, err := draftEntries(ctx, tx, schoolID, draftID)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := diffDraft(ctx, tx, schoolID, entries, from)
+	if err != nil {
+		return nil, err
+	}
+
+	ended := make([]uuid.UUID, 0, len(diff.Changed)+len(diff.Removed))
+	added := make([]uuid.UUID, 0, len(diff.Changed)+len(diff.Added))
+	for _, c := range diff.Changed {
+		ended = append(ended, c.Before.ID)
+		added = append(added, c.After.ID)
+	}
+	for _, e := range diff.Removed {
+		ended = append(ended, e.ID)
+	}
+	for _, e := range diff.Added {
+		added = append(added, e.ID)
+	}
+
+	if err := endEntries(ctx, tx, ended, from); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO timetable_entries (school_id, class_id, group_id, subject_id, teacher_id, room_id, time_slot_id,
+		                                slot_count, epoch_id, day_of_week, week_type, valid_from, valid_until)
+		 SELECT school_id, class_id, group_id, subject_id, teacher_id, room_id, time_slot_id,
+		        slot_count, epoch_id, day_of_week, week_type, GREATEST(valid_from, $2), valid_until
+		 FROM timetable_draft_entries WHERE id = ANY($1)`,
+		added, from); err != nil {
+		return nil, fmt.Errorf("publish draft entries: %w", err)
+	}
+
+	published, err := scanTimetableDraft(tx.QueryRow(ctx,
+		`UPDATE timetable_drafts SET status = 'published', effective_from = $2, published_by = $3, published_at = now()
+		 WHERE id = $1
+		 RETURNING `+timetableDraftColumns,
+		draftID, from, userID))
+	if err != nil {
+		return nil, fmt.Errorf("publish timetable draft: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &PublishResult{
+		Draft: *published, Added: len(diff.Added), Changed: len(diff.Changed),
+		Removed: len(diff.Removed), Unchanged: diff.Unchanged,
+	}, nil
+}
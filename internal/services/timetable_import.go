@@ -0,0 +1,714 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/asc"
+	"github.com/Monstroxx/eduko-backend/internal/models"
+	"github.com/Monstroxx/eduko-backend/internal/untis"
+)
+
+var ErrImportSchoolYear = errors.New("school_year is required")
+
+// lockedPassword is stored for imported teachers. It is no bcrypt hash, so
+// nobody can log in until an admin sets a password.
+const lockedPassword = "!"
+
+// TimetableImport is a timetable taken over from another timetabling
+// program. Teachers and subjects are matched by abbreviation, classes by name
+// within the school year, rooms by name and time slots by number.
+type TimetableImport struct {
+	Teachers  []untis.Teacher
+	Classes   []untis.Class
+	Rooms     []untis.Room
+	Subjects  []untis.Subject
+	TimeSlots []untis.Period
+	Lessons   []ImportLesson
+	Issues    []untis.Issue
+}
+
+// ImportLesson is a weekly lesson of a class; Count > 1 is a block. Group
+// names a course group of the class (created if missing); empty means the
+// whole class.
+type ImportLesson struct {
+	File     string
+	Line     int
+	Class    string
+	Group    string
+	Teacher  string
+	Subject  string
+	Room     string
+	Day      int
+	Period   int
+	Count    int
+	WeekType models.WeekType
+}
+
+// FromUntis converts GPU exports, merging consecutive periods into blocks.
+func FromUntis(d *untis.Data) *TimetableImport {
+	in := &TimetableImport{
+		Teachers: d.Teachers, Classes: d.Classes, Rooms: d.Rooms, Subjects: d.Subjects,
+		TimeSlots: d.Periods, Issues: d.Issues,
+	}
+	for _, b := range untis.Blocks(d.Lessons) {
+		in.Lessons = append(in.Lessons, ImportLesson{
+			File: untis.FileTimetable, Line: b.Line, Class: b.Class, Teacher: b.Teacher, Subject: b.Subject,
+			Room: b.Room, Day: b.Day, Period: b.Period, Count: b.Count, WeekType: models.WeekAll,
+		})
+	}
+	return in
+}
+
+// FromASc converts an aSc Timetables export. Part groups of a class become
+// course groups named "<class> <group>".
+func FromASc(t *asc.Timetable) *TimetableImport {
+	in := &TimetableImport{}
+	for _, p := range t.Periods {
+		in.TimeSlots = append(in.TimeSlots, untis.Period{Number: p.Number, Start: p.Start, End: p.End, Label: p.Label})
+	}
+	for _, x := range t.Teachers {
+		in.Teachers = append(in.Teachers, untis.Teacher{Abbreviation: x.Short, FirstName: x.FirstName, LastName: x.LastName})
+	}
+	for _, x := range t.Subjects {
+		in.Subjects = append(in.Subjects, untis.Subject{Abbreviation: x.Short, Name: x.Name})
+	}
+	for _, name := range t.Rooms {
+		in.Rooms = append(in.Rooms, untis.Room{Name: name})
+	}
+	for _, name := range t.Classes {
+		in.Classes = append(in.Classes, untis.Class{Name: name})
+	}
+	for _, l := range t.Lessons {
+		weekType := models.WeekAll
+		if l.Weeks != "" {
+			weekType = models.WeekType(l.Weeks)
+		}
+		in.Lessons = append(in.Lessons, ImportLesson{
+			File: ascFile, Class: l.Class, Group: l.Group, Teacher: l.Teacher, Subject: l.Subject,
+			Room: l.Room, Day: l.Day, Period: l.Period, Count: l.Count, WeekType: weekType,
+		})
+	}
+	for _, msg := range t.Issues {
+		in.Issues = append(in.Issues, untis.Issue{File: ascFile, Message: msg})
+	}
+	return in
+}
+
+// ascFile names the aSc export in issues.
+const ascFile = "XML"
+
+type ImportOptions struct {
+	SchoolYear string
+	ValidFrom  time.Time
+	ValidUntil *time.Time
+	DryRun     bool
+}
+
+// ImportChanges lists what an import did to one kind of record.
+type ImportChanges struct {
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// ImportLessonChanges lists the timetable entries that were added and the
+// ones that were ended because the import no longer contains them.
+type ImportLessonChanges struct {
+	Created   []string `json:"created"`
+	Ended     []string `json:"ended"`
+	Unchanged int      `json:"unchanged"`
+}
+
+type ImportReport struct {
+	DryRun     bool                `json:"dry_run"`
+	SchoolYear string              `json:"school_year"`
+	ValidFrom  string              `json:"valid_from"`
+	TimeSlots  ImportChanges       `json:"time_slots"`
+	Subjects   ImportChanges       `json:"subjects"`
+	Rooms      ImportChanges       `json:"rooms"`
+	Classes    ImportChanges       `json:"classes"`
+	Teachers   ImportChanges       `json:"teachers"`
+	Groups     ImportChanges       `json:"course_groups"`
+	Lessons    ImportLessonChanges `json:"lessons"`
+	Issues     []untis.Issue       `json:"issues"`
+}
+
+func newImportChanges() ImportChanges {
+	return ImportChanges{Created: []string{}, Updated: []string{}}
+}
+
+type TimetableImportService struct {
+	db *pgxpool.Pool
+}
+
+func NewTimetableImportService(db *pgxpool.Pool) *TimetableImportService {
+	return &TimetableImportService{db: db}
+}
+
+// gradeLevel reads the leading number of a class name ("10a" → 10).
+func gradeLevel(name string) *int {
+	end := strings.IndexFunc(name, func(r rune) bool { return !unicode.IsDigit(r) })
+	if end < 0 {
+		end = len(name)
+	}
+	n, err := strconv.Atoi(name[:end])
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+var dayAbbreviations = [...]string{"", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// lessonLabel describes a timetable entry in the report, e.g.
+// "10a Mon 1-2 M MUE R101". audience is the class or course group.
+func lessonLabel(audience string, day, period, count int, subject, teacher, room string, weekType models.WeekType) string {
+	label := audience + " "
+	if day >= 1 && day <= 7 {
+		label += dayAbbreviations[day]
+	}
+	label += " " + strconv.Itoa(period)
+	if count > 1 {
+		label += "-" + strconv.Itoa(period+count-1)
+	}
+	label += " " + subject + " " + teacher
+	if room != "" {
+		label += " " + room
+	}
+	if weekType != "" && weekType != models.WeekAll {
+		label += " (" + string(weekType) + ")"
+	}
+	return label
+}
+
+// Import creates or updates the master data and replaces the weekly
+// timetable of the imported classes from opts.ValidFrom: entries that are
+// already there stay untouched, new ones start at ValidFrom, and entries
+// missing from the import end the day before (see endEntries). Entries of
+// course groups that are not in the import are left alone. The whole import
+// is one transaction; with opts.DryRun it is rolled back, so the report is a
+// preview.
+func (s *TimetableImportService) Import(ctx context.Context, schoolID uuid.UUID, in *TimetableImport, opts ImportOptions) (*ImportReport, error) {
+	if opts.SchoolYear == "" {
+		return nil, ErrImportSchoolYear
+	}
+	report := &ImportReport{
+		DryRun: opts.DryRun, SchoolYear: opts.SchoolYear, ValidFrom: opts.ValidFrom.Format(dateLayout),
+		TimeSlots: newImportChanges(), Subjects: newImportChanges(), Rooms: newImportChanges(),
+		Classes: newImportChanges(), Teachers: newImportChanges(), Groups: newImportChanges(),
+		Lessons: ImportLessonChanges{Created: []string{}, Ended: []string{}},
+		Issues:  append([]untis.Issue{}, in.Issues...),
+	}
+	issue := func(file string, line int, format string, args ...interface{}) {
+		report.Issues = append(report.Issues, untis.Issue{File: file, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	slots, err := importTimeSlots(ctx, tx, schoolID, in.TimeSlots, &report.TimeSlots)
+	if err != nil {
+		return nil, err
+	}
+	subjects, err := importSubjects(ctx, tx, schoolID, in.Subjects, &report.Subjects)
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := importRooms(ctx, tx, schoolID, in.Rooms, &report.Rooms)
+	if err != nil {
+		return nil, err
+	}
+	classes, err := importClasses(ctx, tx, schoolID, opts.SchoolYear, in.Classes, &report.Classes)
+	if err != nil {
+		return nil, err
+	}
+	teachers, err := importTeachers(ctx, tx, schoolID, in.Teachers, &report.Teachers, issue)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := importCourseGroups(ctx, tx, schoolID, in.Lessons, classes, &report.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the lessons; entries are keyed by their resolved IDs.
+	type entry struct {
+		lesson  ImportLesson
+		classID uuid.UUID
+		groupID *uuid.UUID
+		key     string
+	}
+	var entries []entry
+	keys := map[string]bool{}
+	classIDs := map[uuid.UUID]bool{}
+	groupIDs := map[uuid.UUID]bool{}
+	for _, l := range in.Lessons {
+		classID, ok := classes[strings.ToLower(l.Class)]
+		if !ok {
+			issue(l.File, l.Line, "unknown class %q", l.Class)
+			continue
+		}
+		teacherID, ok := teachers[strings.ToLower(l.Teacher)]
+		if !ok {
+			issue(l.File, l.Line, "unknown teacher %q", l.Teacher)
+			continue
+		}
+		subjectID, ok := subjects[strings.ToLower(l.Subject)]
+		if !ok {
+			issue(l.File, l.Line, "unknown subject %q", l.Subject)
+			continue
+		}
+		var roomID string
+		if l.Room != "" {
+			id, ok := rooms[strings.ToLower(l.Room)]
+			if !ok {
+				issue(l.File, l.Line, "unknown room %q", l.Room)
+				continue
+			}
+			roomID = id.String()
+		}
+		slotID, ok := slots[l.Period]
+		if _, lastOK := slots[l.Period+l.Count-1]; !ok || !lastOK {
+			issue(l.File, l.Line, "period %d-%d is not in the time grid", l.Period, l.Period+l.Count-1)
+			continue
+		}
+		if l.WeekType == "" {
+			l.WeekType = models.WeekAll
+		}
+		var groupID *uuid.UUID
+		var group string
+		if l.Group != "" {
+			id := groups[strings.ToLower(l.Group)]
+			groupID, group = &id, id.String()
+			groupIDs[id] = true
+		}
+		key := strings.Join([]string{classID.String(), group, subjectID.String(), teacherID.String(), roomID,
+			slotID.String(), strconv.Itoa(l.Count), strconv.Itoa(l.Day), string(l.WeekType)}, "|")
+		classIDs[classID] = true
+		if keys[key] {
+			continue // coupled lessons list the same class twice
+		}
+		keys[key] = true
+		entries = append(entries, entry{lesson: l, classID: classID, groupID: groupID, key: key})
+	}
+
+	// Compare with the current timetable of the imported classes.
+	ids := make([]uuid.UUID, 0, len(classIDs))
+	for id := range classIDs {
+		ids = append(ids, id)
+	}
+	groupList := make([]uuid.UUID, 0, len(groupIDs))
+	for id := range groupIDs {
+		groupList = append(groupList, id)
+	}
+	rows, err := tx.Query(ctx,
+		`SELECT t.id, t.class_id, COALESCE(t.group_id::text, ''), t.subject_id, t.teacher_id,
+		        COALESCE(t.room_id::text, ''), t.time_slot_id, t.slot_count, t.day_of_week, t.week_type,
+		        t.epoch_id IS NOT NULL,
+		        COALESCE(g.name, c.name), s.abbreviation, te.abbreviation, COALESCE(r.name, ''), ts.slot_number
+		 FROM timetable_entries t
+		 JOIN classes c ON c.id = t.class_id
+		 JOIN subjects s ON s.id = t.subject_id
+		 JOIN teachers te ON te.id = t.teacher_id
+		 JOIN time_slots ts ON ts.id = t.time_slot_id
+		 LEFT JOIN rooms r ON r.id = t.room_id
+		 LEFT JOIN course_groups g ON g.id = t.group_id
+		 WHERE t.school_id = $1 AND t.class_id = ANY($2) AND (t.group_id IS NULL OR t.group_id = ANY($4))
+		   AND (t.valid_until IS NULL OR t.valid_until >= $3)
+		 ORDER BY t.day_of_week, ts.slot_number, c.name`,
+		schoolID, ids, opts.ValidFrom, groupList)
+	if err != nil {
+		return nil, fmt.Errorf("list timetable entries: %w", err)
+	}
+	var ended []uuid.UUID
+	for rows.Next() {
+		var id, classID, subjectID, teacherID, slotID uuid.UUID
+		var groupID, roomID, audience, subject, teacher, room string
+		var count, day, slotNumber int
+		var weekType models.WeekType
+		var inEpoch bool
+		if err := rows.Scan(&id, &classID, &groupID, &subjectID, &teacherID, &roomID, &slotID, &count, &day,
+			&weekType, &inEpoch, &audience, &subject, &teacher, &room, &slotNumber); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan timetable entry: %w", err)
+		}
+		key := strings.Join([]string{classID.String(), groupID, subjectID.String(), teacherID.String(), roomID,
+			slotID.String(), strconv.Itoa(count), strconv.Itoa(day), string(weekType)}, "|")
+		if !inEpoch && keys[key] {
+			delete(keys, key)
+			report.Lessons.Unchanged++
+			continue
+		}
+		ended = append(ended, id)
+		report.Lessons.Ended = append(report.Lessons.Ended,
+			lessonLabel(audience, day, slotNumber, count, subject, teacher, room, weekType))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list timetable entries: %w", err)
+	}
+
+	if len(ended) > 0 {
+		if err := endEntries(ctx, tx, ended, opts.ValidFrom); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range entries {
+		if !keys[e.key] {
+			continue // unchanged
+		}
+		l := e.lesson
+		var roomID *uuid.UUID
+		if l.Room != "" {
+			id := rooms[strings.ToLower(l.Room)]
+			roomID = &id
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO timetable_entries (school_id, class_id, group_id, subject_id, teacher_id, room_id, time_slot_id,
+			                                slot_count, day_of_week, week_type, valid_from, valid_until)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			schoolID, e.classID, e.groupID, subjects[strings.ToLower(l.Subject)], teachers[strings.ToLower(l.Teacher)],
+			roomID, slots[l.Period], l.Count, l.Day, l.WeekType, opts.ValidFrom, opts.ValidUntil); err != nil {
+			return nil, fmt.Errorf("create timetable entry: %w", err)
+		}
+		audience := l.Class
+		if l.Group != "" {
+			audience = l.Group
+		}
+		report.Lessons.Created = append(report.Lessons.Created,
+			lessonLabel(audience, l.Day, l.Period, l.Count, l.Subject, l.Teacher, l.Room, l.WeekType))
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return report, nil
+}
+
+func importTimeSlots(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, periods []untis.Period, changes *ImportChanges) (map[int]uuid.UUID, error) {
+	type slot struct {
+		id         uuid.UUID
+		start, end string
+	}
+	existing := map[int]slot{}
+	rows, err := tx.Query(ctx,
+		`SELECT id, slot_number, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+		 FROM time_slots WHERE school_id = $1`, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list time slots: %w", err)
+	}
+	for rows.Next() {
+		var n int
+		var ts slot
+		if err := rows.Scan(&ts.id, &n, &ts.start, &ts.end); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan time slot: %w", err)
+		}
+		existing[n] = ts
+	}
+	rows.Close()
+
+	ids := map[int]uuid.UUID{}
+	for n, ts := range existing {
+		ids[n] = ts.id
+	}
+	for _, p := range periods {
+		label := fmt.Sprintf("%d (%s-%s)", p.Number, p.Start, p.End)
+		var lbl *string
+		if p.Label != "" {
+			lbl = &p.Label
+		}
+		ts, ok := existing[p.Number]
+		switch {
+		case !ok:
+			var id uuid.UUID
+			if err := tx.QueryRow(ctx,
+				`INSERT INTO time_slots (school_id, slot_number, start_time, end_time, label)
+				 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+				schoolID, p.Number, p.Start, p.End, lbl).Scan(&id); err != nil {
+				return nil, fmt.Errorf("create time slot: %w", err)
+			}
+			ids[p.Number] = id
+			existing[p.Number] = slot{id: id, start: p.Start, end: p.End}
+			changes.Created = append(changes.Created, label)
+		case ts.start != p.Start || ts.end != p.End:
+			if _, err := tx.Exec(ctx,
+				`UPDATE time_slots SET start_time = $2, end_time = $3, label = COALESCE($4, label) WHERE id = $1`,
+				ts.id, p.Start, p.End, lbl); err != nil {
+				return nil, fmt.Errorf("update time slot: %w", err)
+			}
+			changes.Updated = append(changes.Updated, label)
+		default:
+			changes.Unchanged++
+		}
+	}
+	return ids, nil
+}
+
+func importSubjects(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, subjects []untis.Subject, changes *ImportChanges) (map[string]uuid.UUID, error) {
+	type subject struct {
+		id   uuid.UUID
+		name string
+	}
+	existing := map[string]subject{}
+	rows, err := tx.Query(ctx, `SELECT id, abbreviation, name FROM subjects WHERE school_id = $1`, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list subjects: %w", err)
+	}
+	for rows.Next() {
+		var abbr string
+		var s subject
+		if err := rows.Scan(&s.id, &abbr, &s.name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan subject: %w", err)
+		}
+		existing[strings.ToLower(abbr)] = s
+	}
+	rows.Close()
+
+	for _, in := range subjects {
+		key := strings.ToLower(in.Abbreviation)
+		s, ok := existing[key]
+		switch {
+		case !ok:
+			if err := tx.QueryRow(ctx,
+				`INSERT INTO subjects (school_id, name, abbreviation) VALUES ($1, $2, $3) RETURNING id`,
+				schoolID, in.Name, in.Abbreviation).Scan(&s.id); err != nil {
+				return nil, fmt.Errorf("create subject: %w", err)
+			}
+			s.name = in.Name
+			existing[key] = s
+			changes.Created = append(changes.Created, in.Abbreviation)
+		case s.name != in.Name:
+			if _, err := tx.Exec(ctx, `UPDATE subjects SET name = $2 WHERE id = $1`, s.id, in.Name); err != nil {
+				return nil, fmt.Errorf("update subject: %w", err)
+			}
+			s.name = in.Name
+			existing[key] = s
+			changes.Updated = append(changes.Updated, in.Abbreviation)
+		default:
+			changes.Unchanged++
+		}
+	}
+
+	ids := map[string]uuid.UUID{}
+	for key, s := range existing {
+		ids[key] = s.id
+	}
+	return ids, nil
+}
+
+func importRooms(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, rooms []untis.Room, changes *ImportChanges) (map[string]uuid.UUID, error) {
+	ids := map[string]uuid.UUID{}
+	rows, err := tx.Query(ctx, `SELECT id, name FROM rooms WHERE school_id = $1`, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list rooms: %w", err)
+	}
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan room: %w", err)
+		}
+		ids[strings.ToLower(name)] = id
+	}
+	rows.Close()
+
+	for _, in := range rooms {
+		key := strings.ToLower(in.Name)
+		if _, ok := ids[key]; ok {
+			changes.Unchanged++
+			continue
+		}
+		var id uuid.UUID
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO rooms (school_id, name) VALUES ($1, $2) RETURNING id`,
+			schoolID, in.Name).Scan(&id); err != nil {
+			return nil, fmt.Errorf("create room: %w", err)
+		}
+		ids[key] = id
+		changes.Created = append(changes.Created, in.Name)
+	}
+	return ids, nil
+}
+
+func importClasses(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, schoolYear string, classes []untis.Class, changes *ImportChanges) (map[string]uuid.UUID, error) {
+	ids := map[string]uuid.UUID{}
+	rows, err := tx.Query(ctx,
+		`SELECT id, name FROM classes WHERE school_id = $1 AND school_year = $2`, schoolID, schoolYear)
+	if err != nil {
+		return nil, fmt.Errorf("list classes: %w", err)
+	}
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan class: %w", err)
+		}
+		ids[strings.ToLower(name)] = id
+	}
+	rows.Close()
+
+	for _, in := range classes {
+		key := strings.ToLower(in.Name)
+		if _, ok := ids[key]; ok {
+			changes.Unchanged++
+			continue
+		}
+		var id uuid.UUID
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO classes (school_id, name, grade_level, school_year) VALUES ($1, $2, $3, $4) RETURNING id`,
+			schoolID, in.Name, gradeLevel(in.Name), schoolYear).Scan(&id); err != nil {
+			return nil, fmt.Errorf("create class: %w", err)
+		}
+		ids[key] = id
+		changes.Created = append(changes.Created, in.Name)
+	}
+	return ids, nil
+}
+
+// importTeachers creates a locked teacher account (username = lower-cased
+// abbreviation) for every new abbreviation and updates the names of
+// existing ones.
+func importTeachers(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, teachers []untis.Teacher, changes *ImportChanges,
+	issue func(file string, line int, format string, args ...interface{})) (map[string]uuid.UUID, error) {
+	type teacher struct {
+		id, userID          uuid.UUID
+		firstName, lastName string
+	}
+	existing := map[string]teacher{}
+	rows, err := tx.Query(ctx,
+		`SELECT t.id, t.user_id, t.abbreviation, u.first_name, u.last_name
+		 FROM teachers t JOIN users u ON u.id = t.user_id WHERE t.school_id = $1`, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list teachers: %w", err)
+	}
+	for rows.Next() {
+		var abbr string
+		var t teacher
+		if err := rows.Scan(&t.id, &t.userID, &abbr, &t.firstName, &t.lastName); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan teacher: %w", err)
+		}
+		existing[strings.ToLower(abbr)] = t
+	}
+	rows.Close()
+
+	for _, in := range teachers {
+		key := strings.ToLower(in.Abbreviation)
+		t, ok := existing[key]
+		if ok {
+			// An empty first name in the export does not clear a known one.
+			firstName := in.FirstName
+			if firstName == "" {
+				firstName = t.firstName
+			}
+			if t.lastName == in.LastName && t.firstName == firstName {
+				changes.Unchanged++
+				continue
+			}
+			if _, err := tx.Exec(ctx,
+				`UPDATE users SET first_name = $2, last_name = $3, updated_at = now() WHERE id = $1`,
+				t.userID, firstName, in.LastName); err != nil {
+				return nil, fmt.Errorf("update teacher: %w", err)
+			}
+			t.firstName, t.lastName = firstName, in.LastName
+			existing[key] = t
+			changes.Updated = append(changes.Updated, in.Abbreviation)
+			continue
+		}
+
+		var taken bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS(SELECT 1 FROM users WHERE school_id = $1 AND username = $2)`,
+			schoolID, key).Scan(&taken); err != nil {
+			return nil, fmt.Errorf("check username: %w", err)
+		}
+		if taken {
+			issue(untis.FileTeachers, in.Line, "username %q is already taken", key)
+			continue
+		}
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO users (school_id, username, password_hash, role, first_name, last_name)
+			 VALUES ($1, $2, $3, 'teacher', $4, $5) RETURNING id`,
+			schoolID, key, lockedPassword, in.FirstName, in.LastName).Scan(&t.userID); err != nil {
+			return nil, fmt.Errorf("create teacher user: %w", err)
+		}
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO teachers (user_id, school_id, abbreviation) VALUES ($1, $2, $3) RETURNING id`,
+			t.userID, schoolID, in.Abbreviation).Scan(&t.id); err != nil {
+			return nil, fmt.Errorf("create teacher: %w", err)
+		}
+		t.firstName, t.lastName = in.FirstName, in.LastName
+		existing[key] = t
+		changes.Created = append(changes.Created, in.Abbreviation)
+	}
+
+	ids := map[string]uuid.UUID{}
+	for key, t := range existing {
+		ids[key] = t.id
+	}
+	return ids, nil
+}
+
+// importCourseGroups finds or creates the course groups the lessons refer
+// to. New groups have no members yet.
+func importCourseGroups(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, lessons []ImportLesson, classes map[string]uuid.UUID,
+	changes *ImportChanges) (map[string]uuid.UUID, error) {
+	ids := map[string]uuid.UUID{}
+	rows, err := tx.Query(ctx, `SELECT id, name FROM course_groups WHERE school_id = $1`, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list course groups: %w", err)
+	}
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan course group: %w", err)
+		}
+		ids[strings.ToLower(name)] = id
+	}
+	rows.Close()
+
+	seen := map[string]bool{}
+	for _, l := range lessons {
+		key := strings.ToLower(l.Group)
+		classID, ok := classes[strings.ToLower(l.Class)]
+		if l.Group == "" || !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, ok := ids[key]; ok {
+			changes.Unchanged++
+			continue
+		}
+		var id uuid.UUID
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO course_groups (school_id, name, class_id) VALUES ($1, $2, $3) RETURNING id`,
+			schoolID, l.Group, classID).Scan(&id); err != nil {
+			return nil, fmt.Errorf("create course group: %w", err)
+		}
+		ids[key] = id
+		changes.Created = append(changes.Created, l.Group)
+	}
+	return ids, nil
+}
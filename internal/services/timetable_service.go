@@ -2,9 +2,12 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/Monstroxx/eduko-backend/internal/models"
@@ -18,17 +21,94 @@ func NewTimetableService(db *pgxpool.Pool) *TimetableService {
 	return &TimetableService{db: db}
 }
 
+// enrichedTimetableQuery selects timetable entries (alias t) with their display
+// data; scan rows with scanEnrichedEntry.
+var enrichedTimetableQuery = enrichedQuery("timetable_entries")
+
+// enrichedQuery is enrichedTimetableQuery over table, which has the columns
+// of timetable_entries (as timetable_draft_entries has). columns are selected
+// before the entry's own.
+func enrichedQuery(table string, columns ...string) string {
+	var extra string
+	for _, col := range columns {
+		extra += col + ", "
+	}
+	return `
+		SELECT ` + extra + `
+			t.id, t.school_id, t.class_id, t.group_id, t.subject_id, t.teacher_id, t.room_id,
+			t.time_slot_id, t.slot_count, t.epoch_id, t.day_of_week, t.week_type, t.valid_from, t.valid_until,
+			t.created_at, t.updated_at,
+			sub.name                              AS subject_name,
+			sub.abbreviation                      AS subject_abbreviation,
+			sub.color                             AS subject_color,
+			u.first_name || ' ' || u.last_name    AS teacher_name,
+			tch.abbreviation                      AS teacher_abbreviation,
+			r.name                                AS room_name,
+			c.name                                AS class_name,
+			g.name                                AS group_name,
+			ts.label                              AS time_slot_label,
+			ts.start_time::text                   AS time_slot_start,
+			COALESCE(tse.end_time, ts.end_time)::text AS time_slot_end,
+			ep.name                               AS epoch_name,
+			ep.start_date                         AS epoch_start,
+			ep.end_date                           AS epoch_end
+		FROM ` + table + ` t
+		LEFT JOIN subjects   sub ON sub.id   = t.subject_id
+		LEFT JOIN teachers   tch ON tch.id   = t.teacher_id
+		LEFT JOIN users      u   ON u.id     = tch.user_id
+		LEFT JOIN rooms      r   ON r.id     = t.room_id
+		LEFT JOIN classes    c   ON c.id     = t.class_id
+		LEFT JOIN course_groups g ON g.id    = t.group_id
+		LEFT JOIN time_slots ts  ON ts.id    = t.time_slot_id
+		LEFT JOIN time_slots tse ON tse.school_id = t.school_id AND tse.slot_number = ts.slot_number + t.slot_count - 1
+		LEFT JOIN epochs     ep  ON ep.id    = t.epoch_id
+		WHERE t.school_id = $1`
+}
+
+func scanEnrichedEntry(row pgx.Row) (*models.TimetableEntryEnriched, error) {
+	var e models.TimetableEntryEnriched
+	if err := row.Scan(enrichedEntryFields(&e)...); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// enrichedEntryFields returns the scan destinations of enrichedQuery's
+// columns.
+func enrichedEntryFields(e *models.TimetableEntryEnriched) []interface{} {
+	return []interface{}{
+		&e.ID, &e.SchoolID, &e.ClassID, &e.GroupID, &e.SubjectID, &e.TeacherID, &e.RoomID,
+		&e.TimeSlotID, &e.SlotCount, &e.EpochID, &e.DayOfWeek, &e.WeekType, &e.ValidFrom, &e.ValidUntil,
+		&e.CreatedAt, &e.UpdatedAt,
+		&e.SubjectName, &e.SubjectAbbreviation, &e.SubjectColor,
+		&e.TeacherName, &e.TeacherAbbreviation,
+		&e.RoomName, &e.ClassName, &e.GroupName,
+		&e.TimeSlotLabel, &e.TimeSlotStart, &e.TimeSlotEnd,
+		&e.EpochName, &e.EpochStart, &e.EpochEnd,
+	}
+}
+
+const timetableEntryColumns = `id, school_id, class_id, group_id, subject_id, teacher_id, room_id,
+	time_slot_id, slot_count, epoch_id, day_of_week, week_type, valid_from, valid_until, created_at, updated_at`
+
+func scanTimetableEntry(row pgx.Row) (*models.TimetableEntry, error) {
+	var e models.TimetableEntry
+	if err := row.Scan(&e.ID, &e.SchoolID, &e.ClassID, &e.GroupID, &e.SubjectID, &e.TeacherID,
+		&e.RoomID, &e.TimeSlotID, &e.SlotCount, &e.EpochID, &e.DayOfWeek, &e.WeekType,
+		&e.ValidFrom, &e.ValidUntil, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
 // Get returns raw timetable entries (IDs only). Prefer GetEnriched for API responses.
 func (s *TimetableService) Get(ctx context.Context, schoolID uuid.UUID, classID, teacherID, date string) ([]models.TimetableEntry, error) {
-	query := `SELECT t.id, t.school_id, t.class_id, t.subject_id, t.teacher_id, t.room_id,
-	                 t.time_slot_id, t.day_of_week, t.week_type, t.valid_from, t.valid_until,
-	                 t.created_at, t.updated_at
-	          FROM timetable_entries t WHERE t.school_id = $1`
+	query := `SELECT ` + timetableEntryColumns + ` FROM timetable_entries t WHERE t.school_id = $1`
 	args := []interface{}{schoolID}
 	n := 2
 
 	if classID != "" {
-		query += fmt.Sprintf(` AND t.class_id = $%d`, n)
+		query += ` AND ` + entryForClass("t", fmt.Sprintf("$%d::uuid", n))
 		args = append(args, classID)
 		n++
 	}
@@ -49,59 +129,53 @@ func (s *TimetableService) Get(ctx context.Context, schoolID uuid.UUID, classID,
 
 	entries := make([]models.TimetableEntry, 0)
 	for rows.Next() {
-		var e models.TimetableEntry
-		if err := rows.Scan(&e.ID, &e.SchoolID, &e.ClassID, &e.SubjectID, &e.TeacherID,
-			&e.RoomID, &e.TimeSlotID, &e.DayOfWeek, &e.WeekType,
-			&e.ValidFrom, &e.ValidUntil, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		e, err := scanTimetableEntry(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan timetable: %w", err)
 		}
-		entries = append(entries, e)
+		entries = append(entries, *e)
 	}
 	return entries, nil
 }
 
-// GetEnriched returns timetable entries joined with subjects, teachers, rooms,
-// time_slots, and classes so the Flutter client has all display data in one request.
-func (s *TimetableService) GetEnriched(ctx context.Context, schoolID uuid.UUID, classID, teacherID, date string) ([]models.TimetableEntryEnriched, error) {
-	query := `
-		SELECT
-			t.id, t.school_id, t.class_id, t.subject_id, t.teacher_id, t.room_id,
-			t.time_slot_id, t.day_of_week, t.week_type, t.valid_from, t.valid_until,
-			t.created_at, t.updated_at,
-			sub.name                              AS subject_name,
-			sub.abbreviation                      AS subject_abbreviation,
-			sub.color                             AS subject_color,
-			u.first_name || ' ' || u.last_name    AS teacher_name,
-			tch.abbreviation                      AS teacher_abbreviation,
-			r.name                                AS room_name,
-			c.name                                AS class_name,
-			ts.label                              AS time_slot_label,
-			ts.start_time::text                   AS time_slot_start,
-			ts.end_time::text                     AS time_slot_end
-		FROM timetable_entries t
-		LEFT JOIN subjects   sub ON sub.id   = t.subject_id
-		LEFT JOIN teachers   tch ON tch.id   = t.teacher_id
-		LEFT JOIN users      u   ON u.id     = tch.user_id
-		LEFT JOIN rooms      r   ON r.id     = t.room_id
-		LEFT JOIN classes    c   ON c.id     = t.class_id
-		LEFT JOIN time_slots ts  ON ts.id    = t.time_slot_id
-		WHERE t.school_id = $1`
+// GetEnriched returns the weekly plan valid on date (default: today). weekType
+// A or B restricts it to that week's lessons plus those held every week.
+func (s *TimetableService) GetEnriched(ctx context.Context, schoolID uuid.UUID, f TimetableFilter, date, weekType string) ([]models.TimetableEntryEnriched, error) {
+	query := enrichedTimetableQuery
 
 	args := []interface{}{schoolID}
 	n := 2
 
-	if classID != "" {
-		query += fmt.Sprintf(` AND t.class_id = $%d`, n)
-		args = append(args, classID)
+	if f.ClassID != nil {
+		query += ` AND ` + entryForClass("t", fmt.Sprintf("$%d::uuid", n))
+		args = append(args, *f.ClassID)
 		n++
 	}
-	if teacherID != "" {
+	if f.StudentID != nil {
+		query += ` AND ` + entryForStudent("t", fmt.Sprintf("$%d::uuid", n))
+		args = append(args, *f.StudentID)
+		n++
+	}
+	if f.TeacherID != nil {
 		query += fmt.Sprintf(` AND t.teacher_id = $%d`, n)
-		args = append(args, teacherID)
+		args = append(args, *f.TeacherID)
 		n++
 	}
 
-	query += ` AND (t.valid_until IS NULL OR t.valid_until >= CURRENT_DATE)`
+	if date != "" {
+		query += fmt.Sprintf(` AND t.valid_from <= $%d::date AND (t.valid_until IS NULL OR t.valid_until >= $%d::date)`, n, n)
+		query += fmt.Sprintf(` AND (ep.id IS NULL OR $%d::date BETWEEN ep.start_date AND ep.end_date)`, n)
+		args = append(args, date)
+		n++
+	} else {
+		query += ` AND t.valid_from <= CURRENT_DATE AND (t.valid_until IS NULL OR t.valid_until >= CURRENT_DATE)`
+		query += ` AND (ep.id IS NULL OR CURRENT_DATE BETWEEN ep.start_date AND ep.end_date)`
+	}
+	if weekType != "" {
+		query += fmt.Sprintf(` AND t.week_type IN ('all', $%d)`, n)
+		args = append(args, weekType)
+		n++
+	}
 	query += ` ORDER BY t.day_of_week, ts.slot_number`
 
 	rows, err := s.db.Query(ctx, query, args...)
@@ -112,68 +186,170 @@ func (s *TimetableService) GetEnriched(ctx context.Context, schoolID uuid.UUID,
 
 	entries := make([]models.TimetableEntryEnriched, 0)
 	for rows.Next() {
-		var e models.TimetableEntryEnriched
-		if err := rows.Scan(
-			&e.ID, &e.SchoolID, &e.ClassID, &e.SubjectID, &e.TeacherID, &e.RoomID,
-			&e.TimeSlotID, &e.DayOfWeek, &e.WeekType, &e.ValidFrom, &e.ValidUntil,
-			&e.CreatedAt, &e.UpdatedAt,
-			&e.SubjectName, &e.SubjectAbbreviation, &e.SubjectColor,
-			&e.TeacherName, &e.TeacherAbbreviation,
-			&e.RoomName, &e.ClassName,
-			&e.TimeSlotLabel, &e.TimeSlotStart, &e.TimeSlotEnd,
-		); err != nil {
+		e, err := scanEnrichedEntry(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan enriched timetable: %w", err)
 		}
-		entries = append(entries, e)
+		entries = append(entries, *e)
 	}
 	return entries, nil
 }
 
+var (
+	ErrTimetableNoAudience = errors.New("class_id or group_id required")
+	ErrTimetableBlock      = errors.New("time slot not found or block runs past the last slot")
+	ErrTimetableRange      = errors.New("valid_until must not be before valid_from")
+)
+
 type CreateTimetableInput struct {
-	ClassID    uuid.UUID        `json:"class_id"`
+	// ClassID, GroupID or both: with a group only its members attend.
+	ClassID    *uuid.UUID       `json:"class_id,omitempty"`
+	GroupID    *uuid.UUID       `json:"group_id,omitempty"`
 	SubjectID  uuid.UUID        `json:"subject_id"`
 	TeacherID  uuid.UUID        `json:"teacher_id"`
 	RoomID     *uuid.UUID       `json:"room_id,omitempty"`
 	TimeSlotID uuid.UUID        `json:"time_slot_id"`
+	// SlotCount makes the entry a block over consecutive slots (default 1).
+	SlotCount  int              `json:"slot_count,omitempty"`
+	EpochID    *uuid.UUID       `json:"epoch_id,omitempty"`
 	DayOfWeek  int              `json:"day_of_week"`
 	WeekType   models.WeekType  `json:"week_type"`
 	ValidFrom  string           `json:"valid_from"`
 	ValidUntil *string          `json:"valid_until,omitempty"`
+	// Force stores the entry despite conflicts, e.g. for team teaching.
+	Force bool `json:"force,omitempty"`
 }
 
+// Create stores a new entry. Unless input.Force is set it fails with a
+// *ConflictError when the teacher, room or class is already booked.
 func (s *TimetableService) Create(ctx context.Context, schoolID uuid.UUID, input CreateTimetableInput) (*models.TimetableEntry, error) {
-	var e models.TimetableEntry
-	err := s.db.QueryRow(ctx,
-		`INSERT INTO timetable_entries (school_id, class_id, subject_id, teacher_id, room_id, time_slot_id, day_of_week, week_type, valid_from, valid_until)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		 RETURNING id, school_id, class_id, subject_id, teacher_id, room_id, time_slot_id, day_of_week, week_type, valid_from, valid_until, created_at, updated_at`,
-		schoolID, input.ClassID, input.SubjectID, input.TeacherID, input.RoomID,
+	if input.ClassID == nil && input.GroupID == nil {
+		return nil, ErrTimetableNoAudience
+	}
+	if input.WeekType == "" {
+		input.WeekType = models.WeekAll
+	}
+	if input.SlotCount < 1 {
+		input.SlotCount = 1
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkEntryReferences(ctx, tx, schoolID, input); err != nil {
+		return nil, err
+	}
+
+	if !input.Force {
+		conflicts, err := s.checkConflicts(ctx, tx, schoolID, nil, input)
+		if err != nil {
+			return nil, err
+		}
+		if len(conflicts) > 0 {
+			return nil, &ConflictError{Conflicts: conflicts}
+		}
+	}
+
+	e, err := scanTimetableEntry(tx.QueryRow(ctx,
+		`INSERT INTO timetable_entries (school_id, class_id, group_id, subject_id, teacher_id, room_id, time_slot_id,
+		                                day_of_week, week_type, valid_from, valid_until, slot_count, epoch_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		 RETURNING `+timetableEntryColumns,
+		schoolID, input.ClassID, input.GroupID, input.SubjectID, input.TeacherID, input.RoomID,
 		input.TimeSlotID, input.DayOfWeek, input.WeekType, input.ValidFrom, input.ValidUntil,
-	).Scan(&e.ID, &e.SchoolID, &e.ClassID, &e.SubjectID, &e.TeacherID,
-		&e.RoomID, &e.TimeSlotID, &e.DayOfWeek, &e.WeekType,
-		&e.ValidFrom, &e.ValidUntil, &e.CreatedAt, &e.UpdatedAt)
+		input.SlotCount, input.EpochID,
+	))
 	if err != nil {
 		return nil, fmt.Errorf("create timetable entry: %w", err)
 	}
-	return &e, nil
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return e, nil
 }
 
+// Update replaces an entry, with the same conflict check as Create.
 func (s *TimetableService) Update(ctx context.Context, schoolID, entryID uuid.UUID, input CreateTimetableInput) (*models.TimetableEntry, error) {
-	var e models.TimetableEntry
-	err := s.db.QueryRow(ctx,
-		`UPDATE timetable_entries SET class_id=$3, subject_id=$4, teacher_id=$5, room_id=$6,
-		        time_slot_id=$7, day_of_week=$8, week_type=$9, valid_from=$10, valid_until=$11, updated_at=now()
+	if input.ClassID == nil && input.GroupID == nil {
+		return nil, ErrTimetableNoAudience
+	}
+	if input.WeekType == "" {
+		input.WeekType = models.WeekAll
+	}
+	if input.SlotCount < 1 {
+		input.SlotCount = 1
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkEntryReferences(ctx, tx, schoolID, input); err != nil {
+		return nil, err
+	}
+
+	if !input.Force {
+		conflicts, err := s.checkConflicts(ctx, tx, schoolID, &entryID, input)
+		if err != nil {
+			return nil, err
+		}
+		if len(conflicts) > 0 {
+			return nil, &ConflictError{Conflicts: conflicts}
+		}
+	}
+
+	e, err := scanTimetableEntry(tx.QueryRow(ctx,
+		`UPDATE timetable_entries SET class_id=$3, group_id=$12, subject_id=$4, teacher_id=$5, room_id=$6,
+		        time_slot_id=$7, day_of_week=$8, week_type=$9, valid_from=$10, valid_until=$11,
+		        slot_count=$13, epoch_id=$14, updated_at=now()
 		 WHERE id = $1 AND school_id = $2
-		 RETURNING id, school_id, class_id, subject_id, teacher_id, room_id, time_slot_id, day_of_week, week_type, valid_from, valid_until, created_at, updated_at`,
+		 RETURNING `+timetableEntryColumns,
 		entryID, schoolID, input.ClassID, input.SubjectID, input.TeacherID, input.RoomID,
-		input.TimeSlotID, input.DayOfWeek, input.WeekType, input.ValidFrom, input.ValidUntil,
-	).Scan(&e.ID, &e.SchoolID, &e.ClassID, &e.SubjectID, &e.TeacherID,
-		&e.RoomID, &e.TimeSlotID, &e.DayOfWeek, &e.WeekType,
-		&e.ValidFrom, &e.ValidUntil, &e.CreatedAt, &e.UpdatedAt)
+		input.TimeSlotID, input.DayOfWeek, input.WeekType, input.ValidFrom, input.ValidUntil, input.GroupID,
+		input.SlotCount, input.EpochID,
+	))
 	if err != nil {
 		return nil, fmt.Errorf("update timetable entry: %w", err)
 	}
-	return &e, nil
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return e, nil
+}
+
+// checkEntryReferences verifies that a block's slots exist and the epoch
+// belongs to the school.
+func checkEntryReferences(ctx context.Context, tx pgx.Tx, schoolID uuid.UUID, input CreateTimetableInput) error {
+	if input.ValidUntil != nil && *input.ValidUntil < input.ValidFrom {
+		return ErrTimetableRange
+	}
+	var slots int
+	if err := tx.QueryRow(ctx,
+		`SELECT COUNT(*) FROM time_slots s
+		 JOIN time_slots e ON e.school_id = s.school_id
+		      AND e.slot_number BETWEEN s.slot_number AND s.slot_number + $2 - 1
+		 WHERE s.id = $1 AND s.school_id = $3`,
+		input.TimeSlotID, input.SlotCount, schoolID).Scan(&slots); err != nil {
+		return fmt.Errorf("check time slots: %w", err)
+	}
+	if slots != input.SlotCount {
+		return ErrTimetableBlock
+	}
+	if input.EpochID != nil {
+		var exists bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS(SELECT 1 FROM epochs WHERE id = $1 AND school_id = $2)`,
+			*input.EpochID, schoolID).Scan(&exists); err != nil {
+			return fmt.Errorf("check epoch: %w", err)
+		}
+		if !exists {
+			return ErrEpochNotFound
+		}
+	}
+	return nil
 }
 
 func (s *TimetableService) Delete(ctx context.Context, schoolID, entryID uuid.UUID) error {
@@ -184,3 +360,33 @@ func (s *TimetableService) Delete(ctx context.Context, schoolID, entryID uuid.UU
 	}
 	return nil
 }
+
+// endEntries ends the entries ids on the day before from, so they no longer
+// take place from then on. Entries that would only start on or after from
+// are deleted with their substitutions instead; those with attendance or
+// lesson content already recorded are kept up to their first day.
+func endEntries(ctx context.Context, tx pgx.Tx, ids []uuid.UUID, from time.Time) error {
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM substitutions s USING timetable_entries t
+		 WHERE s.timetable_entry_id = t.id AND t.id = ANY($1) AND t.valid_from >= $2
+		   AND NOT EXISTS (SELECT 1 FROM attendance a WHERE a.timetable_entry_id = t.id)
+		   AND NOT EXISTS (SELECT 1 FROM lesson_content l WHERE l.timetable_entry_id = t.id)`,
+		ids, from); err != nil {
+		return fmt.Errorf("delete substitutions: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM timetable_entries t
+		 WHERE t.id = ANY($1) AND t.valid_from >= $2
+		   AND NOT EXISTS (SELECT 1 FROM attendance a WHERE a.timetable_entry_id = t.id)
+		   AND NOT EXISTS (SELECT 1 FROM lesson_content l WHERE l.timetable_entry_id = t.id)`,
+		ids, from); err != nil {
+		return fmt.Errorf("delete timetable entries: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE timetable_entries SET valid_until = GREATEST($2::date - 1, valid_from), updated_at = now()
+		 WHERE id = ANY($1)`,
+		ids, from); err != nil {
+		return fmt.Errorf("end timetable entries: %w", err)
+	}
+	return nil
+}
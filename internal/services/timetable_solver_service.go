@@ -0,0 +1,578 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+	"github.com/Monstroxx/eduko-backend/internal/solver"
+)
+
+var (
+	ErrAssignmentInvalid     = errors.New("invalid teaching assignment")
+	ErrUnavailabilityInvalid = errors.New("invalid teacher unavailability")
+	ErrSolverRunNotFound     = errors.New("solver run not found")
+	ErrSolverRunInvalid      = errors.New("name and effective_from required")
+	ErrSolverNoAssignments   = errors.New("no teaching assignments")
+)
+
+// TimetableSolverService manages the solver's inputs (teaching assignments,
+// teacher unavailability) and its runs. Runs are queued by the API and
+// executed by the timetable_solver job.
+type TimetableSolverService struct {
+	db *pgxpool.Pool
+}
+
+func NewTimetableSolverService(db *pgxpool.Pool) *TimetableSolverService {
+	return &TimetableSolverService{db: db}
+}
+
+const teachingAssignmentColumns = `id, school_id, class_id, subject_id, teacher_id, periods_per_week, double_periods,
+	room_ids, created_at`
+
+func scanTeachingAssignment(row pgx.Row) (*models.TeachingAssignment, error) {
+	var a models.TeachingAssignment
+	if err := row.Scan(&a.ID, &a.SchoolID, &a.ClassID, &a.SubjectID, &a.TeacherID, &a.PeriodsPerWeek,
+		&a.DoublePeriods, &a.RoomIDs, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *TimetableSolverService) ListAssignments(ctx context.Context, schoolID uuid.UUID) ([]models.TeachingAssignment, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+teachingAssignmentColumns+` FROM teaching_assignments WHERE school_id = $1 ORDER BY created_at, id`,
+		schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list teaching assignments: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.TeachingAssignment, 0)
+	for rows.Next() {
+		a, err := scanTeachingAssignment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan teaching assignment: %w", err)
+		}
+		list = append(list, *a)
+	}
+	return list, rows.Err()
+}
+
+type TeachingAssignmentInput struct {
+	ClassID        uuid.UUID   `json:"class_id"`
+	SubjectID      uuid.UUID   `json:"subject_id"`
+	TeacherID      uuid.UUID   `json:"teacher_id"`
+	PeriodsPerWeek int         `json:"periods_per_week"`
+	DoublePeriods  int         `json:"double_periods"`
+	RoomIDs        []uuid.UUID `json:"room_ids"`
+}
+
+// ReplaceAssignments replaces all teaching assignments of the school.
+func (s *TimetableSolverService) ReplaceAssignments(ctx context.Context, schoolID uuid.UUID, input []TeachingAssignmentInput) ([]models.TeachingAssignment, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM teaching_assignments WHERE school_id = $1`, schoolID); err != nil {
+		return nil, fmt.Errorf("delete teaching assignments: %w", err)
+	}
+	seen := map[string]bool{}
+	list := make([]models.TeachingAssignment, 0, len(input))
+	for i, in := range input {
+		if in.RoomIDs == nil {
+			in.RoomIDs = []uuid.UUID{}
+		}
+		key := in.ClassID.String() + in.SubjectID.String() + in.TeacherID.String()
+		if in.PeriodsPerWeek < 1 || in.DoublePeriods < 0 || in.DoublePeriods*2 > in.PeriodsPerWeek || seen[key] {
+			return nil, fmt.Errorf("%w: entry %d", ErrAssignmentInvalid, i+1)
+		}
+		seen[key] = true
+		var valid bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS(SELECT 1 FROM classes WHERE id = $2 AND school_id = $1)
+			    AND EXISTS(SELECT 1 FROM subjects WHERE id = $3 AND school_id = $1)
+			    AND EXISTS(SELECT 1 FROM teachers WHERE id = $4 AND school_id = $1)
+			    AND (SELECT COUNT(*) FROM rooms WHERE id = ANY($5) AND school_id = $1) = cardinality($5::uuid[])`,
+			schoolID, in.ClassID, in.SubjectID, in.TeacherID, in.RoomIDs).Scan(&valid); err != nil {
+			return nil, fmt.Errorf("check teaching assignment: %w", err)
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: entry %d references an unknown class, subject, teacher or room", ErrAssignmentInvalid, i+1)
+		}
+		a, err := scanTeachingAssignment(tx.QueryRow(ctx,
+			`INSERT INTO teaching_assignments (school_id, class_id, subject_id, teacher_id, periods_per_week,
+			                                   double_periods, room_ids)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)
+			 RETURNING `+teachingAssignmentColumns,
+			schoolID, in.ClassID, in.SubjectID, in.TeacherID, in.PeriodsPerWeek, in.DoublePeriods, in.RoomIDs))
+		if err != nil {
+			return nil, fmt.Errorf("create teaching assignment: %w", err)
+		}
+		list = append(list, *a)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return list, nil
+}
+
+const unavailabilityColumns = `id, school_id, teacher_id, day_of_week, time_slot_id, note, created_at`
+
+func scanUnavailability(row pgx.Row) (*models.TeacherUnavailability, error) {
+	var u models.TeacherUnavailability
+	if err := row.Scan(&u.ID, &u.SchoolID, &u.TeacherID, &u.DayOfWeek, &u.TimeSlotID, &u.Note, &u.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *TimetableSolverService) ListUnavailability(ctx context.Context, schoolID uuid.UUID) ([]models.TeacherUnavailability, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+unavailabilityColumns+` FROM teacher_unavailability WHERE school_id = $1
+		 ORDER BY teacher_id, day_of_week, created_at`, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list teacher unavailability: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.TeacherUnavailability, 0)
+	for rows.Next() {
+		u, err := scanUnavailability(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan teacher unavailability: %w", err)
+		}
+		list = append(list, *u)
+	}
+	return list, rows.Err()
+}
+
+type UnavailabilityInput struct {
+	TeacherID  uuid.UUID  `json:"teacher_id"`
+	DayOfWeek  int        `json:"day_of_week"`
+	TimeSlotID *uuid.UUID `json:"time_slot_id,omitempty"`
+	Note       *string    `json:"note,omitempty"`
+}
+
+// ReplaceUnavailability replaces the school's teacher unavailability.
+func (s *TimetableSolverService) ReplaceUnavailability(ctx context.Context, schoolID uuid.UUID, input []UnavailabilityInput) ([]models.TeacherUnavailability, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM teacher_unavailability WHERE school_id = $1`, schoolID); err != nil {
+		return nil, fmt.Errorf("delete teacher unavailability: %w", err)
+	}
+	list := make([]models.TeacherUnavailability, 0, len(input))
+	for i, in := range input {
+		if in.DayOfWeek < 1 || in.DayOfWeek > 7 {
+			return nil, fmt.Errorf("%w: entry %d: day_of_week must be 1-7", ErrUnavailabilityInvalid, i+1)
+		}
+		var valid bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS(SELECT 1 FROM teachers WHERE id = $2 AND school_id = $1)
+			    AND ($3::uuid IS NULL OR EXISTS(SELECT 1 FROM time_slots WHERE id = $3 AND school_id = $1))`,
+			schoolID, in.TeacherID, in.TimeSlotID).Scan(&valid); err != nil {
+			return nil, fmt.Errorf("check teacher unavailability: %w", err)
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: entry %d references an unknown teacher or time slot", ErrUnavailabilityInvalid, i+1)
+		}
+		u, err := scanUnavailability(tx.QueryRow(ctx,
+			`INSERT INTO teacher_unavailability (school_id, teacher_id, day_of_week, time_slot_id, note)
+			 VALUES ($1, $2, $3, $4, $5)
+			 RETURNING `+unavailabilityColumns,
+			schoolID, in.TeacherID, in.DayOfWeek, in.TimeSlotID, in.Note))
+		if err != nil {
+			return nil, fmt.Errorf("create teacher unavailability: %w", err)
+		}
+		list = append(list, *u)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return list, nil
+}
+
+const solverRunColumns = `id, school_id, name, effective_from, status, progress, draft_id, result, error,
+	created_by, created_at, started_at, finished_at`
+
+func scanSolverRun(row pgx.Row) (*models.TimetableSolverRun, error) {
+	var r models.TimetableSolverRun
+	if err := row.Scan(&r.ID, &r.SchoolID, &r.Name, &r.EffectiveFrom, &r.Status, &r.Progress, &r.DraftID,
+		&r.Result, &r.Error, &r.CreatedBy, &r.CreatedAt, &r.StartedAt, &r.FinishedAt); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+type CreateSolverRunInput struct {
+	Name          string `json:"name"`
+	EffectiveFrom string `json:"effective_from"`
+}
+
+// CreateRun queues a solver run.
+func (s *TimetableSolverService) CreateRun(ctx context.Context, schoolID, userID uuid.UUID, input CreateSolverRunInput) (*models.TimetableSolverRun, error) {
+	if _, err := time.Parse(dateLayout, input.EffectiveFrom); err != nil || input.Name == "" {
+		return nil, ErrSolverRunInvalid
+	}
+	var exists bool
+	if err := s.db.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM teaching_assignments WHERE school_id = $1)`, schoolID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check teaching assignments: %w", err)
+	}
+	if !exists {
+		return nil, ErrSolverNoAssignments
+	}
+	r, err := scanSolverRun(s.db.QueryRow(ctx,
+		`INSERT INTO timetable_solver_runs (school_id, name, effective_from, created_by)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+solverRunColumns,
+		schoolID, input.Name, input.EffectiveFrom, userID))
+	if err != nil {
+		return nil, fmt.Errorf("create solver run: %w", err)
+	}
+	return r, nil
+}
+
+func (s *TimetableSolverService) ListRuns(ctx context.Context, schoolID uuid.UUID) ([]models.TimetableSolverRun, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+solverRunColumns+` FROM timetable_solver_runs WHERE school_id = $1 ORDER BY created_at DESC`,
+		schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("list solver runs: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]models.TimetableSolverRun, 0)
+	for rows.Next() {
+		r, err := scanSolverRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan solver run: %w", err)
+		}
+		list = append(list, *r)
+	}
+	return list, rows.Err()
+}
+
+func (s *TimetableSolverService) GetRun(ctx context.Context, schoolID, runID uuid.UUID) (*models.TimetableSolverRun, error) {
+	r, err := scanSolverRun(s.db.QueryRow(ctx,
+		`SELECT `+solverRunColumns+` FROM timetable_solver_runs WHERE id = $1 AND school_id = $2`,
+		runID, schoolID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSolverRunNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get solver run: %w", err)
+	}
+	return r, nil
+}
+
+// FailInterrupted marks runs as failed that were running when the server
+// stopped. Only call it while holding the job's lock.
+func (s *TimetableSolverService) FailInterrupted(ctx context.Context) error {
+	if _, err := s.db.Exec(ctx,
+		`UPDATE timetable_solver_runs SET status = 'failed', error = 'interrupted', finished_at = now()
+		 WHERE status = 'running'`); err != nil {
+		return fmt.Errorf("fail interrupted solver runs: %w", err)
+	}
+	return nil
+}
+
+// ClaimRun marks the oldest queued run as running and returns it, nil when
+// none is queued.
+func (s *TimetableSolverService) ClaimRun(ctx context.Context) (*models.TimetableSolverRun, error) {
+	r, err := scanSolverRun(s.db.QueryRow(ctx,
+		`UPDATE timetable_solver_runs SET status = 'running', started_at = now()
+		 WHERE id = (SELECT id FROM timetable_solver_runs WHERE status = 'queued'
+		             ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED)
+		 RETURNING `+solverRunColumns))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim solver run: %w", err)
+	}
+	return r, nil
+}
+
+// SolverUnplaced lists the periods of an assignment the solver found no
+// slot for.
+type SolverUnplaced struct {
+	AssignmentID uuid.UUID `json:"assignment_id"`
+	Class        string    `json:"class"`
+	Subject      string    `json:"subject"`
+	Teacher      string    `json:"teacher"`
+	Periods      int       `json:"periods"`
+}
+
+// SolverResult is stored as the result of a finished run.
+type SolverResult struct {
+	Lessons  int              `json:"lessons"`
+	Replaced int              `json:"replaced"`
+	Unplaced []SolverUnplaced `json:"unplaced"`
+	Gaps     int              `json:"gaps"`
+	Repeats  int              `json:"repeats"`
+}
+
+// Execute runs the solver for a claimed run and stores the plan as a draft.
+// Failures are recorded on the run.
+func (s *TimetableSolverService) Execute(ctx context.Context, run *models.TimetableSolverRun) error {
+	result, draftID, err := s.execute(ctx, run)
+	if err != nil {
+		msg := err.Error()
+		if _, uerr := s.db.Exec(context.Background(),
+			`UPDATE timetable_solver_runs SET status = 'failed', error = $2, finished_at = now() WHERE id = $1`,
+			run.ID, msg); uerr != nil {
+			return fmt.Errorf("record solver failure: %w", uerr)
+		}
+		return err
+	}
+	if _, err := s.db.Exec(ctx,
+		`UPDATE timetable_solver_runs SET status = 'done', progress = 100, draft_id = $2, result = $3, finished_at = now()
+		 WHERE id = $1`, run.ID, draftID, result); err != nil {
+		return fmt.Errorf("finish solver run: %w", err)
+	}
+	return nil
+}
+
+type solverAssignment struct {
+	models.TeachingAssignment
+	class, subject, teacher string
+}
+
+func (s *TimetableSolverService) execute(ctx context.Context, run *models.TimetableSolverRun) (*SolverResult, uuid.UUID, error) {
+	schoolID := run.SchoolID
+	schools := NewSchoolService(s.db)
+	p := solver.Problem{
+		Days:        schools.GetIntListSetting(ctx, schoolID, "school_days", []int{1, 2, 3, 4, 5}),
+		MaxPerDay:   schools.GetIntSetting(ctx, schoolID, "max_periods_per_day", 0),
+		Unavailable: map[string][]solver.Slot{},
+		Seed:        int64(run.ID.ID()),
+	}
+
+	// Time grid
+	rows, err := s.db.Query(ctx,
+		`SELECT id, slot_number FROM time_slots WHERE school_id = $1 ORDER BY slot_number`, schoolID)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("list time slots: %w", err)
+	}
+	slotIDs := map[int]uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			rows.Close()
+			return nil, uuid.Nil, fmt.Errorf("scan time slot: %w", err)
+		}
+		slotIDs[n] = id
+		p.Periods = append(p.Periods, n)
+	}
+	rows.Close()
+	if len(p.Periods) == 0 {
+		return nil, uuid.Nil, errors.New("the school has no time slots")
+	}
+
+	// Assignments
+	rows, err = s.db.Query(ctx,
+		`SELECT a.id, a.class_id, a.subject_id, a.teacher_id, a.periods_per_week, a.double_periods, a.room_ids,
+		        c.name, sub.abbreviation, t.abbreviation
+		 FROM teaching_assignments a
+		 JOIN classes c ON c.id = a.class_id
+		 JOIN subjects sub ON sub.id = a.subject_id
+		 JOIN teachers t ON t.id = a.teacher_id
+		 WHERE a.school_id = $1
+		 ORDER BY c.name, sub.abbreviation`, schoolID)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("list teaching assignments: %w", err)
+	}
+	assignments := map[string]*solverAssignment{}
+	var classes []uuid.UUID
+	seenClass := map[uuid.UUID]bool{}
+	for rows.Next() {
+		a := &solverAssignment{}
+		if err := rows.Scan(&a.ID, &a.ClassID, &a.SubjectID, &a.TeacherID, &a.PeriodsPerWeek, &a.DoublePeriods,
+			&a.RoomIDs, &a.class, &a.subject, &a.teacher); err != nil {
+			rows.Close()
+			return nil, uuid.Nil, fmt.Errorf("scan teaching assignment: %w", err)
+		}
+		assignments[a.ID.String()] = a
+		if !seenClass[a.ClassID] {
+			seenClass[a.ClassID] = true
+			classes = append(classes, a.ClassID)
+		}
+		rooms := make([]string, len(a.RoomIDs))
+		for i, id := range a.RoomIDs {
+			rooms[i] = id.String()
+		}
+		p.Requirements = append(p.Requirements, solver.Requirement{
+			ID: a.ID.String(), Class: a.ClassID.String(), Subject: a.SubjectID.String(), Teacher: a.TeacherID.String(),
+			Periods: a.PeriodsPerWeek, Doubles: a.DoublePeriods, Rooms: rooms,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, uuid.Nil, fmt.Errorf("list teaching assignments: %w", err)
+	}
+	if len(p.Requirements) == 0 {
+		return nil, uuid.Nil, ErrSolverNoAssignments
+	}
+
+	// Teacher unavailability
+	rows, err = s.db.Query(ctx,
+		`SELECT u.teacher_id, u.day_of_week, COALESCE(ts.slot_number, 0)
+		 FROM teacher_unavailability u LEFT JOIN time_slots ts ON ts.id = u.time_slot_id
+		 WHERE u.school_id = $1`, schoolID)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("list teacher unavailability: %w", err)
+	}
+	for rows.Next() {
+		var teacher uuid.UUID
+		var sl solver.Slot
+		if err := rows.Scan(&teacher, &sl.Day, &sl.Period); err != nil {
+			rows.Close()
+			return nil, uuid.Nil, fmt.Errorf("scan teacher unavailability: %w", err)
+		}
+		p.Unavailable[teacher.String()] = append(p.Unavailable[teacher.String()], sl)
+	}
+	rows.Close()
+
+	// Published lessons that stay: everything but the class lessons of the
+	// planned classes. The lessons replaced are kept to reuse identical ones.
+	rows, err = s.db.Query(ctx,
+		`SELECT t.id, t.class_id, t.group_id IS NULL AND t.class_id = ANY($3), t.teacher_id, t.room_id, t.subject_id,
+		        t.day_of_week, ts.slot_number, t.slot_count,
+		        t.week_type = 'all' AND t.epoch_id IS NULL AND t.valid_until IS NULL
+		 FROM timetable_entries t JOIN time_slots ts ON ts.id = t.time_slot_id
+		 WHERE t.school_id = $1 AND (t.valid_until IS NULL OR t.valid_until >= $2)`,
+		schoolID, run.EffectiveFrom, classes)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("list timetable entries: %w", err)
+	}
+	replaceable := map[string]uuid.UUID{}
+	replaced := 0
+	for rows.Next() {
+		var id, teacher, subject uuid.UUID
+		var class, room *uuid.UUID
+		var planned, plain bool
+		var b solver.Booking
+		if err := rows.Scan(&id, &class, &planned, &teacher, &room, &subject, &b.Day, &b.Period, &b.Length,
+			&plain); err != nil {
+			rows.Close()
+			return nil, uuid.Nil, fmt.Errorf("scan timetable entry: %w", err)
+		}
+		if planned {
+			replaced++
+			if plain {
+				replaceable[lessonKey(*class, subject, teacher, room, b.Day, b.Period, b.Length)] = id
+			}
+			continue
+		}
+		b.Teacher = teacher.String()
+		if class != nil {
+			b.Class = class.String()
+		}
+		if room != nil {
+			b.Room = room.String()
+		}
+		p.Busy = append(p.Busy, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, uuid.Nil, fmt.Errorf("list timetable entries: %w", err)
+	}
+
+	// Progress is best effort: a failed update doesn't stop the run.
+	last := run.Progress
+	res, err := solver.Solve(ctx, p, func(f float64) {
+		percent := int(f * 99)
+		if percent > last {
+			last = percent
+			s.db.Exec(ctx, `UPDATE timetable_solver_runs SET progress = $2 WHERE id = $1`, run.ID, percent)
+		}
+	})
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("solve: %w", err)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var draftID uuid.UUID
+	if err := tx.QueryRow(ctx,
+		`INSERT INTO timetable_drafts (school_id, name, effective_from, created_by)
+		 VALUES ($1, $2, $3, $4) RETURNING id`,
+		schoolID, run.Name, run.EffectiveFrom, run.CreatedBy).Scan(&draftID); err != nil {
+		return nil, uuid.Nil, fmt.Errorf("create timetable draft: %w", err)
+	}
+	if err := copyPublishedEntries(ctx, tx, schoolID, draftID, run.EffectiveFrom, classes); err != nil {
+		return nil, uuid.Nil, err
+	}
+	for _, l := range res.Lessons {
+		a := assignments[l.Requirement]
+		var room *uuid.UUID
+		if l.Room != "" {
+			id, err := uuid.Parse(l.Room)
+			if err != nil {
+				return nil, uuid.Nil, fmt.Errorf("solver room %q: %w", l.Room, err)
+			}
+			room = &id
+		}
+		// Lessons the solver kept where they were stay linked to their
+		// published entry, so the draft's diff shows them as unchanged.
+		var source *uuid.UUID
+		key := lessonKey(a.ClassID, a.SubjectID, a.TeacherID, room, l.Day, l.Period, l.Length)
+		if id, ok := replaceable[key]; ok {
+			delete(replaceable, key)
+			source = &id
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO timetable_draft_entries (draft_id, source_entry_id, source_updated_at, school_id, class_id,
+			                                      subject_id, teacher_id, room_id, time_slot_id, slot_count, day_of_week,
+			                                      valid_from)
+			 VALUES ($1, $2, (SELECT updated_at FROM timetable_entries WHERE id = $2), $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			draftID, source, schoolID, a.ClassID, a.SubjectID, a.TeacherID, room, slotIDs[l.Period], l.Length,
+			l.Day, run.EffectiveFrom); err != nil {
+			return nil, uuid.Nil, fmt.Errorf("create draft entry: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, uuid.Nil, fmt.Errorf("commit: %w", err)
+	}
+
+	result := &SolverResult{
+		Lessons: len(res.Lessons), Replaced: replaced, Unplaced: make([]SolverUnplaced, 0, len(res.Unplaced)),
+		Gaps: res.Gaps, Repeats: res.Repeats,
+	}
+	for _, u := range res.Unplaced {
+		a := assignments[u.Requirement]
+		result.Unplaced = append(result.Unplaced, SolverUnplaced{
+			AssignmentID: a.ID, Class: a.class, Subject: a.subject, Teacher: a.teacher, Periods: u.Periods,
+		})
+	}
+	return result, draftID, nil
+}
+
+func lessonKey(class, subject, teacher uuid.UUID, room *uuid.UUID, day, period, length int) string {
+	r := ""
+	if room != nil {
+		r = room.String()
+	}
+	return strings.Join([]string{class.String(), subject.String(), teacher.String(), r,
+		strconv.Itoa(day), strconv.Itoa(period), strconv.Itoa(length)}, "|")
+}
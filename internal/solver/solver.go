@@ -0,0 +1,624 @@
+// Package solver builds a weekly timetable from teaching assignments: which
+// teacher teaches which subject to which class for how many periods a week.
+//
+// Hard constraints are never broken: a class, a teacher and a room are in one
+// lesson at a time, teachers are not scheduled when unavailable, lessons that
+// need a room get one of their allowed rooms, and a class has at most
+// MaxPerDay periods a day. Within those, the solver minimises gaps in the
+// classes' days and lessons of the same subject on the same day, and prefers
+// early periods.
+//
+// Lessons are placed greedily, most constrained first; a lesson without a
+// free slot may displace one or two placed lessons, which are placed again
+// later. A local search then moves lessons to cheaper slots.
+package solver
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+)
+
+// Slot is a period on a weekday (1 = Monday). Period 0 stands for the whole
+// day in Problem.Unavailable.
+type Slot struct {
+	Day    int
+	Period int
+}
+
+// Requirement is a teaching assignment: Periods lessons a week, Doubles of
+// them held as double periods. A lesson takes one of Rooms; with no rooms
+// it needs none.
+type Requirement struct {
+	ID      string
+	Class   string
+	Subject string
+	Teacher string
+	Periods int
+	Doubles int
+	Rooms   []string
+}
+
+// Booking is a fixed lesson the solver plans around, e.g. a group lesson
+// that stays as it is. Empty fields don't block anything.
+type Booking struct {
+	Slot
+	Length  int
+	Class   string
+	Teacher string
+	Room    string
+}
+
+type Problem struct {
+	Days    []int // weekdays to plan
+	Periods []int // period numbers in order; a double period needs two consecutive numbers
+	// MaxPerDay limits the periods of a class per day (0: no limit).
+	MaxPerDay    int
+	Requirements []Requirement
+	Unavailable  map[string][]Slot // by teacher
+	Busy         []Booking
+	// Iterations of the local search (default 20000).
+	Iterations int
+	Seed       int64
+}
+
+// Lesson is a placed lesson of requirement Requirement.
+type Lesson struct {
+	Requirement string
+	Day         int
+	Period      int
+	Length      int
+	Room        string
+}
+
+// Unplaced counts the periods of a requirement that found no slot.
+type Unplaced struct {
+	Requirement string
+	Periods     int
+}
+
+type Result struct {
+	Lessons  []Lesson
+	Unplaced []Unplaced
+	// Gaps is the number of free periods between lessons of a class, summed
+	// over classes and days.
+	Gaps int
+	// Repeats counts lessons of a subject on a day after the first one.
+	Repeats int
+}
+
+const (
+	costGap    = 10
+	costRepeat = 6
+	costLate   = 1
+)
+
+type unit struct {
+	req    *Requirement
+	length int
+	placed bool
+	day    int // index into Problem.Days
+	period int // index into Problem.Periods
+	room   string
+}
+
+type state struct {
+	p       *Problem
+	days    int
+	periods int
+	units   []unit
+	// Occupation per resource and cell (day*periods + period): the unit
+	// index, fixed for a booking, free for nothing.
+	class   map[string][]int
+	teacher map[string][]int
+	room    map[string][]int
+	away    map[string][]bool // teacher unavailability
+	rng     *rand.Rand
+}
+
+const (
+	free  = -1
+	fixed = -2
+)
+
+func (s *state) grid(m map[string][]int, key string) []int {
+	g, ok := m[key]
+	if !ok {
+		g = make([]int, s.days*s.periods)
+		for i := range g {
+			g[i] = free
+		}
+		m[key] = g
+	}
+	return g
+}
+
+// Solve plans the requirements. It stops early with ctx's error when ctx is
+// cancelled. progress is called with values from 0 to 1.
+func Solve(ctx context.Context, p Problem, progress func(float64)) (*Result, error) {
+	if progress == nil {
+		progress = func(float64) {}
+	}
+	if p.Iterations == 0 {
+		p.Iterations = 20000
+	}
+	s := &state{
+		p: &p, days: len(p.Days), periods: len(p.Periods),
+		class: map[string][]int{}, teacher: map[string][]int{}, room: map[string][]int{},
+		away: map[string][]bool{}, rng: rand.New(rand.NewSource(p.Seed)),
+	}
+	s.setup()
+	if err := s.construct(ctx, progress); err != nil {
+		return nil, err
+	}
+	if err := s.improve(ctx, progress); err != nil {
+		return nil, err
+	}
+	progress(1)
+	return s.result(), nil
+}
+
+func (s *state) setup() {
+	dayIndex := map[int]int{}
+	for i, d := range s.p.Days {
+		dayIndex[d] = i
+	}
+	periodIndex := map[int]int{}
+	for i, n := range s.p.Periods {
+		periodIndex[n] = i
+	}
+	for teacher, slots := range s.p.Unavailable {
+		away := make([]bool, s.days*s.periods)
+		for _, sl := range slots {
+			d, ok := dayIndex[sl.Day]
+			if !ok {
+				continue
+			}
+			for pi, n := range s.p.Periods {
+				if sl.Period == 0 || sl.Period == n {
+					away[d*s.periods+pi] = true
+				}
+			}
+		}
+		s.away[teacher] = away
+	}
+	for _, b := range s.p.Busy {
+		d, ok := dayIndex[b.Day]
+		if !ok {
+			continue
+		}
+		length := b.Length
+		if length < 1 {
+			length = 1
+		}
+		for k := 0; k < length; k++ {
+			pi, ok := periodIndex[b.Period+k]
+			if !ok {
+				continue
+			}
+			cell := d*s.periods + pi
+			for _, r := range []struct {
+				m   map[string][]int
+				key string
+			}{{s.class, b.Class}, {s.teacher, b.Teacher}, {s.room, b.Room}} {
+				if r.key != "" {
+					s.grid(r.m, r.key)[cell] = fixed
+				}
+			}
+		}
+	}
+
+	for i := range s.p.Requirements {
+		r := &s.p.Requirements[i]
+		doubles := r.Doubles
+		if doubles*2 > r.Periods {
+			doubles = r.Periods / 2
+		}
+		for k := 0; k < doubles; k++ {
+			s.units = append(s.units, unit{req: r, length: 2})
+		}
+		for k := 0; k < r.Periods-2*doubles; k++ {
+			s.units = append(s.units, unit{req: r, length: 1})
+		}
+	}
+}
+
+// consecutive reports whether length periods from index pi exist and follow
+// each other.
+func (s *state) consecutive(pi, length int) bool {
+	if pi+length > s.periods {
+		return false
+	}
+	for k := 1; k < length; k++ {
+		if s.p.Periods[pi+k] != s.p.Periods[pi]+k {
+			return false
+		}
+	}
+	return true
+}
+
+// fits returns a room for unit u at (d, pi), "" when it needs none; ok is
+// false when a hard constraint is broken. u must not be placed.
+func (s *state) fits(u *unit, d, pi int) (room string, ok bool) {
+	if !s.consecutive(pi, u.length) {
+		return "", false
+	}
+	class := s.grid(s.class, u.req.Class)
+	teacher := s.grid(s.teacher, u.req.Teacher)
+	away := s.away[u.req.Teacher]
+	for k := 0; k < u.length; k++ {
+		cell := d*s.periods + pi + k
+		if class[cell] != free || teacher[cell] != free || away != nil && away[cell] {
+			return "", false
+		}
+	}
+	if s.p.MaxPerDay > 0 {
+		n := u.length
+		for k := 0; k < s.periods; k++ {
+			if class[d*s.periods+k] != free {
+				n++
+			}
+		}
+		if n > s.p.MaxPerDay {
+			return "", false
+		}
+	}
+	if len(u.req.Rooms) == 0 {
+		return "", true
+	}
+	for _, r := range u.req.Rooms {
+		g := s.grid(s.room, r)
+		available := true
+		for k := 0; k < u.length; k++ {
+			if g[d*s.periods+pi+k] != free {
+				available = false
+				break
+			}
+		}
+		if available {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+func (s *state) place(i, d, pi int, room string) {
+	u := &s.units[i]
+	u.placed, u.day, u.period, u.room = true, d, pi, room
+	s.mark(u, i)
+}
+
+func (s *state) unplace(i int) {
+	u := &s.units[i]
+	s.mark(u, free)
+	u.placed = false
+}
+
+func (s *state) mark(u *unit, v int) {
+	class := s.grid(s.class, u.req.Class)
+	teacher := s.grid(s.teacher, u.req.Teacher)
+	for k := 0; k < u.length; k++ {
+		cell := u.day*s.periods + u.period + k
+		class[cell] = v
+		teacher[cell] = v
+		if u.room != "" {
+			s.grid(s.room, u.room)[cell] = v
+		}
+	}
+}
+
+// dayCost is the soft cost of a class's day d.
+func (s *state) dayCost(class string, d int) int {
+	g := s.grid(s.class, class)
+	cost := 0
+	first, last, used := -1, -1, 0
+	subjects := map[string]int{}
+	for pi := 0; pi < s.periods; pi++ {
+		v := g[d*s.periods+pi]
+		if v == free {
+			continue
+		}
+		if first < 0 {
+			first = pi
+		}
+		last = pi
+		used++
+		cost += costLate * pi
+		if v >= 0 && s.units[v].period == pi {
+			subjects[s.units[v].req.Subject]++
+		}
+	}
+	if first >= 0 {
+		cost += costGap * (last - first + 1 - used)
+	}
+	for _, n := range subjects {
+		cost += costRepeat * (n - 1)
+	}
+	return cost
+}
+
+type option struct {
+	d, pi int
+	room  string
+	cost  int
+}
+
+// best returns the cheapest slot for the unplaced unit i.
+func (s *state) best(i int) (option, bool) {
+	u := &s.units[i]
+	found := false
+	var best option
+	for d := 0; d < s.days; d++ {
+		before := s.dayCost(u.req.Class, d)
+		for pi := 0; pi < s.periods; pi++ {
+			room, ok := s.fits(u, d, pi)
+			if !ok {
+				continue
+			}
+			s.place(i, d, pi, room)
+			cost := s.dayCost(u.req.Class, d) - before
+			s.unplace(i)
+			if !found || cost < best.cost || cost == best.cost && s.rng.Intn(2) == 0 {
+				best, found = option{d: d, pi: pi, room: room, cost: cost}, true
+			}
+		}
+	}
+	return best, found
+}
+
+// freedom counts the slots unit u could take in an empty plan.
+func (s *state) freedom(u *unit) int {
+	n := 0
+	for d := 0; d < s.days; d++ {
+		for pi := 0; pi < s.periods; pi++ {
+			if _, ok := s.fits(u, d, pi); ok {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (s *state) construct(ctx context.Context, progress func(float64)) error {
+	freedom := make([]int, len(s.units))
+	order := make([]int, len(s.units))
+	for i := range s.units {
+		freedom[i] = s.freedom(&s.units[i])
+		order[i] = i
+	}
+	// Double periods first, then the units with the fewest slots.
+	sort.SliceStable(order, func(a, b int) bool {
+		ua, ub := &s.units[order[a]], &s.units[order[b]]
+		if ua.length != ub.length {
+			return ua.length > ub.length
+		}
+		return freedom[order[a]] < freedom[order[b]]
+	})
+
+	queue := order
+	ejections := 0
+	maxEjections := 10 * len(s.units)
+	placed := 0
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		i := queue[0]
+		queue = queue[1:]
+		if o, ok := s.best(i); ok {
+			s.place(i, o.d, o.pi, o.room)
+		} else if ejections < maxEjections {
+			if ejected, ok := s.eject(i); ok {
+				ejections++
+				queue = append(queue, ejected...)
+			}
+		}
+		placed++
+		if total := placed + len(queue); total > 0 {
+			progress(0.3 * float64(placed) / float64(total))
+		}
+	}
+	return nil
+}
+
+// eject places unit i by taking up to two placed units out of its way. It
+// returns the displaced units.
+func (s *state) eject(i int) ([]int, bool) {
+	u := &s.units[i]
+	type candidate struct {
+		d, pi   int
+		victims []int
+	}
+	var candidates []candidate
+	for d := 0; d < s.days; d++ {
+		for pi := 0; pi < s.periods; pi++ {
+			if !s.consecutive(pi, u.length) {
+				continue
+			}
+			victims, ok := s.blockers(u, d, pi)
+			if ok && len(victims) > 0 && len(victims) <= 2 {
+				candidates = append(candidates, candidate{d, pi, victims})
+			}
+		}
+	}
+	s.rng.Shuffle(len(candidates), func(a, b int) { candidates[a], candidates[b] = candidates[b], candidates[a] })
+	sort.SliceStable(candidates, func(a, b int) bool { return len(candidates[a].victims) < len(candidates[b].victims) })
+
+	for _, c := range candidates {
+		for _, v := range c.victims {
+			s.unplace(v)
+		}
+		if room, ok := s.fits(u, c.d, c.pi); ok {
+			s.place(i, c.d, c.pi, room)
+			return c.victims, true
+		}
+		for _, v := range c.victims {
+			w := &s.units[v]
+			s.place(v, w.day, w.period, w.room)
+		}
+	}
+	return nil, false
+}
+
+// blockers lists the placed units that share the class, teacher or (when
+// all of u's rooms are taken) a room with unit u at (d, pi). ok is false
+// when a fixed booking or the teacher's unavailability is in the way.
+func (s *state) blockers(u *unit, d, pi int) ([]int, bool) {
+	seen := map[int]bool{}
+	var victims []int
+	add := func(v int) bool {
+		if v == fixed {
+			return false
+		}
+		if v >= 0 && !seen[v] {
+			seen[v] = true
+			victims = append(victims, v)
+		}
+		return true
+	}
+	class := s.grid(s.class, u.req.Class)
+	teacher := s.grid(s.teacher, u.req.Teacher)
+	away := s.away[u.req.Teacher]
+	for k := 0; k < u.length; k++ {
+		cell := d*s.periods + pi + k
+		if away != nil && away[cell] || !add(class[cell]) || !add(teacher[cell]) {
+			return nil, false
+		}
+	}
+	if len(u.req.Rooms) > 0 {
+		roomFree := false
+		for _, r := range u.req.Rooms {
+			available := true
+			g := s.grid(s.room, r)
+			for k := 0; k < u.length; k++ {
+				if v := g[d*s.periods+pi+k]; v != free && !seen[v] {
+					available = false
+				}
+			}
+			if available {
+				roomFree = true
+				break
+			}
+		}
+		if !roomFree {
+			g := s.grid(s.room, u.req.Rooms[0])
+			for k := 0; k < u.length; k++ {
+				if !add(g[d*s.periods+pi+k]) {
+					return nil, false
+				}
+			}
+		}
+	}
+	return victims, true
+}
+
+// improve moves random lessons to slots that cost no more.
+func (s *state) improve(ctx context.Context, progress func(float64)) error {
+	var placed []int
+	for i := range s.units {
+		if s.units[i].placed {
+			placed = append(placed, i)
+		}
+	}
+	if len(placed) == 0 {
+		return nil
+	}
+	for it := 0; it < s.p.Iterations; it++ {
+		if it%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			progress(0.3 + 0.7*float64(it)/float64(s.p.Iterations))
+		}
+		i := placed[s.rng.Intn(len(placed))]
+		u := &s.units[i]
+		d, pi := s.rng.Intn(s.days), s.rng.Intn(s.periods)
+		oldD, oldPi, oldRoom := u.day, u.period, u.room
+		if d == oldD && pi == oldPi {
+			continue
+		}
+		before := s.dayCost(u.req.Class, oldD)
+		if d != oldD {
+			before += s.dayCost(u.req.Class, d)
+		}
+		s.unplace(i)
+		room, ok := s.fits(u, d, pi)
+		if !ok {
+			s.place(i, oldD, oldPi, oldRoom)
+			continue
+		}
+		s.place(i, d, pi, room)
+		after := s.dayCost(u.req.Class, oldD)
+		if d != oldD {
+			after += s.dayCost(u.req.Class, d)
+		}
+		if after > before {
+			s.unplace(i)
+			s.place(i, oldD, oldPi, oldRoom)
+		}
+	}
+	return nil
+}
+
+func (s *state) result() *Result {
+	res := &Result{}
+	unplaced := map[string]int{}
+	var order []string
+	classes := map[string]bool{}
+	for i := range s.units {
+		u := &s.units[i]
+		if !u.placed {
+			if _, ok := unplaced[u.req.ID]; !ok {
+				order = append(order, u.req.ID)
+			}
+			unplaced[u.req.ID] += u.length
+			continue
+		}
+		classes[u.req.Class] = true
+		res.Lessons = append(res.Lessons, Lesson{
+			Requirement: u.req.ID, Day: s.p.Days[u.day], Period: s.p.Periods[u.period],
+			Length: u.length, Room: u.room,
+		})
+	}
+	for _, id := range order {
+		res.Unplaced = append(res.Unplaced, Unplaced{Requirement: id, Periods: unplaced[id]})
+	}
+	sort.Slice(res.Lessons, func(a, b int) bool {
+		la, lb := res.Lessons[a], res.Lessons[b]
+		if la.Day != lb.Day {
+			return la.Day < lb.Day
+		}
+		if la.Period != lb.Period {
+			return la.Period < lb.Period
+		}
+		return la.Requirement < lb.Requirement
+	})
+
+	for class := range classes {
+		g := s.grid(s.class, class)
+		for d := 0; d < s.days; d++ {
+			first, last, used := -1, -1, 0
+			subjects := map[string]int{}
+			for pi := 0; pi < s.periods; pi++ {
+				v := g[d*s.periods+pi]
+				if v == free {
+					continue
+				}
+				if first < 0 {
+					first = pi
+				}
+				last, used = pi, used+1
+				if v >= 0 && s.units[v].period == pi {
+					subjects[s.units[v].req.Subject]++
+				}
+			}
+			if first >= 0 {
+				res.Gaps += last - first + 1 - used
+			}
+			for _, n := range subjects {
+				res.Repeats += n - 1
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,383 @@
+// Package untis reads the GPU text exports of Untis (Datei → Import/Export →
+// Untis → Stundenplan) that Eduko needs to take over a timetable:
+//
+//	GPU001  timetable (one line per lesson and period)
+//	GPU003  classes
+//	GPU004  teachers
+//	GPU005  rooms
+//	GPU006  subjects
+//
+// Untis does not export the time grid as a GPU file, so it is read from a
+// small CSV of period number, start and end ("1,08:00,08:45").
+//
+// GPU files are comma- or semicolon-separated with quoted fields and are
+// written as Windows-1252 unless UTF-8 was selected in the export dialog;
+// both are accepted.
+package untis
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// File names as used in the Untis export dialog and in issues.
+const (
+	FileTimetable = "GPU001"
+	FileClasses   = "GPU003"
+	FileTeachers  = "GPU004"
+	FileRooms     = "GPU005"
+	FileSubjects  = "GPU006"
+	FileTimeGrid  = "time_grid"
+)
+
+// ErrEmpty is returned when none of the exports was supplied.
+var ErrEmpty = errors.New("no Untis export files")
+
+// Issue is a line of an export that could not be used.
+type Issue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+type Teacher struct {
+	Line         int
+	Abbreviation string
+	LastName     string
+	FirstName    string
+}
+
+type Class struct {
+	Line     int
+	Name     string
+	LongName string
+}
+
+type Room struct {
+	Line     int
+	Name     string
+	LongName string
+}
+
+type Subject struct {
+	Line         int
+	Abbreviation string
+	Name         string
+}
+
+// Period is a row of the time grid. Start and End are "HH:MM".
+type Period struct {
+	Line   int
+	Number int
+	Start  string
+	End    string
+	Label  string
+}
+
+// Lesson is a GPU001 line: one class, teacher, subject and room in one
+// period. Day is 1 (Monday) to 7.
+type Lesson struct {
+	Line    int
+	Number  string
+	Class   string
+	Teacher string
+	Subject string
+	Room    string
+	Day     int
+	Period  int
+}
+
+// Block is a lesson over Count consecutive periods starting at Period.
+type Block struct {
+	Lesson
+	Count int
+}
+
+// Data is the content of a set of exports. Files that were not uploaded
+// are empty.
+type Data struct {
+	Teachers []Teacher
+	Classes  []Class
+	Rooms    []Room
+	Subjects []Subject
+	Periods  []Period
+	Lessons  []Lesson
+	Issues   []Issue
+}
+
+// decode returns src as UTF-8, converting from Windows-1252 when it is not
+// valid UTF-8, and drops a byte order mark.
+func decode(src []byte) (string, error) {
+	src = bytes.TrimPrefix(src, []byte("\xEF\xBB\xBF"))
+	if utf8.Valid(src) {
+		return string(src), nil
+	}
+	out, err := charmap.Windows1252.NewDecoder().Bytes(src)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+type record struct {
+	line   int
+	fields []string
+}
+
+// field returns the trimmed n-th field (1-based, as in the Untis
+// documentation) or "".
+func (r record) field(n int) string {
+	if n <= len(r.fields) {
+		return strings.TrimSpace(r.fields[n-1])
+	}
+	return ""
+}
+
+// readRecords splits an export into records. The delimiter is taken from the
+// first line.
+func readRecords(file string, r io.Reader) ([]record, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text, err := decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	first, _, _ := strings.Cut(text, "\n")
+
+	cr := csv.NewReader(strings.NewReader(text))
+	if strings.Count(first, ";") > strings.Count(first, ",") {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	var records []record
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		line, _ := cr.FieldPos(0)
+		if len(fields) == 1 && strings.TrimSpace(fields[0]) == "" {
+			continue
+		}
+		records = append(records, record{line: line, fields: fields})
+	}
+}
+
+func (d *Data) issue(file string, line int, format string, args ...interface{}) {
+	d.Issues = append(d.Issues, Issue{File: file, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// ReadTeachers reads GPU004: 1 abbreviation, 2 last name, 29 first name.
+func (d *Data) ReadTeachers(r io.Reader) error {
+	records, err := readRecords(FileTeachers, r)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		t := Teacher{Line: rec.line, Abbreviation: rec.field(1), LastName: rec.field(2), FirstName: rec.field(29)}
+		if t.Abbreviation == "" {
+			d.issue(FileTeachers, rec.line, "missing abbreviation")
+			continue
+		}
+		if t.LastName == "" {
+			t.LastName = t.Abbreviation
+		}
+		d.Teachers = append(d.Teachers, t)
+	}
+	return nil
+}
+
+// ReadClasses reads GPU003: 1 name, 2 long name.
+func (d *Data) ReadClasses(r io.Reader) error {
+	records, err := readRecords(FileClasses, r)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		c := Class{Line: rec.line, Name: rec.field(1), LongName: rec.field(2)}
+		if c.Name == "" {
+			d.issue(FileClasses, rec.line, "missing name")
+			continue
+		}
+		d.Classes = append(d.Classes, c)
+	}
+	return nil
+}
+
+// ReadRooms reads GPU005: 1 name, 2 long name.
+func (d *Data) ReadRooms(r io.Reader) error {
+	records, err := readRecords(FileRooms, r)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		room := Room{Line: rec.line, Name: rec.field(1), LongName: rec.field(2)}
+		if room.Name == "" {
+			d.issue(FileRooms, rec.line, "missing name")
+			continue
+		}
+		d.Rooms = append(d.Rooms, room)
+	}
+	return nil
+}
+
+// ReadSubjects reads GPU006: 1 abbreviation, 2 name.
+func (d *Data) ReadSubjects(r io.Reader) error {
+	records, err := readRecords(FileSubjects, r)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		s := Subject{Line: rec.line, Abbreviation: rec.field(1), Name: rec.field(2)}
+		if s.Abbreviation == "" {
+			d.issue(FileSubjects, rec.line, "missing abbreviation")
+			continue
+		}
+		if s.Name == "" {
+			s.Name = s.Abbreviation
+		}
+		d.Subjects = append(d.Subjects, s)
+	}
+	return nil
+}
+
+// parseClock accepts "8:00", "08:00" and "0800".
+func parseClock(v string) (string, error) {
+	v = strings.ReplaceAll(v, ".", ":")
+	h, m, ok := strings.Cut(v, ":")
+	if !ok && len(v) >= 3 {
+		h, m = v[:len(v)-2], v[len(v)-2:]
+	}
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if err1 != nil || err2 != nil || hour > 23 || minute > 59 || hour < 0 || minute < 0 {
+		return "", fmt.Errorf("invalid time %q", v)
+	}
+	return fmt.Sprintf("%02d:%02d", hour, minute), nil
+}
+
+// ReadTimeGrid reads the time grid: 1 period, 2 start, 3 end, 4 label
+// (optional). A header line is skipped.
+func (d *Data) ReadTimeGrid(r io.Reader) error {
+	records, err := readRecords(FileTimeGrid, r)
+	if err != nil {
+		return err
+	}
+	for i, rec := range records {
+		n, err := strconv.Atoi(rec.field(1))
+		if err != nil {
+			if i > 0 {
+				d.issue(FileTimeGrid, rec.line, "invalid period %q", rec.field(1))
+			}
+			continue
+		}
+		p := Period{Line: rec.line, Number: n, Label: rec.field(4)}
+		if p.Start, err = parseClock(rec.field(2)); err == nil {
+			p.End, err = parseClock(rec.field(3))
+		}
+		if err != nil {
+			d.issue(FileTimeGrid, rec.line, "%v", err)
+			continue
+		}
+		if p.End <= p.Start {
+			d.issue(FileTimeGrid, rec.line, "period %d ends before it starts", n)
+			continue
+		}
+		d.Periods = append(d.Periods, p)
+	}
+	return nil
+}
+
+// ReadTimetable reads GPU001: 1 lesson number, 2 class, 3 teacher,
+// 4 subject, 5 room, 6 day, 7 period.
+func (d *Data) ReadTimetable(r io.Reader) error {
+	records, err := readRecords(FileTimetable, r)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		l := Lesson{
+			Line: rec.line, Number: rec.field(1), Class: rec.field(2), Teacher: rec.field(3),
+			Subject: rec.field(4), Room: rec.field(5),
+		}
+		day, errDay := strconv.Atoi(rec.field(6))
+		period, errPeriod := strconv.Atoi(rec.field(7))
+		switch {
+		case errDay != nil || day < 1 || day > 7:
+			d.issue(FileTimetable, rec.line, "invalid day %q", rec.field(6))
+			continue
+		case errPeriod != nil || period < 1:
+			d.issue(FileTimetable, rec.line, "invalid period %q", rec.field(7))
+			continue
+		case l.Class == "":
+			d.issue(FileTimetable, rec.line, "lesson %s has no class", l.Number)
+			continue
+		case l.Teacher == "":
+			d.issue(FileTimetable, rec.line, "lesson %s has no teacher", l.Number)
+			continue
+		case l.Subject == "":
+			d.issue(FileTimetable, rec.line, "lesson %s has no subject", l.Number)
+			continue
+		}
+		l.Day, l.Period = day, period
+		d.Lessons = append(d.Lessons, l)
+	}
+	return nil
+}
+
+// Blocks merges the lessons into blocks: a lesson in consecutive periods of
+// the same day, with the same class, teacher, subject and room, becomes one
+// double (or longer) period. Lessons are returned in day/period order.
+func Blocks(lessons []Lesson) []Block {
+	sorted := append([]Lesson(nil), lessons...)
+	key := func(l Lesson) string {
+		return strings.Join([]string{l.Number, l.Class, l.Teacher, l.Subject, l.Room, strconv.Itoa(l.Day)}, "\x00")
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if ki, kj := key(sorted[i]), key(sorted[j]); ki != kj {
+			return ki < kj
+		}
+		return sorted[i].Period < sorted[j].Period
+	})
+
+	var blocks []Block
+	for _, l := range sorted {
+		if n := len(blocks); n > 0 {
+			last := &blocks[n-1]
+			if key(last.Lesson) == key(l) && last.Period+last.Count == l.Period {
+				last.Count++
+				continue
+			}
+			if key(last.Lesson) == key(l) && last.Period+last.Count > l.Period {
+				continue // duplicate line
+			}
+		}
+		blocks = append(blocks, Block{Lesson: l, Count: 1})
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		if blocks[i].Day != blocks[j].Day {
+			return blocks[i].Day < blocks[j].Day
+		}
+		if blocks[i].Period != blocks[j].Period {
+			return blocks[i].Period < blocks[j].Period
+		}
+		return blocks[i].Class < blocks[j].Class
+	})
+	return blocks
+}
@@ -0,0 +1,263 @@
+package uploads
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// HEIC cannot be decoded without cgo, so instead of re-encoding, the metadata
+// items (Exif and XMP) are overwritten with zeros in place. Box sizes and item
+// offsets stay unchanged, so the image data is untouched and remains valid.
+
+var heicBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true, "hevc": true, "hevx": true,
+}
+
+func isHEIC(data []byte) bool {
+	if len(data) < 16 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	size := int(binary.BigEndian.Uint32(data))
+	if size < 16 || size > len(data) {
+		return false
+	}
+	if heicBrands[string(data[8:12])] {
+		return true
+	}
+	for i := 16; i+4 <= size; i += 4 {
+		if heicBrands[string(data[i:i+4])] {
+			return true
+		}
+	}
+	return false
+}
+
+type box struct {
+	typ        string
+	start, end int // whole box
+	body       int // first byte after the header
+}
+
+// boxes lists the child boxes in data[from:to].
+func boxes(data []byte, from, to int) ([]box, error) {
+	var list []box
+	for i := from; i < to; {
+		if i+8 > to {
+			return nil, ErrCorrupt
+		}
+		size := uint64(binary.BigEndian.Uint32(data[i:]))
+		typ := string(data[i+4 : i+8])
+		header := 8
+		switch size {
+		case 0:
+			size = uint64(to - i)
+		case 1:
+			if i+16 > to {
+				return nil, ErrCorrupt
+			}
+			size = binary.BigEndian.Uint64(data[i+8:])
+			header = 16
+		}
+		if size < uint64(header) || size > uint64(to-i) {
+			return nil, ErrCorrupt
+		}
+		list = append(list, box{typ: typ, start: i, end: i + int(size), body: i + header})
+		i += int(size)
+	}
+	return list, nil
+}
+
+func find(list []box, typ string) *box {
+	for i := range list {
+		if list[i].typ == typ {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+// reader is a bounds-checked big-endian cursor.
+type reader struct {
+	data []byte
+	pos  int
+	end  int
+	err  bool
+}
+
+func (r *reader) uint(n int) uint64 {
+	if n == 0 {
+		return 0
+	}
+	if r.err || r.pos+n > r.end {
+		r.err = true
+		return 0
+	}
+	var v uint64
+	for _, b := range r.data[r.pos : r.pos+n] {
+		v = v<<8 | uint64(b)
+	}
+	r.pos += n
+	return v
+}
+
+func (r *reader) cstring() string {
+	i := bytes.IndexByte(r.data[r.pos:r.end], 0)
+	if r.err || i < 0 {
+		r.err = true
+		return ""
+	}
+	s := string(r.data[r.pos : r.pos+i])
+	r.pos += i + 1
+	return s
+}
+
+func stripHEIC(src []byte) ([]byte, error) {
+	data := append([]byte(nil), src...)
+
+	top, err := boxes(data, 0, len(data))
+	if err != nil {
+		return nil, err
+	}
+	meta := find(top, "meta")
+	if meta == nil {
+		return nil, ErrCorrupt
+	}
+	children, err := boxes(data, meta.body+4, meta.end) // meta is a FullBox
+	if err != nil {
+		return nil, err
+	}
+
+	metadataItems, err := heicMetadataItems(data, find(children, "iinf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(metadataItems) == 0 {
+		return data, nil
+	}
+
+	idatStart := -1
+	if idat := find(children, "idat"); idat != nil {
+		idatStart = idat.body
+	}
+	iloc := find(children, "iloc")
+	if iloc == nil {
+		return nil, ErrCorrupt
+	}
+	if err := zeroItems(data, iloc, idatStart, metadataItems); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// heicMetadataItems returns the IDs of Exif and XMP items.
+func heicMetadataItems(data []byte, iinf *box) (map[uint64]bool, error) {
+	items := map[uint64]bool{}
+	if iinf == nil {
+		return items, nil
+	}
+	r := &reader{data: data, pos: iinf.body, end: iinf.end}
+	version := r.uint(1)
+	r.uint(3)
+	countSize := 2
+	if version > 0 {
+		countSize = 4
+	}
+	r.uint(countSize)
+	if r.err {
+		return nil, ErrCorrupt
+	}
+
+	entries, err := boxes(data, r.pos, iinf.end)
+	if err != nil {
+		return nil, err
+	}
+	for _, infe := range entries {
+		if infe.typ != "infe" {
+			continue
+		}
+		e := &reader{data: data, pos: infe.body, end: infe.end}
+		v := e.uint(1)
+		e.uint(3)
+		if v < 2 {
+			continue
+		}
+		idSize := 2
+		if v >= 3 {
+			idSize = 4
+		}
+		id := e.uint(idSize)
+		e.uint(2) // protection index
+		itemType := string(data[e.pos:min(e.pos+4, e.end)])
+		e.uint(4)
+		if e.err {
+			return nil, ErrCorrupt
+		}
+		switch itemType {
+		case "Exif":
+			items[id] = true
+		case "mime":
+			e.cstring() // item name
+			contentType := e.cstring()
+			if bytes.Contains([]byte(contentType), []byte("xml")) {
+				items[id] = true
+			}
+		}
+	}
+	return items, nil
+}
+
+// zeroItems overwrites the extents of the given items.
+func zeroItems(data []byte, iloc *box, idatStart int, items map[uint64]bool) error {
+	r := &reader{data: data, pos: iloc.body, end: iloc.end}
+	version := r.uint(1)
+	r.uint(3)
+	sizes := r.uint(2)
+	offsetSize, lengthSize := int(sizes>>12&0xF), int(sizes>>8&0xF)
+	baseOffsetSize, indexSize := int(sizes>>4&0xF), int(sizes&0xF)
+	if version == 0 {
+		indexSize = 0
+	}
+	countSize, idSize := 2, 2
+	if version >= 2 {
+		countSize, idSize = 4, 4
+	}
+	count := r.uint(countSize)
+
+	for k := uint64(0); k < count && !r.err; k++ {
+		id := r.uint(idSize)
+		method := uint64(0)
+		if version >= 1 {
+			method = r.uint(2) & 0xF
+		}
+		r.uint(2) // data reference index
+		base := r.uint(baseOffsetSize)
+		extents := r.uint(2)
+		for x := uint64(0); x < extents && !r.err; x++ {
+			r.uint(indexSize)
+			offset := r.uint(offsetSize)
+			length := r.uint(lengthSize)
+			if !items[id] || r.err {
+				continue
+			}
+			start := base + offset
+			switch method {
+			case 0:
+			case 1:
+				if idatStart < 0 {
+					return ErrCorrupt
+				}
+				start += uint64(idatStart)
+			default:
+				continue // item constructed from other items: no bytes of its own
+			}
+			if length == 0 || start+length > uint64(len(data)) {
+				return ErrCorrupt
+			}
+			clear(data[start : start+length])
+		}
+	}
+	if r.err {
+		return ErrCorrupt
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package uploads
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// Names that make a PDF execute something when opened. Checked after #xx
+// escapes in names are decoded, in the file and in every Flate stream (object
+// streams can hide dictionaries).
+var activeNames = [][]byte{
+	[]byte("/JavaScript"),
+	[]byte("/JS"),
+	[]byte("/Launch"),
+	[]byte("/EmbeddedFile"),
+	[]byte("/RichMedia"),
+	[]byte("/XFA"),
+}
+
+var (
+	nameEscape = regexp.MustCompile(`#[0-9A-Fa-f]{2}`)
+	streamRe   = regexp.MustCompile(`(?s)stream\r?\n(.*?)endstream`)
+)
+
+const maxInflate = 50 << 20
+
+func checkPDF(data []byte) error {
+	if !bytes.Contains(data[max(0, len(data)-2048):], []byte("%%EOF")) {
+		return ErrCorrupt
+	}
+	if err := checkPDFNames(data); err != nil {
+		return err
+	}
+
+	budget := int64(maxInflate)
+	for _, m := range streamRe.FindAllSubmatch(data, -1) {
+		zr, err := zlib.NewReader(bytes.NewReader(m[1]))
+		if err != nil {
+			continue // not Flate-encoded (images, fonts, ...)
+		}
+		inflated, _ := io.ReadAll(io.LimitReader(zr, budget))
+		zr.Close()
+		budget -= int64(len(inflated))
+		if err := checkPDFNames(inflated); err != nil {
+			return err
+		}
+		if budget <= 0 {
+			return ErrCorrupt // decompression bomb
+		}
+	}
+	return nil
+}
+
+func checkPDFNames(data []byte) error {
+	decoded := nameEscape.ReplaceAllFunc(data, func(esc []byte) []byte {
+		b, _ := strconv.ParseUint(string(esc[1:]), 16, 8)
+		return []byte{byte(b)}
+	})
+	if bytes.Contains(decoded, []byte("/Encrypt")) {
+		return ErrEncryptedPDF
+	}
+	for _, name := range activeNames {
+		for i := 0; ; {
+			j := bytes.Index(decoded[i:], name)
+			if j < 0 {
+				break
+			}
+			end := i + j + len(name)
+			// Only whole names count: /JS but not /JSomething.
+			if end == len(decoded) || !isNameChar(decoded[end]) {
+				return ErrActivePDF
+			}
+			i = end
+		}
+	}
+	return nil
+}
+
+func isNameChar(c byte) bool {
+	switch {
+	case c <= ' ', c == '/', c == '(', c == ')', c == '<', c == '>', c == '[', c == ']', c == '{', c == '}', c == '%':
+		return false
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+// Package uploads validates and sanitizes user-supplied files before they are
+// stored: the real content type is sniffed (the client's extension and
+// Content-Type are ignored), only PDF, JPEG, PNG and HEIC are accepted, image
+// metadata (EXIF, GPS, XMP) is removed and PDFs with encryption or active
+// content are rejected.
+package uploads
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	TypePDF  = "application/pdf"
+	TypeJPEG = "image/jpeg"
+	TypePNG  = "image/png"
+	TypeHEIC = "image/heic"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported file type (allowed: PDF, JPEG, PNG, HEIC)")
+	ErrEncryptedPDF    = errors.New("encrypted PDFs are not accepted")
+	ErrActivePDF       = errors.New("PDFs with JavaScript or embedded actions are not accepted")
+	ErrImageTooLarge   = errors.New("image dimensions too large")
+	ErrCorrupt         = errors.New("file is damaged or incomplete")
+)
+
+var extensions = map[string]string{
+	TypePDF:  ".pdf",
+	TypeJPEG: ".jpg",
+	TypePNG:  ".png",
+	TypeHEIC: ".heic",
+}
+
+// Sniff returns the content type of data, or "" if it is not an allowed type.
+func Sniff(data []byte) string {
+	if isHEIC(data) {
+		return TypeHEIC
+	}
+	switch t := http.DetectContentType(data); t {
+	case TypePDF, TypeJPEG, TypePNG:
+		return t
+	}
+	return ""
+}
+
+// Sanitize checks data and returns the content to store together with its
+// sniffed content type. Images are rewritten without metadata.
+func Sanitize(data []byte) ([]byte, string, error) {
+	contentType := Sniff(data)
+	var err error
+	switch contentType {
+	case TypePDF:
+		err = checkPDF(data)
+	case TypeJPEG:
+		data, err = reencodeJPEG(data)
+	case TypePNG:
+		data, err = reencodePNG(data)
+	case TypeHEIC:
+		data, err = stripHEIC(data)
+	default:
+		return nil, "", ErrUnsupportedType
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentType, nil
+}
+
+// FileName replaces the extension of name with the canonical one for
+// contentType, so a sniffed PNG uploaded as "scan.exe" is stored as
+// "scan.png".
+func FileName(name, contentType string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if base == "" || base == "." || base == "/" {
+		base = "upload"
+	}
+	return base + extensions[contentType]
+}
+
+func hasPrefix(data []byte, prefix string) bool {
+	return bytes.HasPrefix(data, []byte(prefix))
+}
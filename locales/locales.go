@@ -0,0 +1,8 @@
+// Package locales embeds the translation files so the backend can localize
+// generated documents and notifications without reading from disk.
+package locales
+
+import "embed"
+
+//go:embed *.json
+var FS embed.FS
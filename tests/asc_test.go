@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Monstroxx/eduko-backend/internal/asc"
+)
+
+const ascExport = `<?xml version="1.0" encoding="windows-1252"?>
+<timetable importtype="database">
+  <periods>
+    <period name="1. Stunde" short="1" period="1" starttime="8:00" endtime="8:45"/>
+    <period name="2. Stunde" short="2" period="2" starttime="8:50" endtime="9:35"/>
+    <period name="3. Stunde" short="3" period="3" starttime="9:50" endtime="10:35"/>
+  </periods>
+  <weeksdefs>
+    <weeksdef id="W0" name="Jede Woche" weeks="11"/>
+    <weeksdef id="WA" name="A-Woche" weeks="10"/>
+    <weeksdef id="W3" name="Dreiwochenzyklus" weeks="100"/>
+  </weeksdefs>
+  <subjects><subject id="S1" name="Mathematik" short="MA"/><subject id="S2" name="Sport" short="SP"/></subjects>
+  <teachers>
+    <teacher id="T1" firstname="Anna" lastname="M` + "\xfc" + `ller" short="M` + "\xdc" + `"/>
+    <teacher id="T2" firstname="Ben" lastname="Schmidt" short="SC"/>
+  </teachers>
+  <classrooms><classroom id="R1" name="Raum 101" short="R101"/><classroom id="R2" name="Halle" short=""/></classrooms>
+  <classes><class id="C1" name="10a" short="10a"/><class id="C2" name="10b" short="10b"/></classes>
+  <groups>
+    <group id="G1" classid="C1" name="Ganze Klasse" entireclass="1"/>
+    <group id="G2" classid="C1" name="Jungen" entireclass="0"/>
+    <group id="G3" classid="C2" name="Jungen" entireclass="0"/>
+  </groups>
+  <lessons>
+    <lesson id="L1" classids="C1" subjectid="S1" teacherids="T1" groupids="G1" periodspercard="1" weeksdefid="W0"/>
+    <lesson id="L2" classids="C1,C2" subjectid="S2" teacherids="T2,T1" groupids="G2,G3" periodspercard="2" weeksdefid="WA"/>
+    <lesson id="L3" classids="C2" subjectid="S1" teacherids="T1" groupids="" periodspercard="1" weeksdefid="W3"/>
+  </lessons>
+  <cards>
+    <card lessonid="L1" classroomids="R1" period="1" days="10000" weeks="" terms="1"/>
+    <card lessonid="L1" classroomids="R1" period="2" days="10000" weeks="" terms="1"/>
+    <card lessonid="L1" classroomids="R1" period="1" days="00100" weeks="" terms="1"/>
+    <card lessonid="L2" classroomids="R2" period="2" days="01000" weeks="" terms="1"/>
+    <card lessonid="L3" classroomids="" period="3" days="00010" weeks="" terms="1"/>
+  </cards>
+</timetable>`
+
+func TestASc_Parse(t *testing.T) {
+	tt, err := asc.Parse(strings.NewReader(ascExport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tt.Periods) != 3 || tt.Periods[0].Start != "08:00" || tt.Periods[2].End != "10:35" {
+		t.Errorf("unexpected periods: %+v", tt.Periods)
+	}
+	if len(tt.Teachers) != 2 || tt.Teachers[0].Short != "MÜ" || tt.Teachers[0].LastName != "Müller" {
+		t.Errorf("unexpected teachers: %+v", tt.Teachers)
+	}
+	if len(tt.Rooms) != 2 || tt.Rooms[0] != "R101" || tt.Rooms[1] != "Halle" {
+		t.Errorf("unexpected rooms: %+v", tt.Rooms)
+	}
+
+	got := map[string]asc.Lesson{}
+	for _, l := range tt.Lessons {
+		got[l.Class+"/"+l.Group+"/"+string(rune('0'+l.Day))] = l
+	}
+	if len(tt.Lessons) != 4 {
+		t.Fatalf("expected 4 lessons, got %+v", tt.Lessons)
+	}
+	// Two cards in consecutive periods are a double period.
+	if l := got["10a//1"]; l.Period != 1 || l.Count != 2 || l.Room != "R101" || l.Teacher != "MÜ" || l.Weeks != "" {
+		t.Errorf("unexpected Monday lesson: %+v", l)
+	}
+	if l := got["10a//3"]; l.Period != 1 || l.Count != 1 {
+		t.Errorf("unexpected Wednesday lesson: %+v", l)
+	}
+	// One card of a two-period lesson, split into the boys of both classes,
+	// in A weeks only.
+	for _, k := range []string{"10a/10a Jungen/2", "10b/10b Jungen/2"} {
+		if l := got[k]; l.Period != 2 || l.Count != 2 || l.Weeks != "A" || l.Teacher != "SC" || l.Subject != "SP" {
+			t.Errorf("unexpected %s: %+v", k, l)
+		}
+	}
+
+	// The second teacher of L2 and the three-week cycle of L3.
+	if len(tt.Issues) != 2 || !strings.Contains(tt.Issues[0], "only SC imported") ||
+		!strings.Contains(tt.Issues[1], "not an A/B cycle") {
+		t.Errorf("unexpected issues: %v", tt.Issues)
+	}
+}
+
+func TestASc_ParseInvalid(t *testing.T) {
+	if _, err := asc.Parse(strings.NewReader("<timetable><periods>")); err == nil {
+		t.Error("expected an error for truncated XML")
+	}
+}
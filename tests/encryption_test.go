@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/Monstroxx/eduko-backend/internal/encryption"
+)
+
+func testMasterKey(id string, fill byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, 32))
+}
+
+func TestKeyring_WrapAndRotate(t *testing.T) {
+	if _, err := encryption.ParseKeyring("k1:c2hvcnQ=", nil); err == nil {
+		t.Error("expected error for short master key")
+	}
+	disabled, err := encryption.ParseKeyring("", nil)
+	if err != nil || disabled.Enabled() {
+		t.Fatalf("expected disabled keyring, got %v", err)
+	}
+
+	old, err := encryption.ParseKeyring(testMasterKey("k1", 1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	school := uuid.New()
+	raw := []byte(strings.Repeat("x", 32))
+	masterID, wrapped, err := old.Wrap(school, raw)
+	if err != nil || masterID != "k1" {
+		t.Fatalf("wrap: %q %v", masterID, err)
+	}
+	if _, err := old.Unwrap(uuid.New(), masterID, wrapped); !errors.Is(err, encryption.ErrCorrupt) {
+		t.Errorf("expected wrapped key to be bound to its school, got %v", err)
+	}
+
+	// After rotation the old master key still unwraps existing data keys.
+	rotated, err := encryption.ParseKeyring(testMasterKey("k2", 2), []string{testMasterKey("k1", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.ActiveID() != "k2" {
+		t.Errorf("expected k2 active, got %q", rotated.ActiveID())
+	}
+	got, err := rotated.Unwrap(school, masterID, wrapped)
+	if err != nil || !bytes.Equal(got, raw) {
+		t.Fatalf("unwrap with retired master key: %v", err)
+	}
+	if _, err := old.Unwrap(school, "k2", wrapped); !errors.Is(err, encryption.ErrUnknownMasterKey) {
+		t.Errorf("expected ErrUnknownMasterKey, got %v", err)
+	}
+}
+
+func TestDataKey_StringsAndBlobs(t *testing.T) {
+	dk, err := encryption.GenerateDataKey(uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := dk.EncryptString("Magen-Darm-Grippe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "Grippe") || !strings.HasPrefix(sealed, "enc:v1:"+dk.ID.String()+":") {
+		t.Errorf("unexpected ciphertext %q", sealed)
+	}
+	if id, ok := encryption.StringKeyID(sealed); !ok || id != dk.ID {
+		t.Errorf("expected key id %s, got %s", dk.ID, id)
+	}
+	if plain, err := dk.DecryptString(sealed); err != nil || plain != "Magen-Darm-Grippe" {
+		t.Errorf("round trip: %q %v", plain, err)
+	}
+	again, _ := dk.EncryptString("Magen-Darm-Grippe")
+	if again == sealed {
+		t.Error("expected random nonce for strings")
+	}
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if _, err := dk.DecryptString(tampered); !errors.Is(err, encryption.ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt for tampered string, got %v", err)
+	}
+	if _, ok := encryption.StringKeyID("plain reason"); ok {
+		t.Error("plaintext must not look encrypted")
+	}
+
+	file := []byte("%PDF-1.4\n% attest\n%%EOF\n")
+	blob, err := dk.EncryptBlob(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(blob, []byte("attest")) {
+		t.Error("blob not encrypted")
+	}
+	if second, _ := dk.EncryptBlob(file); !bytes.Equal(blob, second) {
+		t.Error("expected identical blobs for identical content (de-duplication)")
+	}
+	if plain, err := dk.DecryptBlob(blob); err != nil || !bytes.Equal(plain, file) {
+		t.Errorf("blob round trip: %v", err)
+	}
+	blob[len(blob)-1] ^= 1
+	if _, err := dk.DecryptBlob(blob); !errors.Is(err, encryption.ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt for tampered blob, got %v", err)
+	}
+	if _, ok := encryption.BlobKeyID(file); ok {
+		t.Error("plaintext file must not look encrypted")
+	}
+
+	other, _ := encryption.GenerateDataKey(dk.SchoolID)
+	if _, err := other.DecryptString(sealed); !errors.Is(err, encryption.ErrUnknownDataKey) {
+		t.Errorf("expected ErrUnknownDataKey, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Monstroxx/eduko-backend/internal/ical"
+)
+
+func TestICal_ParseHolidays(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:herbst-2026@berlin\r\n" +
+		"SUMMARY:Herbstferien Berlin\\, 2026\r\n" +
+		"DTSTART;VALUE=DATE:20261019\r\n" +
+		"DTEND;VALUE=DATE:20261031\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:reformation-2026\r\n" +
+		"SUMMARY:Reformations\r\n" +
+		" tag\r\n" +
+		"DTSTART:20261031\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:konferenz\r\n" +
+		"SUMMARY:Konferenz\r\n" +
+		"DTSTART;TZID=Europe/Berlin:20261102T080000\r\n" +
+		"DTEND;TZID=Europe/Berlin:20261102T160000\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	events, err := ical.Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	want := []struct{ uid, summary, start, end string }{
+		{"herbst-2026@berlin", "Herbstferien Berlin, 2026", "2026-10-19", "2026-10-30"},
+		{"reformation-2026", "Reformationstag", "2026-10-31", "2026-10-31"},
+		{"konferenz", "Konferenz", "2026-11-02", "2026-11-02"},
+	}
+	for i, w := range want {
+		ev := events[i]
+		if ev.UID != w.uid || ev.Summary != w.summary ||
+			ev.Start.Format("2006-01-02") != w.start || ev.End.Format("2006-01-02") != w.end {
+			t.Errorf("event %d: got %q %q %s–%s", i, ev.UID, ev.Summary,
+				ev.Start.Format("2006-01-02"), ev.End.Format("2006-01-02"))
+		}
+	}
+
+	if _, err := ical.Parse(strings.NewReader("not a calendar")); !errors.Is(err, ical.ErrInvalid) {
+		t.Errorf("expected ErrInvalid, got %v", err)
+	}
+	bad := "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART;VALUE=DATE:2026-10-19\nEND:VEVENT\nEND:VCALENDAR\n"
+	if _, err := ical.Parse(strings.NewReader(bad)); !errors.Is(err, ical.ErrInvalid) {
+		t.Errorf("expected ErrInvalid for malformed date, got %v", err)
+	}
+}
+
+func TestICal_Write(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no tzdata")
+	}
+	long := strings.Repeat("Größe ", 20)
+	events := []ical.VEvent{
+		{UID: "lesson-1@eduko", Summary: "Entfall: Mathematik", Location: "R101; Haus A",
+			Start: time.Date(2026, 10, 19, 8, 0, 0, 0, berlin), End: time.Date(2026, 10, 19, 8, 45, 0, 0, berlin),
+			Cancelled: true},
+		{UID: "appointment-1@eduko", Summary: "Klausur: " + long, Description: "Kapitel 1,\nKapitel 2",
+			Start: time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC), End: time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC),
+			AllDay: true},
+	}
+	var buf strings.Builder
+	if err := ical.Write(&buf, "Stundenplan", events, time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"DTSTART:20261019T060000Z\r\n",
+		"DTEND:20261019T064500Z\r\n",
+		"LOCATION:R101\\; Haus A\r\n",
+		"STATUS:CANCELLED\r\n",
+		"DTSTART;VALUE=DATE:20261020\r\n",
+		"DTEND;VALUE=DATE:20261021\r\n",
+		"DESCRIPTION:Kapitel 1\\,\\nKapitel 2\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("fold split a UTF-8 sequence: %q", line)
+		}
+	}
+
+	parsed, err := ical.Parse(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || parsed[1].Summary != "Klausur: "+long || parsed[1].End.Format("2006-01-02") != "2026-10-20" {
+		t.Errorf("round trip failed: %+v", parsed)
+	}
+}
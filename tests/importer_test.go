@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/Monstroxx/eduko-backend/internal/importer"
+)
+
+func TestImporter_RowNumbersAndReport(t *testing.T) {
+	csv := "username;date_from\n" +
+		"a;2030-01-01\n" +
+		"\n" +
+		"b;\"broken\"quote\"\n" +
+		"c;not-a-date\n" +
+		"d;\"multi\nline\"\n" +
+		"e;2030-01-02\n"
+
+	reader, err := importer.NewReader(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := importer.NewReport(true)
+	err = reader.Each(report, func(row importer.Row) error {
+		if row.Get("date_from") == "not-a-date" {
+			return importer.Fieldf("date_from", "invalid date")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Total != 5 || report.Imported != 4 || report.Failed != 1 {
+		t.Fatalf("unexpected counts: total=%d imported=%d failed=%d", report.Total, report.Imported, report.Failed)
+	}
+	// Line 3 is blank, so "c" sits on line 5 of the file.
+	if issue := report.Issues[0]; issue.Row != 5 || issue.Column != "date_from" {
+		t.Errorf("expected issue at row 5 column date_from, got %+v", issue)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "row;column;error;username;date_from\n5;date_from;invalid date;c;not-a-date\n"
+	if buf.String() != want {
+		t.Errorf("unexpected error report:\n%s", buf.String())
+	}
+}
+
+func TestImporter_UnexpectedErrorsAbort(t *testing.T) {
+	csv := "username\n" +
+		"a\n" +
+		"b\n" +
+		"c\n" +
+		"d\n"
+
+	reader, err := importer.NewReader(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := importer.NewReport(true)
+	err = reader.Each(report, func(row importer.Row) error {
+		switch row.Get("username") {
+		case "a":
+			return importer.Rowf("missing required fields")
+		case "b":
+			return importer.Constraint(fmt.Errorf("create user: %w",
+				&pgconn.PgError{Code: "23505", ColumnName: "username"}))
+		case "c":
+			return importer.Constraint(errors.New("connection reset"))
+		}
+		return nil
+	})
+
+	var rowErr *importer.RowError
+	if !errors.As(err, &rowErr) || rowErr.Row != 4 {
+		t.Fatalf("expected the import to abort at row 4, got %v", err)
+	}
+	if report.Total != 3 || report.Failed != 2 {
+		t.Fatalf("unexpected counts: total=%d failed=%d", report.Total, report.Failed)
+	}
+	if issue := report.Issues[0]; issue.Column != "" || issue.Message != "missing required fields" {
+		t.Errorf("unexpected row issue: %+v", issue)
+	}
+	if issue := report.Issues[1]; issue.Column != "username" || issue.Message != "already exists" {
+		t.Errorf("unexpected constraint issue: %+v", issue)
+	}
+}
@@ -1,7 +1,9 @@
 package tests
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,14 +11,24 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Monstroxx/eduko-backend/internal/config"
 	"github.com/Monstroxx/eduko-backend/internal/database"
+	"github.com/Monstroxx/eduko-backend/internal/encryption"
+	"github.com/Monstroxx/eduko-backend/internal/events"
 	"github.com/Monstroxx/eduko-backend/internal/handlers"
+	"github.com/Monstroxx/eduko-backend/internal/jobs"
 	"github.com/Monstroxx/eduko-backend/internal/middleware"
+	"github.com/Monstroxx/eduko-backend/internal/models"
+	"github.com/Monstroxx/eduko-backend/internal/notify"
+	"github.com/Monstroxx/eduko-backend/internal/scanner"
+	"github.com/Monstroxx/eduko-backend/internal/storage"
 	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // testServer creates a fully wired Echo server for integration testing.
@@ -35,44 +47,132 @@ func testServer(t *testing.T) (*echo.Echo, *config.Config) {
 		JWTSecret:   "test-secret-key-for-testing",
 		CORSOrigins: []string{"*"},
 		UploadDir:   t.TempDir(),
+
+		SignedURLTTL: time.Minute,
 	}
+	store := storage.NewLocal(cfg.UploadDir)
 
 	db, err := database.Connect(cfg.DatabaseURL)
 	if err != nil {
 		t.Skipf("database not available: %v", err)
 	}
 	t.Cleanup(func() { db.Close() })
+	hub := events.NewHub(db)
+	ctx, cancel := context.WithCancel(context.Background())
+	go hub.Run(ctx)
+	t.Cleanup(cancel)
 
 	e := echo.New()
 	e.HideBanner = true
+	e.GET("/ical/:file", handlers.ServeCalendarFeed(db))
+	e.GET("/display/:file", handlers.ServeDisplay(db))
 
 	api := e.Group("/api/v1")
 	api.POST("/auth/login", handlers.Login(db, cfg))
 	api.POST("/auth/register", handlers.Register(db, cfg))
+	api.GET("/files/attachments/:attachmentId", handlers.DownloadSignedAttachment(db, cfg, store))
 
 	protected := api.Group("")
 	protected.Use(middleware.JWT(cfg.JWTSecret))
 
+	protected.GET("/events", handlers.StreamEvents(hub))
+	protected.GET("/notifications", handlers.ListNotifications(db))
+	protected.GET("/notifications/unread-count", handlers.GetUnreadNotificationCount(db))
+	protected.PATCH("/notifications/read-all", handlers.MarkAllNotificationsRead(db))
+	protected.PATCH("/notifications/:id/read", handlers.MarkNotificationRead(db))
+	protected.GET("/notifications/preferences", handlers.GetNotificationPreferences(db))
+	protected.PUT("/notifications/preferences", handlers.UpdateNotificationPreferences(db))
 	protected.GET("/school", handlers.GetSchool(db))
 	protected.GET("/school/settings", handlers.GetSchoolSettings(db))
+	protected.GET("/school/retention/preview", handlers.PreviewRetention(db))
 	protected.GET("/classes", handlers.ListClasses(db))
 	protected.GET("/classes/:id/students", handlers.ListClassStudents(db))
 	protected.GET("/students", handlers.ListStudents(db))
 	protected.GET("/students/:id", handlers.GetStudent(db))
 	protected.PUT("/students/:id", handlers.UpdateStudent(db))
+	protected.GET("/students/:id/absences", handlers.GetStudentAbsences(db))
+	protected.GET("/students/:id/guardians", handlers.ListStudentGuardians(db))
+	protected.POST("/students/:id/guardians", handlers.AddStudentGuardian(db))
 	protected.POST("/students/import", handlers.ImportStudentsCSV(db))
 	protected.GET("/teachers", handlers.ListTeachers(db))
+	protected.GET("/calendar", handlers.GetCalendar(db))
+	protected.POST("/calendar/school-years", handlers.CreateSchoolYear(db))
+	protected.DELETE("/calendar/school-years/:id", handlers.DeleteSchoolYear(db))
+	protected.POST("/calendar/holidays", handlers.CreateHoliday(db))
+	protected.DELETE("/calendar/holidays/:id", handlers.DeleteHoliday(db))
+	protected.GET("/calendar/feed", handlers.GetCalendarFeed(db))
+	protected.POST("/calendar/feed", handlers.CreateCalendarFeed(db))
+	protected.DELETE("/calendar/feed", handlers.DeleteCalendarFeed(db))
+	protected.GET("/course-groups", handlers.ListCourseGroups(db))
+	protected.POST("/course-groups", handlers.CreateCourseGroup(db))
+	protected.GET("/course-groups/:id", handlers.GetCourseGroup(db))
+	protected.PUT("/course-groups/:id", handlers.UpdateCourseGroup(db))
+	protected.DELETE("/course-groups/:id", handlers.DeleteCourseGroup(db))
+	protected.GET("/course-groups/:id/members", handlers.ListCourseGroupMembers(db))
+	protected.POST("/course-groups/:id/members", handlers.AddCourseGroupMembers(db))
+	protected.DELETE("/course-groups/:id/members/:studentId", handlers.RemoveCourseGroupMember(db))
+	protected.GET("/timetable/epochs", handlers.ListEpochs(db))
+	protected.POST("/timetable/epochs", handlers.CreateEpoch(db))
+	protected.PUT("/timetable/epochs/:id", handlers.UpdateEpoch(db))
+	protected.DELETE("/timetable/epochs/:id", handlers.DeleteEpoch(db))
 	protected.GET("/timetable", handlers.GetTimetable(db))
+	protected.GET("/timetable/day", handlers.GetTimetableDay(db))
+	protected.GET("/timetable/week", handlers.GetTimetableWeek(db))
+	protected.GET("/timetable/conflicts", handlers.GetTimetableConflicts(db))
+	protected.POST("/timetable/import/untis", handlers.ImportUntis(db))
+	protected.POST("/timetable/import/asc", handlers.ImportASc(db))
+	protected.GET("/timetable/drafts", handlers.ListTimetableDrafts(db))
+	protected.POST("/timetable/drafts", handlers.CreateTimetableDraft(db))
+	protected.GET("/timetable/drafts/:id", handlers.GetTimetableDraft(db))
+	protected.DELETE("/timetable/drafts/:id", handlers.DeleteTimetableDraft(db))
+	protected.POST("/timetable/drafts/:id/entries", handlers.CreateTimetableDraftEntry(db))
+	protected.PUT("/timetable/drafts/:id/entries/:entryId", handlers.UpdateTimetableDraftEntry(db))
+	protected.DELETE("/timetable/drafts/:id/entries/:entryId", handlers.DeleteTimetableDraftEntry(db))
+	protected.GET("/timetable/drafts/:id/diff", handlers.GetTimetableDraftDiff(db))
+	protected.GET("/timetable/drafts/:id/conflicts", handlers.GetTimetableDraftConflicts(db))
+	protected.POST("/timetable/drafts/:id/publish", handlers.PublishTimetableDraft(db))
+	protected.GET("/timetable/solver/assignments", handlers.ListTeachingAssignments(db))
+	protected.PUT("/timetable/solver/assignments", handlers.ReplaceTeachingAssignments(db))
+	protected.GET("/timetable/solver/unavailability", handlers.ListTeacherUnavailability(db))
+	protected.PUT("/timetable/solver/unavailability", handlers.ReplaceTeacherUnavailability(db))
+	protected.GET("/timetable/solver/runs", handlers.ListSolverRuns(db))
+	protected.POST("/timetable/solver/runs", handlers.CreateSolverRun(db))
+	protected.GET("/timetable/solver/runs/:id", handlers.GetSolverRun(db))
 	protected.POST("/timetable", handlers.CreateTimetableEntry(db))
+	protected.DELETE("/timetable/:id", handlers.DeleteTimetableEntry(db))
 	protected.GET("/substitutions", handlers.ListSubstitutions(db))
+	protected.GET("/substitutions/plan", handlers.GetSubstitutionPlan(db))
+	protected.GET("/substitutions/displays", handlers.ListDisplayFeeds(db))
+	protected.POST("/substitutions/displays", handlers.CreateDisplayFeed(db))
+	protected.DELETE("/substitutions/displays/:id", handlers.DeleteDisplayFeed(db))
+	protected.POST("/substitutions", handlers.CreateSubstitution(db))
+	protected.PUT("/substitutions/:id", handlers.UpdateSubstitution(db))
+	protected.DELETE("/substitutions/:id", handlers.DeleteSubstitution(db))
+	protected.GET("/substitutions/:id/candidates", handlers.ListSubstituteCandidates(db))
+	protected.POST("/substitutions/confirm", handlers.ConfirmSubstitutes(db))
+	protected.GET("/teachers/:id/absences", handlers.ListTeacherAbsences(db))
+	protected.POST("/teachers/:id/absences", handlers.CreateTeacherAbsence(db))
+	protected.DELETE("/teachers/:id/absences/:absenceId", handlers.DeleteTeacherAbsence(db))
 	protected.POST("/attendance", handlers.RecordAttendance(db))
 	protected.GET("/attendance/class/:classId", handlers.GetClassAttendance(db))
+	protected.GET("/attendance/entry/:entryId/roster", handlers.GetLessonRoster(db))
 	protected.POST("/excuses", handlers.CreateExcuse(db))
 	protected.GET("/excuses", handlers.ListExcuses(db))
 	protected.GET("/excuses/:id", handlers.GetExcuse(db))
 	protected.PATCH("/excuses/:id/approve", handlers.ApproveExcuse(db))
 	protected.PATCH("/excuses/:id/reject", handlers.RejectExcuse(db))
+	protected.POST("/excuses/bulk", handlers.BulkExcuses(db))
+	protected.POST("/excuses/import", handlers.ImportExcusesCSV(db))
 	protected.GET("/excuses/:id/pdf", handlers.GenerateExcusePDF(db))
+	protected.POST("/excuses/:id/attachments", handlers.UploadExcuseForm(db, store, scanner.None{}))
+	protected.GET("/excuses/:id/attachments", handlers.ListExcuseAttachments(db))
+	protected.GET("/excuses/:id/attachments/:attachmentId", handlers.DownloadExcuseAttachment(db, store))
+	protected.POST("/excuses/:id/attachments/:attachmentId/link", handlers.CreateAttachmentLink(db, cfg))
+	protected.DELETE("/excuses/:id/attachments/:attachmentId", handlers.DeleteExcuseAttachment(db, store))
+	protected.POST("/leave-requests", handlers.CreateLeaveRequest(db))
+	protected.GET("/leave-requests", handlers.ListLeaveRequests(db))
+	protected.PATCH("/leave-requests/:id/approve", handlers.ApproveLeaveRequest(db))
+	protected.PATCH("/leave-requests/:id/reject", handlers.RejectLeaveRequest(db))
 	protected.GET("/subjects", handlers.ListSubjects(db))
 	protected.GET("/rooms", handlers.ListRooms(db))
 	protected.GET("/timeslots", handlers.ListTimeSlots(db))
@@ -121,8 +221,52 @@ func authedPost(e *echo.Echo, token, path, body string) *httptest.ResponseRecord
 	return rec
 }
 
+// authedPatch performs an authenticated PATCH request with JSON body.
+func authedPatch(e *echo.Echo, token, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// authedPut performs an authenticated PUT request with JSON body.
+func authedPut(e *echo.Echo, token, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// authedDelete performs an authenticated DELETE request.
+func authedDelete(e *echo.Echo, token, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodDelete, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
 // ── Auth Tests ──────────────────────────────────────────────
 
+func authedUpload(e *echo.Echo, token, path, filename, content string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", filename)
+	io.WriteString(part, content)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
 func TestLogin_Success(t *testing.T) {
 	e, _ := testServer(t)
 	token := login(t, e, "admin", "admin123")
@@ -261,216 +405,1964 @@ func TestGetTimetable(t *testing.T) {
 	}
 }
 
-// ── Excuses Tests ───────────────────────────────────────────
-
-func TestListExcuses(t *testing.T) {
+func TestTimetableConflicts(t *testing.T) {
 	e, _ := testServer(t)
 	token := login(t, e, "admin", "admin123")
 
-	rec := authedGet(e, token, "/api/v1/excuses")
-	if rec.Code != http.StatusOK {
-		t.Fatalf("expected 200, got %d", rec.Code)
+	// Same teacher and room as the seeded first Monday lesson, but for an A
+	// week from 2031 on: 'all' overlaps A, and the validity ranges overlap.
+	body := `{"class_id":"00000000-0000-0000-0000-000000000100",
+		"subject_id":"00000000-0000-0000-0000-000000000201",
+		"teacher_id":"00000000-0000-0000-0000-000000000021",
+		"room_id":"00000000-0000-0000-0000-000000000300",
+		"time_slot_id":"00000000-0000-0000-0000-000000000400",
+		"day_of_week":1,"week_type":"A","valid_from":"2031-01-01"%s}`
+	rec := authedPost(e, token, "/api/v1/timetable", fmt.Sprintf(body, ""))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var conflict struct {
+		Conflicts []struct {
+			Resources []string `json:"resources"`
+			Entries   []struct {
+				ID string `json:"id"`
+			} `json:"entries"`
+		} `json:"conflicts"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &conflict)
+	if len(conflict.Conflicts) != 1 || strings.Join(conflict.Conflicts[0].Resources, ",") != "teacher,room,students" {
+		t.Fatalf("unexpected conflicts: %s", rec.Body.String())
 	}
-}
 
-func TestExcusePDF(t *testing.T) {
-	e, _ := testServer(t)
-	token := login(t, e, "admin", "admin123")
+	// Entries that end before the new one starts don't conflict.
+	rec = authedPost(e, token, "/api/v1/timetable",
+		strings.Replace(fmt.Sprintf(body, `,"valid_until":"2024-12-31"`), "2031-01-01", "2024-01-01", 1))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for a past entry, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var past map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &past)
+	defer authedDelete(e, token, "/api/v1/timetable/"+past["id"].(string))
 
-	// Get an excuse
-	rec := authedGet(e, token, "/api/v1/excuses")
-	var excuses []map[string]interface{}
-	json.Unmarshal(rec.Body.Bytes(), &excuses)
-	if len(excuses) == 0 {
-		t.Skip("no excuses in test db")
+	rec = authedPost(e, token, "/api/v1/timetable", fmt.Sprintf(body, `,"force":true`))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 with force, got %d: %s", rec.Code, rec.Body.String())
 	}
-	excuseID := excuses[0]["id"].(string)
+	var forced map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &forced)
+	defer authedDelete(e, token, "/api/v1/timetable/"+forced["id"].(string))
 
-	rec = authedGet(e, token, "/api/v1/excuses/"+excuseID+"/pdf")
+	rec = authedGet(e, token, "/api/v1/timetable/conflicts")
 	if rec.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
 	}
-	if !strings.HasPrefix(rec.Body.String(), "%PDF") {
-		t.Error("expected PDF content")
+	if !strings.Contains(rec.Body.String(), forced["id"].(string)) {
+		t.Errorf("expected forced entry in conflict scan: %s", rec.Body.String())
 	}
-}
 
-// ── Reference Data Tests ────────────────────────────────────
+	studentToken := login(t, e, "schueler", "student123")
+	if rec := authedGet(e, studentToken, "/api/v1/timetable/conflicts"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for student, got %d", rec.Code)
+	}
+}
 
-func TestListSubjects(t *testing.T) {
+func TestCalendar_NonTeachingDay(t *testing.T) {
 	e, _ := testServer(t)
 	token := login(t, e, "admin", "admin123")
 
-	rec := authedGet(e, token, "/api/v1/subjects")
-	if rec.Code != http.StatusOK {
-		t.Fatalf("expected 200, got %d", rec.Code)
+	rec := authedPost(e, token, "/api/v1/calendar/holidays",
+		`{"name":"Studientag","kind":"non_teaching_day","date_from":"2030-03-18"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
 	}
-	var subjects []map[string]interface{}
-	json.Unmarshal(rec.Body.Bytes(), &subjects)
-	if len(subjects) == 0 {
-		t.Error("expected subjects")
+	var holiday map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &holiday)
+	defer authedDelete(e, token, "/api/v1/calendar/holidays/"+holiday["id"].(string))
+
+	rec = authedGet(e, token, "/api/v1/calendar?from=2030-01-01&to=2030-12-31")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Studientag") {
+		t.Fatalf("expected holiday in calendar, got %d: %s", rec.Code, rec.Body.String())
 	}
-}
 
-func TestListRooms(t *testing.T) {
-	e, _ := testServer(t)
-	token := login(t, e, "admin", "admin123")
+	// The Monday lessons don't take place on the non-teaching day.
+	rec = authedGet(e, token, "/api/v1/timetable/day?date=2030-03-18")
+	var day struct {
+		Holiday *string           `json:"holiday"`
+		Lessons []json.RawMessage `json:"lessons"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &day)
+	if day.Holiday == nil || *day.Holiday != "Studientag" || len(day.Lessons) != 0 {
+		t.Errorf("expected no lessons on Studientag, got %s", rec.Body.String())
+	}
 
-	rec := authedGet(e, token, "/api/v1/rooms")
-	if rec.Code != http.StatusOK {
-		t.Fatalf("expected 200, got %d", rec.Code)
+	rec = authedPost(e, token, "/api/v1/calendar/holidays", `{"name":"x","date_from":"2030-03-18","date_to":"2030-03-01"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for reversed range, got %d", rec.Code)
+	}
+	teacherToken := login(t, e, "lehrer", "teacher123")
+	rec = authedPost(e, teacherToken, "/api/v1/calendar/holidays", `{"name":"x","date_from":"2030-03-18"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for teacher, got %d", rec.Code)
 	}
 }
 
-func TestListTimeSlots(t *testing.T) {
+func TestTimetableDayAndWeek(t *testing.T) {
 	e, _ := testServer(t)
-	token := login(t, e, "admin", "admin123")
+	token := login(t, e, "schueler", "student123")
 
-	rec := authedGet(e, token, "/api/v1/timeslots")
+	rec := authedGet(e, token, "/api/v1/timetable/day?date=2030-03-11&class_id=00000000-0000-0000-0000-000000000100")
 	if rec.Code != http.StatusOK {
-		t.Fatalf("expected 200, got %d", rec.Code)
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
 	}
-	var slots []map[string]interface{}
-	json.Unmarshal(rec.Body.Bytes(), &slots)
-	if len(slots) == 0 {
-		t.Error("expected time slots")
+	var day struct {
+		DayOfWeek int `json:"day_of_week"`
+		Lessons   []struct {
+			Date   string `json:"date"`
+			Status string `json:"status"`
+		} `json:"lessons"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &day)
+	if day.DayOfWeek != 1 || len(day.Lessons) != 4 {
+		t.Fatalf("expected the 4 seeded Monday lessons, got %s", rec.Body.String())
+	}
+	if day.Lessons[0].Date != "2030-03-11" || day.Lessons[0].Status != "regular" {
+		t.Errorf("unexpected lesson %+v", day.Lessons[0])
 	}
-}
 
-// ── Substitutions Tests ─────────────────────────────────────
+	rec = authedGet(e, token, "/api/v1/timetable/week?start=2030-03-13")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var week struct {
+		Start string `json:"start"`
+		Days  []struct {
+			Lessons []json.RawMessage `json:"lessons"`
+		} `json:"days"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &week)
+	if week.Start != "2030-03-11" || len(week.Days) != 7 {
+		t.Fatalf("expected week starting Monday 2030-03-11, got %s", rec.Body.String())
+	}
+	if len(week.Days[0].Lessons) != 4 || len(week.Days[1].Lessons) != 0 {
+		t.Errorf("expected lessons only on Monday, got %d/%d", len(week.Days[0].Lessons), len(week.Days[1].Lessons))
+	}
 
-func TestListSubstitutions(t *testing.T) {
-	e, _ := testServer(t)
-	token := login(t, e, "admin", "admin123")
+	// Before the seeded entries become valid there are no lessons.
+	rec = authedGet(e, token, "/api/v1/timetable/day?date=2025-08-25")
+	json.Unmarshal(rec.Body.Bytes(), &day)
+	if len(day.Lessons) != 0 {
+		t.Errorf("expected no lessons before valid_from, got %d", len(day.Lessons))
+	}
 
-	rec := authedGet(e, token, "/api/v1/substitutions")
-	if rec.Code != http.StatusOK {
-		t.Fatalf("expected 200, got %d", rec.Code)
+	rec = authedGet(e, token, "/api/v1/timetable/day?date=11.03.2030")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid date, got %d", rec.Code)
 	}
 }
 
-// ── Lessons & Appointments ──────────────────────────────────
-
-func TestListLessons(t *testing.T) {
+func TestCourseGroups(t *testing.T) {
 	e, _ := testServer(t)
 	token := login(t, e, "admin", "admin123")
 
-	rec := authedGet(e, token, "/api/v1/lessons")
+	rec := authedPost(e, token, "/api/v1/course-groups",
+		`{"name":"Ethik 10","subject_id":"00000000-0000-0000-0000-000000000201",
+		  "student_ids":["00000000-0000-0000-0000-000000000031"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var group map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &group)
+	groupID := group["id"].(string)
+	defer authedDelete(e, token, "/api/v1/course-groups/"+groupID)
+	if group["member_count"].(float64) != 1 {
+		t.Errorf("expected 1 member, got %v", group["member_count"])
+	}
+
+	// A Tuesday lesson for the group only; the seed has Monday lessons.
+	rec = authedPost(e, token, "/api/v1/timetable", `{"group_id":"`+groupID+`",
+		"subject_id":"00000000-0000-0000-0000-000000000201",
+		"teacher_id":"00000000-0000-0000-0000-000000000021",
+		"room_id":"00000000-0000-0000-0000-000000000301",
+		"time_slot_id":"00000000-0000-0000-0000-000000000400",
+		"day_of_week":2,"valid_from":"2030-01-01","valid_until":"2030-12-31"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for group entry, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var entry map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &entry)
+
+	rec = authedGet(e, token, "/api/v1/attendance/entry/"+entry["id"].(string)+"/roster?date=2030-03-12")
 	if rec.Code != http.StatusOK {
-		t.Fatalf("expected 200, got %d", rec.Code)
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var roster []map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &roster)
+	if len(roster) != 1 || roster[0]["student_id"] != "00000000-0000-0000-0000-000000000031" {
+		t.Errorf("expected the group member in the roster, got %s", rec.Body.String())
+	}
+
+	// The student sees the group lesson in their own timetable.
+	studentToken := login(t, e, "schueler", "student123")
+	rec = authedGet(e, studentToken, "/api/v1/timetable/day?date=2030-03-12")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Ethik 10") {
+		t.Errorf("expected group lesson for student, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = authedPost(e, token, "/api/v1/timetable", `{"subject_id":"00000000-0000-0000-0000-000000000201",
+		"teacher_id":"00000000-0000-0000-0000-000000000021",
+		"time_slot_id":"00000000-0000-0000-0000-000000000401",
+		"day_of_week":2,"valid_from":"2030-01-01"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without class or group, got %d", rec.Code)
+	}
+	if rec := authedPost(e, studentToken, "/api/v1/course-groups", `{"name":"x"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for student, got %d", rec.Code)
 	}
 }
 
-func TestListAppointments(t *testing.T) {
+func TestTimetableBlocksAndEpochs(t *testing.T) {
 	e, _ := testServer(t)
 	token := login(t, e, "admin", "admin123")
 
-	rec := authedGet(e, token, "/api/v1/appointments")
-	if rec.Code != http.StatusOK {
-		t.Fatalf("expected 200, got %d", rec.Code)
+	epochIDs := make([]string, 2)
+	for i, body := range []string{
+		`{"name":"Epoche 1","start_date":"2030-03-01","end_date":"2030-03-15"}`,
+		`{"name":"Epoche 2","start_date":"2030-03-16","end_date":"2030-03-31"}`,
+	} {
+		rec := authedPost(e, token, "/api/v1/timetable/epochs", body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var epoch map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &epoch)
+		epochIDs[i] = epoch["id"].(string)
+		defer authedDelete(e, token, "/api/v1/timetable/epochs/"+epochIDs[i])
 	}
-}
 
-// ── Role-Based Access ───────────────────────────────────────
+	// A Tuesday double period in each epoch: the same teacher and slots don't
+	// conflict because the epochs don't overlap.
+	body := `{"class_id":"00000000-0000-0000-0000-000000000100",
+		"subject_id":"00000000-0000-0000-0000-000000000202",
+		"teacher_id":"00000000-0000-0000-0000-000000000021",
+		"time_slot_id":"00000000-0000-0000-0000-000000000400",
+		"day_of_week":2,"valid_from":"2030-01-01","valid_until":"2030-12-31",%s}`
+	for _, epochID := range epochIDs {
+		rec := authedPost(e, token, "/api/v1/timetable", fmt.Sprintf(body, `"slot_count":2,"epoch_id":"`+epochID+`"`))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var entry map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &entry)
+		defer authedDelete(e, token, "/api/v1/timetable/"+entry["id"].(string))
+	}
 
-func TestStudentCantAccessAttendance(t *testing.T) {
-	e, _ := testServer(t)
-	token := login(t, e, "schueler", "student123")
+	// The second slot of the block is taken.
+	rec := authedPost(e, token, "/api/v1/timetable",
+		strings.Replace(fmt.Sprintf(body, `"slot_count":1`), "0400", "0401", 1))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for the second slot of the block, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = authedPost(e, token, "/api/v1/timetable", fmt.Sprintf(body, `"slot_count":99`))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a block past the last slot, got %d", rec.Code)
+	}
 
-	// Students should still be able to GET their own data via general endpoints
-	rec := authedGet(e, token, "/api/v1/timetable")
-	if rec.Code != http.StatusOK {
-		t.Errorf("student should access timetable, got %d", rec.Code)
+	var day struct {
+		Lessons []struct {
+			SlotCount int    `json:"slot_count"`
+			EpochName string `json:"epoch_name"`
+		} `json:"lessons"`
+	}
+	for date, epoch := range map[string]string{"2030-03-12": "Epoche 1", "2030-03-19": "Epoche 2"} {
+		rec = authedGet(e, token, "/api/v1/timetable/day?date="+date)
+		json.Unmarshal(rec.Body.Bytes(), &day)
+		if len(day.Lessons) != 1 || day.Lessons[0].SlotCount != 2 || day.Lessons[0].EpochName != epoch {
+			t.Errorf("expected one double period of %s on %s, got %s", epoch, date, rec.Body.String())
+		}
+	}
+	rec = authedGet(e, token, "/api/v1/timetable/day?date=2030-04-02")
+	json.Unmarshal(rec.Body.Bytes(), &day)
+	if len(day.Lessons) != 0 {
+		t.Errorf("expected no epoch lessons after the epochs, got %s", rec.Body.String())
+	}
+
+	rec = authedDelete(e, token, "/api/v1/timetable/epochs/"+epochIDs[0])
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 deleting an epoch in use, got %d", rec.Code)
 	}
 }
 
-func TestTeacherCanRecordAttendance(t *testing.T) {
+func TestCalendarFeed(t *testing.T) {
 	e, _ := testServer(t)
-	token := login(t, e, "lehrer", "teacher123")
+	token := login(t, e, "schueler", "student123")
+	defer authedDelete(e, token, "/api/v1/calendar/feed")
 
-	rec := authedGet(e, token, "/api/v1/timetable")
-	if rec.Code != http.StatusOK {
-		t.Errorf("teacher should access timetable, got %d", rec.Code)
+	newFeed := func() string {
+		rec := authedPost(e, token, "/api/v1/calendar/feed", `{}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var feed map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &feed)
+		if feed["token"] == "" || !strings.HasSuffix(feed["path"].(string), ".ics") {
+			t.Fatalf("expected a token and path, got %s", rec.Body.String())
+		}
+		return feed["path"].(string)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
 	}
 
-	rec = authedGet(e, token, "/api/v1/excuses")
+	path := newFeed()
+	rec := get(path)
 	if rec.Code != http.StatusOK {
-		t.Errorf("teacher should list excuses, got %d", rec.Code)
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/calendar") ||
+		!strings.HasPrefix(rec.Body.String(), "BEGIN:VCALENDAR\r\n") {
+		t.Errorf("expected an iCalendar stream, got %s", rec.Body.String())
+	}
+	if rec := get(path + "?weeks=99"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for weeks=99, got %d", rec.Code)
+	}
+	if rec := authedGet(e, token, "/api/v1/calendar/feed"); rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
 	}
-}
 
-// ── CSV Student Import ──────────────────────────────────────
+	// Regenerating revokes the old URL.
+	newPath := newFeed()
+	if rec := get(path); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for the old token, got %d", rec.Code)
+	}
+	if rec := get(newPath); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for the new token, got %d", rec.Code)
+	}
 
-func TestImportStudentsCSV(t *testing.T) {
+	if rec := authedDelete(e, token, "/api/v1/calendar/feed"); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if rec := get(newPath); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after revoking, got %d", rec.Code)
+	}
+	if rec := authedGet(e, token, "/api/v1/calendar/feed"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without a feed, got %d", rec.Code)
+	}
+	if rec := get("/ical/not-a-token.ics"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown token, got %d", rec.Code)
+	}
+}
+
+func TestUntisImport(t *testing.T) {
 	e, _ := testServer(t)
 	token := login(t, e, "admin", "admin123")
 
-	// Use unique suffix to avoid conflicts across test runs
-	suffix := fmt.Sprintf("%d", os.Getpid())
+	abbr := fmt.Sprintf("U%d", os.Getpid())
+	upload := func(dryRun bool, timetable string) map[string]interface{} {
+		t.Helper()
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		w.WriteField("school_year", "2099/00")
+		w.WriteField("valid_from", "2099-08-01")
+		w.WriteField("dry_run", fmt.Sprint(dryRun))
+		for field, content := range map[string]string{
+			"time_grid": "1,08:00,08:45\n2,08:50,09:35\n3,09:50,10:35\n",
+			"gpu006":    `"MA","Mathematik"` + "\n",
+			"gpu003":    fmt.Sprintf(`"%s","Importklasse"`, abbr) + "\n",
+			"gpu004":    fmt.Sprintf(`"%s","Importiert"`, abbr) + "\n",
+			"gpu001":    timetable,
+		} {
+			part, _ := w.CreateFormFile(field, strings.ToUpper(field)+".TXT")
+			io.WriteString(part, content)
+		}
+		w.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/timetable/import/untis", &buf)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var report map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &report)
+		return report
+	}
+	count := func(report map[string]interface{}, kind, change string) int {
+		switch v := report[kind].(map[string]interface{})[change].(type) {
+		case []interface{}:
+			return len(v)
+		case float64:
+			return int(v)
+		}
+		return -1
+	}
 
-	// Build multipart form with CSV
-	csvContent := "username;password;first_name;last_name;email;class_name;date_of_birth\n" +
-		"import_test1_" + suffix + ";pass123;Max;Mustermann;max@test.de;10a;2008-05-15\n" +
-		"import_test2_" + suffix + ";pass123;Erika;Muster;;10a;2008-03-22\n" +
-		"import_test3_" + suffix + ";pass123;Bad;Date;;10a;not-a-date\n"
+	// A double period on Monday, a single period on Tuesday and a line with
+	// an unknown subject.
+	timetable := fmt.Sprintf("1,%[1]q,%[1]q,\"MA\",\"\",1,1,\n1,%[1]q,%[1]q,\"MA\",\"\",1,2,\n"+
+		"2,%[1]q,%[1]q,\"MA\",\"\",2,3,\n3,%[1]q,%[1]q,\"XX\",\"\",3,1,\n", abbr)
+
+	for i := 0; i < 2; i++ {
+		// The dry run stores nothing, so it reports the same twice.
+		report := upload(true, timetable)
+		if count(report, "teachers", "created") != 1 || count(report, "classes", "created") != 1 ||
+			count(report, "subjects", "unchanged") != 1 || count(report, "time_slots", "unchanged") != 3 ||
+			count(report, "lessons", "created") != 2 || len(report["issues"].([]interface{})) != 1 {
+			t.Fatalf("unexpected preview: %v", report)
+		}
+	}
+	upload(false, timetable)
 
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-	part, _ := writer.CreateFormFile("file", "students.csv")
-	io.WriteString(part, csvContent)
-	writer.Close()
+	// Dropping Tuesday ends that entry and keeps the double period.
+	report := upload(false, fmt.Sprintf("1,%[1]q,%[1]q,\"MA\",\"\",1,1,\n1,%[1]q,%[1]q,\"MA\",\"\",1,2,\n", abbr))
+	if count(report, "teachers", "unchanged") != 1 || count(report, "lessons", "unchanged") != 1 ||
+		count(report, "lessons", "ended") != 1 || count(report, "lessons", "created") != 0 {
+		t.Errorf("unexpected second import: %v", report)
+	}
+	if ended := report["lessons"].(map[string]interface{})["ended"].([]interface{}); len(ended) == 1 &&
+		ended[0] != abbr+" Tue 3 MA "+abbr {
+		t.Errorf("unexpected ended entry %v", ended[0])
+	}
 
-	req := httptest.NewRequest(http.MethodPost, "/api/v1/students/import", &buf)
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+	// The imported teacher cannot log in.
 	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(fmt.Sprintf(
+		`{"username":"%s","password":"!","school_id":"00000000-0000-0000-0000-000000000001"}`, strings.ToLower(abbr))))
+	req.Header.Set("Content-Type", "application/json")
 	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an imported teacher, got %d", rec.Code)
+	}
+}
+
+func TestAScImport_DryRun(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
 
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("school_year", "2099/01")
+	w.WriteField("valid_from", "2099-08-01")
+	w.WriteField("dry_run", "true")
+	part, _ := w.CreateFormFile("file", "export.xml")
+	io.WriteString(part, ascExport)
+	w.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/timetable/import/asc", &buf)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
 	if rec.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
 	}
 
-	var result map[string]interface{}
-	json.Unmarshal(rec.Body.Bytes(), &result)
+	var report struct {
+		CourseGroups struct {
+			Created []string `json:"created"`
+		} `json:"course_groups"`
+		Lessons struct {
+			Created []string `json:"created"`
+		} `json:"lessons"`
+		Issues []struct {
+			File string `json:"file"`
+		} `json:"issues"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if len(report.CourseGroups.Created) != 2 || len(report.Lessons.Created) != 4 || len(report.Issues) != 2 {
+		t.Fatalf("unexpected report: %s", rec.Body.String())
+	}
+	found := false
+	for _, l := range report.Lessons.Created {
+		found = found || l == "10a Jungen Tue 2-3 SP SC Halle (A)"
+	}
+	if !found {
+		t.Errorf("expected the A-week sports group lesson, got %v", report.Lessons.Created)
+	}
+}
 
-	imported := int(result["imported"].(float64))
-	if imported != 2 {
-		t.Errorf("expected 2 imported, got %d", imported)
+func TestTimetableDrafts(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+	const class = "00000000-0000-0000-0000-000000000100"
+
+	// A published Sunday lesson the draft will move to another room.
+	lesson := `{"class_id":"` + class + `",
+		"subject_id":"00000000-0000-0000-0000-000000000200",
+		"teacher_id":"00000000-0000-0000-0000-000000000021",
+		"room_id":"00000000-0000-0000-0000-000000000%s",
+		"time_slot_id":"00000000-0000-0000-0000-000000000%s",
+		"day_of_week":7,"valid_from":"2095-01-01"}`
+	rec := authedPost(e, token, "/api/v1/timetable", fmt.Sprintf(lesson, "300", "405"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
 	}
+	var live map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &live)
+	defer authedDelete(e, token, "/api/v1/timetable/"+live["id"].(string))
 
-	errors := result["errors"].([]interface{})
-	if len(errors) != 1 {
-		t.Errorf("expected 1 error (bad date), got %d: %v", len(errors), errors)
+	rec = authedPost(e, token, "/api/v1/timetable/drafts", `{"name":"Test 2095","effective_from":"2095-06-01"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var draft map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &draft)
+	base := "/api/v1/timetable/drafts/" + draft["id"].(string)
+
+	var detail struct {
+		Entries []struct {
+			ID            string `json:"id"`
+			SourceEntryID string `json:"source_entry_id"`
+		} `json:"entries"`
+	}
+	json.Unmarshal(authedGet(e, token, base).Body.Bytes(), &detail)
+	var copied string
+	for _, entry := range detail.Entries {
+		if entry.SourceEntryID == live["id"] {
+			copied = entry.ID
+		}
+	}
+	if copied == "" {
+		t.Fatalf("draft is missing the published lesson: %+v", detail.Entries)
 	}
 
-	// Verify students were actually created
-	rec = authedGet(e, token, "/api/v1/students")
-	var students []map[string]interface{}
-	json.Unmarshal(rec.Body.Bytes(), &students)
+	// Students don't see drafts.
+	studentToken := login(t, e, "schueler", "student123")
+	if rec := authedGet(e, studentToken, base); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a student, got %d", rec.Code)
+	}
 
-	found := 0
-	for _, s := range students {
-		if s["username"] == "import_test1_"+suffix || s["username"] == "import_test2_"+suffix {
-			found++
-		}
+	if rec := authedPut(e, token, base+"/entries/"+copied, fmt.Sprintf(lesson, "301", "405")); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
 	}
-	if found != 2 {
-		t.Errorf("expected to find 2 imported students, found %d", found)
+	if rec := authedPost(e, token, base+"/entries", fmt.Sprintf(lesson, "300", "404")); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
 	}
-}
+	// Same teacher and class in the same slot.
+	rec = authedPost(e, token, base+"/entries", fmt.Sprintf(lesson, "301", "404"))
+	var double map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &double)
 
-func TestImportStudentsCSV_StudentCantAccess(t *testing.T) {
-	e, _ := testServer(t)
-	token := login(t, e, "schueler", "student123")
+	if rec := authedPost(e, token, base+"/publish", `{}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a draft with conflicts, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := authedDelete(e, token, base+"/entries/"+double["id"].(string)); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
 
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-	part, _ := writer.CreateFormFile("file", "students.csv")
-	io.WriteString(part, "username;password;first_name;last_name;date_of_birth\n")
-	writer.Close()
+	rec = authedGet(e, token, base+"/diff")
+	var diff struct {
+		Added   []map[string]interface{} `json:"added"`
+		Removed []map[string]interface{} `json:"removed"`
+		Changed []struct {
+			Before map[string]interface{} `json:"before"`
+			After  map[string]interface{} `json:"after"`
+		} `json:"changed"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &diff)
+	if len(diff.Added) != 1 || len(diff.Removed) != 0 || len(diff.Changed) != 1 ||
+		diff.Changed[0].Before["room_name"] != "A101" || diff.Changed[0].After["room_name"] != "B204" {
+		t.Fatalf("unexpected diff: %s", rec.Body.String())
+	}
 
-	req := httptest.NewRequest(http.MethodPost, "/api/v1/students/import", &buf)
-	req.Header.Set("Authorization", "Bearer "+token)
+	if rec := authedPost(e, token, base+"/publish", `{"effective_from":"2000-01-03"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a past date, got %d", rec.Code)
+	}
+	rec = authedPost(e, token, base+"/publish", `{"force":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if result["added"] != 1.0 || result["changed"] != 1.0 || result["removed"] != 0.0 {
+		t.Errorf("unexpected result: %v", result)
+	}
+
+	// The old plan stays queryable before the effective date.
+	sunday := func(date string) []map[string]interface{} {
+		var entries, out []map[string]interface{}
+		json.Unmarshal(authedGet(e, token, "/api/v1/timetable?class_id="+class+"&date="+date).Body.Bytes(), &entries)
+		for _, entry := range entries {
+			if entry["day_of_week"] == 7.0 {
+				out = append(out, entry)
+			}
+		}
+		return out
+	}
+	if before := sunday("2095-05-31"); len(before) != 1 || before[0]["room_name"] != "A101" {
+		t.Errorf("unexpected plan before publishing: %v", before)
+	}
+	after := sunday("2095-06-01")
+	for _, entry := range after {
+		if entry["id"] != live["id"] {
+			defer authedDelete(e, token, "/api/v1/timetable/"+entry["id"].(string))
+		}
+	}
+	if len(after) != 2 || after[1]["room_name"] != "B204" {
+		t.Errorf("unexpected plan after publishing: %v", after)
+	}
+
+	if rec := authedDelete(e, token, base); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 deleting a published draft, got %d", rec.Code)
+	}
+}
+
+func TestTimetableDrafts_OutdatedBase(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+
+	lesson := `{"class_id":"00000000-0000-0000-0000-000000000100",
+		"subject_id":"00000000-0000-0000-0000-000000000200",
+		"teacher_id":"00000000-0000-0000-0000-000000000021",
+		"room_id":"00000000-0000-0000-0000-000000000%s",
+		"time_slot_id":"00000000-0000-0000-0000-000000000405",
+		"day_of_week":7,"valid_from":"2097-01-01"}`
+	rec := authedPost(e, token, "/api/v1/timetable", fmt.Sprintf(lesson, "300"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var live map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &live)
+	defer authedDelete(e, token, "/api/v1/timetable/"+live["id"].(string))
+
+	rec = authedPost(e, token, "/api/v1/timetable/drafts", `{"name":"Test 2097","effective_from":"2097-06-01"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var draft map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &draft)
+	base := "/api/v1/timetable/drafts/" + draft["id"].(string)
+	defer authedDelete(e, token, base)
+
+	// The published lesson moves after the draft was taken.
+	if rec := authedPut(e, token, "/api/v1/timetable/"+live["id"].(string), fmt.Sprintf(lesson, "301")); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = authedPost(e, token, base+"/publish", `{}`)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "changed since the draft") {
+		t.Fatalf("expected 409 for an outdated draft, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestTimetableDrafts_RemoveLaterLesson(t *testing.T) {
+	e, cfg := testServer(t)
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	defer db.Close()
+	token := login(t, e, "admin", "admin123")
+
+	lesson := `{"class_id":"00000000-0000-0000-0000-000000000100",
+		"subject_id":"00000000-0000-0000-0000-000000000200",
+		"teacher_id":"00000000-0000-0000-0000-000000000021",
+		"time_slot_id":"00000000-0000-0000-0000-000000000405",
+		"day_of_week":7,"valid_from":"2098-09-01"%s}`
+	if rec := authedPost(e, token, "/api/v1/timetable", fmt.Sprintf(lesson, `,"valid_until":"2098-08-31"`)); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for valid_until before valid_from, got %d", rec.Code)
+	}
+	rec := authedPost(e, token, "/api/v1/timetable", fmt.Sprintf(lesson, ""))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var live map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &live)
+	defer authedDelete(e, token, "/api/v1/timetable/"+live["id"].(string))
+
+	// A draft from before the lesson starts drops it.
+	rec = authedPost(e, token, "/api/v1/timetable/drafts", `{"name":"Test 2098","effective_from":"2098-06-01"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var draft map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &draft)
+	base := "/api/v1/timetable/drafts/" + draft["id"].(string)
+	var detail struct {
+		Entries []struct {
+			ID            string `json:"id"`
+			SourceEntryID string `json:"source_entry_id"`
+		} `json:"entries"`
+	}
+	json.Unmarshal(authedGet(e, token, base).Body.Bytes(), &detail)
+	for _, entry := range detail.Entries {
+		if entry.SourceEntryID == live["id"] {
+			authedDelete(e, token, base+"/entries/"+entry.ID)
+		}
+	}
+	rec = authedPost(e, token, base+"/publish", `{}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var exists bool
+	db.QueryRow(context.Background(), `SELECT EXISTS(SELECT 1 FROM timetable_entries WHERE id = $1)`,
+		live["id"]).Scan(&exists)
+	if exists {
+		t.Error("expected the lesson that had not started yet to be deleted")
+	}
+}
+
+func TestTimetableSolver(t *testing.T) {
+	e, cfg := testServer(t)
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	defer db.Close()
+	token := login(t, e, "admin", "admin123")
+	const class = "00000000-0000-0000-0000-000000000100"
+
+	if rec := authedPost(e, token, "/api/v1/timetable/solver/runs", `{"name":"Leer","effective_from":"2096-08-01"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without assignments, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := authedPut(e, token, "/api/v1/timetable/solver/assignments", `[
+		{"class_id":"`+class+`","subject_id":"00000000-0000-0000-0000-000000000200",
+		 "teacher_id":"00000000-0000-0000-0000-000000000021","periods_per_week":4,"double_periods":1},
+		{"class_id":"`+class+`","subject_id":"00000000-0000-0000-0000-000000000201",
+		 "teacher_id":"00000000-0000-0000-0000-000000000021","periods_per_week":3,
+		 "room_ids":["00000000-0000-0000-0000-000000000301"]}]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	defer authedPut(e, token, "/api/v1/timetable/solver/assignments", `[]`)
+	if rec := authedPut(e, token, "/api/v1/timetable/solver/assignments",
+		`[{"class_id":"`+class+`","subject_id":"00000000-0000-0000-0000-000000000200","teacher_id":"00000000-0000-0000-0000-000000000021","periods_per_week":1,"double_periods":1}]`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a double period longer than the week, got %d", rec.Code)
+	}
+
+	// The teacher has Fridays off.
+	if rec := authedPut(e, token, "/api/v1/timetable/solver/unavailability",
+		`[{"teacher_id":"00000000-0000-0000-0000-000000000021","day_of_week":5}]`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	defer authedPut(e, token, "/api/v1/timetable/solver/unavailability", `[]`)
+
+	rec = authedPost(e, token, "/api/v1/timetable/solver/runs", `{"name":"Solver 2096","effective_from":"2096-08-01"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var run map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &run)
+	if run["status"] != "queued" {
+		t.Errorf("expected a queued run, got %v", run["status"])
+	}
+
+	if err := jobs.NewTimetableSolver(db).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(authedGet(e, token, "/api/v1/timetable/solver/runs/"+run["id"].(string)).Body.Bytes(), &run)
+	if run["status"] != "done" || run["draft_id"] == nil {
+		t.Fatalf("expected a finished run with a draft, got %+v", run)
+	}
+	base := "/api/v1/timetable/drafts/" + run["draft_id"].(string)
+	defer authedDelete(e, token, base)
+
+	var detail struct {
+		Entries []struct {
+			ClassID   string `json:"class_id"`
+			SubjectID string `json:"subject_id"`
+			RoomID    string `json:"room_id"`
+			DayOfWeek int    `json:"day_of_week"`
+			SlotCount int    `json:"slot_count"`
+		} `json:"entries"`
+	}
+	json.Unmarshal(authedGet(e, token, base).Body.Bytes(), &detail)
+	periods := map[string]int{}
+	for _, entry := range detail.Entries {
+		if entry.ClassID != class {
+			continue
+		}
+		periods[entry.SubjectID] += entry.SlotCount
+		if entry.DayOfWeek == 5 {
+			t.Errorf("lesson scheduled on the teacher's day off: %+v", entry)
+		}
+		if entry.SubjectID == "00000000-0000-0000-0000-000000000201" && entry.RoomID != "00000000-0000-0000-0000-000000000301" {
+			t.Errorf("German lesson outside the requested room: %+v", entry)
+		}
+	}
+	if periods["00000000-0000-0000-0000-000000000200"] != 4 || periods["00000000-0000-0000-0000-000000000201"] != 3 || len(periods) != 2 {
+		t.Errorf("unexpected lessons for 10a: %v", periods)
+	}
+
+	studentToken := login(t, e, "schueler", "student123")
+	if rec := authedGet(e, studentToken, "/api/v1/timetable/solver/runs"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a student, got %d", rec.Code)
+	}
+}
+
+// ── Excuses Tests ───────────────────────────────────────────
+
+func TestListExcuses(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+
+	rec := authedGet(e, token, "/api/v1/excuses")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestExcusePDF(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+
+	// Get an excuse
+	rec := authedGet(e, token, "/api/v1/excuses")
+	var excuses []map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &excuses)
+	if len(excuses) == 0 {
+		t.Skip("no excuses in test db")
+	}
+	excuseID := excuses[0]["id"].(string)
+
+	rec = authedGet(e, token, "/api/v1/excuses/"+excuseID+"/pdf")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.HasPrefix(rec.Body.String(), "%PDF") {
+		t.Error("expected PDF content")
+	}
+}
+
+func TestTeacherCreatesPaperExcuse(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "lehrer", "teacher123")
+
+	body := `{"student_id":"00000000-0000-0000-0000-000000000031","date_from":"2030-01-07","date_to":"2030-01-08","submission_type":"digital"}`
+	rec := authedPost(e, token, "/api/v1/excuses", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var excuse map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &excuse)
+	if excuse["submission_type"] != "paper" {
+		t.Errorf("expected paper submission, got %v", excuse["submission_type"])
+	}
+	if excuse["paper_received_at"] == nil {
+		t.Error("expected paper_received_at to be set")
+	}
+}
+
+func TestExcuseAttachments(t *testing.T) {
+	e, cfg := testServer(t)
+	token := login(t, e, "schueler", "student123")
+
+	rec := authedPost(e, token, "/api/v1/excuses", `{"date_from":"2030-02-04","date_to":"2030-02-04","submission_type":"digital"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var excuse map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &excuse)
+	path := "/api/v1/excuses/" + excuse["id"].(string) + "/attachments"
+
+	content := "%PDF-1.4\n% attachment test " + fmt.Sprint(os.Getpid()) + "\n%%EOF\n"
+	first := authedUpload(e, token, path, "attest.pdf", content)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", first.Code, first.Body.String())
+	}
+	second := authedUpload(e, token, path, "attest-copy.pdf", content)
+	third := authedUpload(e, token, path, "form.pdf", content+"%signed\n")
+	if second.Code != http.StatusCreated || third.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d / %d", second.Code, third.Code)
+	}
+
+	var a1, a2 map[string]interface{}
+	json.Unmarshal(first.Body.Bytes(), &a1)
+	json.Unmarshal(second.Body.Bytes(), &a2)
+	if a1["id"] != a2["id"] {
+		t.Error("expected identical content to map to the same attachment")
+	}
+	sum := a1["sha256"].(string)
+	if _, err := os.Stat(filepath.Join(cfg.UploadDir, filepath.FromSlash(storage.Key(sum)))); err != nil {
+		t.Errorf("expected content-addressed blob on disk: %v", err)
+	}
+
+	rec = authedGet(e, token, path)
+	var list []map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list) != 2 {
+		t.Errorf("expected 2 attachments, got %d", len(list))
+	}
+}
+
+func TestExcuseAttachmentDownload(t *testing.T) {
+	e, _ := testServer(t)
+	studentToken := login(t, e, "schueler", "student123")
+
+	rec := authedPost(e, studentToken, "/api/v1/excuses", `{"date_from":"2030-02-11","date_to":"2030-02-11","submission_type":"digital"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var excuse map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &excuse)
+	base := "/api/v1/excuses/" + excuse["id"].(string) + "/attachments"
+
+	content := "%PDF-1.4\n% download test " + fmt.Sprint(time.Now().UnixNano()) + "\n%%EOF\n"
+	rec = authedUpload(e, studentToken, base, "attest.pdf", content)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var attachment map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &attachment)
+	path := base + "/" + attachment["id"].(string)
+
+	// The student and the class teacher may read the file.
+	for _, user := range [][2]string{{"schueler", "student123"}, {"lehrer", "teacher123"}} {
+		rec = authedGet(e, login(t, e, user[0], user[1]), path)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", user[0], rec.Code, rec.Body.String())
+		}
+		if rec.Body.String() != content {
+			t.Errorf("%s: unexpected content", user[0])
+		}
+		if rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("%s: expected nosniff header", user[0])
+		}
+	}
+
+	rec = authedPost(e, studentToken, path+"/link", `{}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var link map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &link)
+
+	// Signed URLs work without a token but not when tampered with.
+	req := httptest.NewRequest(http.MethodGet, link["url"].(string), nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != content {
+		t.Errorf("expected signed download, got %d", rec.Code)
+	}
+	req = httptest.NewRequest(http.MethodGet, link["url"].(string)+"0", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for tampered link, got %d", rec.Code)
+	}
+}
+
+func TestExcuseAttachmentAccess(t *testing.T) {
+	e, cfg := testServer(t)
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	// A teacher who neither teaches the class nor decided the excuse.
+	hash, _ := bcrypt.GenerateFromPassword([]byte("other123"), bcrypt.MinCost)
+	const user = "00000000-0000-0000-0000-0000000000a1"
+	if _, err := db.Exec(ctx,
+		`INSERT INTO users (id, school_id, username, password_hash, role, first_name, last_name)
+		 VALUES ($1, '00000000-0000-0000-0000-000000000001', 'fremd', $2, 'teacher', 'Frank', 'Fremd')`,
+		user, string(hash)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(ctx, `DELETE FROM users WHERE id = $1`, user)
+	other := login(t, e, "fremd", "other123")
+
+	studentToken := login(t, e, "schueler", "student123")
+	rec := authedPost(e, studentToken, "/api/v1/excuses", `{"date_from":"2030-02-18","date_to":"2030-02-18","submission_type":"digital"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var excuse map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &excuse)
+	base := "/api/v1/excuses/" + excuse["id"].(string) + "/attachments"
+
+	content := "%PDF-1.4\n% access test " + fmt.Sprint(time.Now().UnixNano()) + "\n%%EOF\n"
+	if rec := authedUpload(e, other, base, "attest.pdf", content); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another teacher's upload, got %d", rec.Code)
+	}
+	rec = authedUpload(e, studentToken, base, "attest.pdf", content)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var attachment map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &attachment)
+	path := base + "/" + attachment["id"].(string)
+	if rec := authedDelete(e, other, path); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another teacher's delete, got %d", rec.Code)
+	}
+
+	// Once approved, the class teacher can't remove the evidence.
+	teacherToken := login(t, e, "lehrer", "teacher123")
+	if rec := authedPatch(e, teacherToken, "/api/v1/excuses/"+excuse["id"].(string)+"/approve", `{}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := authedDelete(e, teacherToken, path); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a decided excuse, got %d", rec.Code)
+	}
+}
+
+func TestEncryptedExcuse(t *testing.T) {
+	ring, err := encryption.ParseKeyring(testMasterKey("test", 7), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryption.SetDefault(ring)
+	t.Cleanup(func() { encryption.SetDefault(&encryption.Keyring{}) })
+
+	e, cfg := testServer(t)
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	defer db.Close()
+	studentToken := login(t, e, "schueler", "student123")
+
+	rec := authedPost(e, studentToken, "/api/v1/excuses",
+		`{"date_from":"2030-02-12","date_to":"2030-02-12","submission_type":"digital","reason":"Migräne"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var excuse map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &excuse)
+	id := excuse["id"].(string)
+
+	var stored string
+	if err := db.QueryRow(context.Background(), `SELECT reason FROM excuses WHERE id = $1`, id).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, "enc:v1:") || strings.Contains(stored, "Migräne") {
+		t.Errorf("expected encrypted reason in database, got %q", stored)
+	}
+	rec = authedGet(e, studentToken, "/api/v1/excuses/"+id)
+	json.Unmarshal(rec.Body.Bytes(), &excuse)
+	if excuse["reason"] != "Migräne" {
+		t.Errorf("expected decrypted reason, got %v", excuse["reason"])
+	}
+
+	content := "%PDF-1.4\n% encrypted " + fmt.Sprint(time.Now().UnixNano()) + "\n%%EOF\n"
+	rec = authedUpload(e, studentToken, "/api/v1/excuses/"+id+"/attachments", "attest.pdf", content)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var attachment map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &attachment)
+
+	var key string
+	db.QueryRow(context.Background(), `SELECT storage_key FROM excuse_attachments WHERE id = $1`, attachment["id"]).Scan(&key)
+	raw, err := os.ReadFile(filepath.Join(cfg.UploadDir, filepath.FromSlash(key)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := encryption.BlobKeyID(raw); !ok || bytes.Contains(raw, []byte("encrypted")) {
+		t.Error("expected encrypted blob on disk")
+	}
+	rec = authedGet(e, studentToken, "/api/v1/excuses/"+id+"/attachments/"+attachment["id"].(string))
+	if rec.Code != http.StatusOK || rec.Body.String() != content {
+		t.Errorf("expected decrypted download, got %d", rec.Code)
+	}
+}
+
+func TestBulkExcuses(t *testing.T) {
+	e, _ := testServer(t)
+	studentToken := login(t, e, "schueler", "student123")
+	teacherToken := login(t, e, "lehrer", "teacher123")
+
+	rec := authedPost(e, studentToken, "/api/v1/excuses",
+		`{"date_from":"2030-01-14","date_to":"2030-01-14","submission_type":"paper"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var excuse map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &excuse)
+
+	body := fmt.Sprintf(`{"action":"paper_received","ids":["%s","00000000-0000-0000-0000-00000000dead"]}`, excuse["id"])
+	rec = authedPost(e, teacherToken, "/api/v1/excuses/bulk", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if result["succeeded"].(float64) != 1 || result["failed"].(float64) != 1 {
+		t.Errorf("expected 1 succeeded and 1 failed, got %v", result)
+	}
+
+	rec = authedPost(e, studentToken, "/api/v1/excuses/bulk", body)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for student, got %d", rec.Code)
+	}
+}
+
+// ── Leave Requests Tests ────────────────────────────────────
+
+func TestLeaveRequest_ClassTeacherApproves(t *testing.T) {
+	e, _ := testServer(t)
+	studentToken := login(t, e, "schueler", "student123")
+	teacherToken := login(t, e, "lehrer", "teacher123")
+
+	// Monday in the far future so the seed timetable (Mon, 4 lessons) applies.
+	body := `{"date_from":"2030-03-04","date_to":"2030-03-04","slot_from":2,"reason":"Wettkampf"}`
+	rec := authedPost(e, studentToken, "/api/v1/leave-requests", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var leave map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &leave)
+	if leave["approval_level"] != "class_teacher" {
+		t.Errorf("expected class_teacher approval for one day, got %v", leave["approval_level"])
+	}
+
+	rec = authedPatch(e, teacherToken, "/api/v1/leave-requests/"+leave["id"].(string)+"/approve", `{}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var approved map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &approved)
+	if approved["status"] != "approved" {
+		t.Errorf("expected approved, got %v", approved["status"])
+	}
+	// Lessons 2–4 of the seeded Monday timetable.
+	if n := int(approved["prefilled_lessons"].(float64)); n != 3 {
+		t.Errorf("expected 3 prefilled lessons, got %d", n)
+	}
+
+	// A second decision is a conflict.
+	rec = authedPatch(e, teacherToken, "/api/v1/leave-requests/"+leave["id"].(string)+"/reject", `{}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for decided request, got %d", rec.Code)
+	}
+}
+
+func TestLeaveRequest_PrefillKeepsRecordedAttendance(t *testing.T) {
+	e, cfg := testServer(t)
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	studentToken := login(t, e, "schueler", "student123")
+	teacherToken := login(t, e, "lehrer", "teacher123")
+	const student, monday = "00000000-0000-0000-0000-000000000031", "2030-03-11" // an A week
+	defer db.Exec(ctx, `DELETE FROM attendance WHERE student_id = $1 AND date = $2`, student, monday)
+
+	// A B-week lesson doesn't take place that Monday.
+	var bWeek string
+	if err := db.QueryRow(ctx,
+		`INSERT INTO timetable_entries (school_id, class_id, subject_id, teacher_id, time_slot_id, day_of_week, week_type, valid_from)
+		 VALUES ('00000000-0000-0000-0000-000000000001', '00000000-0000-0000-0000-000000000100',
+		         '00000000-0000-0000-0000-000000000200', '00000000-0000-0000-0000-000000000021',
+		         '00000000-0000-0000-0000-000000000403', 1, 'B', '2030-01-01')
+		 RETURNING id`).Scan(&bWeek); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(ctx, `DELETE FROM timetable_entries WHERE id = $1`, bWeek)
+
+	// The student was present in the first period.
+	var first string
+	if err := db.QueryRow(ctx,
+		`SELECT id FROM timetable_entries WHERE class_id = '00000000-0000-0000-0000-000000000100'
+		 AND time_slot_id = '00000000-0000-0000-0000-000000000400' AND day_of_week = 1 AND week_type = 'all'`).Scan(&first); err != nil {
+		t.Fatal(err)
+	}
+	rec := authedPost(e, teacherToken, "/api/v1/attendance",
+		`{"student_id":"`+student+`","timetable_entry_id":"`+first+`","date":"`+monday+`","status":"present"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = authedPost(e, studentToken, "/api/v1/leave-requests", `{"date_from":"`+monday+`","date_to":"`+monday+`","reason":"Arzttermin"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var leave map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &leave)
+	rec = authedPatch(e, teacherToken, "/api/v1/leave-requests/"+leave["id"].(string)+"/approve", `{}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	json.Unmarshal(rec.Body.Bytes(), &leave)
+	if leave["prefilled_lessons"] != float64(3) {
+		t.Errorf("expected 3 prefilled lessons, got %v", leave["prefilled_lessons"])
+	}
+	var status string
+	db.QueryRow(ctx, `SELECT status FROM attendance WHERE student_id = $1 AND timetable_entry_id = $2 AND date = $3`,
+		student, first, monday).Scan(&status)
+	if status != "present" {
+		t.Errorf("expected recorded attendance to stay present, got %q", status)
+	}
+}
+
+func TestLeaveRequest_LongLeaveNeedsHead(t *testing.T) {
+	e, _ := testServer(t)
+	studentToken := login(t, e, "schueler", "student123")
+	teacherToken := login(t, e, "lehrer", "teacher123")
+
+	body := `{"date_from":"2030-04-01","date_to":"2030-04-12","reason":"Familienfeier im Ausland"}`
+	rec := authedPost(e, studentToken, "/api/v1/leave-requests", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var leave map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &leave)
+	if leave["approval_level"] != "head" {
+		t.Fatalf("expected head approval for two weeks, got %v", leave["approval_level"])
+	}
+
+	rec = authedPatch(e, teacherToken, "/api/v1/leave-requests/"+leave["id"].(string)+"/approve", `{}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for class teacher on head-level request, got %d", rec.Code)
+	}
+}
+
+func TestLeaveRequest_UnknownStudent(t *testing.T) {
+	e, _ := testServer(t)
+	teacherToken := login(t, e, "lehrer", "teacher123")
+
+	body := `{"student_id":"00000000-0000-0000-0000-00000000dead","date_from":"2030-03-04","date_to":"2030-03-04","reason":"Wettkampf"}`
+	rec := authedPost(e, teacherToken, "/api/v1/leave-requests", body)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a student of another school, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStudentGuardians(t *testing.T) {
+	e, _ := testServer(t)
+	adminToken := login(t, e, "admin", "admin123")
+	studentPath := "/api/v1/students/00000000-0000-0000-0000-000000000031"
+
+	rec := authedGet(e, adminToken, studentPath+"/guardians")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The admin is not a guardian account.
+	adminID := "00000000-0000-0000-0000-000000000010"
+	rec = authedPost(e, adminToken, studentPath+"/guardians", `{"user_id":"`+adminID+`"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for non-guardian user, got %d", rec.Code)
+	}
+
+	studentToken := login(t, e, "schueler", "student123")
+	rec = authedPost(e, studentToken, studentPath+"/guardians", `{"user_id":"`+adminID+`"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for student, got %d", rec.Code)
+	}
+}
+
+func TestStudentAbsences_StatusFilter(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+
+	rec := authedGet(e, token, "/api/v1/students/00000000-0000-0000-0000-000000000031/absences?status=unexcused")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var list []map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	for _, a := range list {
+		if a["status"] != "unexcused" {
+			t.Errorf("expected only unexcused absences, got %v", a["status"])
+		}
+	}
+}
+
+// ── Reference Data Tests ────────────────────────────────────
+
+func TestRetentionPreview(t *testing.T) {
+	e, cfg := testServer(t)
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	defer db.Close()
+	adminToken := login(t, e, "admin", "admin123")
+	teacherToken := login(t, e, "lehrer", "teacher123")
+
+	// An excuse from long ago is reported but not deleted by the preview.
+	rec := authedPost(e, teacherToken, "/api/v1/excuses",
+		`{"student_id":"00000000-0000-0000-0000-000000000031","date_from":"2019-03-04","date_to":"2019-03-04","submission_type":"paper"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var excuse map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &excuse)
+	// A legacy upload counts as a file of the excuse.
+	if _, err := db.Exec(context.Background(),
+		`UPDATE excuses SET file_path = 'legacy/retention-preview.pdf' WHERE id = $1`, excuse["id"]); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = authedGet(e, adminToken, "/api/v1/school/retention/preview")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var report struct {
+		DryRun bool `json:"dry_run"`
+		Items  []struct {
+			Entity string `json:"entity"`
+			Rows   int    `json:"rows"`
+			Files  int    `json:"files"`
+		} `json:"items"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if !report.DryRun {
+		t.Error("expected dry_run report")
+	}
+	found := false
+	for _, item := range report.Items {
+		found = found || (item.Entity == "excuses" && item.Rows >= 1 && item.Files >= 1)
+	}
+	if !found {
+		t.Errorf("expected expired excuses in preview: %s", rec.Body.String())
+	}
+
+	if rec := authedGet(e, adminToken, "/api/v1/excuses/"+excuse["id"].(string)); rec.Code != http.StatusOK {
+		t.Errorf("preview must not delete, got %d", rec.Code)
+	}
+	if rec := authedGet(e, teacherToken, "/api/v1/school/retention/preview"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for teacher, got %d", rec.Code)
+	}
+}
+
+func TestListSubjects(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+
+	rec := authedGet(e, token, "/api/v1/subjects")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var subjects []map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &subjects)
+	if len(subjects) == 0 {
+		t.Error("expected subjects")
+	}
+}
+
+func TestListRooms(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+
+	rec := authedGet(e, token, "/api/v1/rooms")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestListTimeSlots(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+
+	rec := authedGet(e, token, "/api/v1/timeslots")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var slots []map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &slots)
+	if len(slots) == 0 {
+		t.Error("expected time slots")
+	}
+}
+
+// ── Substitutions Tests ─────────────────────────────────────
+
+func TestListSubstitutions(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+
+	rec := authedGet(e, token, "/api/v1/substitutions")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestSubstitutionValidation(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+	const monday, tuesday = "2031-03-10", "2031-03-11"
+
+	// The seed's Monday lessons of 10a, all given by MUS.
+	var entries []struct {
+		ID         string `json:"id"`
+		TimeSlotID string `json:"time_slot_id"`
+		DayOfWeek  int    `json:"day_of_week"`
+	}
+	json.Unmarshal(authedGet(e, token, "/api/v1/timetable?class_id=00000000-0000-0000-0000-000000000100").Body.Bytes(), &entries)
+	lesson := map[string]string{}
+	for _, entry := range entries {
+		if entry.DayOfWeek == 1 {
+			lesson[entry.TimeSlotID[len(entry.TimeSlotID)-3:]] = entry.ID
+		}
+	}
+	if lesson["400"] == "" || lesson["402"] == "" {
+		t.Fatalf("seed lessons not found: %+v", entries)
+	}
+
+	// MUS also teaches on Tuesdays in the third period, in A101.
+	rec := authedPost(e, token, "/api/v1/timetable", `{"class_id":"00000000-0000-0000-0000-000000000100",
+		"subject_id":"00000000-0000-0000-0000-000000000202",
+		"teacher_id":"00000000-0000-0000-0000-000000000021",
+		"room_id":"00000000-0000-0000-0000-000000000300",
+		"time_slot_id":"00000000-0000-0000-0000-000000000402",
+		"day_of_week":2,"valid_from":"2031-01-01"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var tue map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &tue)
+	defer authedDelete(e, token, "/api/v1/timetable/"+tue["id"].(string))
+
+	sub := func(entry, date, typ, extra string) string {
+		return `{"timetable_entry_id":"` + entry + `","date":"` + date + `","type":"` + typ + `"` + extra + `}`
+	}
+	const roomB204 = `,"substitute_room_id":"00000000-0000-0000-0000-000000000301"`
+	for name, body := range map[string]string{
+		"cancellation with teacher":    sub(lesson["400"], monday, "cancellation", `,"substitute_teacher_id":"00000000-0000-0000-0000-000000000021"`),
+		"room change without room":     sub(lesson["400"], monday, "room_change", ""),
+		"substitution without teacher": sub(lesson["400"], monday, "substitution", ""),
+		"unknown type":                 sub(lesson["400"], monday, "holiday", ""),
+		"wrong weekday":                sub(lesson["400"], tuesday, "room_change", roomB204),
+		"extra lesson on its day":      sub(lesson["400"], monday, "extra_lesson", ""),
+	} {
+		if rec := authedPost(e, token, "/api/v1/substitutions", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", name, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec = authedPost(e, token, "/api/v1/substitutions", sub(lesson["400"], monday, "room_change", roomB204))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var roomChange map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &roomChange)
+	defer authedDelete(e, token, "/api/v1/substitutions/"+roomChange["id"].(string))
+	if rec := authedPost(e, token, "/api/v1/substitutions", sub(lesson["400"], monday, "cancellation", "")); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a second substitution of the lesson, got %d", rec.Code)
+	}
+	if rec := authedPut(e, token, "/api/v1/substitutions/"+roomChange["id"].(string), sub(lesson["400"], monday, "cancellation", "")); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 updating the lesson's own substitution, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// An extra German lesson on Tuesday collides with MUS's Tuesday lesson.
+	extra := sub(lesson["402"], tuesday, "extra_lesson", "")
+	rec = authedPost(e, token, "/api/v1/substitutions", extra)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), `"teacher"`) {
+		t.Fatalf("expected a teacher conflict, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = authedPost(e, token, "/api/v1/substitutions", strings.TrimSuffix(extra, "}")+`,"force":true}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 with force, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var forced map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &forced)
+	defer authedDelete(e, token, "/api/v1/substitutions/"+forced["id"].(string))
+
+	// The extra lesson now holds B204 at that time.
+	rec = authedPost(e, token, "/api/v1/substitutions", sub(tue["id"].(string), tuesday, "room_change", roomB204))
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), `"room"`) {
+		t.Errorf("expected a room conflict, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := authedPut(e, token, "/api/v1/substitutions/00000000-0000-0000-0000-000000000999", sub(lesson["400"], monday, "cancellation", "")); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestTeacherAbsence_Substitutes(t *testing.T) {
+	e, cfg := testServer(t)
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	token := login(t, e, "admin", "admin123")
+	const school = "00000000-0000-0000-0000-000000000001"
+
+	// A second teacher who teaches 10a in the first period in March 2031.
+	const user, teacher = "00000000-0000-0000-0000-000000000022", "00000000-0000-0000-0000-000000000023"
+	if _, err := db.Exec(ctx,
+		`INSERT INTO users (id, school_id, username, password_hash, role, first_name, last_name)
+		 VALUES ($1, $2, 'vertretung', '', 'teacher', 'Vera', 'Vertretung')`, user, school); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(ctx, `DELETE FROM users WHERE id = $1`, user)
+	if _, err := db.Exec(ctx,
+		`INSERT INTO teachers (id, user_id, school_id, abbreviation) VALUES ($1, $2, $3, 'VER')`,
+		teacher, user, school); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(ctx, `DELETE FROM teachers WHERE id = $1`, teacher)
+	if _, err := db.Exec(ctx,
+		`INSERT INTO timetable_entries (school_id, class_id, subject_id, teacher_id, time_slot_id, day_of_week, valid_from, valid_until)
+		 VALUES ($1, '00000000-0000-0000-0000-000000000100', '00000000-0000-0000-0000-000000000202', $2,
+		         '00000000-0000-0000-0000-000000000400', 1, '2031-03-01', '2031-03-31')`, school, teacher); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(ctx, `DELETE FROM timetable_entries WHERE teacher_id = $1`, teacher)
+
+	// MUS is ill on Monday, 2031-03-10, and has four lessons that day.
+	absences := "/api/v1/teachers/00000000-0000-0000-0000-000000000021/absences"
+	rec := authedPost(e, token, absences, `{"date_from":"2031-03-10","date_to":"2031-03-10"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var absence struct {
+		ID            string `json:"id"`
+		Substitutions []struct {
+			ID               string `json:"id"`
+			TeacherAbsenceID string `json:"teacher_absence_id"`
+		} `json:"substitutions"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &absence)
+	defer authedDelete(e, token, absences+"/"+absence.ID)
+	if len(absence.Substitutions) != 4 || absence.Substitutions[0].TeacherAbsenceID != absence.ID {
+		t.Fatalf("expected 4 substitutions for the absence, got %s", rec.Body.String())
+	}
+	if rec := authedPost(e, token, absences, `{"date_from":"2031-03-09","date_to":"2031-03-12"}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for an overlapping absence, got %d", rec.Code)
+	}
+
+	// VER is busy in the first period; for the others VER is the only
+	// candidate and known to the class.
+	var confirm []string
+	busy := 0
+	for _, sub := range absence.Substitutions {
+		rec := authedGet(e, token, "/api/v1/substitutions/"+sub.ID+"/candidates")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var candidates []struct {
+			TeacherID    string `json:"teacher_id"`
+			TeachesClass bool   `json:"teaches_class"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &candidates)
+		if len(candidates) == 0 {
+			busy++
+			continue
+		}
+		if len(candidates) != 1 || candidates[0].TeacherID != teacher || !candidates[0].TeachesClass {
+			t.Errorf("unexpected candidates: %s", rec.Body.String())
+		}
+		confirm = append(confirm, `{"substitution_id":"`+sub.ID+`","teacher_id":"`+teacher+`"}`)
+	}
+	if busy != 1 {
+		t.Errorf("expected one lesson without candidates, got %d", busy)
+	}
+
+	if rec := authedPost(e, token, "/api/v1/substitutions/confirm",
+		`[{"substitution_id":"`+absence.ID+`","teacher_id":"`+teacher+`"}]`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown substitution, got %d", rec.Code)
+	}
+	if rec := authedPost(e, token, "/api/v1/substitutions/confirm",
+		`[{"substitution_id":"`+absence.Substitutions[0].ID+`","teacher_id":"00000000-0000-0000-0000-000000000021"}]`); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for the absent teacher, got %d", rec.Code)
+	}
+	rec = authedPost(e, token, "/api/v1/substitutions/confirm", "["+strings.Join(confirm, ",")+"]")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var pending []map[string]interface{}
+	json.Unmarshal(authedGet(e, token, "/api/v1/substitutions?date=2031-03-10&pending=true").Body.Bytes(), &pending)
+	if len(pending) != 1 {
+		t.Errorf("expected 1 open substitution, got %d", len(pending))
+	}
+
+	if rec := authedDelete(e, token, absences+"/"+absence.ID); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	json.Unmarshal(authedGet(e, token, "/api/v1/substitutions?date=2031-03-10").Body.Bytes(), &pending)
+	if len(pending) != 0 {
+		t.Errorf("expected the absence's substitutions to be removed, got %d", len(pending))
+	}
+}
+
+func TestTeacherAbsence_RestoresSubstitutions(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+	const monday = "2031-03-31"
+
+	var entries []struct {
+		ID         string `json:"id"`
+		TimeSlotID string `json:"time_slot_id"`
+		DayOfWeek  int    `json:"day_of_week"`
+	}
+	json.Unmarshal(authedGet(e, token, "/api/v1/timetable?class_id=00000000-0000-0000-0000-000000000100").Body.Bytes(), &entries)
+	var entry string
+	for _, en := range entries {
+		if en.DayOfWeek == 1 && strings.HasSuffix(en.TimeSlotID, "400") {
+			entry = en.ID
+		}
+	}
+	if entry == "" {
+		t.Fatalf("seed lesson not found: %+v", entries)
+	}
+
+	// The first period moves to B204, then MUS falls ill.
+	rec := authedPost(e, token, "/api/v1/substitutions", `{"timetable_entry_id":"`+entry+`","date":"`+monday+`",
+		"type":"room_change","substitute_room_id":"00000000-0000-0000-0000-000000000301"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var roomChange map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &roomChange)
+	defer authedDelete(e, token, "/api/v1/substitutions/"+roomChange["id"].(string))
+
+	absences := "/api/v1/teachers/00000000-0000-0000-0000-000000000021/absences"
+	rec = authedPost(e, token, absences, `{"date_from":"`+monday+`","date_to":"`+monday+`"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var absence map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &absence)
+	if rec := authedDelete(e, token, absences+"/"+absence["id"].(string)); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+
+	// The room change is back as it was.
+	var list []map[string]interface{}
+	json.Unmarshal(authedGet(e, token, "/api/v1/substitutions?date="+monday).Body.Bytes(), &list)
+	if len(list) != 1 || list[0]["id"] != roomChange["id"] || list[0]["type"] != "room_change" ||
+		list[0]["teacher_absence_id"] != nil || list[0]["substitute_room_id"] != roomChange["substitute_room_id"] {
+		t.Errorf("expected the room change to be restored, got %+v", list)
+	}
+}
+
+func TestSubstitutionPlan_Display(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+	const monday = "2031-03-17"
+
+	var entries []struct {
+		ID         string `json:"id"`
+		TimeSlotID string `json:"time_slot_id"`
+		DayOfWeek  int    `json:"day_of_week"`
+	}
+	json.Unmarshal(authedGet(e, token, "/api/v1/timetable?class_id=00000000-0000-0000-0000-000000000100").Body.Bytes(), &entries)
+	lesson := map[string]string{}
+	for _, entry := range entries {
+		if entry.DayOfWeek == 1 {
+			lesson[entry.TimeSlotID[len(entry.TimeSlotID)-3:]] = entry.ID
+		}
+	}
+	if lesson["400"] == "" || lesson["402"] == "" {
+		t.Fatalf("seed lessons not found: %+v", entries)
+	}
+	for _, body := range []string{
+		`{"timetable_entry_id":"` + lesson["402"] + `","date":"` + monday + `","type":"room_change",
+			"substitute_room_id":"00000000-0000-0000-0000-000000000300","note":"Projektor"}`,
+		`{"timetable_entry_id":"` + lesson["400"] + `","date":"` + monday + `","type":"cancellation"}`,
+	} {
+		rec := authedPost(e, token, "/api/v1/substitutions", body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var sub map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &sub)
+		defer authedDelete(e, token, "/api/v1/substitutions/"+sub["id"].(string))
+	}
+
+	// Any user may read the plan: one class, in lesson order, with names.
+	student := login(t, e, "schueler", "student123")
+	rec := authedGet(e, student, "/api/v1/substitutions/plan?from="+monday+"&to="+monday)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var plan []struct {
+		Date    string `json:"date"`
+		Classes []struct {
+			Class   string `json:"class"`
+			Entries []struct {
+				Type            string  `json:"type"`
+				Teacher         *string `json:"teacher"`
+				OriginalTeacher *string `json:"original_teacher"`
+				Room            *string `json:"room"`
+				OriginalRoom    *string `json:"original_room"`
+				Note            *string `json:"note"`
+			} `json:"entries"`
+		} `json:"classes"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &plan)
+	if len(plan) != 1 || len(plan[0].Classes) != 1 || plan[0].Classes[0].Class != "10a" || len(plan[0].Classes[0].Entries) != 2 {
+		t.Fatalf("unexpected plan: %s", rec.Body.String())
+	}
+	cancelled, moved := plan[0].Classes[0].Entries[0], plan[0].Classes[0].Entries[1]
+	if cancelled.Type != "cancellation" || cancelled.Teacher != nil || cancelled.OriginalTeacher == nil || *cancelled.OriginalTeacher != "MUS" {
+		t.Errorf("unexpected cancellation: %s", rec.Body.String())
+	}
+	if moved.Type != "room_change" || moved.Room == nil || *moved.Room != "A101" ||
+		moved.OriginalRoom == nil || *moved.OriginalRoom != "B204" || moved.Note == nil {
+		t.Errorf("unexpected room change: %s", rec.Body.String())
+	}
+	for _, q := range []string{"from=2031-03-17&to=2031-03-16", "from=2031-03-01&to=2031-05-01", "from=17.03.2031"} {
+		if rec := authedGet(e, student, "/api/v1/substitutions/plan?"+q); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", q, rec.Code)
+		}
+	}
+
+	// Displays are managed by admins and served without login.
+	if rec := authedPost(e, student, "/api/v1/substitutions/displays", `{"name":"Foyer"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a student, got %d", rec.Code)
+	}
+	if rec := authedPost(e, token, "/api/v1/substitutions/displays", `{"name":"Foyer","days_ahead":20}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for days_ahead=20, got %d", rec.Code)
+	}
+	rec = authedPost(e, token, "/api/v1/substitutions/displays", `{"name":"Foyer","days_ahead":2}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var feed map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &feed)
+	defer authedDelete(e, token, "/api/v1/substitutions/displays/"+feed["id"].(string))
+	path := strings.TrimSuffix(feed["path"].(string), ".html")
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	rec = get(path + ".json")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var shown struct {
+		School string            `json:"school"`
+		Days   []json.RawMessage `json:"days"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &shown)
+	if shown.School == "" || len(shown.Days) == 0 {
+		t.Errorf("unexpected display: %s", rec.Body.String())
+	}
+	for _, field := range []string{`"note"`, `"original_teacher"`, `"substitution_id"`} {
+		if strings.Contains(rec.Body.String(), field) {
+			t.Errorf("display leaks %s: %s", field, rec.Body.String())
+		}
+	}
+	rec = get(path + ".html?lang=en")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") ||
+		!strings.Contains(rec.Body.String(), `http-equiv="refresh"`) {
+		t.Errorf("expected a refreshing HTML page, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var displays []map[string]interface{}
+	json.Unmarshal(authedGet(e, token, "/api/v1/substitutions/displays").Body.Bytes(), &displays)
+	if len(displays) != 1 || displays[0]["last_used_at"] == nil {
+		t.Errorf("expected one used display, got %+v", displays)
+	}
+	if rec := authedDelete(e, token, "/api/v1/substitutions/displays/"+feed["id"].(string)); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if rec := get(path + ".json"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after deleting, got %d", rec.Code)
+	}
+	if rec := get("/display/not-a-token.txt"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown file, got %d", rec.Code)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	e, cfg := testServer(t)
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	defer db.Close()
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	if rec := authedGet(e, "", "/api/v1/events"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", rec.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/events", nil)
+	req.Header.Set("Authorization", "Bearer "+login(t, e, "schueler", "student123"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	received := make(chan string, 16)
+	go func() {
+		defer close(received)
+		lines := bufio.NewScanner(resp.Body)
+		for lines.Scan() {
+			if typ, ok := strings.CutPrefix(lines.Text(), "event: "); ok {
+				received <- typ
+			}
+		}
+	}()
+
+	// The teacher records attendance for the student. The listener may still
+	// be connecting, so record until the event arrives.
+	const student, monday = "00000000-0000-0000-0000-000000000031", "2031-03-24"
+	defer db.Exec(context.Background(), `DELETE FROM attendance WHERE student_id = $1 AND date = $2`, student, monday)
+	var entries []struct {
+		ID         string `json:"id"`
+		TimeSlotID string `json:"time_slot_id"`
+		DayOfWeek  int    `json:"day_of_week"`
+	}
+	teacher := login(t, e, "lehrer", "teacher123")
+	json.Unmarshal(authedGet(e, teacher, "/api/v1/timetable?class_id=00000000-0000-0000-0000-000000000100").Body.Bytes(), &entries)
+	var entry string
+	for _, en := range entries {
+		if en.DayOfWeek == 1 && strings.HasSuffix(en.TimeSlotID, "400") {
+			entry = en.ID
+		}
+	}
+	if entry == "" {
+		t.Fatalf("seed lesson not found: %+v", entries)
+	}
+	body := `{"student_id":"` + student + `","timetable_entry_id":"` + entry + `","date":"` + monday + `","status":"late"}`
+	tick := time.NewTicker(250 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		if rec := authedPost(e, teacher, "/api/v1/attendance", body); rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		select {
+		case typ, ok := <-received:
+			if !ok {
+				t.Fatal("stream closed before the event")
+			}
+			if typ != events.AttendanceRecorded {
+				t.Fatalf("expected %s, got %s", events.AttendanceRecorded, typ)
+			}
+			return
+		case <-tick.C:
+		case <-ctx.Done():
+			t.Fatal("no event received")
+		}
+	}
+}
+
+// ── Lessons & Appointments ──────────────────────────────────
+
+func TestListLessons(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+
+	rec := authedGet(e, token, "/api/v1/lessons")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestListAppointments(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+
+	rec := authedGet(e, token, "/api/v1/appointments")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+// ── Role-Based Access ───────────────────────────────────────
+
+func TestStudentCantAccessAttendance(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "schueler", "student123")
+
+	// Students should still be able to GET their own data via general endpoints
+	rec := authedGet(e, token, "/api/v1/timetable")
+	if rec.Code != http.StatusOK {
+		t.Errorf("student should access timetable, got %d", rec.Code)
+	}
+}
+
+func TestTeacherCanRecordAttendance(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "lehrer", "teacher123")
+
+	rec := authedGet(e, token, "/api/v1/timetable")
+	if rec.Code != http.StatusOK {
+		t.Errorf("teacher should access timetable, got %d", rec.Code)
+	}
+
+	rec = authedGet(e, token, "/api/v1/excuses")
+	if rec.Code != http.StatusOK {
+		t.Errorf("teacher should list excuses, got %d", rec.Code)
+	}
+}
+
+// ── CSV Student Import ──────────────────────────────────────
+
+func TestImportStudentsCSV(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+
+	// Use unique suffix to avoid conflicts across test runs
+	suffix := fmt.Sprintf("%d", os.Getpid())
+
+	// Build multipart form with CSV
+	csvContent := "username;password;first_name;last_name;email;class_name;date_of_birth\n" +
+		"import_test1_" + suffix + ";pass123;Max;Mustermann;max@test.de;10a;2008-05-15\n" +
+		"import_test2_" + suffix + ";pass123;Erika;Muster;;10a;2008-03-22\n" +
+		"import_test3_" + suffix + ";pass123;Bad;Date;;10a;not-a-date\n"
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", "students.csv")
+	io.WriteString(part, csvContent)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/students/import", &buf)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+
+	imported := int(result["imported"].(float64))
+	if imported != 2 {
+		t.Errorf("expected 2 imported, got %d", imported)
+	}
+
+	errors := result["errors"].([]interface{})
+	if len(errors) != 1 {
+		t.Errorf("expected 1 error (bad date), got %d: %v", len(errors), errors)
+	}
+
+	// Verify students were actually created
+	rec = authedGet(e, token, "/api/v1/students")
+	var students []map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &students)
+
+	found := 0
+	for _, s := range students {
+		if s["username"] == "import_test1_"+suffix || s["username"] == "import_test2_"+suffix {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("expected to find 2 imported students, found %d", found)
+	}
+}
+
+func TestImportStudentsCSV_StudentCantAccess(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "schueler", "student123")
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", "students.csv")
+	io.WriteString(part, "username;password;first_name;last_name;date_of_birth\n")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/students/import", &buf)
+	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	rec := httptest.NewRecorder()
 	e.ServeHTTP(rec, req)
@@ -479,3 +2371,264 @@ func TestImportStudentsCSV_StudentCantAccess(t *testing.T) {
 		t.Errorf("expected 403 for student, got %d", rec.Code)
 	}
 }
+
+// ── CSV Excuse Import ───────────────────────────────────────
+
+func TestImportExcusesCSV_DryRunByUsernameAndName(t *testing.T) {
+	e, _ := testServer(t)
+	token := login(t, e, "admin", "admin123")
+
+	csvContent := "username;class_name;first_name;last_name;date_from;date_to;submission_type;reason\n" +
+		"schueler;;;;2030-02-04;2030-02-04;paper;Arzt\n" +
+		";10a;Lisa;Schmidt;2030-02-05;2030-02-05;;Krank\n" +
+		"nobody;;;;2030-02-06;2030-02-06;paper;\n" +
+		";10a;Lisa;Schmidt;2030-02-07;2030-02-03;paper;\n"
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", "excuses.csv")
+	io.WriteString(part, csvContent)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/excuses/import?dry_run=true", &buf)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if result["dry_run"] != true {
+		t.Error("expected dry_run to be echoed")
+	}
+	if int(result["imported"].(float64)) != 2 {
+		t.Errorf("expected 2 valid rows, got %v", result["imported"])
+	}
+	issues := result["issues"].([]interface{})
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues, got %v", issues)
+	}
+	if row := int(issues[0].(map[string]interface{})["row"].(float64)); row != 4 {
+		t.Errorf("expected first issue on row 4, got %d", row)
+	}
+
+	// Nothing was committed.
+	rec = authedGet(e, token, "/api/v1/excuses?student_id=00000000-0000-0000-0000-000000000031")
+	if strings.Contains(rec.Body.String(), "2030-02-04") {
+		t.Error("dry run must not create excuses")
+	}
+}
+
+// ── Notifications ───────────────────────────────────────────
+
+func TestNotifications(t *testing.T) {
+	e, cfg := testServer(t)
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	defer db.Close()
+
+	const studentUser = "00000000-0000-0000-0000-000000000030"
+	cleanup := func() {
+		db.Exec(context.Background(), `DELETE FROM notifications WHERE user_id = $1`, studentUser)
+		db.Exec(context.Background(), `DELETE FROM notification_preferences WHERE user_id = $1`, studentUser)
+	}
+	cleanup()
+	defer cleanup()
+
+	// The teacher rejects the student's excuse.
+	student := login(t, e, "schueler", "student123")
+	teacher := login(t, e, "lehrer", "teacher123")
+	rec := authedPost(e, student, "/api/v1/excuses", `{"date_from":"2030-03-04","date_to":"2030-03-05","submission_type":"digital"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var excuse map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &excuse)
+	rec = authedPatch(e, teacher, "/api/v1/excuses/"+excuse["id"].(string)+"/reject", `{"reason":"no signature"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var list []models.Notification
+	rec = authedGet(e, student, "/api/v1/notifications?lang=en")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Type != "excuse_rejected" || list[0].Category != models.NotifyExcuse {
+		t.Fatalf("expected one excuse_rejected notification, got %+v", list)
+	}
+	if list[0].Title != "Excuse rejected" || !strings.Contains(list[0].Body, "Lisa Schmidt") {
+		t.Errorf("unexpected text: %q / %q", list[0].Title, list[0].Body)
+	}
+	json.Unmarshal(authedGet(e, student, "/api/v1/notifications?lang=de").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Title != "Entschuldigung abgelehnt" || !strings.Contains(list[0].Body, "04.03.2030") {
+		t.Errorf("unexpected german text: %+v", list)
+	}
+	var emailPending bool
+	db.QueryRow(context.Background(), `SELECT email_pending FROM notifications WHERE id = $1`, list[0].ID).Scan(&emailPending)
+	if emailPending {
+		t.Error("excuse decisions are not e-mailed by default")
+	}
+
+	var count map[string]int
+	json.Unmarshal(authedGet(e, student, "/api/v1/notifications/unread-count").Body.Bytes(), &count)
+	if count["unread"] != 1 {
+		t.Errorf("expected 1 unread, got %v", count)
+	}
+
+	// Only the recipient can mark it read.
+	path := "/api/v1/notifications/" + list[0].ID.String() + "/read"
+	if rec := authedPatch(e, teacher, path, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user, got %d", rec.Code)
+	}
+	if rec := authedPatch(e, student, path, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	json.Unmarshal(authedGet(e, student, "/api/v1/notifications/unread-count").Body.Bytes(), &count)
+	if count["unread"] != 0 {
+		t.Errorf("expected 0 unread, got %v", count)
+	}
+	json.Unmarshal(authedGet(e, student, "/api/v1/notifications?unread=true").Body.Bytes(), &list)
+	if len(list) != 0 {
+		t.Errorf("expected no unread notifications, got %d", len(list))
+	}
+	if rec := authedGet(e, student, "/api/v1/notifications?limit=0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for limit=0, got %d", rec.Code)
+	}
+
+	// Preferences default to e-mail for reminders only.
+	var prefs []models.NotificationPreference
+	json.Unmarshal(authedGet(e, student, "/api/v1/notifications/preferences").Body.Bytes(), &prefs)
+	if len(prefs) != 4 {
+		t.Fatalf("expected 4 categories, got %+v", prefs)
+	}
+	for _, p := range prefs {
+		if p.Email != (p.Category == models.NotifyExcuseReminder) || !p.Push {
+			t.Errorf("unexpected default %+v", p)
+		}
+	}
+	rec = authedPut(e, student, "/api/v1/notifications/preferences", `[{"category":"excuse","email":true,"push":false}]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	json.Unmarshal(rec.Body.Bytes(), &prefs)
+	for _, p := range prefs {
+		if p.Category == models.NotifyExcuse && (!p.Email || p.Push) {
+			t.Errorf("preference not saved: %+v", p)
+		}
+	}
+	rec = authedPut(e, student, "/api/v1/notifications/preferences", `[{"category":"homework","email":true}]`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown category, got %d", rec.Code)
+	}
+}
+
+type failingNotifier struct{}
+
+func (failingNotifier) Send(context.Context, notify.Message) error {
+	return fmt.Errorf("smtp: connection refused")
+}
+
+func TestNotificationMailer_BacksOffAndGivesUp(t *testing.T) {
+	_, cfg := testServer(t)
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	const school, teacherUser, noMail = "00000000-0000-0000-0000-000000000001",
+		"00000000-0000-0000-0000-000000000020", "00000000-0000-0000-0000-0000000000a2"
+	if _, err := db.Exec(ctx,
+		`INSERT INTO users (id, school_id, username, password_hash, role, first_name, last_name)
+		 VALUES ($1, $2, 'ohnemail', 'x', 'teacher', 'Ohne', 'Mail')`, noMail, school); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(ctx, `DELETE FROM users WHERE id = $1`, noMail)
+	defer db.Exec(ctx, `DELETE FROM notifications WHERE user_id = $1 AND type = 'test_mail'`, teacherUser)
+
+	var failing, orphaned string
+	insert := `INSERT INTO notifications (school_id, user_id, category, type, email_pending)
+	           VALUES ($1, $2, 'substitution', 'test_mail', true) RETURNING id`
+	if err := db.QueryRow(ctx, insert, school, teacherUser).Scan(&failing); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(ctx, insert, school, noMail).Scan(&orphaned); err != nil {
+		t.Fatal(err)
+	}
+
+	mailer := jobs.NewNotificationMailer(db, failingNotifier{})
+	if err := mailer.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var pending, due bool
+	var attempts int
+	db.QueryRow(ctx, `SELECT email_pending, email_attempts, email_retry_at <= now() FROM notifications WHERE id = $1`,
+		failing).Scan(&pending, &attempts, &due)
+	if !pending || attempts != 1 || due {
+		t.Errorf("expected a delayed retry, got pending=%v attempts=%d due=%v", pending, attempts, due)
+	}
+	db.QueryRow(ctx, `SELECT email_pending FROM notifications WHERE id = $1`, orphaned).Scan(&pending)
+	if pending {
+		t.Error("expected the e-mail of a user without address to be dropped")
+	}
+
+	// The last attempt fails too.
+	db.Exec(ctx, `UPDATE notifications SET email_attempts = 4, email_retry_at = NULL WHERE id = $1`, failing)
+	if err := mailer.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	db.QueryRow(ctx, `SELECT email_pending FROM notifications WHERE id = $1`, failing).Scan(&pending)
+	if pending {
+		t.Error("expected the e-mail to be given up after 5 attempts")
+	}
+}
+
+func TestSubstitutionNotices_NotifyOnce(t *testing.T) {
+	_, cfg := testServer(t)
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	const studentUser = "00000000-0000-0000-0000-000000000030"
+	var sub string
+	if err := db.QueryRow(ctx,
+		`INSERT INTO substitutions (school_id, timetable_entry_id, date, type, created_by)
+		 SELECT t.school_id, t.id, (now() AT TIME ZONE sc.timezone)::date, 'cancellation', '00000000-0000-0000-0000-000000000010'
+		 FROM timetable_entries t JOIN schools sc ON sc.id = t.school_id
+		 WHERE t.class_id = '00000000-0000-0000-0000-000000000100'
+		   AND t.time_slot_id = '00000000-0000-0000-0000-000000000400' AND t.day_of_week = 1 AND t.week_type = 'all'
+		 RETURNING id`).Scan(&sub); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(ctx, `DELETE FROM substitutions WHERE id = $1`, sub)
+	defer db.Exec(ctx, `DELETE FROM notifications WHERE user_id = $1 AND type = 'substitution'`, studentUser)
+
+	job := jobs.NewSubstitutionNotices(db)
+	for i := 0; i < 2; i++ {
+		if err := job.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var n int
+	db.QueryRow(ctx, `SELECT count(*) FROM notifications WHERE user_id = $1 AND type = 'substitution'`, studentUser).Scan(&n)
+	if n != 1 {
+		t.Errorf("expected the student to be notified once, got %d notifications", n)
+	}
+	var notified bool
+	db.QueryRow(ctx, `SELECT notified_at IS NOT NULL FROM substitutions WHERE id = $1`, sub).Scan(&notified)
+	if !notified {
+		t.Error("expected the substitution to be marked notified")
+	}
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Monstroxx/eduko-backend/internal/i18n"
+	"github.com/Monstroxx/eduko-backend/internal/models"
+	"github.com/Monstroxx/eduko-backend/internal/pdf"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+func TestI18n_Fallbacks(t *testing.T) {
+	if got := i18n.For("en-GB").T("excuses.approved"); got != "Approved" {
+		t.Errorf("expected English translation, got %q", got)
+	}
+	if got := i18n.For("fr", "").T("excuses.approved"); got != "Entschuldigt" {
+		t.Errorf("expected fallback to German, got %q", got)
+	}
+	if got := i18n.For("en").T("does.not.exist"); got != "does.not.exist" {
+		t.Errorf("expected key for missing translation, got %q", got)
+	}
+}
+
+func TestRenderExcusePDF(t *testing.T) {
+	reason := "Magen-Darm-Grippe\nArzt war informiert"
+	day := time.Date(2030, 3, 4, 0, 0, 0, 0, time.UTC)
+	doc := &services.ExcuseDocument{
+		Excuse: &models.Excuse{
+			DateFrom:       day,
+			DateTo:         day.AddDate(0, 0, 1),
+			Status:         models.ExcuseApproved,
+			SubmissionType: models.SubmissionPaper,
+			Reason:         &reason,
+			SubmittedAt:    day.AddDate(0, 0, 2),
+		},
+		SchoolName:    "Gymnasium Süd",
+		SchoolAddress: "Schulstraße 1\n12345 Musterstadt",
+		StudentName:   "Jürgen Müller",
+		ClassName:     "10a",
+		ClassTeacher:  "Max Mustermann",
+	}
+	for i := 1; i <= 60; i++ {
+		doc.Lessons = append(doc.Lessons, services.ExcuseLesson{
+			Date: day, SlotNumber: i, StartTime: "08:00", EndTime: "08:45",
+			Subject: "Erdkunde", Teacher: "MUS", Status: "excused_leave",
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.RenderExcuse(&buf, doc, i18n.For("de")); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "%PDF") {
+		t.Fatal("expected PDF content")
+	}
+	if !strings.Contains(out, "/FontFile2") {
+		t.Error("expected an embedded TrueType font")
+	}
+	if n := strings.Count(out, "/Type /Page\n"); n < 2 {
+		t.Errorf("expected the lesson table to span pages, got %d page(s)", n)
+	}
+
+	// startxref must point at the xref table.
+	m := regexp.MustCompile(`startxref\s+(\d+)`).FindStringSubmatch(out)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	offset, _ := strconv.Atoi(m[1])
+	if offset == 0 || !strings.HasPrefix(out[offset:], "xref") {
+		t.Errorf("startxref %d does not point at the xref table", offset)
+	}
+}
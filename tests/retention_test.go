@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+func TestRetentionCutoff(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	cases := []struct {
+		today string
+		years int
+		want  string
+	}{
+		// The school year 2024/25 ended on 2025-07-31; kept for one more year.
+		{"2026-10-18", 1, "2025-07-31"},
+		{"2026-07-31", 1, "2025-07-31"},
+		{"2026-07-30", 1, "2024-07-31"},
+		{"2026-10-18", 0, "2026-07-31"},
+		{"2026-01-15", 2, "2023-07-31"},
+	}
+	for _, tc := range cases {
+		got := services.RetentionCutoff(day(tc.today), time.July, 31, tc.years)
+		if got.Format("2006-01-02") != tc.want {
+			t.Errorf("today %s, %d year(s): expected %s, got %s", tc.today, tc.years, tc.want, got.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestValidateRetentionSettings(t *testing.T) {
+	valid := map[string]interface{}{
+		"excuses":    map[string]interface{}{"years": 1, "action": "delete"},
+		"attendance": map[string]interface{}{"years": 2, "action": "anonymize"},
+	}
+	if err := services.ValidateSetting("retention", valid); err != nil {
+		t.Errorf("expected valid policy, got %v", err)
+	}
+	for name, value := range map[string]interface{}{
+		"unknown entity": map[string]interface{}{"grades": map[string]interface{}{"years": 1, "action": "delete"}},
+		"bad action":     map[string]interface{}{"attachments": map[string]interface{}{"years": 1, "action": "anonymize"}},
+		"negative years": map[string]interface{}{"excuses": map[string]interface{}{"years": -1, "action": "delete"}},
+		"not an object":  "1y",
+	} {
+		if err := services.ValidateSetting("retention", value); !errors.Is(err, services.ErrInvalidRetentionPolicy) {
+			t.Errorf("%s: expected ErrInvalidRetentionPolicy, got %v", name, err)
+		}
+	}
+	if err := services.ValidateSetting("school_year_end", "07-31"); err != nil {
+		t.Errorf("expected valid school_year_end, got %v", err)
+	}
+	if err := services.ValidateSetting("school_year_end", "31.07."); err == nil {
+		t.Error("expected error for malformed school_year_end")
+	}
+}
@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Monstroxx/eduko-backend/internal/signing"
+)
+
+func TestSigning(t *testing.T) {
+	signer := signing.New("secret", "attachment")
+	now := time.Unix(1_900_000_000, 0)
+	expires := now.Add(5 * time.Minute)
+	sig := signer.Sign("subject", expires)
+	exp := fmt.Sprint(expires.Unix())
+
+	if err := signer.Verify("subject", exp, sig, now); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+	if err := signer.Verify("other", exp, sig, now); !errors.Is(err, signing.ErrInvalid) {
+		t.Errorf("expected ErrInvalid for other subject, got %v", err)
+	}
+	if err := signer.Verify("subject", fmt.Sprint(expires.Unix()+60), sig, now); !errors.Is(err, signing.ErrInvalid) {
+		t.Errorf("expected ErrInvalid for extended expiry, got %v", err)
+	}
+	if err := signer.Verify("subject", exp, sig, expires.Add(time.Second)); !errors.Is(err, signing.ErrExpired) {
+		t.Errorf("expected ErrExpired, got %v", err)
+	}
+	if err := signing.New("secret", "other").Verify("subject", exp, sig, now); !errors.Is(err, signing.ErrInvalid) {
+		t.Errorf("expected signatures to be bound to their purpose, got %v", err)
+	}
+}
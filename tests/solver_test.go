@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Monstroxx/eduko-backend/internal/solver"
+)
+
+func TestSolver_HardConstraints(t *testing.T) {
+	p := solver.Problem{
+		Days:      []int{1, 2, 3, 4, 5},
+		Periods:   []int{1, 2, 3, 4, 5, 6},
+		MaxPerDay: 5,
+		Requirements: []solver.Requirement{
+			{ID: "10a-MA", Class: "10a", Subject: "MA", Teacher: "MUE", Periods: 5, Doubles: 1},
+			{ID: "10a-DE", Class: "10a", Subject: "DE", Teacher: "SCH", Periods: 4},
+			{ID: "10a-CH", Class: "10a", Subject: "CH", Teacher: "MUE", Periods: 2, Doubles: 1, Rooms: []string{"Labor"}},
+			{ID: "10b-MA", Class: "10b", Subject: "MA", Teacher: "MUE", Periods: 5},
+			{ID: "10b-DE", Class: "10b", Subject: "DE", Teacher: "SCH", Periods: 4},
+			{ID: "10b-CH", Class: "10b", Subject: "CH", Teacher: "BEC", Periods: 2, Rooms: []string{"Labor"}},
+		},
+		// MUE doesn't work on Fridays, SCH not in the first period on Mondays.
+		Unavailable: map[string][]solver.Slot{
+			"MUE": {{Day: 5}},
+			"SCH": {{Day: 1, Period: 1}},
+		},
+		// The lab is booked by another class on Tuesday morning.
+		Busy: []solver.Booking{{Slot: solver.Slot{Day: 2, Period: 1}, Length: 3, Room: "Labor"}},
+	}
+	res, err := solver.Solve(context.Background(), p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Unplaced) != 0 {
+		t.Fatalf("unplaced lessons: %+v", res.Unplaced)
+	}
+
+	reqs := map[string]solver.Requirement{}
+	for _, r := range p.Requirements {
+		reqs[r.ID] = r
+	}
+	type cell struct {
+		who    string
+		day    int
+		period int
+	}
+	taken := map[cell]string{}
+	periods := map[string]int{}
+	perDay := map[cell]int{}
+	doubles := 0
+	for _, l := range res.Lessons {
+		r := reqs[l.Requirement]
+		periods[r.ID] += l.Length
+		if l.Length == 2 {
+			doubles++
+		}
+		if (len(r.Rooms) > 0) != (l.Room == "Labor") {
+			t.Errorf("%s: unexpected room %q", r.ID, l.Room)
+		}
+		perDay[cell{r.Class, l.Day, 0}] += l.Length
+		for k := 0; k < l.Length; k++ {
+			for _, who := range []string{r.Class, r.Teacher, l.Room} {
+				c := cell{who, l.Day, l.Period + k}
+				if who == "" {
+					continue
+				}
+				if other, ok := taken[c]; ok {
+					t.Errorf("%s double-booked on day %d period %d: %s and %s", who, c.day, c.period, other, r.ID)
+				}
+				taken[c] = r.ID
+			}
+			if r.Teacher == "MUE" && l.Day == 5 || r.Teacher == "SCH" && l.Day == 1 && l.Period+k == 1 {
+				t.Errorf("%s scheduled while %s is unavailable: %+v", r.ID, r.Teacher, l)
+			}
+			if l.Room == "Labor" && l.Day == 2 && l.Period+k <= 3 {
+				t.Errorf("%s in the booked lab: %+v", r.ID, l)
+			}
+		}
+	}
+	for _, r := range p.Requirements {
+		if periods[r.ID] != r.Periods {
+			t.Errorf("%s: expected %d periods, got %d", r.ID, r.Periods, periods[r.ID])
+		}
+	}
+	if doubles != 2 {
+		t.Errorf("expected 2 double periods, got %d", doubles)
+	}
+	for c, n := range perDay {
+		if n > p.MaxPerDay {
+			t.Errorf("%s has %d periods on day %d", c.who, n, c.day)
+		}
+	}
+	if res.Gaps != 0 {
+		t.Errorf("expected no gaps, got %d", res.Gaps)
+	}
+}
+
+func TestSolver_Infeasible(t *testing.T) {
+	// One teacher, two classes, but only three periods in the week.
+	p := solver.Problem{
+		Days:    []int{1},
+		Periods: []int{1, 2, 3},
+		Requirements: []solver.Requirement{
+			{ID: "a", Class: "5a", Subject: "MA", Teacher: "X", Periods: 2},
+			{ID: "b", Class: "5b", Subject: "MA", Teacher: "X", Periods: 2},
+		},
+	}
+	res, err := solver.Solve(context.Background(), p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Lessons) != 3 || len(res.Unplaced) != 1 || res.Unplaced[0].Periods != 1 {
+		t.Errorf("expected one unplaced period, got %+v", res)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := solver.Solve(ctx, p, nil); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Monstroxx/eduko-backend/internal/storage"
+)
+
+func testStore(t *testing.T, store storage.Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	blob, err := storage.PutContent(ctx, store, strings.NewReader("hello eduko"), 1<<20, "text/plain")
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if blob.Key != storage.Key(blob.SHA256) || blob.Size != 11 {
+		t.Errorf("unexpected blob %+v", blob)
+	}
+
+	again, err := storage.PutContent(ctx, store, strings.NewReader("hello eduko"), 1<<20, "text/plain")
+	if err != nil || again.Key != blob.Key {
+		t.Errorf("expected identical content to share a key, got %v / %v", again, err)
+	}
+
+	r, err := store.Get(ctx, blob.Key)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "hello eduko" {
+		t.Errorf("unexpected content %q", data)
+	}
+
+	if err := store.Delete(ctx, blob.Key); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if ok, _ := store.Exists(ctx, blob.Key); ok {
+		t.Error("expected blob to be gone")
+	}
+	if _, err := store.Get(ctx, blob.Key); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := storage.PutContent(ctx, store, strings.NewReader("too large"), 4, "text/plain"); !errors.Is(err, storage.ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	store := storage.NewLocal(t.TempDir())
+	testStore(t, store)
+
+	if err := store.Put(context.Background(), "../escape", strings.NewReader("x"), 1, ""); err == nil {
+		t.Error("expected keys outside the upload dir to be rejected")
+	}
+}
+
+// TestS3Store runs against an S3-compatible server, e.g. a local MinIO:
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	S3_TEST_ENDPOINT=localhost:9000 S3_TEST_BUCKET=eduko-test go test ./tests -run S3
+func TestS3Store(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+	store, err := storage.NewS3(storage.S3Options{
+		Endpoint:  endpoint,
+		Bucket:    os.Getenv("S3_TEST_BUCKET"),
+		AccessKey: envOr("S3_TEST_ACCESS_KEY", "minioadmin"),
+		SecretKey: envOr("S3_TEST_SECRET_KEY", "minioadmin"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Monstroxx/eduko-backend/internal/models"
+	"github.com/Monstroxx/eduko-backend/internal/services"
+)
+
+func TestWeekType(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	if got := services.WeekStart(day("2026-10-18")); !got.Equal(day("2026-10-12")) {
+		t.Errorf("week of Sunday 2026-10-18 starts %s", got.Format("2006-01-02"))
+	}
+
+	// Without a reference odd ISO weeks are A weeks (2026-10-12 is week 42).
+	if got := services.WeekTypeFor(day("2026-10-12"), nil); got != models.WeekB {
+		t.Errorf("expected B for ISO week 42, got %s", got)
+	}
+	if got := services.WeekTypeFor(day("2026-10-21"), nil); got != models.WeekA {
+		t.Errorf("expected A for ISO week 43, got %s", got)
+	}
+
+	ref := day("2025-09-03") // Wednesday of an A week
+	cases := map[string]models.WeekType{
+		"2025-09-01": models.WeekA,
+		"2025-09-07": models.WeekA,
+		"2025-09-08": models.WeekB,
+		"2025-09-15": models.WeekA,
+		"2025-08-25": models.WeekB,
+		"2026-01-12": models.WeekB, // 19 weeks later, across the year boundary
+	}
+	for d, want := range cases {
+		if got := services.WeekTypeFor(day(d), &ref); got != want {
+			t.Errorf("%s: expected %s, got %s", d, want, got)
+		}
+	}
+
+	if err := services.ValidateSetting("ab_week_reference", "2025-09-01"); err != nil {
+		t.Errorf("valid reference rejected: %v", err)
+	}
+	if err := services.ValidateSetting("ab_week_reference", "next monday"); err == nil {
+		t.Error("expected error for invalid reference")
+	}
+}
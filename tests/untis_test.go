@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Monstroxx/eduko-backend/internal/untis"
+)
+
+func TestUntis_ReadExports(t *testing.T) {
+	var d untis.Data
+
+	// Windows-1252, as Untis writes by default: 0xFC is "ü".
+	teachers := "\"M\xfcL\",\"M\xfcller\",\"\"\r\n\"\",\"Ohne\"\r\n"
+	if err := d.ReadTeachers(strings.NewReader(teachers)); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Teachers) != 1 || d.Teachers[0].Abbreviation != "MüL" || d.Teachers[0].LastName != "Müller" {
+		t.Errorf("unexpected teachers: %+v", d.Teachers)
+	}
+
+	if err := d.ReadSubjects(strings.NewReader("\"M\";\"Mathematik\"\n\"PH\";\"\"\n")); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Subjects) != 2 || d.Subjects[0].Name != "Mathematik" || d.Subjects[1].Name != "PH" {
+		t.Errorf("unexpected subjects: %+v", d.Subjects)
+	}
+
+	grid := "Stunde,Beginn,Ende\n1,0800,0845\n2,8:50,9:35,Zweite\n3,10:00,09:00\n"
+	if err := d.ReadTimeGrid(strings.NewReader(grid)); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Periods) != 2 || d.Periods[0].Start != "08:00" || d.Periods[1].End != "09:35" || d.Periods[1].Label != "Zweite" {
+		t.Errorf("unexpected periods: %+v", d.Periods)
+	}
+
+	timetable := strings.Join([]string{
+		`1,"10a","MüL","M","R101",1,1,`,
+		`1,"10a","MüL","M","R101",1,2,`,
+		`1,"10a","MüL","M","R101",1,4,`,
+		`2,"","MüL","AUF","",2,1,`,
+		`3,"10a","MüL","M","R101",8,1,`,
+	}, "\n")
+	if err := d.ReadTimetable(strings.NewReader(timetable)); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Lessons) != 3 {
+		t.Fatalf("expected 3 lessons, got %+v", d.Lessons)
+	}
+
+	// Teacher without abbreviation, bad period 3, no class, day 8.
+	if len(d.Issues) != 4 {
+		t.Errorf("expected 4 issues, got %+v", d.Issues)
+	}
+	for _, issue := range d.Issues {
+		if issue.File == untis.FileTimetable && issue.Line != 4 && issue.Line != 5 {
+			t.Errorf("wrong line for %+v", issue)
+		}
+	}
+
+	blocks := untis.Blocks(d.Lessons)
+	if len(blocks) != 2 || blocks[0].Period != 1 || blocks[0].Count != 2 || blocks[1].Period != 4 || blocks[1].Count != 1 {
+		t.Errorf("expected a double period and a single one, got %+v", blocks)
+	}
+}
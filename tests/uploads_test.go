@@ -0,0 +1,255 @@
+package tests
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Monstroxx/eduko-backend/internal/scanner"
+	"github.com/Monstroxx/eduko-backend/internal/uploads"
+)
+
+// exifSegment builds an APP1 segment with orientation and a GPS IFD pointer.
+func exifSegment(orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("II*\x00")
+	binary.Write(&tiff, binary.LittleEndian, uint32(8))
+	binary.Write(&tiff, binary.LittleEndian, uint16(2))
+	// Orientation (SHORT)
+	binary.Write(&tiff, binary.LittleEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.LittleEndian, uint32(1))
+	binary.Write(&tiff, binary.LittleEndian, []uint16{orientation, 0})
+	// GPSInfo (LONG), pointing at dummy data
+	binary.Write(&tiff, binary.LittleEndian, []uint16{0x8825, 4})
+	binary.Write(&tiff, binary.LittleEndian, []uint32{1, 38})
+	binary.Write(&tiff, binary.LittleEndian, uint32(0))
+	tiff.WriteString("GPS52.5200N13.4050E")
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+func TestSanitize_JPEGStripsExifAndAppliesOrientation(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		img.Set(x, 0, color.RGBA{255, 0, 0, 255})
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, nil)
+	raw := buf.Bytes()
+	withExif := append(append(append([]byte{}, raw[:2]...), exifSegment(6)...), raw[2:]...)
+
+	out, contentType, err := uploads.Sanitize(withExif)
+	if err != nil {
+		t.Fatalf("sanitize: %v", err)
+	}
+	if contentType != uploads.TypeJPEG {
+		t.Errorf("expected image/jpeg, got %s", contentType)
+	}
+	if bytes.Contains(out, []byte("Exif")) || bytes.Contains(out, []byte("GPS52")) {
+		t.Error("expected EXIF/GPS data to be removed")
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 20 || cfg.Height != 40 {
+		t.Errorf("expected rotated 20x40 image, got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestSanitize_PNGStripsTextChunks(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)))
+	raw := buf.Bytes()
+	// Insert a tEXt chunk after IHDR (8 byte signature + 25 byte IHDR).
+	chunk := []byte("tEXtGPS\x0052.5200N")
+	text := binary.BigEndian.AppendUint32(nil, uint32(len(chunk)-4))
+	text = append(text, chunk...)
+	text = binary.BigEndian.AppendUint32(text, crc32.ChecksumIEEE(chunk))
+	withText := append(append(append([]byte{}, raw[:33]...), text...), raw[33:]...)
+
+	out, contentType, err := uploads.Sanitize(withText)
+	if err != nil {
+		t.Fatalf("sanitize: %v", err)
+	}
+	if contentType != uploads.TypePNG || bytes.Contains(out, []byte("tEXt")) {
+		t.Errorf("expected clean PNG, got %s", contentType)
+	}
+}
+
+func deflate(s string) string {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	io.WriteString(w, s)
+	w.Close()
+	return buf.String()
+}
+
+func TestSanitize_PDF(t *testing.T) {
+	doc := func(body string) []byte {
+		return []byte("%PDF-1.7\n1 0 obj\n" + body + "\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	}
+	cases := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"plain", doc("<< /Type /Catalog /JSFoo 1 >>"), nil},
+		{"javascript", doc("<< /OpenAction << /S /JavaScript /JS (app.alert(1)) >> >>"), uploads.ErrActivePDF},
+		{"escaped name", doc("<< /OpenAction << /S /J#61vaScript >> >>"), uploads.ErrActivePDF},
+		{"launch", doc("<< /A << /S /Launch /F (cmd.exe) >> >>"), uploads.ErrActivePDF},
+		{"encrypted", doc("<< /Type /Catalog >>\ntrailer << /Encrypt 5 0 R >>"), uploads.ErrEncryptedPDF},
+		{"hidden in object stream", doc("<< /Type /ObjStm /Filter /FlateDecode >>\nstream\n" +
+			deflate("<< /S /JavaScript /JS (x) >>") + "\nendstream"), uploads.ErrActivePDF},
+		{"truncated", []byte("%PDF-1.7\n1 0 obj\n<< >>\n"), uploads.ErrCorrupt},
+	}
+	for _, tc := range cases {
+		_, _, err := uploads.Sanitize(tc.data)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestSanitize_RejectsOtherTypes(t *testing.T) {
+	for _, data := range []string{
+		"<html><script>alert(1)</script></html>",
+		"MZ\x90\x00\x03\x00\x00\x00",
+		"plain text",
+	} {
+		if _, _, err := uploads.Sanitize([]byte(data)); !errors.Is(err, uploads.ErrUnsupportedType) {
+			t.Errorf("%q: expected ErrUnsupportedType, got %v", data[:4], err)
+		}
+	}
+	if got := uploads.FileName("C:\\fakepath\\scan.exe", uploads.TypePNG); got != "scan.png" {
+		t.Errorf("expected scan.png, got %s", got)
+	}
+}
+
+func heicBox(typ string, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	out := make([]byte, 8, 8+len(b))
+	binary.BigEndian.PutUint32(out, uint32(8+len(b)))
+	copy(out[4:], typ)
+	return append(out, b...)
+}
+
+func TestSanitize_HEICBlanksExif(t *testing.T) {
+	exif := []byte("\x00\x00\x00\x06Exif\x00\x00GPS52.5200N13.4050E")
+	image := []byte("HEVC-PIXELDATA")
+
+	ftyp := heicBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	hdlr := heicBox("hdlr", []byte("\x00\x00\x00\x00\x00\x00\x00\x00pict\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"))
+	iinf := heicBox("iinf", []byte("\x00\x00\x00\x00\x00\x02"),
+		heicBox("infe", []byte("\x02\x00\x00\x00\x00\x01\x00\x00hvc1\x00")),
+		heicBox("infe", []byte("\x02\x00\x00\x00\x00\x02\x00\x00Exif\x00")))
+	ilocLen := 8 + 4 + 2 + 2 + 2*(2+2+2+4+4)
+	metaLen := 8 + 4 + len(hdlr) + len(iinf) + ilocLen
+	mdatStart := len(ftyp) + metaLen + 8
+	item := func(id, offset, length int) []byte {
+		b := make([]byte, 14)
+		binary.BigEndian.PutUint16(b, uint16(id))
+		binary.BigEndian.PutUint16(b[4:], 1) // extent count
+		binary.BigEndian.PutUint32(b[6:], uint32(offset))
+		binary.BigEndian.PutUint32(b[10:], uint32(length))
+		return b
+	}
+	iloc := heicBox("iloc", []byte("\x00\x00\x00\x00\x44\x00\x00\x02"),
+		item(1, mdatStart, len(image)), item(2, mdatStart+len(image), len(exif)))
+	meta := heicBox("meta", []byte{0, 0, 0, 0}, hdlr, iinf, iloc)
+	file := bytes.Join([][]byte{ftyp, meta, heicBox("mdat", image, exif)}, nil)
+	if len(meta) != metaLen {
+		t.Fatalf("test fixture: meta length %d != %d", len(meta), metaLen)
+	}
+
+	out, contentType, err := uploads.Sanitize(file)
+	if err != nil {
+		t.Fatalf("sanitize: %v", err)
+	}
+	if contentType != uploads.TypeHEIC {
+		t.Errorf("expected image/heic, got %s", contentType)
+	}
+	if len(out) != len(file) || !bytes.Contains(out, image) {
+		t.Error("expected image data and layout to be preserved")
+	}
+	if bytes.Contains(out, []byte("GPS52")) || !bytes.Contains(out, make([]byte, len(exif))) {
+		t.Error("expected Exif item to be blanked")
+	}
+}
+
+// fakeClamd answers INSTREAM requests like clamd, flagging the EICAR marker.
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "clamd.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				cmd := make([]byte, len("zINSTREAM\x00"))
+				io.ReadFull(conn, cmd)
+				var data []byte
+				for {
+					var size uint32
+					if binary.Read(conn, binary.BigEndian, &size) != nil || size == 0 {
+						break
+					}
+					chunk := make([]byte, size)
+					io.ReadFull(conn, chunk)
+					data = append(data, chunk...)
+				}
+				if strings.Contains(string(data), "EICAR") {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+				} else {
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			}(conn)
+		}
+	}()
+	return sock
+}
+
+func TestClamdScanner(t *testing.T) {
+	scan := scanner.NewClamd(fakeClamd(t))
+	ctx := context.Background()
+
+	res, err := scan.Scan(ctx, strings.NewReader("%PDF-1.4 harmless"))
+	if err != nil || res.Status != scanner.StatusClean {
+		t.Errorf("expected clean, got %+v / %v", res, err)
+	}
+	res, err = scan.Scan(ctx, strings.NewReader("X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*"))
+	if err != nil || res.Status != scanner.StatusInfected || res.Signature != "Eicar-Test-Signature" {
+		t.Errorf("expected infected, got %+v / %v", res, err)
+	}
+	if res.Status.Released() || !scanner.StatusSkipped.Released() {
+		t.Error("unexpected release rules")
+	}
+
+	down := scanner.NewClamd(filepath.Join(t.TempDir(), "missing.sock"))
+	if _, err := down.Scan(ctx, strings.NewReader("x")); err == nil {
+		t.Error("expected error when clamd is unreachable")
+	}
+}